@@ -9,12 +9,15 @@ import (
 
 	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/cleanup"
 	configurationEndpoint "github.com/oidc-mytoken/server/internal/endpoints/configuration"
 	"github.com/oidc-mytoken/server/internal/jws"
+	"github.com/oidc-mytoken/server/internal/notification"
 	"github.com/oidc-mytoken/server/internal/oidc/authcode"
 	"github.com/oidc-mytoken/server/internal/server"
 	"github.com/oidc-mytoken/server/internal/utils/geoip"
 	loggerUtils "github.com/oidc-mytoken/server/internal/utils/logger"
+	"github.com/oidc-mytoken/server/internal/webhook"
 	"github.com/oidc-mytoken/server/shared/httpClient"
 )
 
@@ -29,12 +32,15 @@ func main() {
 	jws.LoadKey()
 	httpClient.Init(config.Get().IssuerURL)
 	geoip.Init()
+	cleanup.StartCleanupJob()
+	notification.StartExpiryChecker()
+	webhook.StartDeliveryWorker()
 
 	server.Start()
 }
 
 func handleSignals() {
-	signals := make(chan os.Signal)
+	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGHUP, syscall.SIGUSR1)
 	go func() {
 		for {
@@ -18,17 +18,20 @@ import (
 	"github.com/oidc-mytoken/server/internal/db/dbdefinition"
 	"github.com/oidc-mytoken/server/internal/jws"
 	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/utils/geoip"
 	loggerUtils "github.com/oidc-mytoken/server/internal/utils/logger"
-	"github.com/oidc-mytoken/server/internal/utils/zipdownload"
+	"github.com/oidc-mytoken/server/shared/httpClient"
 	model2 "github.com/oidc-mytoken/server/shared/model"
 	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
+	"github.com/oidc-mytoken/server/shared/utils"
 	"github.com/oidc-mytoken/server/shared/utils/fileutil"
 )
 
 var genSigningKeyComm commandGenSigningKey
 var createDBComm commandCreateDB
+var migrateDBComm commandMigrateDB
 var installComm struct {
-	GeoIP commandInstallGeoIPDB `command:"geoip-db" description:"Installs the ip geolocation database."`
+	GeoIP commandInstallGeoIPDB `command:"geoip-db" description:"Installs the ip geolocation database. By default it is downloaded from the configured mirror; alternatively a local file can be given."`
 }
 
 func main() {
@@ -44,6 +47,10 @@ func main() {
 		log.WithError(err).Fatal()
 		os.Exit(1)
 	}
+	if _, err := parser.AddCommand("migrate", "Migrates the database", "Updates an existing database to the schema needed by this mytoken version.", &migrateDBComm); err != nil {
+		log.WithError(err).Fatal()
+		os.Exit(1)
+	}
 	if _, err := parser.AddCommand("install", "Installs needed dependencies", "", &installComm); err != nil {
 		log.WithError(err).Fatal()
 		os.Exit(1)
@@ -67,21 +74,58 @@ type commandCreateDB struct {
 	Username string  `short:"u" long:"user" default:"root" description:"This username is used to connect to the database to create a new database, database user, and tables."`
 	Password *string `short:"p" optional:"true" optional-value:"" long:"password" description:"The password for the database user"`
 }
-type commandInstallGeoIPDB struct{}
+type commandMigrateDB struct {
+	Username string  `short:"u" long:"user" default:"root" description:"This username is used to connect to the database to alter the tables."`
+	Password *string `short:"p" optional:"true" optional-value:"" long:"password" description:"The password for the database user"`
+}
+type commandInstallGeoIPDB struct {
+	File string `short:"f" long:"file" description:"Install the database from this local file instead of downloading it. The file can be the database itself, a zip archive, or a gzipped tar archive."`
+	URL  string `short:"u" long:"url" description:"Download the database from this url instead of the configured geo_ip.mirror"`
+}
+
+func (c *commandInstallGeoIPDB) getData() ([]byte, error) {
+	if c.File != "" {
+		log.WithField("file", c.File).Debug("Reading geo ip database from local file")
+		return ioutil.ReadFile(c.File)
+	}
+	url := c.URL
+	if url == "" {
+		url = config.Get().GeoIP.Mirror
+	}
+	if url == "" {
+		return nil, fmt.Errorf("no download url for geo ip database; set geo_ip.mirror or pass --url or --file")
+	}
+	log.WithField("url", url).Debug("Downloading geo ip database")
+	resp, err := httpClient.Do().R().Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("could not download geo ip database: %s", resp.Status())
+	}
+	return resp.Body(), nil
+}
 
 // Execute implements the flags.Commander interface
 func (c *commandInstallGeoIPDB) Execute(args []string) error {
-	archive, err := zipdownload.DownloadZipped("https://download.ip2location.com/lite/IP2LOCATION-LITE-DB1.IPV6.BIN.ZIP")
+	conf := config.Get().GeoIP
+	if conf.DBFile == "" {
+		return fmt.Errorf("geo_ip.db_file not set")
+	}
+	data, err := c.getData()
 	if err != nil {
 		return err
 	}
-	log.Debug("Downloaded zip file")
-	err = ioutil.WriteFile(config.Get().GeoIPDBFile, archive["IP2LOCATION-LITE-DB1.IPV6.BIN"], 0644)
-	if err == nil {
-		log.WithField("file", config.Get().GeoIPDBFile).Debug("Installed geo ip database")
-		fmt.Printf("Installed geo ip database file to '%s'.\n", config.Get().GeoIPDBFile)
+	dbData, err := geoip.ExtractDatabase(data, conf.Provider)
+	if err != nil {
+		return err
 	}
-	return err
+	if err = geoip.InstallDatabase(dbData, conf.Provider, conf.DBFile); err != nil {
+		return err
+	}
+	log.WithField("file", conf.DBFile).Debug("Installed geo ip database")
+	fmt.Printf("Installed geo ip database file to '%s'. Send SIGHUP to a running server to reload it.\n", conf.DBFile)
+	return nil
 }
 
 // Execute implements the flags.Commander interface
@@ -130,7 +174,10 @@ func (c *commandCreateDB) Execute(args []string) error {
 		if err := createTables(tx); err != nil {
 			return err
 		}
-		if err := addPredefinedValues(tx); err != nil { // skipcq RVV-B0005
+		if err := addPredefinedValues(tx); err != nil {
+			return err
+		}
+		if err := setMigrationsApplied(tx); err != nil { // skipcq RVV-B0005
 			return err
 		}
 		return nil
@@ -141,6 +188,75 @@ func (c *commandCreateDB) Execute(args []string) error {
 	return err
 }
 
+// Execute implements the flags.Commander interface
+func (c *commandMigrateDB) Execute(args []string) error {
+	password := ""
+	if c.Password != nil && *c.Password == "" { // -p specified without argument
+		password = prompter.Password("Database Password")
+	}
+	db := cluster.NewFromConfig(config.DBConf{
+		Hosts:    config.Get().DB.Hosts,
+		User:     c.Username,
+		Password: password,
+	})
+	var applied []string
+	if err := db.Transact(func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec(`USE ` + config.Get().DB.DB); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(dbdefinition.MigrationsTableDDL); err != nil {
+			return err
+		}
+		return tx.Select(&applied, `SELECT version FROM SchemaMigrations`)
+	}); err != nil {
+		return err
+	}
+	count := 0
+	for _, m := range dbdefinition.Migrations {
+		if utils.StringInSlice(m.Version, applied) {
+			continue
+		}
+		if err := db.Transact(func(tx *sqlx.Tx) error {
+			return applyMigration(tx, m)
+		}); err != nil {
+			return fmt.Errorf("migration '%s' failed: %w", m.Version, err)
+		}
+		fmt.Printf("Applied migration '%s'.\n", m.Version)
+		count++
+	}
+	if count == 0 {
+		fmt.Println("Database is up to date.")
+	}
+	return nil
+}
+
+func applyMigration(tx *sqlx.Tx, m dbdefinition.Migration) error {
+	if _, err := tx.Exec(`USE ` + config.Get().DB.DB); err != nil {
+		return err
+	}
+	for _, cmd := range m.Cmds {
+		log.Trace(cmd)
+		if _, err := tx.Exec(cmd); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO SchemaMigrations (version) VALUES(?)`, m.Version); err != nil {
+		return err
+	}
+	log.WithField("version", m.Version).Debug("Applied migration")
+	return nil
+}
+
+func setMigrationsApplied(tx *sqlx.Tx) error {
+	for _, m := range dbdefinition.Migrations {
+		if _, err := tx.Exec(`INSERT IGNORE INTO SchemaMigrations (version) VALUES(?)`, m.Version); err != nil {
+			return err
+		}
+	}
+	log.WithField("database", config.Get().DB.DB).Debug("Marked migrations as applied")
+	return nil
+}
+
 func addPredefinedValues(tx *sqlx.Tx) error {
 	for _, attr := range model.Attributes {
 		if _, err := tx.Exec(`INSERT IGNORE INTO Attributes (attribute) VALUES(?)`, attr); err != nil {
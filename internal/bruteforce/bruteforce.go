@@ -0,0 +1,126 @@
+package bruteforce
+
+import (
+	"net"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/failedlookuprepo"
+)
+
+// Kinds of short secrets that can be guessed
+const (
+	KindPollingCode  = "polling_code"
+	KindTransferCode = "transfer_code"
+	KindShortToken   = "short_token"
+)
+
+// ipv6ClientBits is the prefix length IPv6 clients are counted by, since a single client usually controls a whole /64
+const ipv6ClientBits = 64
+
+// ipv4NetworkBits and ipv6NetworkBits are the prefix lengths of the networks failed lookups are counted by in
+// addition to the client
+const (
+	ipv4NetworkBits = 24
+	ipv6NetworkBits = 48
+)
+
+// prefix returns the network of ip with the passed prefix length for IPv4 and IPv6 addresses in CIDR notation; if ip
+// is not an ip address, it is returned unchanged
+func prefix(ip string, ipv4Bits, ipv6Bits int) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if ipv4 := parsed.To4(); ipv4 != nil {
+		if ipv4Bits == 32 {
+			return ip
+		}
+		return (&net.IPNet{
+			IP:   ipv4.Mask(net.CIDRMask(ipv4Bits, 32)),
+			Mask: net.CIDRMask(ipv4Bits, 32),
+		}).String()
+	}
+	return (&net.IPNet{
+		IP:   parsed.Mask(net.CIDRMask(ipv6Bits, 128)),
+		Mask: net.CIDRMask(ipv6Bits, 128),
+	}).String()
+}
+
+// clientKey returns the key the failed lookups of ip are counted under
+func clientKey(ip string) string {
+	return prefix(ip, 32, ipv6ClientBits)
+}
+
+// networkKey returns the key of the network the failed lookups of ip are counted under
+func networkKey(ip string) string {
+	return prefix(ip, ipv4NetworkBits, ipv6NetworkBits)
+}
+
+// locked decides if a client is locked out, given the failed lookups of the client, of its network, and of all
+// clients. During suspected distributed guessing, every client that failed is locked out, so that each guessing client
+// only gets a single guess per window.
+func locked(counts failedlookuprepo.Counts, conf config.BruteForceConf) bool {
+	if counts.Total >= conf.MaxFailuresGlobal && counts.ByClient > 0 {
+		return true
+	}
+	return counts.ByClient >= conf.MaxFailuresPerClient || counts.ByNetwork >= conf.MaxFailuresPerNetwork
+}
+
+// Locked checks if lookups of the passed kind are locked for ip, because ip or its network failed too often, or ip
+// failed during suspected distributed guessing. Errors are only logged, so that a database problem does not lock out
+// every client.
+func Locked(kind, ip string) bool {
+	conf := config.Get().Features.BruteForceProtection
+	if !conf.Enabled {
+		return false
+	}
+	counts, err := failedlookuprepo.Count(nil, kind, clientKey(ip), networkKey(ip), conf.Window)
+	if err != nil {
+		log.WithError(err).Error("Could not count failed lookups")
+		return false
+	}
+	return locked(counts, conf)
+}
+
+// RecordFailure records a failed lookup of the passed kind by ip. When a client, a network, or all clients together
+// reach their threshold, the suspected guessing is reported to the operator through the server log and the database.
+func RecordFailure(kind, ip string) {
+	conf := config.Get().Features.BruteForceProtection
+	if !conf.Enabled {
+		return
+	}
+	client, network := clientKey(ip), networkKey(ip)
+	if err := failedlookuprepo.Add(nil, kind, client, network); err != nil {
+		log.WithError(err).Error("Could not store failed lookup")
+		return
+	}
+	counts, err := failedlookuprepo.Count(nil, kind, client, network, conf.Window)
+	if err != nil {
+		log.WithError(err).Error("Could not count failed lookups")
+		return
+	}
+	if counts.ByClient == conf.MaxFailuresPerClient {
+		report(kind, failedlookuprepo.ScopeClient, client, counts.ByClient, "Suspected guessing, client is locked out")
+	}
+	if counts.ByNetwork == conf.MaxFailuresPerNetwork {
+		report(kind, failedlookuprepo.ScopeNetwork, network, counts.ByNetwork, "Suspected guessing, network is locked out")
+	}
+	if counts.Total == conf.MaxFailuresGlobal {
+		report(kind, failedlookuprepo.ScopeGlobal, "", counts.Total, "Suspected distributed guessing, failing clients are locked out")
+	}
+}
+
+// report logs suspected guessing and stores a record of it, so that the operator can query it later
+func report(kind, scope, source string, failures int, msg string) {
+	log.WithFields(log.Fields{
+		"kind":     kind,
+		"scope":    scope,
+		"source":   source,
+		"failures": failures,
+	}).Warn(msg)
+	if err := failedlookuprepo.AddSuspectedGuessing(nil, kind, scope, source, failures); err != nil {
+		log.WithError(err).Error("Could not store suspected guessing")
+	}
+}
@@ -0,0 +1,70 @@
+package bruteforce
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/failedlookuprepo"
+)
+
+func TestClientKey(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.1":            "192.0.2.1",
+		"2001:db8:1:2:3:4:5:6": "2001:db8:1:2::/64",
+		"2001:db8:1:2:ffff::1": "2001:db8:1:2::/64",
+		"2001:db8:1:3::1":      "2001:db8:1:3::/64",
+		"::ffff:192.0.2.1":     "::ffff:192.0.2.1",
+		"not an ip":            "not an ip",
+	}
+	for ip, expected := range tests {
+		if key := clientKey(ip); key != expected {
+			t.Errorf("Expected key '%s' for '%s', got '%s'", expected, ip, key)
+		}
+	}
+}
+
+func TestNetworkKey(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.1":            "192.0.2.0/24",
+		"192.0.2.254":          "192.0.2.0/24",
+		"198.51.100.1":         "198.51.100.0/24",
+		"2001:db8:1:2:3:4:5:6": "2001:db8:1::/48",
+		"2001:db8:1:ffff::1":   "2001:db8:1::/48",
+		"::ffff:192.0.2.1":     "192.0.2.0/24",
+		"not an ip":            "not an ip",
+	}
+	for ip, expected := range tests {
+		if key := networkKey(ip); key != expected {
+			t.Errorf("Expected key '%s' for '%s', got '%s'", expected, ip, key)
+		}
+	}
+}
+
+func TestLocked(t *testing.T) {
+	conf := config.BruteForceConf{
+		Enabled:               true,
+		MaxFailuresPerClient:  10,
+		MaxFailuresPerNetwork: 50,
+		MaxFailuresGlobal:     100,
+	}
+	tests := []struct {
+		name     string
+		counts   failedlookuprepo.Counts
+		expected bool
+	}{
+		{name: "NoFailures", counts: failedlookuprepo.Counts{}, expected: false},
+		{name: "BelowLimits", counts: failedlookuprepo.Counts{ByClient: 9, ByNetwork: 49, Total: 99}, expected: false},
+		{name: "ClientLimit", counts: failedlookuprepo.Counts{ByClient: 10, ByNetwork: 10, Total: 10}, expected: true},
+		{name: "NetworkLimit", counts: failedlookuprepo.Counts{ByClient: 1, ByNetwork: 50, Total: 50}, expected: true},
+		{name: "BelowGlobalLimitFailedClient", counts: failedlookuprepo.Counts{ByClient: 1, ByNetwork: 1, Total: 99}, expected: false},
+		{name: "GlobalLimitFailedClient", counts: failedlookuprepo.Counts{ByClient: 1, ByNetwork: 1, Total: 100}, expected: true},
+		{name: "GlobalLimitOtherClient", counts: failedlookuprepo.Counts{Total: 1000}, expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if l := locked(test.counts, conf); l != test.expected {
+				t.Errorf("Expected locked=%v, got %v", test.expected, l)
+			}
+		})
+	}
+}
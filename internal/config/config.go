@@ -2,11 +2,15 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"strings"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	log "github.com/sirupsen/logrus"
 	yaml "gopkg.in/yaml.v3"
 
+	"github.com/oidc-mytoken/server/pkg/api/v0"
 	"github.com/oidc-mytoken/server/pkg/oauth2x"
 	"github.com/oidc-mytoken/server/shared/context"
 	"github.com/oidc-mytoken/server/shared/model"
@@ -17,7 +21,8 @@ import (
 
 var defaultConfig = Config{
 	Server: serverConf{
-		Port: 8000,
+		Port:           8000,
+		ClientIPHeader: ClientIPHeaderXForwardedFor,
 		TLS: tlsConf{
 			Enabled:      true, // The default is that TLS is enabled if cert and key are given, this is checked later; we must set true here, because otherwise we cannot distinct this from a false set by the user
 			RedirectHTTP: true,
@@ -45,12 +50,19 @@ var defaultConfig = Config{
 			Level:  "error",
 		},
 	},
+	GeoIP: geoIPConf{
+		Provider: GeoIPProviderIP2Location,
+	},
 	ServiceDocumentation: "https://docs-sdm.scc.kit.edu/mytoken/",
 	Features: featuresConf{
 		EnabledOIDCFlows: []model.OIDCFlow{
 			model.OIDCFlowAuthorizationCode,
 		},
-		TokenRevocation: onlyEnable{true},
+		TokenRevocation: revocationConf{
+			Enabled:            true,
+			FreshAuthMaxAge:    300,
+			TombstoneRetention: 90,
+		},
 		ShortTokens: shortTokenConfig{
 			Enabled: true,
 			Len:     64,
@@ -61,16 +73,75 @@ var defaultConfig = Config{
 			Len:                     8,
 			PollingCodeExpiresAfter: 300,
 			PollingInterval:         5,
+			LongPollMaxWait:         30,
 		},
 		AccessTokenGrant: onlyEnable{true},
 		SignedJWTGrant:   onlyEnable{true},
 		TokenInfo: tokeninfoConfig{
-			Introspect: onlyEnable{true},
-			History:    onlyEnable{true},
-			Tree:       onlyEnable{true},
-			List:       onlyEnable{true},
+			Introspect:    onlyEnable{true},
+			History:       onlyEnable{true},
+			Tree:          onlyEnable{true},
+			List:          onlyEnable{true},
+			Suspend:       onlyEnable{true},
+			Metadata:      onlyEnable{true},
+			AnomalyPolicy: onlyEnable{true},
+			PageSize: pageSizeConf{
+				Default: 100,
+				Max:     1000,
+			},
 		},
 		WebInterface: onlyEnable{true},
+		DenialEvents: denialEventsConf{
+			Enabled:      true,
+			MaxPerMinute: 10,
+		},
+		AnomalyDetection: AnomalyDetectionConf{
+			Enabled:        true,
+			DefaultAction:  api.AnomalyActionLog,
+			BaselineEvents: 1000,
+			NewCountry:     true,
+			NewASN:         true,
+			NewUserAgent:   true,
+			ImpossibleTravel: ImpossibleTravelConf{
+				Enabled:     true,
+				MaxSpeed:    1000,
+				MinDistance: 500,
+			},
+		},
+		Notifications: notificationConf{
+			Email: EmailConf{
+				SMTP: SMTPConf{
+					Port: 587,
+					TLS:  SMTPTLSStartTLS,
+				},
+			},
+			ExpiryWarning: 3 * 24 * 3600,
+			CheckInterval: 3600,
+		},
+		EventStream: EventStreamConf{
+			Enabled:           true,
+			PollInterval:      2,
+			KeepAliveInterval: 15,
+			MaxDuration:       60,
+			MaxConnections:    1000,
+		},
+		BruteForceProtection: BruteForceConf{
+			Enabled:               true,
+			Window:                600,
+			MaxFailuresPerClient:  10,
+			MaxFailuresPerNetwork: 50,
+			MaxFailuresGlobal:     1000,
+		},
+		Webhooks: webhookConf{
+			MaxPerUser:               10,
+			PollInterval:             5,
+			Workers:                  10,
+			MaxConcurrencyPerWebhook: 2,
+			Timeout:                  10,
+			MaxAttempts:              10,
+			InitialBackoff:           30,
+			MaxBackoff:               6 * 3600,
+		},
 	},
 	ProviderByIssuer: make(map[string]*ProviderConf),
 	API: apiConf{
@@ -82,7 +153,8 @@ var defaultConfig = Config{
 type Config struct {
 	IssuerURL            string                   `yaml:"issuer"`
 	Server               serverConf               `yaml:"server"`
-	GeoIPDBFile          string                   `yaml:"geo_ip_db_file"`
+	GeoIPDBFile          string                   `yaml:"geo_ip_db_file"` // Deprecated: use geo_ip.db_file
+	GeoIP                geoIPConf                `yaml:"geo_ip"`
 	API                  apiConf                  `yaml:"api"`
 	DB                   DBConf                   `yaml:"database"`
 	Signing              signingConf              `yaml:"signing"`
@@ -92,6 +164,97 @@ type Config struct {
 	Providers            []*ProviderConf          `yaml:"providers"`
 	ProviderByIssuer     map[string]*ProviderConf `yaml:"-"`
 	ServiceOperator      ServiceOperatorConf      `yaml:"service_operator"`
+	Profiles             ProfilesConf             `yaml:"profiles"`
+}
+
+// ProfilesConf holds the restriction and capability profiles that can be referenced in mytoken requests
+type ProfilesConf struct {
+	Restrictions []RestrictionProfileConf `yaml:"restrictions"`
+	Capabilities []CapabilityProfileConf  `yaml:"capabilities"`
+}
+
+// RestrictionProfileConf holds the configuration of a restriction profile; nbf and exp are given in seconds relative
+// to the creation of the mytoken
+type RestrictionProfileConf struct {
+	Name         string           `yaml:"name"`
+	Description  string           `yaml:"description"`
+	Restrictions api.Restrictions `yaml:"restrictions"`
+}
+
+// CapabilityProfileConf holds the configuration of a capability profile
+type CapabilityProfileConf struct {
+	Name                 string   `yaml:"name"`
+	Description          string   `yaml:"description"`
+	Capabilities         []string `yaml:"capabilities"`
+	SubtokenCapabilities []string `yaml:"subtoken_capabilities"`
+}
+
+func (p *ProfilesConf) validate() error {
+	names := []string{}
+	for i, r := range p.Restrictions {
+		if r.Name == "" {
+			return fmt.Errorf("invalid config: profiles.restrictions.name not set (Index %d)", i)
+		}
+		if utils.StringInSlice(r.Name, names) {
+			return fmt.Errorf("invalid config: profiles.restrictions.name '%s' used multiple times", r.Name)
+		}
+		names = append(names, r.Name)
+	}
+	names = []string{}
+	for i, c := range p.Capabilities {
+		if c.Name == "" {
+			return fmt.Errorf("invalid config: profiles.capabilities.name not set (Index %d)", i)
+		}
+		if utils.StringInSlice(c.Name, names) {
+			return fmt.Errorf("invalid config: profiles.capabilities.name '%s' used multiple times", c.Name)
+		}
+		names = append(names, c.Name)
+		for _, cc := range append(c.Capabilities, c.SubtokenCapabilities...) {
+			if !api.AllCapabilities.Has(api.NewCapability(cc)) {
+				return fmt.Errorf("invalid config: unknown capability '%s' in profile '%s'", cc, c.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Supported geo ip database providers
+const (
+	GeoIPProviderIP2Location = "ip2location"
+	GeoIPProviderMMDB        = "mmdb"
+)
+
+// defaultIP2LocationMirror is the url of the IP2Location LITE database used if no mirror is configured
+const defaultIP2LocationMirror = "https://download.ip2location.com/lite/IP2LOCATION-LITE-DB1.IPV6.BIN.ZIP"
+
+type geoIPConf struct {
+	Provider string `yaml:"provider"`
+	DBFile   string `yaml:"db_file"`
+	Mirror   string `yaml:"mirror"`
+	// ASNDBFile is an optional MaxMind ASN database; it is used by the anomaly detection
+	ASNDBFile string `yaml:"asn_db_file"`
+}
+
+func (c *geoIPConf) setDefaults(legacyDBFile string) {
+	if c.DBFile == "" {
+		c.DBFile = legacyDBFile
+	}
+	if c.Mirror == "" && c.Provider == GeoIPProviderIP2Location {
+		c.Mirror = defaultIP2LocationMirror
+	}
+}
+
+func (c *geoIPConf) validate() error {
+	// Geo ip lookups are optional; without a database file they are disabled
+	if c.DBFile == "" {
+		return nil
+	}
+	switch c.Provider {
+	case GeoIPProviderIP2Location, GeoIPProviderMMDB:
+	default:
+		return fmt.Errorf("invalid config: unknown geo_ip.provider '%s'", c.Provider)
+	}
+	return nil
 }
 
 type apiConf struct {
@@ -99,23 +262,230 @@ type apiConf struct {
 }
 
 type featuresConf struct {
-	EnabledOIDCFlows []model.OIDCFlow `yaml:"enabled_oidc_flows"`
-	TokenRevocation  onlyEnable       `yaml:"token_revocation"`
-	ShortTokens      shortTokenConfig `yaml:"short_tokens"`
-	TransferCodes    onlyEnable       `yaml:"transfer_codes"`
-	Polling          pollingConf      `yaml:"polling_codes"`
-	AccessTokenGrant onlyEnable       `yaml:"access_token_grant"`
-	SignedJWTGrant   onlyEnable       `yaml:"signed_jwt_grant"`
-	TokenInfo        tokeninfoConfig  `yaml:"tokeninfo"`
-	WebInterface     onlyEnable       `yaml:"web_interface"`
+	EnabledOIDCFlows []model.OIDCFlow     `yaml:"enabled_oidc_flows"`
+	TokenRevocation  revocationConf       `yaml:"token_revocation"`
+	ShortTokens      shortTokenConfig     `yaml:"short_tokens"`
+	TransferCodes    onlyEnable           `yaml:"transfer_codes"`
+	Polling          pollingConf          `yaml:"polling_codes"`
+	AccessTokenGrant onlyEnable           `yaml:"access_token_grant"`
+	SignedJWTGrant   onlyEnable           `yaml:"signed_jwt_grant"`
+	TokenInfo        tokeninfoConfig      `yaml:"tokeninfo"`
+	WebInterface     onlyEnable           `yaml:"web_interface"`
+	UsageBudget      onlyEnable           `yaml:"shared_usage_budget"`
+	DenialEvents     denialEventsConf     `yaml:"denial_events"`
+	AnomalyDetection AnomalyDetectionConf `yaml:"anomaly_detection"`
+	Notifications    notificationConf     `yaml:"notifications"`
+	Webhooks         webhookConf          `yaml:"webhooks"`
+	EventStream      EventStreamConf      `yaml:"event_stream"`
+	// BruteForceProtection limits failed lookups of polling codes, transfer codes, and short tokens
+	BruteForceProtection BruteForceConf `yaml:"brute_force_protection"`
 }
 
 type tokeninfoConfig struct {
-	Enabled    bool       `yaml:"-"`
-	Introspect onlyEnable `yaml:"introspect"`
-	History    onlyEnable `yaml:"event_history"`
-	Tree       onlyEnable `yaml:"subtoken_tree"`
-	List       onlyEnable `yaml:"list_mytokens"`
+	Enabled       bool         `yaml:"-"`
+	Introspect    onlyEnable   `yaml:"introspect"`
+	History       onlyEnable   `yaml:"event_history"`
+	Tree          onlyEnable   `yaml:"subtoken_tree"`
+	List          onlyEnable   `yaml:"list_mytokens"`
+	Suspend       onlyEnable   `yaml:"suspend"`
+	Metadata      onlyEnable   `yaml:"update_metadata"`
+	AnomalyPolicy onlyEnable   `yaml:"anomaly_policy"`
+	PageSize      pageSizeConf `yaml:"page_size"`
+}
+
+type pageSizeConf struct {
+	Default int `yaml:"default"`
+	Max     int `yaml:"max"`
+}
+
+type denialEventsConf struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxPerMinute is the maximum number of denial events stored per mytoken and minute
+	MaxPerMinute int `yaml:"max_per_minute"`
+}
+
+// AnomalyDetectionConf holds the configuration of the anomaly detection for mytoken usages
+type AnomalyDetectionConf struct {
+	Enabled bool `yaml:"enabled"`
+	// DefaultAction is the action taken on an anomaly if neither the mytoken nor its user have set a policy
+	DefaultAction string `yaml:"default_action"`
+	// BaselineEvents is the number of the most recent events of a mytoken a usage is compared to
+	BaselineEvents   int                  `yaml:"baseline_events"`
+	NewCountry       bool                 `yaml:"new_country"`
+	NewASN           bool                 `yaml:"new_asn"`
+	NewUserAgent     bool                 `yaml:"new_user_agent"`
+	ImpossibleTravel ImpossibleTravelConf `yaml:"impossible_travel"`
+}
+
+// ImpossibleTravelConf holds the configuration for detecting consecutive usages from locations that are too far apart
+type ImpossibleTravelConf struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxSpeed is the highest plausible travel speed in km/h
+	MaxSpeed float64 `yaml:"max_speed"`
+	// MinDistance is the distance in km up to which usages are never reported, since geo ip locations are imprecise
+	MinDistance float64 `yaml:"min_distance"`
+}
+
+type notificationConf struct {
+	Email EmailConf `yaml:"email"`
+	// ExpiryWarning is the number of seconds before a mytoken expires at which the expiring_soon notification is sent
+	ExpiryWarning int `yaml:"expiry_warning"`
+	// CheckInterval is the number of seconds between two checks for expiring mytokens
+	CheckInterval int `yaml:"check_interval"`
+}
+
+// EmailConf holds the configuration for sending notifications by email
+type EmailConf struct {
+	Enabled bool     `yaml:"enabled"`
+	From    string   `yaml:"from"`
+	SMTP    SMTPConf `yaml:"smtp"`
+}
+
+// SMTPConf holds the configuration of the smtp server used to send emails
+type SMTPConf struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	TLS      string `yaml:"tls"`
+}
+
+// SMTP TLS modes
+const (
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLSImplicit = "tls"
+	SMTPTLSNone     = "none"
+)
+
+func (c *EmailConf) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.From == "" {
+		return fmt.Errorf("invalid config: notifications.email.from not set")
+	}
+	if c.SMTP.Host == "" {
+		return fmt.Errorf("invalid config: notifications.email.smtp.host not set")
+	}
+	switch c.SMTP.TLS {
+	case SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+	default:
+		return fmt.Errorf("invalid config: unknown notifications.email.smtp.tls '%s'", c.SMTP.TLS)
+	}
+	return nil
+}
+
+// BruteForceConf holds the configuration of the brute-force protection for short secrets
+type BruteForceConf struct {
+	Enabled bool `yaml:"enabled"`
+	// Window is the number of seconds failed lookups are counted for
+	Window int `yaml:"window"`
+	// MaxFailuresPerClient is the number of failed lookups of one kind after which a client is locked out for that
+	// kind; IPv6 clients are counted per /64 network
+	MaxFailuresPerClient int `yaml:"max_failures_per_client"`
+	// MaxFailuresPerNetwork is the number of failed lookups of one kind from a network after which all clients in the
+	// network are locked out for that kind; IPv4 networks are /24, IPv6 networks are /48
+	MaxFailuresPerNetwork int `yaml:"max_failures_per_network"`
+	// MaxFailuresGlobal is the number of failed lookups of one kind from all clients after which distributed guessing
+	// is reported and all clients that failed within the window are locked out; clients without failures are not, since
+	// otherwise any client could be locked out by others
+	MaxFailuresGlobal int `yaml:"max_failures_global"`
+}
+
+func (c *BruteForceConf) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Window <= 0 || c.MaxFailuresPerClient <= 0 || c.MaxFailuresPerNetwork <= 0 || c.MaxFailuresGlobal <= 0 {
+		return fmt.Errorf("invalid config: brute_force_protection.window, max_failures_per_client, max_failures_per_network, and max_failures_global must be positive")
+	}
+	return nil
+}
+
+// EventStreamConf holds the configuration of the event stream endpoint
+type EventStreamConf struct {
+	Enabled bool `yaml:"enabled"`
+	// PollInterval is the number of seconds between two checks for new events
+	PollInterval int `yaml:"poll_interval"`
+	// KeepAliveInterval is the number of seconds after which a comment is sent if there were no events
+	KeepAliveInterval int `yaml:"keep_alive_interval"`
+	// MaxDuration is the number of seconds after which a stream is closed; clients reconnect and resume the stream
+	// with the Last-Event-ID header. It must be less than the server's write timeout.
+	MaxDuration int `yaml:"max_duration"`
+	// MaxConnections is the maximum number of concurrent streams per server instance
+	MaxConnections int `yaml:"max_connections"`
+}
+
+// maxEventStreamDuration is the upper limit for event_stream.max_duration given by the server's write timeout
+const maxEventStreamDuration = 80
+
+func (c *EventStreamConf) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.PollInterval <= 0 || c.KeepAliveInterval <= 0 || c.MaxConnections <= 0 {
+		return fmt.Errorf("invalid config: event_stream.poll_interval, keep_alive_interval, and max_connections must be positive")
+	}
+	if c.MaxDuration <= 0 || c.MaxDuration > maxEventStreamDuration {
+		return fmt.Errorf("invalid config: event_stream.max_duration must be between 1 and %d", maxEventStreamDuration)
+	}
+	return nil
+}
+
+type webhookConf struct {
+	Enabled bool `yaml:"enabled"`
+	// OperatorSubscriptions receive the events of all mytokens
+	OperatorSubscriptions []OperatorWebhookConf `yaml:"operator_subscriptions"`
+	MaxPerUser            int                   `yaml:"max_per_user"`
+	// AllowPrivateTargets allows user webhooks to point to loopback and private network addresses
+	AllowPrivateTargets bool `yaml:"allow_private_targets"`
+	// PollInterval is the number of seconds between two checks for due deliveries
+	PollInterval int `yaml:"poll_interval"`
+	// Workers is the maximum number of concurrent delivery attempts to user webhooks; operator webhooks are delivered
+	// by separate workers
+	Workers int `yaml:"workers"`
+	// MaxConcurrencyPerWebhook is the maximum number of concurrent delivery attempts to a single webhook
+	MaxConcurrencyPerWebhook int `yaml:"max_concurrency_per_webhook"`
+	// Timeout is the number of seconds after which a delivery attempt is aborted
+	Timeout     int `yaml:"timeout"`
+	MaxAttempts int `yaml:"max_attempts"`
+	// InitialBackoff and MaxBackoff are the number of seconds to wait after the first failed attempt and the upper
+	// limit for the exponentially growing wait time
+	InitialBackoff int `yaml:"initial_backoff"`
+	MaxBackoff     int `yaml:"max_backoff"`
+}
+
+// OperatorWebhookConf holds the configuration of a webhook subscription of the operator
+type OperatorWebhookConf struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// Secret is used to sign the payloads with HMAC; if not set they are signed with the server key
+	Secret string `yaml:"secret"`
+	// Events limits the delivered events; if empty, all events are delivered
+	Events []string `yaml:"events"`
+}
+
+func (c *webhookConf) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.PollInterval <= 0 || c.Timeout <= 0 || c.MaxAttempts <= 0 || c.InitialBackoff <= 0 || c.MaxBackoff < c.InitialBackoff {
+		return fmt.Errorf("invalid config: webhooks.poll_interval, timeout, max_attempts, and initial_backoff must be positive and max_backoff not smaller than initial_backoff")
+	}
+	if c.Workers <= 0 || c.MaxConcurrencyPerWebhook <= 0 {
+		return fmt.Errorf("invalid config: webhooks.workers and max_concurrency_per_webhook must be positive")
+	}
+	names := make(map[string]bool)
+	for _, s := range c.OperatorSubscriptions {
+		if s.Name == "" || names[s.Name] {
+			return fmt.Errorf("invalid config: webhooks.operator_subscriptions need a unique name")
+		}
+		names[s.Name] = true
+		if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid config: invalid url '%s' for webhook '%s'", s.URL, s.Name)
+		}
+	}
+	return nil
 }
 
 type shortTokenConfig struct {
@@ -139,11 +509,25 @@ type LoggerConf struct {
 	Level  string `yaml:"level"`
 }
 
+type revocationConf struct {
+	Enabled bool `yaml:"enabled"`
+	// FreshAuthMaxAge is the maximum age in seconds of the re-authentication at the provider through which a web
+	// interface session mytoken was obtained, that allows to revoke all mytokens of the user without the
+	// revoke_any_token capability
+	FreshAuthMaxAge int64 `yaml:"fresh_auth_max_age"`
+	// TombstoneRetention is the number of days for which revoked mytokens and their event history are kept; 0 disables
+	// keeping them
+	TombstoneRetention int64 `yaml:"tombstone_retention"`
+}
+
 type pollingConf struct {
 	Enabled                 bool  `yaml:"enabled"`
 	Len                     int   `yaml:"len"`
 	PollingCodeExpiresAfter int64 `yaml:"expires_after"`
 	PollingInterval         int64 `yaml:"polling_interval"`
+	// LongPollMaxWait is the maximum number of seconds a polling code request is held until the consent is
+	// completed; 0 disables long polling
+	LongPollMaxWait int64 `yaml:"long_poll_max_wait"`
 }
 
 type DBConf struct {
@@ -154,10 +538,38 @@ type DBConf struct {
 	ReconnectInterval int64    `yaml:"try_reconnect_interval"`
 }
 
+// Headers in which trusted proxies can pass the client ip
+const (
+	ClientIPHeaderXForwardedFor = "X-Forwarded-For"
+	ClientIPHeaderForwarded     = "Forwarded"
+)
+
 type serverConf struct {
-	Hostname string  `yaml:"hostname"`
-	Port     int     `yaml:"port"`
-	TLS      tlsConf `yaml:"tls"`
+	Hostname       string   `yaml:"hostname"`
+	Port           int      `yaml:"port"`
+	TLS            tlsConf  `yaml:"tls"`
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// ClientIPHeader is the header the trusted proxies pass the client ip in; only this header is read, so that
+	// clients cannot spoof their ip by sending the other one
+	ClientIPHeader string `yaml:"client_ip_header"`
+}
+
+func (c *serverConf) validate() error {
+	for _, p := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(p); err != nil && net.ParseIP(p) == nil {
+			return fmt.Errorf("invalid config: server.trusted_proxies: '%s' is neither an ip address nor a subnet", p)
+		}
+	}
+	switch {
+	case strings.EqualFold(c.ClientIPHeader, ClientIPHeaderXForwardedFor):
+		c.ClientIPHeader = ClientIPHeaderXForwardedFor
+	case strings.EqualFold(c.ClientIPHeader, ClientIPHeaderForwarded):
+		c.ClientIPHeader = ClientIPHeaderForwarded
+	default:
+		return fmt.Errorf("invalid config: server.client_ip_header: '%s' is neither '%s' nor '%s'",
+			c.ClientIPHeader, ClientIPHeaderXForwardedFor, ClientIPHeaderForwarded)
+	}
+	return nil
 }
 
 type tlsConf struct {
@@ -226,9 +638,18 @@ func validate() error {
 			conf.Server.TLS.Enabled = false
 		}
 	}
+	if err := conf.Server.validate(); err != nil {
+		return err
+	}
 	if err := conf.ServiceOperator.validate(); err != nil {
 		return err
 	}
+	if err := conf.GeoIP.validate(); err != nil {
+		return err
+	}
+	if err := conf.Profiles.validate(); err != nil {
+		return err
+	}
 	if len(conf.Providers) <= 0 {
 		return fmt.Errorf("invalid config: providers must have at least one entry")
 	}
@@ -277,11 +698,40 @@ func validate() error {
 	if !conf.Features.TokenInfo.Introspect.Enabled && conf.Features.WebInterface.Enabled {
 		return fmt.Errorf("web interface requires tokeninfo.introspect to be enabled")
 	}
+	if ps := conf.Features.TokenInfo.PageSize; ps.Default <= 0 || ps.Max < ps.Default {
+		return fmt.Errorf("invalid config: tokeninfo.page_size.default must be positive and not greater than max")
+	}
+	switch conf.Features.AnomalyDetection.DefaultAction {
+	case api.AnomalyActionLog, api.AnomalyActionNotify, api.AnomalyActionSuspend:
+	default:
+		return fmt.Errorf("invalid config: unknown anomaly_detection.default_action '%s'", conf.Features.AnomalyDetection.DefaultAction)
+	}
+	if a := conf.Features.AnomalyDetection; a.Enabled && a.BaselineEvents <= 0 {
+		return fmt.Errorf("invalid config: anomaly_detection.baseline_events must be positive")
+	}
+	if err := conf.Features.BruteForceProtection.validate(); err != nil {
+		return err
+	}
+	if err := conf.Features.EventStream.validate(); err != nil {
+		return err
+	}
+	if err := conf.Features.Webhooks.validate(); err != nil {
+		return err
+	}
+	if err := conf.Features.Notifications.Email.validate(); err != nil {
+		return err
+	}
+	if n := conf.Features.Notifications; n.Email.Enabled && (n.ExpiryWarning <= 0 || n.CheckInterval <= 0) {
+		return fmt.Errorf("invalid config: notifications.expiry_warning and notifications.check_interval must be positive")
+	}
 	conf.Features.TokenInfo.Enabled = utils.OR(
 		conf.Features.TokenInfo.Introspect.Enabled,
 		conf.Features.TokenInfo.History.Enabled,
 		conf.Features.TokenInfo.Tree.Enabled,
 		conf.Features.TokenInfo.List.Enabled,
+		conf.Features.TokenInfo.Suspend.Enabled,
+		conf.Features.TokenInfo.Metadata.Enabled,
+		conf.Features.TokenInfo.AnomalyPolicy.Enabled,
 	)
 	return nil
 }
@@ -299,6 +749,12 @@ func Load() {
 	}
 }
 
+// LoadDefault populates the Config with the default values without reading a config file; it is intended for tests
+func LoadDefault() {
+	c := defaultConfig
+	conf = &c
+}
+
 func load() {
 	data, _ := fileutil.ReadConfigFile("config.yaml", possibleConfigLocations)
 	conf = &defaultConfig
@@ -307,6 +763,7 @@ func load() {
 		log.WithError(err).Fatal()
 		return
 	}
+	conf.GeoIP.setDefaults(conf.GeoIPDBFile)
 }
 
 // LoadForSetup reads the config file and populates the Config struct; it does not validate the Config, since this is not required for setup
@@ -0,0 +1,42 @@
+// Package cleanup provides a background job that deletes database entries that are no longer needed.
+package cleanup
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/eventrepo"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/failedlookuprepo"
+	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/notificationrepo"
+)
+
+// interval is the time between two cleanup runs
+const interval = time.Hour
+
+// StartCleanupJob starts a background job that periodically deletes expired database entries
+func StartCleanupJob() {
+	go func() {
+		for {
+			cleanup()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func cleanup() {
+	if err := dbhelper.DeleteExpiredTombstones(nil); err != nil {
+		log.WithError(err).Error("Could not delete expired tombstones")
+	}
+	if err := notificationrepo.DeleteExpiredEmailConfirmations(nil); err != nil {
+		log.WithError(err).Error("Could not delete expired email confirmations")
+	}
+	if err := eventrepo.DeleteExpiredEventStreams(nil); err != nil {
+		log.WithError(err).Error("Could not delete expired event streams")
+	}
+	if err := failedlookuprepo.DeleteExpired(nil, config.Get().Features.BruteForceProtection.Window); err != nil {
+		log.WithError(err).Error("Could not delete expired failed lookups")
+	}
+}
@@ -22,7 +22,12 @@ func Connect() {
 		db.Close()
 		log.Debug("Done")
 	}
-	db = cluster.NewFromConfig(config.Get().DB)
+	ConnectConfig(config.Get().DB)
+}
+
+// ConnectConfig connects to the database using the passed db config
+func ConnectConfig(conf config.DBConf) {
+	db = cluster.NewFromConfig(conf)
 }
 
 // NullString extends the sql.NullString
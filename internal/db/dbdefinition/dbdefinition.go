@@ -43,7 +43,7 @@ var DDL = []string{
 		"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT," +
 		"  `token` text NOT NULL," +
 		"  `created` datetime NOT NULL DEFAULT current_timestamp()," +
-		"  `ip_created` varchar(32) NOT NULL," +
+		"  `ip_created` varchar(45) NOT NULL," +
 		"  `comment` text DEFAULT NULL," +
 		"  `MT_id` varchar(128) NOT NULL," +
 		"  PRIMARY KEY (`id`)," +
@@ -85,6 +85,11 @@ var DDL = []string{
 		"  `expires_in` int(11) NOT NULL," +
 		"  `expires_at` datetime NOT NULL DEFAULT (current_timestamp() + interval `expires_in` second)," +
 		"  `subtoken_capabilities` longtext CHARACTER SET utf8mb4 COLLATE utf8mb4_bin DEFAULT NULL CHECK (json_valid(`subtoken_capabilities`))," +
+		"  `restriction_profile` varchar(100) DEFAULT NULL," +
+		"  `capability_profile` varchar(100) DEFAULT NULL," +
+		"  `subtoken_limits` longtext CHARACTER SET utf8mb4 COLLATE utf8mb4_bin DEFAULT NULL CHECK (json_valid(`subtoken_limits`))," +
+		"  `reauthenticate` bit(1) NOT NULL DEFAULT b'0'," +
+		"  `ip` varchar(45) DEFAULT NULL," +
 		"  PRIMARY KEY (`state_h`)" +
 		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
 	"/*!40101 SET character_set_client = @saved_cs_client */;",
@@ -136,6 +141,47 @@ var DDL = []string{
 		"  UNIQUE KEY `Events_UN` (`event`)" +
 		") ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;",
 	"/*!40101 SET character_set_client = @saved_cs_client */;",
+	"" +
+		"--",
+	"-- Table structure for table `EventStreams`",
+	"--",
+	"" +
+		"DROP TABLE IF EXISTS `EventStreams`;",
+	"/*!40101 SET @saved_cs_client     = @@character_set_client */;",
+	"/*!40101 SET character_set_client = utf8 */;",
+	"CREATE TABLE `EventStreams` (" +
+		"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT," +
+		"  `MT_id` varchar(128) NOT NULL," +
+		"  `all_of_user` bit(1) NOT NULL DEFAULT b'0'," +
+		"  `start_event_id` bigint(20) unsigned NOT NULL," +
+		"  `expires_at` datetime NOT NULL," +
+		"  PRIMARY KEY (`id`)," +
+		"  KEY `EventStreams_FK` (`MT_id`)," +
+		"  KEY `EventStreams_expires_at_IDX` (`expires_at`)," +
+		"  CONSTRAINT `EventStreams_FK` FOREIGN KEY (`MT_id`) REFERENCES `MTokens` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+	"/*!40101 SET character_set_client = @saved_cs_client */;",
+	"" +
+		"--",
+	"-- Table structure for table `FailedLookups`",
+	"--",
+	"" +
+		"DROP TABLE IF EXISTS `FailedLookups`;",
+	"/*!40101 SET @saved_cs_client     = @@character_set_client */;",
+	"/*!40101 SET character_set_client = utf8 */;",
+	"CREATE TABLE `FailedLookups` (" +
+		"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT," +
+		"  `client` varchar(64) NOT NULL," +
+		"  `network` varchar(64) NOT NULL DEFAULT ''," +
+		"  `kind` varchar(32) NOT NULL," +
+		"  `time` datetime NOT NULL DEFAULT current_timestamp()," +
+		"  PRIMARY KEY (`id`)," +
+		"  KEY `FailedLookups_kind_time_IDX` (`kind`,`time`)," +
+		"  KEY `FailedLookups_client_kind_time_IDX` (`client`,`kind`,`time`)," +
+		"  KEY `FailedLookups_network_kind_time_IDX` (`network`,`kind`,`time`)," +
+		"  KEY `FailedLookups_time_IDX` (`time`)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+	"/*!40101 SET character_set_client = @saved_cs_client */;",
 	"" +
 		"--",
 	"-- Table structure for table `Grants`",
@@ -165,15 +211,34 @@ var DDL = []string{
 		"  `time` datetime NOT NULL DEFAULT current_timestamp()," +
 		"  `event_id` int(10) unsigned NOT NULL DEFAULT 0," +
 		"  `comment` varchar(100) DEFAULT NULL," +
-		"  `ip` varchar(32) NOT NULL," +
+		"  `ip` varchar(45) NOT NULL," +
 		"  `user_agent` text NOT NULL," +
+		"  `country` char(2) DEFAULT NULL," +
+		"  `asn` int(10) unsigned DEFAULT NULL," +
 		"  PRIMARY KEY (`id`)," +
 		"  KEY `MT_Events_FK_2` (`MT_id`)," +
+		"  KEY `MT_Events_MT_id_time_IDX` (`MT_id`,`time`,`id`)," +
 		"  KEY `MT_Events_FK_3` (`event_id`)," +
 		"  CONSTRAINT `MT_Events_FK_2` FOREIGN KEY (`MT_id`) REFERENCES `MTokens` (`id`) ON DELETE CASCADE ON UPDATE CASCADE," +
 		"  CONSTRAINT `MT_Events_FK_3` FOREIGN KEY (`event_id`) REFERENCES `Events` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
 		") ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;",
 	"/*!40101 SET character_set_client = @saved_cs_client */;",
+	"" +
+		"--",
+	"-- Table structure for table `MT_Tags`",
+	"--",
+	"" +
+		"DROP TABLE IF EXISTS `MT_Tags`;",
+	"/*!40101 SET @saved_cs_client     = @@character_set_client */;",
+	"/*!40101 SET character_set_client = utf8 */;",
+	"CREATE TABLE `MT_Tags` (" +
+		"  `MT_id` varchar(128) NOT NULL," +
+		"  `tag` varchar(100) NOT NULL," +
+		"  PRIMARY KEY (`MT_id`,`tag`)," +
+		"  KEY `MT_Tags_tag_IDX` (`tag`)," +
+		"  CONSTRAINT `MT_Tags_FK` FOREIGN KEY (`MT_id`) REFERENCES `MTokens` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+	"/*!40101 SET character_set_client = @saved_cs_client */;",
 	"" +
 		"--",
 	"-- Table structure for table `MTokens`",
@@ -188,12 +253,22 @@ var DDL = []string{
 		"  `root_id` varchar(128) DEFAULT NULL," +
 		"  `name` varchar(100) DEFAULT NULL," +
 		"  `created` datetime NOT NULL DEFAULT current_timestamp()," +
-		"  `ip_created` varchar(32) NOT NULL," +
+		"  `ip_created` varchar(45) NOT NULL," +
 		"  `user_id` bigint(20) unsigned NOT NULL," +
 		"  `rt_id` bigint(20) unsigned NOT NULL," +
 		"  `seqno` bigint(20) unsigned NOT NULL," +
 		"  `last_rotated` datetime NOT NULL DEFAULT current_timestamp()," +
+		"  `max_depth` int(10) unsigned DEFAULT NULL," +
+		"  `max_children` int(10) unsigned DEFAULT NULL," +
+		"  `max_descendants` int(10) unsigned DEFAULT NULL," +
+		"  `management_id` char(64) NOT NULL," +
+		"  `suspended_by` varchar(128) DEFAULT NULL," +
+		"  `description` text DEFAULT NULL," +
+		"  `anomaly_policy` varchar(16) DEFAULT NULL," +
+		"  `expires_at` datetime DEFAULT NULL," +
+		"  `expiry_notified` tinyint(1) NOT NULL DEFAULT 0," +
 		"  PRIMARY KEY (`id`)," +
+		"  UNIQUE KEY `MTokens_management_id_UN` (`management_id`)," +
 		"  KEY `SessionTokens_parent_id_IDX` (`parent_id`) USING BTREE," +
 		"  KEY `SessionTokens_root_id_IDX` (`root_id`) USING BTREE," +
 		"  KEY `Mytokens_FK_2` (`user_id`)," +
@@ -247,6 +322,40 @@ var DDL = []string{
 		"  `encryption_key` tinyint NOT NULL" +
 		") ENGINE=MyISAM */;",
 	"SET character_set_client = @saved_cs_client;",
+	"" +
+		"--",
+	"-- Table structure for table `NotificationEmailConfirmations`",
+	"--",
+	"" +
+		"DROP TABLE IF EXISTS `NotificationEmailConfirmations`;",
+	"/*!40101 SET @saved_cs_client     = @@character_set_client */;",
+	"/*!40101 SET character_set_client = utf8 */;",
+	"CREATE TABLE `NotificationEmailConfirmations` (" +
+		"  `user_id` bigint(20) unsigned NOT NULL," +
+		"  `email` varchar(256) NOT NULL," +
+		"  `code` varchar(128) NOT NULL," +
+		"  `expires_at` datetime NOT NULL," +
+		"  PRIMARY KEY (`user_id`)," +
+		"  UNIQUE KEY `NotificationEmailConfirmations_UN` (`code`)," +
+		"  KEY `NotificationEmailConfirmations_expires_at_IDX` (`expires_at`)," +
+		"  CONSTRAINT `NotificationEmailConfirmations_FK` FOREIGN KEY (`user_id`) REFERENCES `Users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+	"/*!40101 SET character_set_client = @saved_cs_client */;",
+	"" +
+		"--",
+	"-- Table structure for table `NotificationSubscriptions`",
+	"--",
+	"" +
+		"DROP TABLE IF EXISTS `NotificationSubscriptions`;",
+	"/*!40101 SET @saved_cs_client     = @@character_set_client */;",
+	"/*!40101 SET character_set_client = utf8 */;",
+	"CREATE TABLE `NotificationSubscriptions` (" +
+		"  `user_id` bigint(20) unsigned NOT NULL," +
+		"  `notification` varchar(32) NOT NULL," +
+		"  PRIMARY KEY (`user_id`,`notification`)," +
+		"  CONSTRAINT `NotificationSubscriptions_FK` FOREIGN KEY (`user_id`) REFERENCES `Users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+	"/*!40101 SET character_set_client = @saved_cs_client */;",
 	"" +
 		"--",
 	"-- Table structure for table `ProxyTokens`",
@@ -282,6 +391,21 @@ var DDL = []string{
 		"  CONSTRAINT `RT_EncryptionKeys_FK_1` FOREIGN KEY (`rt_id`) REFERENCES `RefreshTokens` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
 		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
 	"/*!40101 SET character_set_client = @saved_cs_client */;",
+	"" +
+		"--",
+	"-- Table structure for table `Reauthentications`",
+	"--",
+	"" +
+		"DROP TABLE IF EXISTS `Reauthentications`;",
+	"/*!40101 SET @saved_cs_client     = @@character_set_client */;",
+	"/*!40101 SET character_set_client = utf8 */;",
+	"CREATE TABLE `Reauthentications` (" +
+		"  `MT_id` varchar(128) NOT NULL," +
+		"  `auth_time` datetime NOT NULL," +
+		"  PRIMARY KEY (`MT_id`)," +
+		"  CONSTRAINT `Reauthentications_FK` FOREIGN KEY (`MT_id`) REFERENCES `MTokens` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+	"/*!40101 SET character_set_client = @saved_cs_client */;",
 	"" +
 		"--",
 	"-- Table structure for table `RefreshTokens`",
@@ -298,6 +422,91 @@ var DDL = []string{
 		"  PRIMARY KEY (`id`)" +
 		") ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;",
 	"/*!40101 SET character_set_client = @saved_cs_client */;",
+	"" +
+		"--",
+	"-- Table structure for table `RevokedMTokens`",
+	"--",
+	"" +
+		"DROP TABLE IF EXISTS `RevokedMTokens`;",
+	"/*!40101 SET @saved_cs_client     = @@character_set_client */;",
+	"/*!40101 SET character_set_client = utf8 */;",
+	"CREATE TABLE `RevokedMTokens` (" +
+		"  `id` varchar(128) NOT NULL," +
+		"  `management_id` char(64) NOT NULL," +
+		"  `parent_id` varchar(128) DEFAULT NULL," +
+		"  `root_id` varchar(128) DEFAULT NULL," +
+		"  `user_id` bigint(20) unsigned NOT NULL," +
+		"  `name` varchar(100) DEFAULT NULL," +
+		"  `created` datetime NOT NULL," +
+		"  `revoked` datetime NOT NULL DEFAULT current_timestamp()," +
+		"  `reason` varchar(64) NOT NULL," +
+		"  `actor` char(64) DEFAULT NULL," +
+		"  `ip` varchar(45) DEFAULT NULL," +
+		"  PRIMARY KEY (`id`)," +
+		"  KEY `RevokedMTokens_management_id_IDX` (`management_id`)," +
+		"  KEY `RevokedMTokens_user_id_IDX` (`user_id`)," +
+		"  KEY `RevokedMTokens_revoked_IDX` (`revoked`)," +
+		"  CONSTRAINT `RevokedMTokens_FK` FOREIGN KEY (`user_id`) REFERENCES `Users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+	"/*!40101 SET character_set_client = @saved_cs_client */;",
+	"" +
+		"--",
+	"-- Table structure for table `RevokedMT_Events`",
+	"--",
+	"" +
+		"DROP TABLE IF EXISTS `RevokedMT_Events`;",
+	"/*!40101 SET @saved_cs_client     = @@character_set_client */;",
+	"/*!40101 SET character_set_client = utf8 */;",
+	"CREATE TABLE `RevokedMT_Events` (" +
+		"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT," +
+		"  `MT_id` varchar(128) NOT NULL," +
+		"  `time` datetime NOT NULL," +
+		"  `event_id` int(10) unsigned NOT NULL," +
+		"  `comment` varchar(100) DEFAULT NULL," +
+		"  `ip` varchar(45) NOT NULL," +
+		"  `user_agent` text NOT NULL," +
+		"  `country` char(2) DEFAULT NULL," +
+		"  `asn` int(10) unsigned DEFAULT NULL," +
+		"  PRIMARY KEY (`id`)," +
+		"  KEY `RevokedMT_Events_FK` (`MT_id`)," +
+		"  KEY `RevokedMT_Events_FK_1` (`event_id`)," +
+		"  CONSTRAINT `RevokedMT_Events_FK` FOREIGN KEY (`MT_id`) REFERENCES `RevokedMTokens` (`id`) ON DELETE CASCADE ON UPDATE CASCADE," +
+		"  CONSTRAINT `RevokedMT_Events_FK_1` FOREIGN KEY (`event_id`) REFERENCES `Events` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+	"/*!40101 SET character_set_client = @saved_cs_client */;",
+	"" +
+		"--",
+	"-- Table structure for table `SchemaMigrations`",
+	"--",
+	"" +
+		"DROP TABLE IF EXISTS `SchemaMigrations`;",
+	"/*!40101 SET @saved_cs_client     = @@character_set_client */;",
+	"/*!40101 SET character_set_client = utf8 */;",
+	"CREATE TABLE `SchemaMigrations` (" +
+		"  `version` varchar(64) NOT NULL," +
+		"  `applied` datetime NOT NULL DEFAULT current_timestamp()," +
+		"  PRIMARY KEY (`version`)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+	"/*!40101 SET character_set_client = @saved_cs_client */;",
+	"" +
+		"--",
+	"-- Table structure for table `SuspectedGuessing`",
+	"--",
+	"" +
+		"DROP TABLE IF EXISTS `SuspectedGuessing`;",
+	"/*!40101 SET @saved_cs_client     = @@character_set_client */;",
+	"/*!40101 SET character_set_client = utf8 */;",
+	"CREATE TABLE `SuspectedGuessing` (" +
+		"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT," +
+		"  `kind` varchar(32) NOT NULL," +
+		"  `scope` varchar(16) NOT NULL," +
+		"  `source` varchar(64) DEFAULT NULL," +
+		"  `failures` int(10) unsigned NOT NULL," +
+		"  `time` datetime NOT NULL DEFAULT current_timestamp()," +
+		"  PRIMARY KEY (`id`)," +
+		"  KEY `SuspectedGuessing_time_IDX` (`time`)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+	"/*!40101 SET character_set_client = @saved_cs_client */;",
 	"" +
 		"--",
 	"-- Table structure for table `TokenUsages`",
@@ -312,6 +521,9 @@ var DDL = []string{
 		"  `usages_AT` int(10) unsigned NOT NULL DEFAULT 0," +
 		"  `usages_other` int(10) unsigned NOT NULL DEFAULT 0," +
 		"  `restriction_hash` char(128) NOT NULL," +
+		"  `parent_restriction_hash` char(128) DEFAULT NULL," +
+		"  `descendant_usages_AT` int(10) unsigned NOT NULL DEFAULT 0," +
+		"  `descendant_usages_other` int(10) unsigned NOT NULL DEFAULT 0," +
 		"  PRIMARY KEY (`MT_id`,`restriction_hash`)," +
 		"  CONSTRAINT `TokenUsages_FK` FOREIGN KEY (`MT_id`) REFERENCES `MTokens` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
 		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
@@ -352,6 +564,9 @@ var DDL = []string{
 		"  `revoke_MT` bit(1) NOT NULL DEFAULT b'0'," +
 		"  `response_type` varchar(128) NOT NULL DEFAULT 'token'," +
 		"  `consent_declined` bit(1) DEFAULT NULL," +
+		"  `last_polled` datetime DEFAULT NULL," +
+		"  `polling_interval` int(10) unsigned DEFAULT NULL," +
+		"  `long_poll_until` datetime DEFAULT NULL," +
 		"  PRIMARY KEY (`id`)," +
 		"  CONSTRAINT `TransferCodesAttributes_FK` FOREIGN KEY (`id`) REFERENCES `ProxyTokens` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
 		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
@@ -409,10 +624,54 @@ var DDL = []string{
 		"  `iss` varchar(256) NOT NULL," +
 		"  `token_tracing` tinyint(1) NOT NULL DEFAULT 1," +
 		"  `jwt_pk` text DEFAULT NULL," +
+		"  `anomaly_policy` varchar(16) DEFAULT NULL," +
+		"  `notification_email` varchar(256) DEFAULT NULL," +
 		"  PRIMARY KEY (`id`)," +
 		"  UNIQUE KEY `Users_UN` (`sub`,`iss`)" +
 		") ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;",
 	"/*!40101 SET character_set_client = @saved_cs_client */;",
+	"" +
+		"--",
+	"-- Table structure for table `WebhookDeliveries`",
+	"--",
+	"" +
+		"DROP TABLE IF EXISTS `WebhookDeliveries`;",
+	"/*!40101 SET @saved_cs_client     = @@character_set_client */;",
+	"/*!40101 SET character_set_client = utf8 */;",
+	"CREATE TABLE `WebhookDeliveries` (" +
+		"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT," +
+		"  `webhook_id` bigint(20) unsigned DEFAULT NULL," +
+		"  `operator_webhook` varchar(128) DEFAULT NULL," +
+		"  `payload` text NOT NULL," +
+		"  `attempts` int(10) unsigned NOT NULL DEFAULT 0," +
+		"  `next_attempt` datetime NOT NULL DEFAULT current_timestamp()," +
+		"  `last_error` varchar(256) DEFAULT NULL," +
+		"  PRIMARY KEY (`id`)," +
+		"  KEY `WebhookDeliveries_next_attempt_IDX` (`next_attempt`)," +
+		"  KEY `WebhookDeliveries_FK` (`webhook_id`)," +
+		"  CONSTRAINT `WebhookDeliveries_FK` FOREIGN KEY (`webhook_id`) REFERENCES `Webhooks` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+	"/*!40101 SET character_set_client = @saved_cs_client */;",
+	"" +
+		"--",
+	"-- Table structure for table `Webhooks`",
+	"--",
+	"" +
+		"DROP TABLE IF EXISTS `Webhooks`;",
+	"/*!40101 SET @saved_cs_client     = @@character_set_client */;",
+	"/*!40101 SET character_set_client = utf8 */;",
+	"CREATE TABLE `Webhooks` (" +
+		"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT," +
+		"  `user_id` bigint(20) unsigned NOT NULL," +
+		"  `url` varchar(2048) NOT NULL," +
+		"  `events` text DEFAULT NULL," +
+		"  `secret` varchar(128) DEFAULT NULL," +
+		"  `created` datetime NOT NULL DEFAULT current_timestamp()," +
+		"  PRIMARY KEY (`id`)," +
+		"  KEY `Webhooks_FK` (`user_id`)," +
+		"  CONSTRAINT `Webhooks_FK` FOREIGN KEY (`user_id`) REFERENCES `Users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+	"/*!40101 SET character_set_client = @saved_cs_client */;",
 	"" +
 		"--",
 	"-- Final view structure for view `EventHistory`",
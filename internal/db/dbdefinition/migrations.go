@@ -0,0 +1,284 @@
+package dbdefinition
+
+// Migration holds the commands to update an existing database to a newer schema
+type Migration struct {
+	Version string
+	Cmds    []string
+}
+
+// MigrationsTableDDL creates the table that holds the applied migrations, if it does not exist yet
+const MigrationsTableDDL = "CREATE TABLE IF NOT EXISTS `SchemaMigrations` (" +
+	"  `version` varchar(64) NOT NULL," +
+	"  `applied` datetime NOT NULL DEFAULT current_timestamp()," +
+	"  PRIMARY KEY (`version`)" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;"
+
+// Migrations holds all database migrations in the order they must be applied. The DDL always creates the newest
+// schema, so a newly created database already includes all migrations.
+var Migrations = []Migration{
+	{
+		Version: "0.2.0-ipv6",
+		Cmds: []string{
+			"ALTER TABLE `MTokens` MODIFY `ip_created` varchar(45) NOT NULL;",
+			"ALTER TABLE `AccessTokens` MODIFY `ip_created` varchar(45) NOT NULL;",
+			"ALTER TABLE `MT_Events` MODIFY `ip` varchar(45) NOT NULL;",
+		},
+	},
+	{
+		Version: "0.2.0-profiles",
+		Cmds: []string{
+			"ALTER TABLE `AuthInfo` ADD `restriction_profile` varchar(100) DEFAULT NULL;",
+			"ALTER TABLE `AuthInfo` ADD `capability_profile` varchar(100) DEFAULT NULL;",
+		},
+	},
+	{
+		Version: "0.2.0-restriction-profile-at-consent",
+		Cmds: []string{
+			"ALTER TABLE `AuthInfo` ADD `ip` varchar(45) DEFAULT NULL;",
+		},
+	},
+	{
+		Version: "0.2.0-usage-budget",
+		Cmds: []string{
+			"ALTER TABLE `TokenUsages` ADD `parent_restriction_hash` char(128) DEFAULT NULL;",
+			"ALTER TABLE `TokenUsages` ADD `descendant_usages_AT` int(10) unsigned NOT NULL DEFAULT 0;",
+			"ALTER TABLE `TokenUsages` ADD `descendant_usages_other` int(10) unsigned NOT NULL DEFAULT 0;",
+		},
+	},
+	{
+		Version: "0.2.0-subtoken-limits",
+		Cmds: []string{
+			"ALTER TABLE `MTokens` ADD `max_depth` int(10) unsigned DEFAULT NULL;",
+			"ALTER TABLE `MTokens` ADD `max_children` int(10) unsigned DEFAULT NULL;",
+			"ALTER TABLE `MTokens` ADD `max_descendants` int(10) unsigned DEFAULT NULL;",
+			"ALTER TABLE `AuthInfo` ADD `subtoken_limits` longtext CHARACTER SET utf8mb4 COLLATE utf8mb4_bin DEFAULT NULL CHECK (json_valid(`subtoken_limits`));",
+		},
+	},
+	{
+		Version: "0.2.0-management-id",
+		Cmds: []string{
+			"ALTER TABLE `MTokens` ADD `management_id` char(64) DEFAULT NULL;",
+			"UPDATE `MTokens` SET `management_id`=SHA2(`id`, 256);",
+			"ALTER TABLE `MTokens` MODIFY `management_id` char(64) NOT NULL;",
+			"ALTER TABLE `MTokens` ADD UNIQUE KEY `MTokens_management_id_UN` (`management_id`);",
+			"INSERT IGNORE INTO `Events` (`event`) VALUES('revoked_other_token');",
+		},
+	},
+	{
+		Version: "0.2.0-reauthentication",
+		Cmds: []string{
+			"ALTER TABLE `AuthInfo` ADD `reauthenticate` bit(1) NOT NULL DEFAULT b'0';",
+			"CREATE TABLE IF NOT EXISTS `Reauthentications` (" +
+				"  `MT_id` varchar(128) NOT NULL," +
+				"  `auth_time` datetime NOT NULL," +
+				"  PRIMARY KEY (`MT_id`)," +
+				"  CONSTRAINT `Reauthentications_FK` FOREIGN KEY (`MT_id`) REFERENCES `MTokens` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+		},
+	},
+	{
+		Version: "0.2.0-tombstones",
+		Cmds: []string{
+			"CREATE TABLE IF NOT EXISTS `RevokedMTokens` (" +
+				"  `id` varchar(128) NOT NULL," +
+				"  `management_id` char(64) NOT NULL," +
+				"  `parent_id` varchar(128) DEFAULT NULL," +
+				"  `root_id` varchar(128) DEFAULT NULL," +
+				"  `user_id` bigint(20) unsigned NOT NULL," +
+				"  `name` varchar(100) DEFAULT NULL," +
+				"  `created` datetime NOT NULL," +
+				"  `revoked` datetime NOT NULL DEFAULT current_timestamp()," +
+				"  `reason` varchar(64) NOT NULL," +
+				"  `actor` char(64) DEFAULT NULL," +
+				"  `ip` varchar(45) DEFAULT NULL," +
+				"  PRIMARY KEY (`id`)," +
+				"  KEY `RevokedMTokens_management_id_IDX` (`management_id`)," +
+				"  KEY `RevokedMTokens_user_id_IDX` (`user_id`)," +
+				"  KEY `RevokedMTokens_revoked_IDX` (`revoked`)," +
+				"  CONSTRAINT `RevokedMTokens_FK` FOREIGN KEY (`user_id`) REFERENCES `Users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+			"CREATE TABLE IF NOT EXISTS `RevokedMT_Events` (" +
+				"  `id` bigint(20) unsigned NOT NULL," +
+				"  `MT_id` varchar(128) NOT NULL," +
+				"  `time` datetime NOT NULL," +
+				"  `event_id` int(10) unsigned NOT NULL," +
+				"  `comment` varchar(100) DEFAULT NULL," +
+				"  `ip` varchar(45) NOT NULL," +
+				"  `user_agent` text NOT NULL," +
+				"  PRIMARY KEY (`id`)," +
+				"  KEY `RevokedMT_Events_FK` (`MT_id`)," +
+				"  KEY `RevokedMT_Events_FK_1` (`event_id`)," +
+				"  CONSTRAINT `RevokedMT_Events_FK` FOREIGN KEY (`MT_id`) REFERENCES `RevokedMTokens` (`id`) ON DELETE CASCADE ON UPDATE CASCADE," +
+				"  CONSTRAINT `RevokedMT_Events_FK_1` FOREIGN KEY (`event_id`) REFERENCES `Events` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+		},
+	},
+	{
+		Version: "0.2.0-suspension",
+		Cmds: []string{
+			"ALTER TABLE `MTokens` ADD `suspended_by` varchar(128) DEFAULT NULL;",
+			"INSERT IGNORE INTO `Events` (`event`) VALUES('suspended'), ('resumed');",
+		},
+	},
+	{
+		Version: "0.2.0-metadata",
+		Cmds: []string{
+			"ALTER TABLE `MTokens` ADD `description` text DEFAULT NULL;",
+			"CREATE TABLE IF NOT EXISTS `MT_Tags` (" +
+				"  `MT_id` varchar(128) NOT NULL," +
+				"  `tag` varchar(100) NOT NULL," +
+				"  PRIMARY KEY (`MT_id`,`tag`)," +
+				"  KEY `MT_Tags_tag_IDX` (`tag`)," +
+				"  CONSTRAINT `MT_Tags_FK` FOREIGN KEY (`MT_id`) REFERENCES `MTokens` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+			"INSERT IGNORE INTO `Events` (`event`) VALUES('name_changed'), ('description_changed'), ('tags_changed');",
+		},
+	},
+	{
+		Version: "0.2.0-event-history-pagination",
+		Cmds: []string{
+			"ALTER TABLE `MT_Events` ADD `country` char(2) DEFAULT NULL;",
+			"ALTER TABLE `RevokedMT_Events` ADD `country` char(2) DEFAULT NULL;",
+			"CREATE INDEX IF NOT EXISTS `MT_Events_MT_id_time_IDX` ON `MT_Events` (`MT_id`,`time`,`id`);",
+		},
+	},
+	{
+		Version: "0.2.0-subtree-history",
+		Cmds: []string{
+			"INSERT IGNORE INTO `Events` (`event`) VALUES('tokeninfo_subtree_history');",
+		},
+	},
+	{
+		Version: "0.2.0-denial-events",
+		Cmds: []string{
+			"ALTER TABLE `RevokedMT_Events` MODIFY `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT;",
+			"INSERT IGNORE INTO `Events` (`event`) VALUES('denied_capability'), ('denied_restriction'), ('denied_usage_limit'), ('denied_invalid_token');",
+		},
+	},
+	{
+		Version: "0.2.0-anomaly-detection",
+		Cmds: []string{
+			"ALTER TABLE `MT_Events` ADD `asn` int(10) unsigned DEFAULT NULL;",
+			"ALTER TABLE `RevokedMT_Events` ADD `asn` int(10) unsigned DEFAULT NULL;",
+			"ALTER TABLE `MTokens` ADD `anomaly_policy` varchar(16) DEFAULT NULL;",
+			"ALTER TABLE `Users` ADD `anomaly_policy` varchar(16) DEFAULT NULL;",
+			"INSERT IGNORE INTO `Events` (`event`) VALUES('anomaly_detected'), ('anomaly_policy_changed');",
+		},
+	},
+	{
+		Version: "0.2.0-email-notifications",
+		Cmds: []string{
+			"ALTER TABLE `MTokens` ADD `expires_at` datetime DEFAULT NULL;",
+			"ALTER TABLE `MTokens` ADD `expiry_notified` tinyint(1) NOT NULL DEFAULT 0;",
+			"ALTER TABLE `Users` ADD `notification_email` varchar(256) DEFAULT NULL;",
+			"CREATE TABLE IF NOT EXISTS `NotificationSubscriptions` (" +
+				"  `user_id` bigint(20) unsigned NOT NULL," +
+				"  `notification` varchar(32) NOT NULL," +
+				"  PRIMARY KEY (`user_id`,`notification`)," +
+				"  CONSTRAINT `NotificationSubscriptions_FK` FOREIGN KEY (`user_id`) REFERENCES `Users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+			"INSERT IGNORE INTO `Events` (`event`) VALUES('notification_settings_changed');",
+		},
+	},
+	{
+		Version: "0.2.0-notification-email-confirmation",
+		Cmds: []string{
+			"CREATE TABLE IF NOT EXISTS `NotificationEmailConfirmations` (" +
+				"  `user_id` bigint(20) unsigned NOT NULL," +
+				"  `email` varchar(256) NOT NULL," +
+				"  `code` varchar(128) NOT NULL," +
+				"  `expires_at` datetime NOT NULL," +
+				"  PRIMARY KEY (`user_id`)," +
+				"  UNIQUE KEY `NotificationEmailConfirmations_UN` (`code`)," +
+				"  KEY `NotificationEmailConfirmations_expires_at_IDX` (`expires_at`)," +
+				"  CONSTRAINT `NotificationEmailConfirmations_FK` FOREIGN KEY (`user_id`) REFERENCES `Users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+		},
+	},
+	{
+		Version: "0.2.0-webhooks",
+		Cmds: []string{
+			"CREATE TABLE IF NOT EXISTS `Webhooks` (" +
+				"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT," +
+				"  `user_id` bigint(20) unsigned NOT NULL," +
+				"  `url` varchar(2048) NOT NULL," +
+				"  `events` text DEFAULT NULL," +
+				"  `secret` varchar(128) DEFAULT NULL," +
+				"  `created` datetime NOT NULL DEFAULT current_timestamp()," +
+				"  PRIMARY KEY (`id`)," +
+				"  KEY `Webhooks_FK` (`user_id`)," +
+				"  CONSTRAINT `Webhooks_FK` FOREIGN KEY (`user_id`) REFERENCES `Users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+			"CREATE TABLE IF NOT EXISTS `WebhookDeliveries` (" +
+				"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT," +
+				"  `webhook_id` bigint(20) unsigned DEFAULT NULL," +
+				"  `operator_webhook` varchar(128) DEFAULT NULL," +
+				"  `payload` text NOT NULL," +
+				"  `attempts` int(10) unsigned NOT NULL DEFAULT 0," +
+				"  `next_attempt` datetime NOT NULL DEFAULT current_timestamp()," +
+				"  `last_error` varchar(256) DEFAULT NULL," +
+				"  PRIMARY KEY (`id`)," +
+				"  KEY `WebhookDeliveries_next_attempt_IDX` (`next_attempt`)," +
+				"  KEY `WebhookDeliveries_FK` (`webhook_id`)," +
+				"  CONSTRAINT `WebhookDeliveries_FK` FOREIGN KEY (`webhook_id`) REFERENCES `Webhooks` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+			"INSERT IGNORE INTO `Events` (`event`) VALUES('webhook_settings_changed');",
+		},
+	},
+	{
+		Version: "0.2.0-event-streams",
+		Cmds: []string{
+			"CREATE TABLE IF NOT EXISTS `EventStreams` (" +
+				"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT," +
+				"  `MT_id` varchar(128) NOT NULL," +
+				"  `all_of_user` bit(1) NOT NULL DEFAULT b'0'," +
+				"  `start_event_id` bigint(20) unsigned NOT NULL," +
+				"  `expires_at` datetime NOT NULL," +
+				"  PRIMARY KEY (`id`)," +
+				"  KEY `EventStreams_FK` (`MT_id`)," +
+				"  KEY `EventStreams_expires_at_IDX` (`expires_at`)," +
+				"  CONSTRAINT `EventStreams_FK` FOREIGN KEY (`MT_id`) REFERENCES `MTokens` (`id`) ON DELETE CASCADE ON UPDATE CASCADE" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+		},
+	},
+	{
+		Version: "0.2.0-polling-slow-down",
+		Cmds: []string{
+			"ALTER TABLE `TransferCodesAttributes` ADD `last_polled` datetime DEFAULT NULL;",
+			"ALTER TABLE `TransferCodesAttributes` ADD `polling_interval` int(10) unsigned DEFAULT NULL;",
+			"ALTER TABLE `TransferCodesAttributes` ADD `long_poll_until` datetime DEFAULT NULL;",
+		},
+	},
+	{
+		Version: "0.2.0-brute-force-protection",
+		Cmds: []string{
+			"CREATE TABLE IF NOT EXISTS `FailedLookups` (" +
+				"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT," +
+				"  `client` varchar(64) NOT NULL," +
+				"  `kind` varchar(32) NOT NULL," +
+				"  `time` datetime NOT NULL DEFAULT current_timestamp()," +
+				"  PRIMARY KEY (`id`)," +
+				"  KEY `FailedLookups_kind_time_IDX` (`kind`,`time`)," +
+				"  KEY `FailedLookups_client_kind_time_IDX` (`client`,`kind`,`time`)," +
+				"  KEY `FailedLookups_time_IDX` (`time`)" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+		},
+	},
+	{
+		Version: "0.2.0-suspected-guessing",
+		Cmds: []string{
+			"ALTER TABLE `FailedLookups` ADD `network` varchar(64) NOT NULL DEFAULT '' AFTER `client`;",
+			"ALTER TABLE `FailedLookups` ADD INDEX `FailedLookups_network_kind_time_IDX` (`network`,`kind`,`time`);",
+			"CREATE TABLE IF NOT EXISTS `SuspectedGuessing` (" +
+				"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT," +
+				"  `kind` varchar(32) NOT NULL," +
+				"  `scope` varchar(16) NOT NULL," +
+				"  `source` varchar(64) DEFAULT NULL," +
+				"  `failures` int(10) unsigned NOT NULL," +
+				"  `time` datetime NOT NULL DEFAULT current_timestamp()," +
+				"  PRIMARY KEY (`id`)," +
+				"  KEY `SuspectedGuessing_time_IDX` (`time`)" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+		},
+	},
+}
@@ -27,6 +27,13 @@ type AuthFlowInfoOut struct {
 	SubtokenCapabilities api.Capabilities
 	Name                 string
 	PollingCode          bool
+	RestrictionProfile   string
+	CapabilityProfile    string
+	SubtokenLimits       *api.SubtokenLimits
+	// Reauthenticate is set if the user must authenticate again at the provider
+	Reauthenticate bool
+	// IP is the ip of the client that started the flow; the macros of the restriction profile are resolved for it
+	IP string
 }
 
 type authFlowInfo struct {
@@ -36,8 +43,13 @@ type authFlowInfo struct {
 	Capabilities         api.Capabilities
 	SubtokenCapabilities api.Capabilities `db:"subtoken_capabilities"`
 	Name                 db.NullString
-	PollingCode          db.BitBool `db:"polling_code"`
-	ExpiresIn            int64      `db:"expires_in"`
+	PollingCode          db.BitBool          `db:"polling_code"`
+	ExpiresIn            int64               `db:"expires_in"`
+	RestrictionProfile   db.NullString       `db:"restriction_profile"`
+	CapabilityProfile    db.NullString       `db:"capability_profile"`
+	SubtokenLimits       *api.SubtokenLimits `db:"subtoken_limits"`
+	Reauthenticate       db.BitBool          `db:"reauthenticate"`
+	IP                   db.NullString       `db:"ip"`
 }
 
 func (i *AuthFlowInfo) toAuthFlowInfo() *authFlowInfo {
@@ -50,6 +62,11 @@ func (i *AuthFlowInfo) toAuthFlowInfo() *authFlowInfo {
 		Name:                 db.NewNullString(i.Name),
 		ExpiresIn:            config.Get().Features.Polling.PollingCodeExpiresAfter,
 		PollingCode:          i.PollingCode != nil,
+		RestrictionProfile:   db.NewNullString(i.RestrictionProfile),
+		CapabilityProfile:    db.NewNullString(i.CapabilityProfile),
+		SubtokenLimits:       i.SubtokenLimits,
+		Reauthenticate:       db.BitBool(i.Reauthenticate),
+		IP:                   db.NewNullString(i.IP),
 	}
 }
 
@@ -62,6 +79,11 @@ func (i *authFlowInfo) toAuthFlowInfo() *AuthFlowInfoOut {
 		SubtokenCapabilities: i.SubtokenCapabilities,
 		Name:                 i.Name.String,
 		PollingCode:          bool(i.PollingCode),
+		RestrictionProfile:   i.RestrictionProfile.String,
+		CapabilityProfile:    i.CapabilityProfile.String,
+		SubtokenLimits:       i.SubtokenLimits,
+		Reauthenticate:       bool(i.Reauthenticate),
+		IP:                   i.IP.String,
 	}
 }
 
@@ -75,7 +97,7 @@ func (i *AuthFlowInfo) Store(tx *sqlx.Tx) error {
 				return err
 			}
 		}
-		_, err := tx.NamedExec(`INSERT INTO AuthInfo (state_h, iss, restrictions, capabilities, subtoken_capabilities, name, expires_in, polling_code) VALUES(:state_h, :iss, :restrictions, :capabilities, :subtoken_capabilities, :name, :expires_in, :polling_code)`, store)
+		_, err := tx.NamedExec(`INSERT INTO AuthInfo (state_h, iss, restrictions, capabilities, subtoken_capabilities, name, expires_in, polling_code, restriction_profile, capability_profile, subtoken_limits, reauthenticate, ip) VALUES(:state_h, :iss, :restrictions, :capabilities, :subtoken_capabilities, :name, :expires_in, :polling_code, :restriction_profile, :capability_profile, :subtoken_limits, :reauthenticate, :ip)`, store)
 		return err
 	})
 }
@@ -84,7 +106,7 @@ func (i *AuthFlowInfo) Store(tx *sqlx.Tx) error {
 func GetAuthFlowInfoByState(state *state.State) (*AuthFlowInfoOut, error) {
 	info := authFlowInfo{}
 	if err := db.Transact(func(tx *sqlx.Tx) error {
-		return tx.Get(&info, `SELECT state_h, iss, restrictions, capabilities, subtoken_capabilities, name, polling_code FROM AuthInfo WHERE state_h=? AND expires_at >= CURRENT_TIMESTAMP()`, state)
+		return tx.Get(&info, `SELECT state_h, iss, restrictions, capabilities, subtoken_capabilities, name, polling_code, restriction_profile, capability_profile, subtoken_limits, reauthenticate, ip FROM AuthInfo WHERE state_h=? AND expires_at >= CURRENT_TIMESTAMP()`, state)
 	}); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,54 @@
+package eventrepo
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/utils/geoip"
+)
+
+// StoreDenial stores the EventDBObject as a denial event, unless maxPerMinute denial events were already stored for
+// this mytoken within the last minute. The event is stored for the mytoken if it exists, or for its tombstone if it
+// was revoked; denials for unknown mytokens are not stored. The passed denialEvents are the names of all denial events.
+func (e *EventDBObject) StoreDenial(tx *sqlx.Tx, denialEvents []string, maxPerMinute int) (stored bool, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		query, args, err := sqlx.In(`SELECT
+			(SELECT COUNT(1) FROM MT_Events me JOIN Events e ON e.id=me.event_id
+			WHERE me.MT_id=? AND e.event IN (?) AND me.time > TIMESTAMPADD(MINUTE, -1, CURRENT_TIMESTAMP()))
+			+
+			(SELECT COUNT(1) FROM RevokedMT_Events me JOIN Events e ON e.id=me.event_id
+			WHERE me.MT_id=? AND e.event IN (?) AND me.time > TIMESTAMPADD(MINUTE, -1, CURRENT_TIMESTAMP()))`,
+			e.MTID, denialEvents, e.MTID, denialEvents)
+		if err != nil {
+			return err
+		}
+		var count int
+		if err = tx.Get(&count, tx.Rebind(query), args...); err != nil {
+			return err
+		}
+		if count >= maxPerMinute {
+			return nil
+		}
+		res, err := tx.Exec(`INSERT INTO MT_Events (MT_id, event_id, comment, ip, user_agent, country, asn)
+			SELECT id, (SELECT id FROM Events WHERE event=?), ?, ?, ?, ?, ? FROM MTokens WHERE id=?`,
+			e.Event.String(), e.Event.Comment, e.ClientMetaData.IP, e.ClientMetaData.UserAgent,
+			db.NewNullString(geoip.CountryCode(e.ClientMetaData.IP)), lookupASN(e.ClientMetaData.IP), e.MTID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n > 0 {
+			stored = n > 0
+			return err
+		}
+		res, err = tx.Exec(`INSERT INTO RevokedMT_Events (MT_id, time, event_id, comment, ip, user_agent)
+			SELECT id, CURRENT_TIMESTAMP(), (SELECT id FROM Events WHERE event=?), ?, ?, ? FROM RevokedMTokens WHERE id=?`,
+			e.Event.String(), e.Event.Comment, e.ClientMetaData.IP, e.ClientMetaData.UserAgent, e.MTID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		stored = n > 0
+		return err
+	})
+	return
+}
@@ -1,9 +1,12 @@
 package eventrepo
 
 import (
+	"database/sql"
+
 	"github.com/jmoiron/sqlx"
 
 	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/utils/geoip"
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
 	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
@@ -19,8 +22,18 @@ type EventDBObject struct {
 // Store stores the EventDBObject in the database
 func (e *EventDBObject) Store(tx *sqlx.Tx) error {
 	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		_, err := tx.Exec(`INSERT INTO MT_Events (MT_id, event_id, comment, ip, user_agent) VALUES(?, (SELECT id FROM Events WHERE event=?), ?, ?, ?)`,
-			e.MTID, e.Event.String(), e.Event.Comment, e.ClientMetaData.IP, e.ClientMetaData.UserAgent)
+		_, err := tx.Exec(`INSERT INTO MT_Events (MT_id, event_id, comment, ip, user_agent, country, asn) VALUES(?, (SELECT id FROM Events WHERE event=?), ?, ?, ?, ?, ?)`,
+			e.MTID, e.Event.String(), e.Event.Comment, e.ClientMetaData.IP, e.ClientMetaData.UserAgent,
+			db.NewNullString(geoip.CountryCode(e.ClientMetaData.IP)), lookupASN(e.ClientMetaData.IP))
 		return err
 	})
 }
+
+// lookupASN returns the autonomous system number of ip, or NULL if it is not known
+func lookupASN(ip string) sql.NullInt64 {
+	asn := geoip.ASN(ip)
+	return sql.NullInt64{
+		Int64: int64(asn),
+		Valid: asn != 0,
+	}
+}
@@ -1,9 +1,14 @@
 package eventrepo
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/jmoiron/sqlx"
 
 	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/utils/pagination"
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
 	"github.com/oidc-mytoken/server/shared/utils/unixtime"
@@ -13,13 +18,144 @@ type EventHistory []EventEntry
 
 type EventEntry struct {
 	api.EventEntry `json:",inline"`
+	ID             uint64            `db:"id" json:"-"`
 	MTID           mtid.MTID         `db:"MT_id" json:"-"`
 	Time           unixtime.UnixTime `db:"time" json:"time"`
 }
 
-func GetEventHistory(tx *sqlx.Tx, id mtid.MTID) (history EventHistory, err error) {
+// EventHistoryQuery holds the filters, the sort order, and the page of an event history query; zero values do not
+// filter, and without a Limit all events are returned. Events stored before the country column was added have no
+// country and are not matched by a Country filter.
+type EventHistoryQuery struct {
+	Events     []string
+	Since      unixtime.UnixTime
+	Until      unixtime.UnixTime
+	IP         string
+	Country    string
+	Descending bool
+	After      *pagination.Cursor
+	Limit      int
+}
+
+// cursor returns the pagination.Cursor pointing to this EventEntry
+func (e EventEntry) cursor() *pagination.Cursor {
+	return &pagination.Cursor{
+		Key: strconv.FormatInt(int64(e.Time), 10),
+		ID:  strconv.FormatUint(e.ID, 10),
+	}
+}
+
+// where returns the conditions and arguments of the query in addition to the passed ones; the events are always
+// ordered by time and id
+func (q EventHistoryQuery) where(conditions []string, args []interface{}) (string, []interface{}, error) {
+	if len(q.Events) > 0 {
+		conditions = append(conditions, "e.event IN (?)")
+		args = append(args, q.Events)
+	}
+	if q.Since > 0 {
+		conditions = append(conditions, "me.time>=?")
+		args = append(args, q.Since)
+	}
+	if q.Until > 0 {
+		conditions = append(conditions, "me.time<=?")
+		args = append(args, q.Until)
+	}
+	if q.IP != "" {
+		conditions = append(conditions, "me.ip=?")
+		args = append(args, q.IP)
+	}
+	if q.Country != "" {
+		conditions = append(conditions, "me.country=?")
+		args = append(args, strings.ToUpper(q.Country))
+	}
+	if q.After != nil {
+		t, err := strconv.ParseInt(q.After.Key, 10, 64)
+		if err != nil {
+			return "", nil, pagination.ErrInvalidCursor
+		}
+		eventID, err := strconv.ParseUint(q.After.ID, 10, 64)
+		if err != nil {
+			return "", nil, pagination.ErrInvalidCursor
+		}
+		cmp := ">"
+		if q.Descending {
+			cmp = "<"
+		}
+		conditions = append(conditions, fmt.Sprintf("(me.time%s? OR (me.time=? AND me.id%s?))", cmp, cmp))
+		args = append(args, unixtime.UnixTime(t), unixtime.UnixTime(t), eventID)
+	}
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// subtreeCTE selects the ids of a mytoken and all its subtokens
+const subtreeCTE = `
+	WITH Recursive subtree
+	AS
+	(
+		SELECT id FROM MTokens WHERE id=?
+		UNION ALL
+		SELECT mt.id FROM MTokens mt INNER JOIN subtree s WHERE mt.parent_id=s.id
+	)`
+
+// GetEventHistory returns a page of the event history of the passed mytoken matching the EventHistoryQuery; if there
+// are more events, a pagination.Cursor for the next page is returned
+func GetEventHistory(tx *sqlx.Tx, id mtid.MTID, q EventHistoryQuery) (EventHistory, *pagination.Cursor, error) {
+	return q.get(tx, id, "MT_Events", false)
+}
+
+// GetRevokedEventHistory returns a page of the event history of the passed revoked mytoken, which was kept with its
+// tombstone, matching the EventHistoryQuery; if there are more events, a pagination.Cursor for the next page is
+// returned
+func GetRevokedEventHistory(tx *sqlx.Tx, id mtid.MTID, q EventHistoryQuery) (EventHistory, *pagination.Cursor, error) {
+	return q.get(tx, id, "RevokedMT_Events", false)
+}
+
+// GetSubtreeEventHistory returns a page of the combined event history of the passed mytoken and all its subtokens
+// matching the EventHistoryQuery; each event carries the management id and name of its mytoken. If there are more
+// events, a pagination.Cursor for the next page is returned.
+func GetSubtreeEventHistory(tx *sqlx.Tx, id mtid.MTID, q EventHistoryQuery) (EventHistory, *pagination.Cursor, error) {
+	return q.get(tx, id, "MT_Events", true)
+}
+
+func (q EventHistoryQuery) get(tx *sqlx.Tx, id mtid.MTID, table string, subtree bool) (history EventHistory, next *pagination.Cursor, err error) {
+	with := ""
+	columns := "me.id, me.MT_id, e.event, me.time, me.comment, me.ip, me.user_agent, COALESCE(me.country, '') AS country"
+	join := "JOIN Events e ON e.id=me.event_id"
+	conditions := []string{"me.MT_id=?"}
+	if subtree {
+		with = subtreeCTE
+		columns += ", t.management_id, COALESCE(t.name, '') AS token_name"
+		join += " JOIN MTokens t ON t.id=me.MT_id"
+		conditions = []string{"me.MT_id IN (SELECT id FROM subtree)"}
+	}
+	where, args, err := q.where(conditions, []interface{}{id})
+	if err != nil {
+		return nil, nil, err
+	}
+	order := "ASC"
+	if q.Descending {
+		order = "DESC"
+	}
+	query := fmt.Sprintf(`%s SELECT %s FROM %s me %s WHERE %s ORDER BY me.time %s, me.id %s`,
+		with, columns, table, join, where, order, order)
+	if q.Limit > 0 {
+		// one more event than requested is selected to know if there is a next page
+		query += " LIMIT ?"
+		args = append(args, q.Limit+1)
+	}
 	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		return tx.Select(&history, `SELECT MT_id, event, time, comment, ip, user_agent FROM EventHistory WHERE MT_id=?`, id)
+		query, args, err := sqlx.In(query, args...)
+		if err != nil {
+			return err
+		}
+		return tx.Select(&history, tx.Rebind(query), args...)
 	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if q.Limit > 0 && len(history) > q.Limit {
+		history = history[:q.Limit]
+		next = history[len(history)-1].cursor()
+	}
 	return
 }
@@ -0,0 +1,100 @@
+package eventrepo
+
+import (
+	"testing"
+
+	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/db/dbtest"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+func logTestEvent(t *testing.T, id mtid.MTID) {
+	e := EventDBObject{
+		Event:          event.FromNumber(event.MTEventTokenInfoIntrospect, ""),
+		MTID:           id,
+		ClientMetaData: api.ClientMetaData{IP: "127.0.0.1"},
+	}
+	if err := e.Store(nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestGetSubtreeEventHistory checks that the history of a subtree contains the events of all mytokens in the subtree
+// labelled with their management id.
+func TestGetSubtreeEventHistory(t *testing.T) {
+	dbtest.Connect(t)
+	id := dbtest.CreateMytoken(t)
+	child := dbtest.CreateSubtoken(t, id)
+	grandchild := dbtest.CreateSubtoken(t, child)
+	for _, tid := range []mtid.MTID{id, child, grandchild} {
+		logTestEvent(t, tid)
+	}
+
+	q := EventHistoryQuery{Limit: 2}
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		history, next, err := GetSubtreeEventHistory(nil, child, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range history {
+			seen[e.ManagementID] = true
+		}
+		if next == nil {
+			break
+		}
+		q.After = next
+	}
+	if len(seen) != 2 || !seen[child.ManagementID()] || !seen[grandchild.ManagementID()] {
+		t.Errorf("Expected events of the child and grandchild, but got events of '%v'", seen)
+	}
+}
+
+// TestGetRevokedEventHistory checks that the history of a revoked mytoken is kept with its tombstone.
+func TestGetRevokedEventHistory(t *testing.T) {
+	dbtest.Connect(t)
+	id := dbtest.CreateMytoken(t)
+	logTestEvent(t, id)
+	if err := dbhelper.RevokeMT(nil, id, false, dbhelper.Revocation{Reason: dbhelper.RevocationReasonRevoked}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, _, err := GetRevokedEventHistory(nil, id, EventHistoryQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Event != event.AllEvents[event.MTEventTokenInfoIntrospect] {
+		t.Errorf("Expected the introspect event, but got '%+v'", history)
+	}
+	if history, _, err = GetEventHistory(nil, id, EventHistoryQuery{Limit: 10}); err != nil || len(history) != 0 {
+		t.Errorf("Expected no events of the revoked mytoken, but got '%+v' (error: %v)", history, err)
+	}
+}
+
+// TestStoreDenialRateLimit checks that no more than the allowed number of denial events are stored per minute.
+func TestStoreDenialRateLimit(t *testing.T) {
+	dbtest.Connect(t)
+	id := dbtest.CreateMytoken(t)
+	denialEvents := []string{event.AllEvents[event.MTEventDeniedUsageLimit]}
+
+	stored := 0
+	for i := 0; i < 5; i++ {
+		e := EventDBObject{
+			Event:          event.FromNumber(event.MTEventDeniedUsageLimit, "no usages left"),
+			MTID:           id,
+			ClientMetaData: api.ClientMetaData{IP: "127.0.0.1"},
+		}
+		ok, err := e.StoreDenial(nil, denialEvents, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			stored++
+		}
+	}
+	if stored != 3 {
+		t.Errorf("Expected 3 stored denial events, but got %d", stored)
+	}
+}
@@ -0,0 +1,80 @@
+package eventrepo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+// GetLastEventID returns the id of the most recent event of all mytokens
+func GetLastEventID(tx *sqlx.Tx) (id uint64, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		return tx.Get(&id, `SELECT COALESCE(MAX(id), 0) FROM MT_Events`)
+	})
+	return
+}
+
+// CreateEventStream stores a new event stream of the passed mytoken that starts after the event startEventID and can be
+// resumed for lifetime seconds; it returns the id of the stream
+func CreateEventStream(tx *sqlx.Tx, id mtid.MTID, allOfUser bool, startEventID uint64, lifetime int) (streamID uint64, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		res, err := tx.Exec(`INSERT INTO EventStreams (MT_id, all_of_user, start_event_id, expires_at) VALUES(?, ?, ?, TIMESTAMPADD(SECOND, ?, CURRENT_TIMESTAMP()))`,
+			id, allOfUser, startEventID, lifetime)
+		if err != nil {
+			return err
+		}
+		lastID, err := res.LastInsertId()
+		streamID = uint64(lastID)
+		return err
+	})
+	return
+}
+
+// ResumeEventStream returns the id of the event after which the passed event stream started and extends the time the
+// stream can be resumed to lifetime seconds. found is false if there is no such unexpired stream of the passed
+// mytoken with the same scope.
+func ResumeEventStream(tx *sqlx.Tx, streamID uint64, id mtid.MTID, allOfUser bool, lifetime int) (startEventID uint64, found bool, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		if err := tx.Get(&startEventID, `SELECT start_event_id FROM EventStreams WHERE id=? AND MT_id=? AND all_of_user=? AND expires_at > CURRENT_TIMESTAMP()`,
+			streamID, id, allOfUser); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+		found = true
+		_, err := tx.Exec(`UPDATE EventStreams SET expires_at=TIMESTAMPADD(SECOND, ?, CURRENT_TIMESTAMP()) WHERE id=?`, lifetime, streamID)
+		return err
+	})
+	return
+}
+
+// DeleteExpiredEventStreams deletes the event streams that can no longer be resumed
+func DeleteExpiredEventStreams(tx *sqlx.Tx) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`DELETE FROM EventStreams WHERE expires_at <= CURRENT_TIMESTAMP()`)
+		return err
+	})
+}
+
+// GetEventsAfter returns up to limit events with an id greater than afterID, ordered by id. The events are those of
+// the passed mytoken or, if allOfUser is set, of all mytokens of its user; each event carries the management id and
+// name of its mytoken.
+func GetEventsAfter(tx *sqlx.Tx, id mtid.MTID, allOfUser bool, afterID uint64, limit int) (events EventHistory, err error) {
+	condition := "me.MT_id=?"
+	if allOfUser {
+		condition = "t.user_id=(SELECT user_id FROM MTokens WHERE id=?)"
+	}
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		return tx.Select(&events, fmt.Sprintf(`SELECT me.id, me.MT_id, e.event, me.time, me.comment, me.ip, me.user_agent,
+			COALESCE(me.country, '') AS country, t.management_id, COALESCE(t.name, '') AS token_name
+			FROM MT_Events me JOIN Events e ON e.id=me.event_id JOIN MTokens t ON t.id=me.MT_id
+			WHERE %s AND me.id>? ORDER BY me.id LIMIT ?`, condition), id, afterID, limit)
+	})
+	return
+}
@@ -0,0 +1,38 @@
+package eventrepo
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/db/dbtest"
+)
+
+// TestResumeEventStream checks that an event stream can only be resumed by its mytoken with the same scope.
+func TestResumeEventStream(t *testing.T) {
+	dbtest.Connect(t)
+	id := dbtest.CreateMytoken(t)
+	other := dbtest.CreateMytoken(t)
+	streamID, err := CreateEventStream(nil, id, false, 42, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, found, err := ResumeEventStream(nil, streamID, id, false, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || start != 42 {
+		t.Errorf("Expected the stream to start after event 42, got found=%v, start=%d", found, start)
+	}
+	if _, found, err = ResumeEventStream(nil, streamID, id, true, 3600); err != nil || found {
+		t.Errorf("Expected the stream not to be resumed with all=true, got found=%v, err=%v", found, err)
+	}
+	if _, found, err = ResumeEventStream(nil, streamID, other, false, 3600); err != nil || found {
+		t.Errorf("Expected the stream not to be resumed by another mytoken, got found=%v, err=%v", found, err)
+	}
+	expired, err := CreateEventStream(nil, id, false, 42, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err = ResumeEventStream(nil, expired, id, false, 3600); err != nil || found {
+		t.Errorf("Expected an expired stream not to be resumed, got found=%v, err=%v", found, err)
+	}
+}
@@ -0,0 +1,68 @@
+package eventrepo
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+// UsageBaseline summarizes the previous usages of a mytoken in comparison to a new usage; it is the baseline for the
+// anomaly detection
+type UsageBaseline struct {
+	// Events is the number of previous events
+	Events int `db:"events"`
+	// WithCountry and SameCountry are the numbers of previous events with a known country and with the country of the
+	// new usage
+	WithCountry int `db:"with_country"`
+	SameCountry int `db:"same_country"`
+	// WithASN and SameASN are the numbers of previous events with a known asn and with the asn of the new usage
+	WithASN int `db:"with_asn"`
+	SameASN int `db:"same_asn"`
+	// UserAgents are the distinct user agents of the previous events
+	UserAgents []string `db:"-"`
+	// LastIP is the ip of the most recent event and LastSecondsAgo how long ago it happened
+	LastIP         string `db:"last_ip"`
+	LastSecondsAgo int64  `db:"last_seconds_ago"`
+}
+
+// GetUsageBaseline returns the UsageBaseline of a mytoken for a new usage with the passed country and asn; the
+// baseline consists of at most maxEvents of the most recent events, events with one of the passed ignoredEvents are not
+// taken into account
+func GetUsageBaseline(tx *sqlx.Tx, id mtid.MTID, country string, asn uint, maxEvents int, ignoredEvents []string) (b UsageBaseline, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		recent, args, err := sqlx.In(`SELECT me.country, me.asn, me.user_agent
+			FROM MT_Events me JOIN Events e ON e.id=me.event_id
+			WHERE me.MT_id=? AND e.event NOT IN (?)
+			ORDER BY me.id DESC LIMIT ?`,
+			id, ignoredEvents, maxEvents)
+		if err != nil {
+			return err
+		}
+		if err = tx.Get(&b, tx.Rebind(`SELECT
+			COUNT(1) AS events,
+			COUNT(r.country) AS with_country,
+			COALESCE(SUM(r.country=?), 0) AS same_country,
+			COUNT(r.asn) AS with_asn,
+			COALESCE(SUM(r.asn=?), 0) AS same_asn
+			FROM (`+recent+`) r`), append([]interface{}{country, asn}, args...)...); err != nil {
+			return err
+		}
+		if b.Events == 0 {
+			return nil
+		}
+		if err = tx.Select(&b.UserAgents, tx.Rebind(`SELECT DISTINCT r.user_agent FROM (`+recent+`) r WHERE r.user_agent<>''`), args...); err != nil {
+			return err
+		}
+		query, args, err := sqlx.In(`SELECT me.ip AS last_ip, TIMESTAMPDIFF(SECOND, me.time, CURRENT_TIMESTAMP()) AS last_seconds_ago
+			FROM MT_Events me JOIN Events e ON e.id=me.event_id
+			WHERE me.MT_id=? AND e.event NOT IN (?)
+			ORDER BY me.time DESC, me.id DESC LIMIT 1`,
+			id, ignoredEvents)
+		if err != nil {
+			return err
+		}
+		return tx.Get(&b, tx.Rebind(query), args...)
+	})
+	return
+}
@@ -0,0 +1,44 @@
+package failedlookuprepo
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+)
+
+// Add stores a failed lookup of the passed kind by client, which is part of network
+func Add(tx *sqlx.Tx, kind, client, network string) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`INSERT INTO FailedLookups (client, network, kind) VALUES(?, ?, ?)`, client, network, kind)
+		return err
+	})
+}
+
+// Counts holds the number of failed lookups of one kind within the window by a client, by the client's network, and
+// by all clients
+type Counts struct {
+	ByClient  int `db:"by_client"`
+	ByNetwork int `db:"by_network"`
+	Total     int `db:"total"`
+}
+
+// Count returns the number of failed lookups of the passed kind within the last window seconds by client, by network,
+// and by all clients
+func Count(tx *sqlx.Tx, kind, client, network string, window int) (counts Counts, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		return tx.Get(&counts, `SELECT
+			(SELECT COUNT(1) FROM FailedLookups WHERE client=? AND kind=? AND time > TIMESTAMPADD(SECOND, -?, CURRENT_TIMESTAMP())) AS by_client,
+			(SELECT COUNT(1) FROM FailedLookups WHERE network=? AND kind=? AND time > TIMESTAMPADD(SECOND, -?, CURRENT_TIMESTAMP())) AS by_network,
+			(SELECT COUNT(1) FROM FailedLookups WHERE kind=? AND time > TIMESTAMPADD(SECOND, -?, CURRENT_TIMESTAMP())) AS total`,
+			client, kind, window, network, kind, window, kind, window)
+	})
+	return
+}
+
+// DeleteExpired deletes the failed lookups older than window seconds, since they are no longer counted
+func DeleteExpired(tx *sqlx.Tx, window int) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`DELETE FROM FailedLookups WHERE time <= TIMESTAMPADD(SECOND, -?, CURRENT_TIMESTAMP())`, window)
+		return err
+	})
+}
@@ -0,0 +1,25 @@
+package failedlookuprepo
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+)
+
+// Scopes of suspected guessing
+const (
+	ScopeClient  = "client"
+	ScopeNetwork = "network"
+	ScopeGlobal  = "global"
+)
+
+// AddSuspectedGuessing stores a record of suspected guessing, i.e. that a client, a network, or all clients together
+// reached a threshold of failed lookups of the passed kind; source is the client or network and empty for the global
+// scope
+func AddSuspectedGuessing(tx *sqlx.Tx, kind, scope, source string, failures int) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`INSERT INTO SuspectedGuessing (kind, scope, source, failures) VALUES(?, ?, ?, ?)`,
+			kind, scope, db.NewNullString(source), failures)
+		return err
+	})
+}
@@ -90,14 +90,24 @@ func (ste *MytokenEntry) Root() bool {
 // Store stores the MytokenEntry in the database
 func (ste *MytokenEntry) Store(tx *sqlx.Tx, comment string) error {
 	steStore := mytokenEntryStore{
-		ID:       ste.ID,
-		SeqNo:    ste.SeqNo,
-		ParentID: ste.ParentID,
-		RootID:   ste.RootID,
-		Name:     db.NewNullString(ste.Name),
-		IP:       ste.IP,
-		Iss:      ste.Token.OIDCIssuer,
-		Sub:      ste.Token.OIDCSubject,
+		ID:           ste.ID,
+		SeqNo:        ste.SeqNo,
+		ParentID:     ste.ParentID,
+		RootID:       ste.RootID,
+		Name:         db.NewNullString(ste.Name),
+		IP:           ste.IP,
+		Iss:          ste.Token.OIDCIssuer,
+		Sub:          ste.Token.OIDCSubject,
+		ManagementID: ste.ID.ManagementID(),
+	}
+	if ste.Token.ExpiresAt != 0 {
+		exp := int64(ste.Token.ExpiresAt)
+		steStore.ExpiresAt = &exp
+	}
+	if l := ste.Token.SubtokenLimits; l != nil {
+		steStore.MaxDepth = l.MaxDepth
+		steStore.MaxChildren = l.MaxChildren
+		steStore.MaxDescendants = l.MaxDescendants
 	}
 	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
 		if ste.rtID == nil {
@@ -146,12 +156,17 @@ type mytokenEntryStore struct {
 	IP             string `db:"ip_created"`
 	Iss            string
 	Sub            string
+	MaxDepth       *uint64 `db:"max_depth"`
+	MaxChildren    *uint64 `db:"max_children"`
+	MaxDescendants *uint64 `db:"max_descendants"`
+	ManagementID   string  `db:"management_id"`
+	ExpiresAt      *int64  `db:"expires_at"`
 }
 
 // Store stores the mytokenEntryStore in the database; if this is the first token for this user, the user is also added to the db
 func (e *mytokenEntryStore) Store(tx *sqlx.Tx) error {
 	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		stmt, err := tx.PrepareNamed(`INSERT INTO MTokens (id, seqno, parent_id, root_id, rt_id, name, ip_created, user_id) VALUES(:id, :seqno, :parent_id, :root_id, :rt_id, :name, :ip_created, (SELECT id FROM Users WHERE iss=:iss AND sub=:sub))`)
+		stmt, err := tx.PrepareNamed(`INSERT INTO MTokens (id, seqno, parent_id, root_id, rt_id, name, ip_created, max_depth, max_children, max_descendants, management_id, expires_at, user_id) VALUES(:id, :seqno, :parent_id, :root_id, :rt_id, :name, :ip_created, :max_depth, :max_children, :max_descendants, :management_id, FROM_UNIXTIME(:expires_at), (SELECT id FROM Users WHERE iss=:iss AND sub=:sub))`)
 		if err != nil {
 			return err
 		}
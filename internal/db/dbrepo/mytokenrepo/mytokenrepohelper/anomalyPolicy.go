@@ -0,0 +1,42 @@
+package mytokenrepohelper
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+// GetAnomalyPolicies returns the anomaly policies set for the passed mytoken and for its user; an empty string means
+// that no policy is set on that level
+func GetAnomalyPolicies(tx *sqlx.Tx, id mtid.MTID) (tokenPolicy, userPolicy string, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		var res struct {
+			Token db.NullString `db:"token_policy"`
+			User  db.NullString `db:"user_policy"`
+		}
+		if err := tx.Get(&res, `SELECT m.anomaly_policy AS token_policy, u.anomaly_policy AS user_policy FROM MTokens m JOIN Users u ON u.id=m.user_id WHERE m.id=?`, id); err != nil {
+			return err
+		}
+		tokenPolicy, userPolicy = res.Token.String, res.User.String
+		return nil
+	})
+	return
+}
+
+// SetMTAnomalyPolicy sets the anomaly policy of the passed mytoken; an empty policy removes it
+func SetMTAnomalyPolicy(tx *sqlx.Tx, id mtid.MTID, policy string) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`UPDATE MTokens SET anomaly_policy=? WHERE id=?`, db.NewNullString(policy), id)
+		return err
+	})
+}
+
+// SetUserAnomalyPolicy sets the anomaly policy for all mytokens of the user of the passed mytoken; an empty policy
+// removes it
+func SetUserAnomalyPolicy(tx *sqlx.Tx, id mtid.MTID, policy string) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`UPDATE Users SET anomaly_policy=? WHERE id=(SELECT user_id FROM MTokens WHERE id=?)`, db.NewNullString(policy), id)
+		return err
+	})
+}
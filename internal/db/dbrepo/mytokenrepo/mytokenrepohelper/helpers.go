@@ -7,9 +7,9 @@ import (
 	"github.com/jmoiron/sqlx"
 
 	"github.com/oidc-mytoken/server/internal/db"
-	"github.com/oidc-mytoken/server/internal/utils/hashUtils"
 	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
 	"github.com/oidc-mytoken/server/shared/mytoken/rotation"
+	"github.com/oidc-mytoken/server/shared/utils/unixtime"
 )
 
 func ParseError(err error) (bool, error) {
@@ -41,37 +41,78 @@ func GetMTRootID(id mtid.MTID) (mtid.MTID, bool, error) {
 	return rootID, found, err
 }
 
-// recursiveRevokeMT revokes the passed mytoken as well as all children
-func recursiveRevokeMT(tx *sqlx.Tx, id mtid.MTID) error {
-	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		_, err := tx.Exec(`
-			DELETE FROM MTokens WHERE id=ANY(
+// GetMTIDByManagementID returns the id of the mytoken with the passed management id, if it belongs to the same user
+// as the mytoken with the passed id
+func GetMTIDByManagementID(tx *sqlx.Tx, managementID string, sameUserAs mtid.MTID) (mtid.MTID, bool, error) {
+	var id mtid.MTID
+	found, err := ParseError(db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		return tx.Get(&id, `SELECT id FROM MTokens WHERE management_id=? AND user_id=(SELECT user_id FROM MTokens WHERE id=?)`, managementID, sameUserAs)
+	}))
+	return id, found, err
+}
+
+// getSubtreeIDs returns the ids of all descendants of the passed mytoken
+func getSubtreeIDs(tx *sqlx.Tx, id mtid.MTID) (children []string, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		return tx.Select(&children, `
 			WITH Recursive childs
 			AS
 			(
-				SELECT id, parent_id FROM MTokens WHERE id=?
+				SELECT id, parent_id FROM MTokens WHERE parent_id=?
 				UNION ALL
 				SELECT mt.id, mt.parent_id FROM MTokens mt INNER JOIN childs c WHERE mt.parent_id=c.id
 			)
 			SELECT id
-			FROM   childs
-			)`, id)
-		return err
+			FROM   childs`, id)
 	})
+	return
 }
 
-// CheckTokenRevoked checks if a Mytoken has been revoked.
-func CheckTokenRevoked(tx *sqlx.Tx, id mtid.MTID, seqno uint64, rot *rotation.Rotation) (bool, error) {
+// recursiveRevokeMT revokes the passed mytoken as well as all children
+func recursiveRevokeMT(tx *sqlx.Tx, id mtid.MTID, rev Revocation) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		children, err := getSubtreeIDs(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := storeTombstones(tx, children, RevocationReasonParentRevoked, rev); err != nil {
+			return err
+		}
+		if err := storeTombstones(tx, []string{id.Hash()}, rev.Reason, rev); err != nil {
+			return err
+		}
+		return deleteMTs(tx, append(children, id.Hash()))
+	})
+}
+
+// CheckTokenRevoked checks if a Mytoken has been revoked or is suspended. If it is not valid, a description of the
+// reason (e.g. whether it was revoked, is suspended, or is unknown) is returned.
+func CheckTokenRevoked(tx *sqlx.Tx, id mtid.MTID, seqno uint64, rot *rotation.Rotation) (revoked bool, reason string, err error) {
 	if rot != nil && rot.Lifetime > 0 {
-		return checkRotatingTokenRevoked(tx, id, seqno, rot.Lifetime)
+		revoked, err = checkRotatingTokenRevoked(tx, id, seqno, rot.Lifetime)
+	} else {
+		revoked, err = checkTokenRevoked(tx, id, seqno)
+	}
+	if err != nil || !revoked {
+		return
 	}
-	return checkTokenRevoked(tx, id, seqno)
+	reason, err = getInvalidReason(tx, id)
+	return
+}
+
+// SetMissingExpiresAt stores the expiration time of a Mytoken that was created before expires_at was recorded; the
+// time can only be taken from the token itself, so it is set when the token is used
+func SetMissingExpiresAt(tx *sqlx.Tx, id mtid.MTID, expiresAt unixtime.UnixTime) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`UPDATE MTokens SET expires_at=? WHERE id=? AND expires_at IS NULL`, expiresAt, id)
+		return err
+	})
 }
 
 func checkTokenRevoked(tx *sqlx.Tx, id mtid.MTID, seqno uint64) (bool, error) {
 	var count int
 	if err := db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		return tx.Get(&count, `SELECT COUNT(1) FROM MTokens WHERE id=? AND seqno=?`, id, seqno)
+		return tx.Get(&count, `SELECT COUNT(1) FROM MTokens WHERE id=? AND seqno=? AND suspended_by IS NULL`, id, seqno)
 	}); err != nil {
 		return true, err
 	}
@@ -84,7 +125,7 @@ func checkTokenRevoked(tx *sqlx.Tx, id mtid.MTID, seqno uint64) (bool, error) {
 func checkRotatingTokenRevoked(tx *sqlx.Tx, id mtid.MTID, seqno, rotationLifetime uint64) (bool, error) {
 	var count int
 	if err := db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		return tx.Get(&count, `SELECT COUNT(1) FROM MTokens WHERE id=? AND seqno=? AND TIMESTAMPADD(SECOND, ?, last_rotated) >= CURRENT_TIMESTAMP()`, id, seqno, rotationLifetime)
+		return tx.Get(&count, `SELECT COUNT(1) FROM MTokens WHERE id=? AND seqno=? AND suspended_by IS NULL AND TIMESTAMPADD(SECOND, ?, last_rotated) >= CURRENT_TIMESTAMP()`, id, seqno, rotationLifetime)
 	}); err != nil {
 		return true, err
 	}
@@ -95,68 +136,25 @@ func checkRotatingTokenRevoked(tx *sqlx.Tx, id mtid.MTID, seqno, rotationLifetim
 }
 
 // revokeMT revokes the passed mytoken but no children
-func revokeMT(tx *sqlx.Tx, id mtid.MTID) error {
+func revokeMT(tx *sqlx.Tx, id mtid.MTID, rev Revocation) error {
 	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		_, err := tx.Exec(`DELETE FROM MTokens WHERE id=?`, id)
-		return err
+		ids := []string{id.Hash()}
+		if err := storeTombstones(tx, ids, rev.Reason, rev); err != nil {
+			return err
+		}
+		if err := handOverSuspension(tx, id); err != nil {
+			return err
+		}
+		return deleteMTs(tx, ids)
 	})
 }
 
-// RevokeMT revokes the passed mytoken and depending on the recursive parameter also its children
-func RevokeMT(tx *sqlx.Tx, id mtid.MTID, recursive bool) error {
+// RevokeMT revokes the passed mytoken and depending on the recursive parameter also its children; tombstones are
+// kept for all revoked mytokens
+func RevokeMT(tx *sqlx.Tx, id mtid.MTID, recursive bool, rev Revocation) error {
 	if recursive {
-		return recursiveRevokeMT(tx, id)
+		return recursiveRevokeMT(tx, id, rev)
 	} else {
-		return revokeMT(tx, id)
+		return revokeMT(tx, id, rev)
 	}
 }
-
-// GetTokenUsagesAT returns how often a Mytoken was used with a specific restriction to obtain an access token
-func GetTokenUsagesAT(tx *sqlx.Tx, myID mtid.MTID, restrictionHash string) (usages *int64, err error) {
-	var usageCount int64
-	if err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		return tx.Get(&usageCount, `SELECT usages_AT FROM TokenUsages WHERE restriction_hash=? AND MT_id=?`, restrictionHash, myID)
-	}); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			// No usage entry -> was not used before -> usages=nil
-			err = nil // This is fine
-			return
-		}
-		return
-	}
-	usages = &usageCount
-	return
-}
-
-// GetTokenUsagesOther returns how often a Mytoken was used with a specific restriction to do something else than obtaining an access token
-func GetTokenUsagesOther(tx *sqlx.Tx, myID mtid.MTID, restrictionHash string) (usages *int64, err error) {
-	var usageCount int64
-	if err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		return tx.Get(&usageCount, `SELECT usages_other FROM TokenUsages WHERE restriction_hash=? AND MT_id=?`, restrictionHash, myID)
-	}); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			// No usage entry -> was not used before -> usages=nil
-			err = nil // This is fine
-			return
-		}
-		return
-	}
-	usages = &usageCount
-	return
-}
-
-// IncreaseTokenUsageAT increases the usage count for obtaining ATs with a Mytoken and the given restriction
-func IncreaseTokenUsageAT(tx *sqlx.Tx, myID mtid.MTID, jsonRestriction []byte) error {
-	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		_, err := tx.Exec(`INSERT INTO TokenUsages (MT_id, restriction, restriction_hash, usages_AT) VALUES (?, ?, ?, 1) ON DUPLICATE KEY UPDATE usages_AT = usages_AT + 1`, myID, jsonRestriction, hashUtils.SHA512Str(jsonRestriction))
-		return err
-	})
-}
-
-// IncreaseTokenUsageOther increases the usage count for other usages with a Mytoken and the given restriction
-func IncreaseTokenUsageOther(tx *sqlx.Tx, myID mtid.MTID, jsonRestriction []byte) error {
-	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		_, err := tx.Exec(`INSERT INTO TokenUsages (MT_id, restriction, restriction_hash, usages_other) VALUES (?, ?, ?, 1) ON DUPLICATE KEY UPDATE usages_other = usages_other + 1`, myID, jsonRestriction, hashUtils.SHA512Str(jsonRestriction))
-		return err
-	})
-}
@@ -0,0 +1,263 @@
+package mytokenrepohelper
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/db/dbtest"
+	"github.com/oidc-mytoken/server/internal/utils/hashUtils"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+func TestConsumeTokenUsageNoUsagesLeft(t *testing.T) {
+	limit := int64(0)
+	// Must not touch the database, since no usage can be reserved
+	reserved, err := ConsumeTokenUsageAT(nil, mtid.MTID{}, []byte(`{}`), &limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reserved {
+		t.Error("reserved a usage although no usages are left")
+	}
+}
+
+func TestReserveQuery(t *testing.T) {
+	// The limit must be checked in the update itself, so that concurrent requests cannot exceed it
+	limited := usageColumnsAT.reserveQuery(true)
+	if !strings.HasSuffix(limited, "WHERE MT_id=? AND restriction_hash=? AND usages_AT + descendant_usages_AT < ?") {
+		t.Errorf("Limited reservation does not check the limit: %s", limited)
+	}
+	unlimited := usageColumnsOther.reserveQuery(false)
+	if !strings.HasPrefix(unlimited, "UPDATE TokenUsages SET usages_other = usages_other + 1") || strings.Contains(unlimited, "<") {
+		t.Errorf("Unexpected unlimited reservation: %s", unlimited)
+	}
+}
+
+func TestReserveAncestorQuery(t *testing.T) {
+	q := usageColumnsAT.reserveAncestorQuery()
+	if !strings.HasPrefix(q, "UPDATE TokenUsages SET descendant_usages_AT = descendant_usages_AT + 1") {
+		t.Errorf("Ancestor reservation does not count as descendant usage: %s", q)
+	}
+	if !strings.Contains(q, "usages_AT + descendant_usages_AT < JSON_VALUE(restriction, ?)") {
+		t.Errorf("Ancestor reservation does not check the shared limit: %s", q)
+	}
+}
+
+// TestConsumeTokenUsageATConcurrent checks that concurrent requests cannot exceed the usage limit.
+func TestConsumeTokenUsageATConcurrent(t *testing.T) {
+	dbtest.Connect(t)
+	id := dbtest.CreateMytoken(t)
+
+	const requests = 50
+	limit := int64(5)
+	restriction := []byte(`{"usages_AT":5}`)
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	reservedCount := 0
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reserved, err := ConsumeTokenUsageAT(nil, id, restriction, &limit)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if reserved {
+				mutex.Lock()
+				reservedCount++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if reservedCount != int(limit) {
+		t.Errorf("Expected %d reserved usages, but got %d", limit, reservedCount)
+	}
+}
+
+// TestConsumeTokenUsageATSharedBudget checks that the usages of a subtoken count against the usage limit of the
+// linked parent restriction.
+func TestConsumeTokenUsageATSharedBudget(t *testing.T) {
+	dbtest.Connect(t)
+	parent := dbtest.CreateMytoken(t)
+	child := dbtest.CreateSubtoken(t, parent)
+	parentRestriction := []byte(`{"usages_AT":3}`)
+	childRestriction := []byte(`{"scope":"openid","usages_AT":3}`)
+	if err := LinkTokenUsageBudget(nil, child, childRestriction, parent, parentRestriction); err != nil {
+		t.Fatal(err)
+	}
+	limit := int64(3)
+	for i := 0; i < 2; i++ {
+		if reserved, err := ConsumeTokenUsageAT(nil, child, childRestriction, &limit); err != nil {
+			t.Fatal(err)
+		} else if !reserved {
+			t.Fatalf("usage %d of child not reserved", i)
+		}
+	}
+	if reserved, err := ConsumeTokenUsageAT(nil, parent, parentRestriction, &limit); err != nil {
+		t.Fatal(err)
+	} else if !reserved {
+		t.Fatal("usage of parent not reserved")
+	}
+	// the parent's budget is exhausted, although the child did only use 2 of its 3 usages
+	if reserved, err := ConsumeTokenUsageAT(nil, child, childRestriction, &limit); err != nil {
+		t.Fatal(err)
+	} else if reserved {
+		t.Error("reserved a usage of the child although the parent's budget is exhausted")
+	}
+	usages, err := GetTokenUsages(nil, parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := usages[hashUtils.SHA512Str(parentRestriction)]
+	if u.UsagesAT != 1 || u.DescendantUsagesAT != 2 {
+		t.Errorf("Expected 1 own and 2 descendant usages, but got %d and %d", u.UsagesAT, u.DescendantUsagesAT)
+	}
+}
+
+// TestGetMTIDByManagementID checks that a mytoken can only be looked up by its management id for the same user.
+func TestGetMTIDByManagementID(t *testing.T) {
+	dbtest.Connect(t)
+	id := dbtest.CreateMytoken(t)
+	other := dbtest.CreateMytoken(t)
+
+	found, ok, err := GetMTIDByManagementID(nil, id.ManagementID(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || found.Hash() != id.Hash() {
+		t.Errorf("Expected to find mytoken '%s', but got '%s'", id.Hash(), found.Hash())
+	}
+	if _, ok, err = GetMTIDByManagementID(nil, other.ManagementID(), id); err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("Found mytoken of another user")
+	}
+}
+
+// TestRevokeAllOfUser checks that only the mytokens of the user are revoked.
+func TestRevokeAllOfUser(t *testing.T) {
+	dbtest.Connect(t)
+	id := dbtest.CreateMytoken(t)
+	other := dbtest.CreateMytoken(t)
+
+	revoked, err := RevokeAllOfUser(nil, id, Revocation{Reason: RevocationReasonRevokeAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revoked.ManagementIDs) != 1 || revoked.ManagementIDs[0] != id.ManagementID() {
+		t.Errorf("Expected only '%s' to be revoked, but got '%v'", id.ManagementID(), revoked.ManagementIDs)
+	}
+	if len(revoked.RTIDs) != 1 {
+		t.Errorf("Expected one refresh token, but got '%v'", revoked.RTIDs)
+	}
+	if _, found, err := GetMTIDByManagementID(nil, id.ManagementID(), id); err != nil || found {
+		t.Errorf("Revoked mytoken still found (error: %v)", err)
+	}
+	if _, found, err := GetMTIDByManagementID(nil, other.ManagementID(), other); err != nil || !found {
+		t.Errorf("Mytoken of another user was revoked (error: %v)", err)
+	}
+}
+
+// TestRevokeMTTombstone checks that a revoked mytoken leaves a tombstone that is reported by CheckTokenRevoked.
+func TestRevokeMTTombstone(t *testing.T) {
+	dbtest.Connect(t)
+	id := dbtest.CreateMytoken(t)
+	child := dbtest.CreateSubtoken(t, id)
+
+	if err := RevokeMT(nil, id, true, Revocation{Reason: RevocationReasonRevoked, IP: "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		id     mtid.MTID
+		reason string
+	}{
+		{id, RevocationReasonRevoked},
+		{child, RevocationReasonParentRevoked},
+	} {
+		revoked, reason, err := CheckTokenRevoked(nil, tc.id, 1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !revoked {
+			t.Errorf("Mytoken '%s' not revoked", tc.id.Hash())
+		}
+		if !strings.Contains(reason, tc.reason) {
+			t.Errorf("Expected reason to contain '%s', but got '%s'", tc.reason, reason)
+		}
+	}
+	_, reason, err := CheckTokenRevoked(nil, mtid.New(), 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason != "unknown token" {
+		t.Errorf("Expected 'unknown token', but got '%s'", reason)
+	}
+}
+
+// TestSuspendResumeMT checks that a suspension is propagated to the children and can only be lifted for the mytoken
+// that was suspended.
+func TestSuspendResumeMT(t *testing.T) {
+	dbtest.Connect(t)
+	id := dbtest.CreateMytoken(t)
+	child := dbtest.CreateSubtoken(t, id)
+
+	if err := SuspendMT(nil, id); err != nil {
+		t.Fatal(err)
+	}
+	for _, tid := range []mtid.MTID{id, child} {
+		revoked, reason, err := CheckTokenRevoked(nil, tid, 1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !revoked || reason != "token is suspended" {
+			t.Errorf("Expected mytoken '%s' to be suspended, but got '%v' ('%s')", tid.Hash(), revoked, reason)
+		}
+	}
+	if err := ResumeMT(nil, child); !errors.Is(err, ErrSuspendedByParent) {
+		t.Errorf("Expected ErrSuspendedByParent, but got '%v'", err)
+	}
+	if err := ResumeMT(nil, id); err != nil {
+		t.Fatal(err)
+	}
+	for _, tid := range []mtid.MTID{id, child} {
+		if revoked, reason, err := CheckTokenRevoked(nil, tid, 1, nil); err != nil {
+			t.Fatal(err)
+		} else if revoked {
+			t.Errorf("Mytoken '%s' still invalid: %s", tid.Hash(), reason)
+		}
+	}
+}
+
+// TestResumeAfterSuspenderRevoked checks that the subtokens of a suspended mytoken that is revoked without its
+// children can still be resumed.
+func TestResumeAfterSuspenderRevoked(t *testing.T) {
+	dbtest.Connect(t)
+	id := dbtest.CreateMytoken(t)
+	child := dbtest.CreateSubtoken(t, id)
+	grandchild := dbtest.CreateSubtoken(t, child)
+
+	if err := SuspendMT(nil, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeMT(nil, id, false, Revocation{Reason: RevocationReasonRevoked}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ResumeMT(nil, grandchild); !errors.Is(err, ErrSuspendedByParent) {
+		t.Errorf("Expected ErrSuspendedByParent, but got '%v'", err)
+	}
+	if err := ResumeMT(nil, child); err != nil {
+		t.Fatal(err)
+	}
+	for _, tid := range []mtid.MTID{child, grandchild} {
+		if revoked, reason, err := CheckTokenRevoked(nil, tid, 1, nil); err != nil {
+			t.Fatal(err)
+		} else if revoked {
+			t.Errorf("Mytoken '%s' still invalid: %s", tid.Hash(), reason)
+		}
+	}
+}
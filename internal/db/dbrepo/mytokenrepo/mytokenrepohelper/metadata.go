@@ -0,0 +1,39 @@
+package mytokenrepohelper
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+// UpdateName sets the name of the passed mytoken; an empty name removes it
+func UpdateName(tx *sqlx.Tx, id mtid.MTID, name string) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`UPDATE MTokens SET name=? WHERE id=?`, db.NewNullString(name), id)
+		return err
+	})
+}
+
+// UpdateDescription sets the description of the passed mytoken; an empty description removes it
+func UpdateDescription(tx *sqlx.Tx, id mtid.MTID, description string) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`UPDATE MTokens SET description=? WHERE id=?`, db.NewNullString(description), id)
+		return err
+	})
+}
+
+// SetTags replaces the tags of the passed mytoken
+func SetTags(tx *sqlx.Tx, id mtid.MTID, tags []string) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM MT_Tags WHERE MT_id=?`, id); err != nil {
+			return err
+		}
+		for _, t := range tags {
+			if _, err := tx.Exec(`INSERT INTO MT_Tags (MT_id, tag) VALUES(?, ?)`, id, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
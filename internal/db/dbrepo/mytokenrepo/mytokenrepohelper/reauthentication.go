@@ -0,0 +1,28 @@
+package mytokenrepohelper
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/shared/utils/unixtime"
+)
+
+// StoreReauthentication stores that the passed mytoken was obtained through an OIDC flow in which the user
+// authenticated again at the provider at authTime
+func StoreReauthentication(tx *sqlx.Tx, id mtid.MTID, authTime unixtime.UnixTime) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`INSERT INTO Reauthentications (MT_id, auth_time) VALUES (?, FROM_UNIXTIME(?))`, id, int64(authTime))
+		return err
+	})
+}
+
+// ReauthenticatedWithin checks if the passed mytoken was obtained through an OIDC flow in which the user authenticated
+// again at the provider at most maxAge seconds ago
+func ReauthenticatedWithin(tx *sqlx.Tx, id mtid.MTID, maxAge int64) (bool, error) {
+	var count int
+	err := db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		return tx.Get(&count, `SELECT COUNT(1) FROM Reauthentications WHERE MT_id=? AND auth_time >= TIMESTAMPADD(SECOND, ?, CURRENT_TIMESTAMP())`, id, -maxAge)
+	})
+	return count > 0, err
+}
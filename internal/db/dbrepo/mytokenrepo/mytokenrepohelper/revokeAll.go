@@ -0,0 +1,49 @@
+package mytokenrepohelper
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+// RevokedUserTokens holds information about the mytokens that were revoked by RevokeAllOfUser
+type RevokedUserTokens struct {
+	ManagementIDs []string
+	RTIDs         []uint64
+	TransferCodes int
+	ShortTokens   int
+}
+
+// RevokeAllOfUser revokes all mytokens of the user of the passed mytoken id; transfer codes and short tokens for
+// these mytokens are deleted with them. The refresh tokens are not deleted, their ids are returned instead. Tombstones
+// are kept for all revoked mytokens.
+func RevokeAllOfUser(tx *sqlx.Tx, id mtid.MTID, rev Revocation) (revoked RevokedUserTokens, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		var uid uint64
+		if err := tx.Get(&uid, `SELECT user_id FROM MTokens WHERE id=? FOR UPDATE`, id); err != nil {
+			return err
+		}
+		if err := tx.Select(&revoked.ManagementIDs, `SELECT management_id FROM MTokens WHERE user_id=? FOR UPDATE`, uid); err != nil {
+			return err
+		}
+		if err := tx.Select(&revoked.RTIDs, `SELECT DISTINCT rt_id FROM MTokens WHERE user_id=?`, uid); err != nil {
+			return err
+		}
+		if err := tx.Get(&revoked.TransferCodes, `SELECT COUNT(1) FROM ProxyTokens pt JOIN MTokens mt ON pt.MT_id=mt.id JOIN TransferCodesAttributes tca ON tca.id=pt.id WHERE mt.user_id=?`, uid); err != nil {
+			return err
+		}
+		if err := tx.Get(&revoked.ShortTokens, `SELECT COUNT(1) FROM ProxyTokens pt JOIN MTokens mt ON pt.MT_id=mt.id WHERE mt.user_id=? AND pt.id NOT IN (SELECT id FROM TransferCodesAttributes)`, uid); err != nil {
+			return err
+		}
+		var ids []string
+		if err := tx.Select(&ids, `SELECT id FROM MTokens WHERE user_id=?`, uid); err != nil {
+			return err
+		}
+		if err := storeTombstones(tx, ids, rev.Reason, rev); err != nil {
+			return err
+		}
+		return deleteMTs(tx, ids)
+	})
+	return
+}
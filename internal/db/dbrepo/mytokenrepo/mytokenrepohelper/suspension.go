@@ -0,0 +1,93 @@
+package mytokenrepohelper
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+// ErrSuspendedByParent is returned if a mytoken should be resumed that was suspended through one of its parents
+var ErrSuspendedByParent = errors.New("mytoken was suspended through a parent")
+
+// SuspendMT suspends the passed mytoken and all its children; mytokens that are already suspended are not changed,
+// so they stay suspended if this mytoken is resumed
+func SuspendMT(tx *sqlx.Tx, id mtid.MTID) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		children, err := getSubtreeIDs(tx, id)
+		if err != nil {
+			return err
+		}
+		query, args, err := sqlx.In(`UPDATE MTokens SET suspended_by=? WHERE suspended_by IS NULL AND id IN (?)`, id.Hash(), append(children, id.Hash()))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(tx.Rebind(query), args...)
+		return err
+	})
+}
+
+// ResumeMT resumes the passed mytoken and all its children that were suspended together with it; if the mytoken was
+// suspended through one of its parents ErrSuspendedByParent is returned. If the mytoken that caused the suspension no
+// longer exists, the mytoken can be resumed like the origin of the suspension.
+func ResumeMT(tx *sqlx.Tx, id mtid.MTID) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		var suspendedBy sql.NullString
+		if err := tx.Get(&suspendedBy, `SELECT suspended_by FROM MTokens WHERE id=?`, id); err != nil {
+			return err
+		}
+		if !suspendedBy.Valid {
+			return nil
+		}
+		if suspendedBy.String != id.Hash() {
+			var suspenderExists bool
+			if err := tx.Get(&suspenderExists, `SELECT COUNT(1)>0 FROM MTokens WHERE id=?`, suspendedBy.String); err != nil {
+				return err
+			}
+			if suspenderExists {
+				return ErrSuspendedByParent
+			}
+		}
+		// If the parent was suspended in the meantime, the subtree stays suspended through the parent
+		var parentSuspendedBy sql.NullString
+		if _, err := ParseError(tx.Get(&parentSuspendedBy, `SELECT p.suspended_by FROM MTokens p INNER JOIN MTokens mt ON p.id=mt.parent_id WHERE mt.id=?`, id)); err != nil {
+			return err
+		}
+		children, err := getSubtreeIDs(tx, id)
+		if err != nil {
+			return err
+		}
+		query, args, err := sqlx.In(`UPDATE MTokens SET suspended_by=? WHERE suspended_by=? AND id IN (?)`, parentSuspendedBy, suspendedBy.String, append(children, id.Hash()))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(tx.Rebind(query), args...)
+		return err
+	})
+}
+
+// handOverSuspension makes each child that was suspended through the passed mytoken the origin of the suspension of
+// its own subtree; it is called before the mytoken is revoked without its children, so they can still be resumed
+func handOverSuspension(tx *sqlx.Tx, id mtid.MTID) error {
+	var children []mtid.MTID
+	if err := tx.Select(&children, `SELECT id FROM MTokens WHERE parent_id=? AND suspended_by=?`, id, id.Hash()); err != nil {
+		return err
+	}
+	for _, c := range children {
+		subtree, err := getSubtreeIDs(tx, c)
+		if err != nil {
+			return err
+		}
+		query, args, err := sqlx.In(`UPDATE MTokens SET suspended_by=? WHERE suspended_by=? AND id IN (?)`, c.Hash(), id.Hash(), append(subtree, c.Hash()))
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(tx.Rebind(query), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
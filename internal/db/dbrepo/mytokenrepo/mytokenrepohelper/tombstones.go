@@ -0,0 +1,121 @@
+package mytokenrepohelper
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/shared/utils/unixtime"
+)
+
+// Reasons for the revocation of a mytoken as stored in its tombstone
+const (
+	RevocationReasonRevoked             = "revoked"
+	RevocationReasonParentRevoked       = "parent_revoked"
+	RevocationReasonRevokedByOtherToken = "revoked_by_other_token"
+	RevocationReasonRevokeAll           = "revoke_all"
+)
+
+// Revocation describes why, by whom, and from where mytokens are revoked
+type Revocation struct {
+	Reason string
+	// Actor is the management id of the mytoken that requested the revocation
+	Actor string
+	IP    string
+}
+
+// DeleteExpiredTombstones deletes the tombstones that are older than the configured retention period
+func DeleteExpiredTombstones(tx *sqlx.Tx) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`DELETE FROM RevokedMTokens WHERE revoked < TIMESTAMPADD(DAY, -?, CURRENT_TIMESTAMP())`,
+			config.Get().Features.TokenRevocation.TombstoneRetention)
+		return err
+	})
+}
+
+// storeTombstones stores tombstones for the mytokens with the passed ids and moves their event history, so it is not
+// deleted together with the mytokens
+func storeTombstones(tx *sqlx.Tx, ids []string, reason string, rev Revocation) error {
+	if config.Get().Features.TokenRevocation.TombstoneRetention == 0 || len(ids) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In(`INSERT INTO RevokedMTokens (id, management_id, parent_id, root_id, user_id, name, created, reason, actor, ip)
+		SELECT id, management_id, parent_id, root_id, user_id, name, created, ?, ?, ? FROM MTokens WHERE id IN (?)`,
+		reason, db.NewNullString(rev.Actor), db.NewNullString(rev.IP), ids)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(tx.Rebind(query), args...); err != nil {
+		return err
+	}
+	query, args, err = sqlx.In(`INSERT INTO RevokedMT_Events (MT_id, time, event_id, comment, ip, user_agent, country, asn)
+		SELECT MT_id, time, event_id, comment, ip, user_agent, country, asn FROM MT_Events WHERE MT_id IN (?) ORDER BY id`, ids)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(tx.Rebind(query), args...)
+	return err
+}
+
+// GetRevokedMTIDByManagementID returns the id of the revoked mytoken with the passed management id, if its tombstone
+// is still kept and it belonged to the same user as the mytoken with the passed id
+func GetRevokedMTIDByManagementID(tx *sqlx.Tx, managementID string, sameUserAs mtid.MTID) (mtid.MTID, bool, error) {
+	var id mtid.MTID
+	found, err := ParseError(db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		return tx.Get(&id, `SELECT id FROM RevokedMTokens WHERE management_id=? AND user_id=(SELECT user_id FROM MTokens WHERE id=?)`, managementID, sameUserAs)
+	}))
+	return id, found, err
+}
+
+// deleteMTs deletes the mytokens with the passed ids
+func deleteMTs(tx *sqlx.Tx, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In(`DELETE FROM MTokens WHERE id IN (?)`, ids)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(tx.Rebind(query), args...)
+	return err
+}
+
+type tombstone struct {
+	Reason  string            `db:"reason"`
+	Revoked unixtime.UnixTime `db:"revoked"`
+}
+
+// getInvalidReason returns a description why the mytoken with the passed id is not valid
+func getInvalidReason(tx *sqlx.Tx, id mtid.MTID) (reason string, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		var t tombstone
+		found, err := ParseError(tx.Get(&t, `SELECT reason, revoked FROM RevokedMTokens WHERE id=?`, id))
+		if err != nil {
+			return err
+		}
+		if found {
+			reason = fmt.Sprintf("token was revoked (%s) at %s", t.Reason, t.Revoked.Time().UTC().Format("2006-01-02 15:04:05 MST"))
+			return nil
+		}
+		var suspendedBy sql.NullString
+		found, err = ParseError(tx.Get(&suspendedBy, `SELECT suspended_by FROM MTokens WHERE id=?`, id))
+		if err != nil {
+			return err
+		}
+		if found && suspendedBy.Valid {
+			reason = "token is suspended"
+			return nil
+		}
+		if found {
+			reason = "token was rotated or not rotated in time"
+			return nil
+		}
+		reason = "unknown token"
+		return nil
+	})
+	return
+}
@@ -0,0 +1,180 @@
+package mytokenrepohelper
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/utils/hashUtils"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+// TokenUsage holds how often a Mytoken was used with a specific restriction
+type TokenUsage struct {
+	RestrictionHash       string `db:"restriction_hash"`
+	UsagesAT              int64  `db:"usages_AT"`
+	UsagesOther           int64  `db:"usages_other"`
+	DescendantUsagesAT    int64  `db:"descendant_usages_AT"`
+	DescendantUsagesOther int64  `db:"descendant_usages_other"`
+}
+
+// usageColumns holds the column names for one kind of usage and the json path of its limit in the restriction
+type usageColumns struct {
+	own        string
+	descendant string
+	limitPath  string
+}
+
+var (
+	usageColumnsAT    = usageColumns{own: "usages_AT", descendant: "descendant_usages_AT", limitPath: "$.usages_AT"}
+	usageColumnsOther = usageColumns{own: "usages_other", descendant: "descendant_usages_other", limitPath: "$.usages_other"}
+)
+
+// reserveQuery returns the update that reserves a usage of a restriction; if limited, the update has to be called
+// with the limit as additional argument and only changes the row if the own and the descendants' usages are below it
+func (c usageColumns) reserveQuery(limited bool) string {
+	query := `UPDATE TokenUsages SET ` + c.own + ` = ` + c.own + ` + 1 WHERE MT_id=? AND restriction_hash=?`
+	if limited {
+		query += ` AND ` + c.own + ` + ` + c.descendant + ` < ?`
+	}
+	return query
+}
+
+// reserveAncestorQuery returns the update that reserves a usage of a descendant at the linked restriction of an
+// ancestor; the row is only changed if the limit stored in the ancestor's restriction is not reached yet
+func (c usageColumns) reserveAncestorQuery() string {
+	return `UPDATE TokenUsages SET ` + c.descendant + ` = ` + c.descendant + ` + 1 WHERE MT_id=? AND restriction_hash=? AND (JSON_VALUE(restriction, ?) IS NULL OR ` + c.own + ` + ` + c.descendant + ` < JSON_VALUE(restriction, ?))`
+}
+
+// GetTokenUsages returns the usages of all restrictions of a Mytoken with a single query; the returned map is keyed by
+// the restriction hash. Restrictions that were not used before have no entry.
+func GetTokenUsages(tx *sqlx.Tx, myID mtid.MTID) (map[string]TokenUsage, error) {
+	var usages []TokenUsage
+	if err := db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		return tx.Select(&usages, `SELECT restriction_hash, usages_AT, usages_other, descendant_usages_AT, descendant_usages_other FROM TokenUsages WHERE MT_id=?`, myID)
+	}); err != nil {
+		return nil, err
+	}
+	m := make(map[string]TokenUsage, len(usages))
+	for _, u := range usages {
+		m[u.RestrictionHash] = u
+	}
+	return m, nil
+}
+
+// LinkTokenUsageBudget links a restriction of a subtoken to the restriction of its parent it was derived from, so
+// that the usages of the subtoken also count against the usage limits of the parent's restriction
+func LinkTokenUsageBudget(tx *sqlx.Tx, myID mtid.MTID, jsonRestriction []byte, parentID mtid.MTID, parentJSONRestriction []byte) error {
+	parentHash := hashUtils.SHA512Str(parentJSONRestriction)
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec(`INSERT IGNORE INTO TokenUsages (MT_id, restriction, restriction_hash) VALUES (?, ?, ?)`, parentID, parentJSONRestriction, parentHash); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO TokenUsages (MT_id, restriction, restriction_hash, parent_restriction_hash) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE parent_restriction_hash=VALUES(parent_restriction_hash)`, myID, jsonRestriction, hashUtils.SHA512Str(jsonRestriction), parentHash)
+		return err
+	})
+}
+
+// ConsumeTokenUsageAT atomically reserves one usage for obtaining an access token with a Mytoken and the given
+// restriction. If limit is not nil, the usage is only reserved if the limit is not reached yet; the returned bool
+// indicates if a usage was reserved.
+func ConsumeTokenUsageAT(tx *sqlx.Tx, myID mtid.MTID, jsonRestriction []byte, limit *int64) (bool, error) {
+	return consumeTokenUsage(tx, myID, jsonRestriction, usageColumnsAT, limit)
+}
+
+// ConsumeTokenUsageOther atomically reserves one usage for other usages with a Mytoken and the given restriction. If
+// limit is not nil, the usage is only reserved if the limit is not reached yet; the returned bool indicates if a
+// usage was reserved.
+func ConsumeTokenUsageOther(tx *sqlx.Tx, myID mtid.MTID, jsonRestriction []byte, limit *int64) (bool, error) {
+	return consumeTokenUsage(tx, myID, jsonRestriction, usageColumnsOther, limit)
+}
+
+// ReleaseTokenUsageAT gives back a usage that was reserved with ConsumeTokenUsageAT but not used
+func ReleaseTokenUsageAT(tx *sqlx.Tx, myID mtid.MTID, jsonRestriction []byte) error {
+	cols := usageColumnsAT
+	hash := hashUtils.SHA512Str(jsonRestriction)
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec(`UPDATE TokenUsages SET `+cols.own+` = `+cols.own+` - 1 WHERE MT_id=? AND restriction_hash=? AND `+cols.own+` > 0`, myID, hash); err != nil {
+			return err
+		}
+		id := myID
+		for {
+			parent, found, err := getBudgetParent(tx, id, hash)
+			if err != nil || !found {
+				return err
+			}
+			if _, err = tx.Exec(`UPDATE TokenUsages SET `+cols.descendant+` = `+cols.descendant+` - 1 WHERE MT_id=? AND restriction_hash=? AND `+cols.descendant+` > 0`, parent.ID, parent.RestrictionHash); err != nil {
+				return err
+			}
+			id, hash = parent.ID, parent.RestrictionHash
+		}
+	})
+}
+
+// consumeTokenUsage reserves a usage with a conditional update; the update locks the row and evaluates the condition
+// on the latest committed value, so concurrent requests cannot exceed the limit. If the restriction is linked to a
+// restriction of the parent, the usage is also reserved at all ancestors.
+func consumeTokenUsage(tx *sqlx.Tx, myID mtid.MTID, jsonRestriction []byte, cols usageColumns, limit *int64) (reserved bool, err error) {
+	if limit != nil && *limit <= 0 {
+		return false, nil
+	}
+	hash := hashUtils.SHA512Str(jsonRestriction)
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec(`INSERT IGNORE INTO TokenUsages (MT_id, restriction, restriction_hash) VALUES (?, ?, ?)`, myID, jsonRestriction, hash); err != nil {
+			return err
+		}
+		// The savepoint allows to undo the usages of the token and its ancestors if the budget of an ancestor is
+		// exhausted, without rolling back the whole transaction
+		if _, err := tx.Exec(`SAVEPOINT consume_usage`); err != nil {
+			return err
+		}
+		args := []interface{}{myID, hash}
+		if limit != nil {
+			args = append(args, *limit)
+		}
+		ok, err := execAffectsOne(tx, cols.reserveQuery(limit != nil), args...)
+		if err != nil || !ok {
+			return err
+		}
+		id := myID
+		for {
+			parent, found, err := getBudgetParent(tx, id, hash)
+			if err != nil {
+				return err
+			}
+			if !found {
+				reserved = true
+				return nil
+			}
+			ok, err = execAffectsOne(tx, cols.reserveAncestorQuery(), parent.ID, parent.RestrictionHash, cols.limitPath, cols.limitPath)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				_, err = tx.Exec(`ROLLBACK TO SAVEPOINT consume_usage`)
+				return err
+			}
+			id, hash = parent.ID, parent.RestrictionHash
+		}
+	})
+	return
+}
+
+type budgetParent struct {
+	ID              mtid.MTID `db:"parent_id"`
+	RestrictionHash string    `db:"parent_restriction_hash"`
+}
+
+// getBudgetParent returns the parent's restriction a restriction of a mytoken is linked to
+func getBudgetParent(tx *sqlx.Tx, myID mtid.MTID, restrictionHash string) (parent budgetParent, found bool, err error) {
+	found, err = ParseError(tx.Get(&parent, `SELECT m.parent_id, t.parent_restriction_hash FROM TokenUsages t JOIN MTokens m ON m.id=t.MT_id WHERE t.MT_id=? AND t.restriction_hash=? AND t.parent_restriction_hash IS NOT NULL AND m.parent_id IS NOT NULL`, myID, restrictionHash))
+	return
+}
+
+func execAffectsOne(tx *sqlx.Tx, query string, args ...interface{}) (bool, error) {
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected == 1, err
+}
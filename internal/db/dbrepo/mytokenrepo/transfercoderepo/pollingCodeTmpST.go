@@ -89,3 +89,68 @@ func DeclineConsentByState(tx *sqlx.Tx, state *state.State) error {
 		return err
 	})
 }
+
+// slowDownIncrease is the number of seconds the polling interval of a polling code is increased by if the client
+// polls too fast, as defined by RFC 8628
+const slowDownIncrease = 5
+
+// RecordPoll records a poll of the polling code and checks that the client respects the polling interval of the
+// polling code, which starts at the passed interval. If the client polled too fast, slowDown is true and the polling
+// interval of the polling code is increased.
+func RecordPoll(tx *sqlx.Tx, pollingCode string, interval int64) (slowDown bool, err error) {
+	pc := createProxyToken(pollingCode)
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		var p struct {
+			Since    sql.NullInt64 `db:"since"`
+			Interval sql.NullInt64 `db:"polling_interval"`
+		}
+		if err := tx.Get(&p, `SELECT TIMESTAMPDIFF(SECOND, last_polled, CURRENT_TIMESTAMP()) AS since, polling_interval FROM TransferCodesAttributes WHERE id=? FOR UPDATE`, pc.ID()); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+		if p.Interval.Valid {
+			interval = p.Interval.Int64
+		}
+		if p.Since.Valid && tooFast(p.Since.Int64, interval) {
+			slowDown = true
+			interval += slowDownIncrease
+		}
+		_, err := tx.Exec(`UPDATE TransferCodesAttributes SET last_polled=CURRENT_TIMESTAMP(), polling_interval=? WHERE id=?`, interval, pc.ID())
+		return err
+	})
+	return
+}
+
+// StartLongPoll marks a long poll of the polling code as running for the passed number of seconds; started is false if
+// another long poll of the polling code is still running. The mark is removed by EndLongPoll; if the server instance
+// holding the long poll fails, it expires.
+func StartLongPoll(tx *sqlx.Tx, pollingCode string, seconds int64) (started bool, err error) {
+	pc := createProxyToken(pollingCode)
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		res, err := tx.Exec(`UPDATE TransferCodesAttributes SET long_poll_until=CURRENT_TIMESTAMP() + INTERVAL ? SECOND WHERE id=? AND (long_poll_until IS NULL OR long_poll_until<CURRENT_TIMESTAMP())`, seconds, pc.ID())
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		started = n > 0
+		return err
+	})
+	return
+}
+
+// EndLongPoll removes the mark set by StartLongPoll
+func EndLongPoll(tx *sqlx.Tx, pollingCode string) error {
+	pc := createProxyToken(pollingCode)
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`UPDATE TransferCodesAttributes SET long_poll_until=NULL WHERE id=?`, pc.ID())
+		return err
+	})
+}
+
+// tooFast checks if a poll since seconds after the previous one violates the polling interval; since the time is only
+// known to the second, one second of jitter is tolerated
+func tooFast(since, interval int64) bool {
+	return since+1 < interval
+}
@@ -0,0 +1,25 @@
+package transfercoderepo
+
+import (
+	"testing"
+)
+
+func TestTooFast(t *testing.T) {
+	tests := []struct {
+		since    int64
+		interval int64
+		expected bool
+	}{
+		{since: 0, interval: 5, expected: true},
+		{since: 3, interval: 5, expected: true},
+		{since: 4, interval: 5, expected: false},
+		{since: 5, interval: 5, expected: false},
+		{since: 30, interval: 5, expected: false},
+		{since: 6, interval: 10, expected: true},
+	}
+	for _, test := range tests {
+		if tooFast(test.since, test.interval) != test.expected {
+			t.Errorf("Expected tooFast(%d, %d) to be %v", test.since, test.interval, test.expected)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+// ErrSubtokenLimitReached is returned if a subtoken cannot be created, because it would exceed the subtoken limits of
+// the parent or one of its ancestors
+var ErrSubtokenLimitReached = errors.New("subtoken limit reached")
+
+type limitsEntry struct {
+	ID             mtid.MTID
+	ParentID       mtid.MTID `db:"parent_id"`
+	MaxDepth       *uint64   `db:"max_depth"`
+	MaxChildren    *uint64   `db:"max_children"`
+	MaxDescendants *uint64   `db:"max_descendants"`
+	// Inactive is set for expired and suspended mytokens, which do not count towards the limits. Mytokens created
+	// before expires_at was recorded only get it when they are used again; until then they count as active.
+	Inactive bool `db:"inactive"`
+}
+
+// CheckSubtokenLimits checks if another subtoken can be created from the passed mytoken without exceeding the subtoken
+// limits of the mytoken or one of its ancestors. The root of the token tree is locked until the transaction ends, so
+// concurrent requests cannot exceed the limits. Expired and suspended subtokens are not counted.
+func CheckSubtokenLimits(tx *sqlx.Tx, parentID mtid.MTID) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		var rootID mtid.MTID
+		if err := tx.Get(&rootID, `SELECT COALESCE(root_id, id) FROM MTokens WHERE id=?`, parentID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`SELECT id FROM MTokens WHERE id=? FOR UPDATE`, rootID); err != nil {
+			return err
+		}
+		var tokens []limitsEntry
+		if err := tx.Select(&tokens, `SELECT id, parent_id, max_depth, max_children, max_descendants,
+			(suspended_by IS NOT NULL OR (expires_at IS NOT NULL AND expires_at < CURRENT_TIMESTAMP())) AS inactive
+			FROM MTokens WHERE id=? OR root_id=?`, rootID, rootID); err != nil {
+			return err
+		}
+		return checkSubtokenLimits(tokens, parentID)
+	})
+}
+
+func checkSubtokenLimits(tokens []limitsEntry, parentID mtid.MTID) error {
+	byID := make(map[string]limitsEntry, len(tokens))
+	children := make(map[string][]string)
+	for _, t := range tokens {
+		byID[t.ID.Hash()] = t
+		if t.ParentID.HashValid() {
+			children[t.ParentID.Hash()] = append(children[t.ParentID.Hash()], t.ID.Hash())
+		}
+	}
+	countChildren := func(id string) (n uint64) {
+		for _, c := range children[id] {
+			if !byID[c].Inactive {
+				n++
+			}
+		}
+		return
+	}
+	var countDescendants func(id string) uint64
+	countDescendants = func(id string) (n uint64) {
+		for _, c := range children[id] {
+			n += countDescendants(c)
+		}
+		return n + countChildren(id)
+	}
+	// depth is the generation of the new subtoken below the current ancestor
+	id := parentID.Hash()
+	for depth := uint64(1); ; depth++ {
+		t, found := byID[id]
+		if !found {
+			return nil
+		}
+		if t.MaxDepth != nil && depth > *t.MaxDepth {
+			if depth == 1 {
+				return fmt.Errorf("%w: this mytoken cannot create subtokens", ErrSubtokenLimitReached)
+			}
+			return fmt.Errorf("%w: an ancestor of this mytoken allows only %d generations of subtokens", ErrSubtokenLimitReached, *t.MaxDepth)
+		}
+		if depth == 1 && t.MaxChildren != nil && countChildren(id) >= *t.MaxChildren {
+			return fmt.Errorf("%w: this mytoken already has the maximum of %d subtokens", ErrSubtokenLimitReached, *t.MaxChildren)
+		}
+		if t.MaxDescendants != nil && countDescendants(id) >= *t.MaxDescendants {
+			if depth == 1 {
+				return fmt.Errorf("%w: this mytoken already has the maximum of %d direct and indirect subtokens", ErrSubtokenLimitReached, *t.MaxDescendants)
+			}
+			return fmt.Errorf("%w: an ancestor of this mytoken already has the maximum of %d direct and indirect subtokens", ErrSubtokenLimitReached, *t.MaxDescendants)
+		}
+		if !t.ParentID.HashValid() {
+			return nil
+		}
+		id = t.ParentID.Hash()
+	}
+}
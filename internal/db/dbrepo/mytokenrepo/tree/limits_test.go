@@ -0,0 +1,86 @@
+package tree
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+func newLimit(v uint64) *uint64 {
+	return &v
+}
+
+// testTree returns the tokens root -> a -> b and root -> c
+func testTree() (root, a, b, c limitsEntry) {
+	root = limitsEntry{ID: mtid.New()}
+	a = limitsEntry{ID: mtid.New(), ParentID: root.ID}
+	b = limitsEntry{ID: mtid.New(), ParentID: a.ID}
+	c = limitsEntry{ID: mtid.New(), ParentID: root.ID}
+	return
+}
+
+func checkLimitErr(t *testing.T, err error, expectReached bool) {
+	if expectReached && !errors.Is(err, ErrSubtokenLimitReached) {
+		t.Errorf("Expected subtoken limit to be reached, but got '%v'", err)
+	}
+	if !expectReached && err != nil {
+		t.Errorf("Expected no error, but got '%v'", err)
+	}
+}
+
+func TestCheckSubtokenLimitsNoLimits(t *testing.T) {
+	root, a, b, c := testTree()
+	checkLimitErr(t, checkSubtokenLimits([]limitsEntry{root, a, b, c}, b.ID), false)
+}
+
+func TestCheckSubtokenLimitsMaxDepth(t *testing.T) {
+	root, a, b, c := testTree()
+	root.MaxDepth = newLimit(2)
+	tokens := []limitsEntry{root, a, b, c}
+	checkLimitErr(t, checkSubtokenLimits(tokens, a.ID), false)
+	checkLimitErr(t, checkSubtokenLimits(tokens, b.ID), true)
+}
+
+func TestCheckSubtokenLimitsMaxDepthZero(t *testing.T) {
+	root, a, b, c := testTree()
+	a.MaxDepth = newLimit(0)
+	checkLimitErr(t, checkSubtokenLimits([]limitsEntry{root, a, b, c}, a.ID), true)
+}
+
+func TestCheckSubtokenLimitsMaxChildren(t *testing.T) {
+	root, a, b, c := testTree()
+	root.MaxChildren = newLimit(2)
+	tokens := []limitsEntry{root, a, b, c}
+	checkLimitErr(t, checkSubtokenLimits(tokens, root.ID), true)
+	// max_children only limits direct subtokens
+	checkLimitErr(t, checkSubtokenLimits(tokens, a.ID), false)
+}
+
+func TestCheckSubtokenLimitsMaxDescendants(t *testing.T) {
+	root, a, b, c := testTree()
+	root.MaxDescendants = newLimit(3)
+	tokens := []limitsEntry{root, a, b, c}
+	checkLimitErr(t, checkSubtokenLimits(tokens, b.ID), true)
+	checkLimitErr(t, checkSubtokenLimits(tokens[:3], b.ID), false)
+}
+
+func TestCheckSubtokenLimitsMaxChildrenInactive(t *testing.T) {
+	root, a, b, c := testTree()
+	root.MaxChildren = newLimit(2)
+	// expired or suspended subtokens do not count towards max_children
+	c.Inactive = true
+	checkLimitErr(t, checkSubtokenLimits([]limitsEntry{root, a, b, c}, root.ID), false)
+}
+
+func TestCheckSubtokenLimitsMaxDescendantsInactive(t *testing.T) {
+	root, a, b, c := testTree()
+	root.MaxDescendants = newLimit(3)
+	// expired or suspended subtokens do not count towards max_descendants, but their active children still do
+	a.Inactive = true
+	checkLimitErr(t, checkSubtokenLimits([]limitsEntry{root, a, b, c}, b.ID), false)
+	b.Inactive = true
+	c.Inactive = true
+	root.MaxDescendants = newLimit(1)
+	checkLimitErr(t, checkSubtokenLimits([]limitsEntry{root, a, b, c}, root.ID), false)
+}
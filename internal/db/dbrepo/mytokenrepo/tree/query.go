@@ -0,0 +1,177 @@
+package tree
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/utils/pagination"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	"github.com/oidc-mytoken/server/shared/utils"
+	"github.com/oidc-mytoken/server/shared/utils/unixtime"
+)
+
+// Query holds the filters, the sort order, and the page of a list or subtree query; zero values do not filter. Like
+// in the database, tags are matched case-insensitive.
+type Query struct {
+	Tag        string
+	Status     string
+	SortBy     string
+	Descending bool
+	After      *pagination.Cursor
+	Limit      int
+}
+
+// matches checks if the passed MytokenEntry matches the filters of the Query
+func (q Query) matches(e MytokenEntry) bool {
+	if q.Tag != "" && !utils.StringInSliceIgnoreCase(q.Tag, e.Tags) {
+		return false
+	}
+	switch q.Status {
+	case api.TokenStatusActive:
+		return !e.Suspended
+	case api.TokenStatusSuspended:
+		return e.Suspended
+	}
+	return true
+}
+
+// key returns the value of the sort key of the passed MytokenEntry
+func (q Query) key(e MytokenEntry) string {
+	if q.SortBy == api.SortByName {
+		return e.Name.String
+	}
+	return strconv.FormatInt(int64(e.CreatedAt), 10)
+}
+
+// compare compares the passed MytokenEntry with the entry given by its sort key and management id according to the
+// sort order of the Query
+func (q Query) compare(e MytokenEntry, key, managementID string) int {
+	var c int
+	if q.SortBy == api.SortByName {
+		c = strings.Compare(e.Name.String, key)
+	} else {
+		k, _ := strconv.ParseInt(key, 10, 64)
+		switch created := int64(e.CreatedAt); {
+		case created < k:
+			c = -1
+		case created > k:
+			c = 1
+		}
+	}
+	if c == 0 {
+		c = strings.Compare(e.ManagementID, managementID)
+	}
+	if q.Descending {
+		c = -c
+	}
+	return c
+}
+
+// cursor returns the pagination.Cursor pointing to the passed MytokenEntry
+func (q Query) cursor(e MytokenEntry) *pagination.Cursor {
+	return &pagination.Cursor{
+		Key: q.key(e),
+		ID:  e.ManagementID,
+	}
+}
+
+// sort sorts the passed MytokenEntryTrees and all their children
+func (q Query) sort(trees []MytokenEntryTree) {
+	sort.Slice(trees, func(i, j int) bool {
+		b := trees[j].Token
+		return q.compare(trees[i].Token, q.key(b), b.ManagementID) < 0
+	})
+	for _, t := range trees {
+		q.sort(t.Children)
+	}
+}
+
+// ApplyToTrees filters the passed MytokenEntryTrees and sorts them and all their children
+func (q Query) ApplyToTrees(trees []MytokenEntryTree) []MytokenEntryTree {
+	filtered := []MytokenEntryTree{}
+	for _, t := range trees {
+		if ft, ok := t.Filter(q.matches); ok {
+			filtered = append(filtered, ft)
+		}
+	}
+	q.sort(filtered)
+	return filtered
+}
+
+// ApplyToTree filters and sorts the children of the passed MytokenEntryTree; the root is always kept
+func (q Query) ApplyToTree(t MytokenEntryTree) MytokenEntryTree {
+	t, _ = t.Filter(q.matches)
+	t.Children = q.ApplyToTrees(t.Children)
+	return t
+}
+
+// matchCondition returns the sql condition and its arguments that corresponds to matches for the mytoken m
+func (q Query) matchCondition() (string, []interface{}) {
+	conditions := []string{"TRUE"}
+	var args []interface{}
+	if q.Tag != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM MT_Tags WHERE MT_Tags.MT_id=m.id AND MT_Tags.tag=?)")
+		args = append(args, q.Tag)
+	}
+	switch q.Status {
+	case api.TokenStatusActive:
+		conditions = append(conditions, "m.suspended_by IS NULL")
+	case api.TokenStatusSuspended:
+		conditions = append(conditions, "m.suspended_by IS NOT NULL")
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// orderKey returns the sql expression of the sort key; names are compared binary like in compare
+func (q Query) orderKey() string {
+	if q.SortBy == api.SortByName {
+		return "COALESCE(MTokens.name, '') COLLATE utf8mb4_bin"
+	}
+	return "MTokens.created"
+}
+
+// selectPage selects the page of the mytokens matching the passed conditions following the cursor of the Query,
+// ordered by the sort key and the management id; with is put in front of the query, e.g. for a common table
+// expression. If there are more mytokens, a pagination.Cursor for the next page is returned.
+func (q Query) selectPage(tx *sqlx.Tx, with string, conditions []string, args []interface{}) ([]MytokenEntry, *pagination.Cursor, error) {
+	cmp, order := ">", "ASC"
+	if q.Descending {
+		cmp, order = "<", "DESC"
+	}
+	if q.After != nil {
+		var key interface{} = q.After.Key
+		if q.SortBy != api.SortByName {
+			t, err := strconv.ParseInt(q.After.Key, 10, 64)
+			if err != nil {
+				return nil, nil, pagination.ErrInvalidCursor
+			}
+			key = unixtime.UnixTime(t)
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s%s? OR (%s=? AND MTokens.management_id%s?))",
+			q.orderKey(), cmp, q.orderKey(), cmp))
+		args = append(args, key, key, q.After.ID)
+	}
+	query := fmt.Sprintf(`%s SELECT %s FROM MTokens WHERE %s ORDER BY %s %s, MTokens.management_id %s`,
+		with, selectEntryColumns, strings.Join(conditions, " AND "), q.orderKey(), order, order)
+	if q.Limit > 0 {
+		// one more mytoken than requested is selected to know if there is a next page
+		query += " LIMIT ?"
+		args = append(args, q.Limit+1)
+	}
+	var tokens []MytokenEntry
+	if err := db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		return tx.Select(&tokens, query, args...)
+	}); err != nil {
+		return nil, nil, err
+	}
+	if q.Limit <= 0 || len(tokens) <= q.Limit {
+		return tokens, nil, nil
+	}
+	tokens = tokens[:q.Limit]
+	return tokens, q.cursor(tokens[len(tokens)-1]), nil
+}
@@ -0,0 +1,91 @@
+package tree
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbtest"
+)
+
+func listTrees() []MytokenEntryTree {
+	var trees []MytokenEntryTree
+	for i, name := range []string{"d", "b", "e", "a", "c"} {
+		e := taggedEntry(name, 10)
+		e.Name = db.NewNullString(name)
+		if i%2 == 0 {
+			e.CreatedAt = 20
+		}
+		trees = append(trees, MytokenEntryTree{Token: e})
+	}
+	return trees
+}
+
+func managementIDs(trees []MytokenEntryTree) (ids []string) {
+	for _, t := range trees {
+		ids = append(ids, t.Token.ManagementID)
+	}
+	return
+}
+
+func checkIDs(t *testing.T, trees []MytokenEntryTree, expected ...string) {
+	ids := managementIDs(trees)
+	if len(ids) != len(expected) {
+		t.Fatalf("Expected '%v', but got '%v'", expected, ids)
+	}
+	for i := range ids {
+		if ids[i] != expected[i] {
+			t.Fatalf("Expected '%v', but got '%v'", expected, ids)
+		}
+	}
+}
+
+func TestQuerySortByCreated(t *testing.T) {
+	checkIDs(t, Query{}.ApplyToTrees(listTrees()), "a", "b", "c", "d", "e")
+}
+
+func TestQuerySortByNameDescending(t *testing.T) {
+	trees := Query{
+		SortBy:     "name",
+		Descending: true,
+	}.ApplyToTrees(listTrees())
+	checkIDs(t, trees, "e", "d", "c", "b", "a")
+}
+
+// TestSubtreePage checks that the children of a subtree are paged with their own subtokens.
+func TestSubtreePage(t *testing.T) {
+	dbtest.Connect(t)
+	id := dbtest.CreateMytoken(t)
+	expected := make(map[string]string)
+	for i := 0; i < 3; i++ {
+		child := dbtest.CreateSubtoken(t, id)
+		grandchild := dbtest.CreateSubtoken(t, child)
+		expected[child.ManagementID()] = grandchild.ManagementID()
+	}
+
+	q := Query{Limit: 2}
+	var children []MytokenEntryTree
+	for i := 0; i < 3; i++ {
+		tree, next, err := SubtreePage(nil, id, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tree.Children) > q.Limit {
+			t.Fatalf("Expected at most %d children, but got %d", q.Limit, len(tree.Children))
+		}
+		children = append(children, tree.Children...)
+		if next == nil {
+			break
+		}
+		q.After = next
+	}
+	if len(children) != len(expected) {
+		t.Fatalf("Expected %d children, but got '%v'", len(expected), managementIDs(children))
+	}
+	for _, c := range children {
+		grandchild, found := expected[c.Token.ManagementID]
+		if !found || len(c.Children) != 1 || c.Children[0].Token.ManagementID != grandchild {
+			t.Errorf("Expected child '%s' with subtoken '%s', but got '%v'", c.Token.ManagementID, grandchild,
+				managementIDs(c.Children))
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package tree
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+// GetTags returns the tags of the passed mytoken
+func GetTags(tx *sqlx.Tx, tokenID mtid.MTID) (tags []string, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		return tx.Select(&tags, `SELECT tag FROM MT_Tags WHERE MT_id=? ORDER BY tag`, tokenID)
+	})
+	return
+}
+
+// loadTags sets the tags of all passed MytokenEntry
+func loadTags(tx *sqlx.Tx, tokens []MytokenEntry) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	ids := make([]string, len(tokens))
+	for i, t := range tokens {
+		ids[i] = t.ID.Hash()
+	}
+	var tags []struct {
+		MTID string `db:"MT_id"`
+		Tag  string
+	}
+	if err := db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		query, args, err := sqlx.In(`SELECT MT_id, tag FROM MT_Tags WHERE MT_id IN (?) ORDER BY tag`, ids)
+		if err != nil {
+			return err
+		}
+		return tx.Select(&tags, tx.Rebind(query), args...)
+	}); err != nil {
+		return err
+	}
+	tagsByID := make(map[string][]string)
+	for _, t := range tags {
+		tagsByID[t.MTID] = append(tagsByID[t.MTID], t.Tag)
+	}
+	for i := range tokens {
+		tokens[i].Tags = tagsByID[tokens[i].ID.Hash()]
+	}
+	return nil
+}
+
+// Filter returns the MytokenEntryTree reduced to the mytokens for which keep returns true; the parents of such
+// mytokens are kept, so the tree structure is preserved. The returned bool indicates if any mytoken in the tree is kept.
+func (t MytokenEntryTree) Filter(keep func(MytokenEntry) bool) (MytokenEntryTree, bool) {
+	filtered := MytokenEntryTree{Token: t.Token}
+	for _, c := range t.Children {
+		if fc, ok := c.Filter(keep); ok {
+			filtered.Children = append(filtered.Children, fc)
+		}
+	}
+	return filtered, len(filtered.Children) > 0 || keep(t.Token)
+}
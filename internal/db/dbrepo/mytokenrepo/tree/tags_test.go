@@ -0,0 +1,67 @@
+package tree
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	"github.com/oidc-mytoken/server/shared/utils/unixtime"
+)
+
+func taggedEntry(name string, created unixtime.UnixTime, tags ...string) MytokenEntry {
+	return MytokenEntry{
+		MytokenEntry: api.MytokenEntry{Tags: tags},
+		ManagementID: name,
+		CreatedAt:    created,
+	}
+}
+
+// taggedTree returns the tree root -> a -> b and root -> c, where only b is tagged with 'ci'
+func taggedTree() MytokenEntryTree {
+	return MytokenEntryTree{
+		Token: taggedEntry("root", 1),
+		Children: []MytokenEntryTree{
+			{
+				Token:    taggedEntry("a", 2, "laptop"),
+				Children: []MytokenEntryTree{{Token: taggedEntry("b", 3, "ci", "laptop")}},
+			},
+			{Token: taggedEntry("c", 4)},
+		},
+	}
+}
+
+func TestFilterByTagKeepsParents(t *testing.T) {
+	filtered := Query{Tag: "ci"}.ApplyToTree(taggedTree())
+	if len(filtered.Children) != 1 || filtered.Children[0].Token.ManagementID != "a" {
+		t.Fatalf("Expected only 'a' as child of root, but got %+v", filtered.Children)
+	}
+	a := filtered.Children[0]
+	if len(a.Children) != 1 || a.Children[0].Token.ManagementID != "b" {
+		t.Errorf("Expected only 'b' as child of 'a', but got %+v", a.Children)
+	}
+}
+
+func TestFilterByTagDropsChildren(t *testing.T) {
+	filtered := Query{Tag: "laptop"}.ApplyToTree(taggedTree())
+	if len(filtered.Children) != 1 || len(filtered.Children[0].Children) != 1 {
+		t.Errorf("Expected 'a' and 'b' to be kept, but got %+v", filtered.Children)
+	}
+}
+
+func TestFilterTreesByTagUnknown(t *testing.T) {
+	if filtered := (Query{Tag: "unknown"}).ApplyToTrees([]MytokenEntryTree{taggedTree()}); len(filtered) != 0 {
+		t.Errorf("Expected no trees, but got %+v", filtered)
+	}
+}
+
+func TestFilterByStatus(t *testing.T) {
+	tree := taggedTree()
+	tree.Children[1].Token.Suspended = true
+	active := Query{Status: api.TokenStatusActive}.ApplyToTree(tree)
+	if len(active.Children) != 1 || active.Children[0].Token.ManagementID != "a" {
+		t.Errorf("Expected only 'a' to be active, but got %+v", active.Children)
+	}
+	suspended := Query{Status: api.TokenStatusSuspended}.ApplyToTree(tree)
+	if len(suspended.Children) != 1 || suspended.Children[0].Token.ManagementID != "c" {
+		t.Errorf("Expected only 'c' to be suspended, but got %+v", suspended.Children)
+	}
+}
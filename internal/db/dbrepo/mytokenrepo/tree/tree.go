@@ -4,6 +4,7 @@ import (
 	"github.com/jmoiron/sqlx"
 
 	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/utils/pagination"
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
 	"github.com/oidc-mytoken/server/shared/utils/unixtime"
@@ -16,10 +17,21 @@ type MytokenEntry struct {
 	ID               mtid.MTID         `json:"-"`
 	ParentID         mtid.MTID         `db:"parent_id" json:"-"`
 	RootID           mtid.MTID         `db:"root_id" json:"-"`
+	ManagementID     string            `db:"management_id" json:"management_id"`
 	Name             db.NullString     `json:"name,omitempty"`
+	Description      db.NullString     `json:"description,omitempty"`
 	CreatedAt        unixtime.UnixTime `db:"created" json:"created"`
+	// The usages of subtokens that count against the usage limits of this token's restrictions
+	DescendantUsagesAT    uint64 `db:"descendant_usages_AT" json:"descendant_usages_AT,omitempty"`
+	DescendantUsagesOther uint64 `db:"descendant_usages_other" json:"descendant_usages_other,omitempty"`
 }
 
+// selectEntryColumns are the columns selected for a MytokenEntry from the MTokens table
+const selectEntryColumns = `id, parent_id, root_id, management_id, name, description, created, ip_created AS ip,
+	suspended_by IS NOT NULL AS suspended,
+	(SELECT COALESCE(SUM(descendant_usages_AT), 0) FROM TokenUsages WHERE MT_id=MTokens.id) AS descendant_usages_AT,
+	(SELECT COALESCE(SUM(descendant_usages_other), 0) FROM TokenUsages WHERE MT_id=MTokens.id) AS descendant_usages_other`
+
 // MytokenEntryTree is a tree of MytokenEntry
 type MytokenEntryTree struct {
 	Token    MytokenEntry       `json:"token"`
@@ -41,53 +53,123 @@ func GetUserID(tx *sqlx.Tx, tokenID mtid.MTID) (uid int64, err error) {
 	return
 }
 
-func AllTokens(tx *sqlx.Tx, tokenID mtid.MTID) (trees []MytokenEntryTree, err error) {
-	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		uid, e := GetUserID(tx, tokenID)
-		if e != nil {
-			return e
-		}
-		trees, err = AllTokensForUser(tx, uid)
-		return err
-	})
-	return
-}
-func AllTokensForUser(tx *sqlx.Tx, uid int64) ([]MytokenEntryTree, error) {
+// descendantsCTE selects the ids of all subtokens of the mytokens with the passed ids
+const descendantsCTE = `
+	WITH Recursive descendants
+	AS
+	(
+		SELECT id FROM MTokens WHERE parent_id IN (?)
+		UNION ALL
+		SELECT mt.id FROM MTokens mt INNER JOIN descendants d WHERE mt.parent_id=d.id
+	)`
+
+// subtokensCTE selects the ids of all subtokens of a mytoken, each with the id of the direct subtoken it descends from
+const subtokensCTE = `
+	WITH Recursive subtokens
+	AS
+	(
+		SELECT id, id AS top FROM MTokens WHERE parent_id=?
+		UNION ALL
+		SELECT mt.id, s.top FROM MTokens mt INNER JOIN subtokens s WHERE mt.parent_id=s.id
+	)`
+
+// withDescendants loads the subtokens and the tags of the passed mytokens and returns their trees
+func withDescendants(tx *sqlx.Tx, tops []MytokenEntry) ([]MytokenEntryTree, error) {
+	trees := []MytokenEntryTree{}
+	if len(tops) == 0 {
+		return trees, nil
+	}
+	ids := make([]string, len(tops))
+	for i, t := range tops {
+		ids[i] = t.ID.Hash()
+	}
 	var tokens []MytokenEntry
 	if err := db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		return tx.Select(&tokens, `SELECT id, parent_id, root_id, name, created, ip_created AS ip FROM MTokens WHERE user_id=?`, uid)
+		query, args, err := sqlx.In(descendantsCTE+` SELECT `+selectEntryColumns+` FROM MTokens WHERE id IN (SELECT id FROM descendants)`, ids)
+		if err != nil {
+			return err
+		}
+		if err = tx.Select(&tokens, tx.Rebind(query), args...); err != nil {
+			return err
+		}
+		all := append(append([]MytokenEntry{}, tops...), tokens...)
+		if err = loadTags(tx, all); err != nil {
+			return err
+		}
+		tops, tokens = all[:len(tops)], all[len(tops):]
+		return nil
 	}); err != nil {
 		return nil, err
 	}
-	return tokensToTrees(tokens), nil
+	var t MytokenEntryTree
+	for _, top := range tops {
+		t, tokens = tokensToTree(top, tokens)
+		trees = append(trees, t)
+	}
+	return trees, nil
 }
 
-func subtokens(tx *sqlx.Tx, rootID mtid.MTID) ([]MytokenEntry, error) {
-	var tokens []MytokenEntry
-	err := db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		return tx.Select(&tokens, `SELECT id, parent_id, root_id, name, created, ip_created AS ip FROM MTokens WHERE root_id=?`, rootID)
+// UserTokensPage returns a page of the token trees of the user of the passed mytoken that match the Query; the
+// pagination applies to the trees, i.e. the root mytokens. If there are more trees, a pagination.Cursor for the next
+// page is returned.
+func UserTokensPage(tx *sqlx.Tx, tokenID mtid.MTID, q Query) (trees []MytokenEntryTree, next *pagination.Cursor, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		uid, err := GetUserID(tx, tokenID)
+		if err != nil {
+			return err
+		}
+		match, matchArgs := q.matchCondition()
+		var roots []MytokenEntry
+		if roots, next, err = q.selectPage(tx, "", []string{
+			"MTokens.user_id=?",
+			"(MTokens.root_id IS NULL OR MTokens.root_id=MTokens.id)",
+			"EXISTS (SELECT 1 FROM MTokens m WHERE (m.id=MTokens.id OR m.root_id=MTokens.id) AND " + match + ")",
+		}, append([]interface{}{uid}, matchArgs...)); err != nil {
+			return err
+		}
+		trees, err = withDescendants(tx, roots)
+		return err
 	})
-	return tokens, err
+	if err != nil {
+		return nil, nil, err
+	}
+	return q.ApplyToTrees(trees), next, nil
 }
 
-func TokenSubTree(tx *sqlx.Tx, tokenID mtid.MTID) (MytokenEntryTree, error) {
-	var tokens []MytokenEntry
-	var root MytokenEntry
-	if err := db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		var err error
-		if err = tx.Get(&root, `SELECT id, parent_id, root_id, name, created, ip_created AS ip FROM MTokens WHERE id=?`, tokenID); err != nil {
+// SubtreePage returns the subtree of the passed mytoken with a page of its children that match the Query; the
+// pagination applies to the direct subtokens. If there are more, a pagination.Cursor for the next page is returned.
+func SubtreePage(tx *sqlx.Tx, tokenID mtid.MTID, q Query) (tree MytokenEntryTree, next *pagination.Cursor, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		if tree.Token, err = GetEntry(tx, tokenID); err != nil {
 			return err
 		}
-		if root.Root() {
-			root.RootID = root.ID
+		match, matchArgs := q.matchCondition()
+		var children []MytokenEntry
+		if children, next, err = q.selectPage(tx, subtokensCTE, []string{
+			"MTokens.parent_id=?",
+			"MTokens.id IN (SELECT s.top FROM subtokens s JOIN MTokens m ON m.id=s.id WHERE " + match + ")",
+		}, append([]interface{}{tokenID, tokenID}, matchArgs...)); err != nil {
+			return err
 		}
-		tokens, err = subtokens(tx, root.RootID)
+		tree.Children, err = withDescendants(tx, children)
 		return err
-	}); err != nil {
-		return MytokenEntryTree{}, err
+	})
+	if err != nil {
+		return MytokenEntryTree{}, nil, err
 	}
-	tree, _ := tokensToTree(root, tokens)
-	return tree, nil
+	return q.ApplyToTree(tree), next, nil
+}
+
+// GetEntry returns the MytokenEntry of the passed mytoken
+func GetEntry(tx *sqlx.Tx, tokenID mtid.MTID) (entry MytokenEntry, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		if err := tx.Get(&entry, `SELECT `+selectEntryColumns+` FROM MTokens WHERE id=?`, tokenID); err != nil {
+			return err
+		}
+		entry.Tags, err = GetTags(tx, tokenID)
+		return err
+	})
+	return
 }
 
 func tokensToTrees(tokens []MytokenEntry) (trees []MytokenEntryTree) {
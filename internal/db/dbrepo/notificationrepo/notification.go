@@ -0,0 +1,192 @@
+package notificationrepo
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/utils/hashUtils"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+// GetSettings returns the notification settings of the user of the passed mytoken
+func GetSettings(tx *sqlx.Tx, id mtid.MTID) (settings api.NotificationSettings, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		var email db.NullString
+		if err := tx.Get(&email, `SELECT u.notification_email FROM Users u JOIN MTokens m ON m.user_id=u.id WHERE m.id=?`, id); err != nil {
+			return err
+		}
+		settings.Email = email.String
+		var pending []string
+		if err := tx.Select(&pending, `SELECT c.email FROM NotificationEmailConfirmations c JOIN MTokens m ON m.user_id=c.user_id
+			WHERE m.id=? AND c.expires_at > CURRENT_TIMESTAMP()`, id); err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			settings.PendingEmail = pending[0]
+		}
+		settings.Subscriptions = []string{}
+		return tx.Select(&settings.Subscriptions, `SELECT ns.notification FROM NotificationSubscriptions ns JOIN MTokens m ON m.user_id=ns.user_id WHERE m.id=? ORDER BY ns.notification`, id)
+	})
+	return
+}
+
+// SetSettings replaces the notification settings of the user of the passed mytoken. A new email address is only used
+// after it was confirmed: it is stored together with the passed confirmation code, which expires after lifetime
+// seconds, and pending is true. An empty email address removes the address.
+func SetSettings(tx *sqlx.Tx, id mtid.MTID, settings api.NotificationSettings, code string, lifetime int) (pending bool, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		var user struct {
+			ID    uint64        `db:"id"`
+			Email db.NullString `db:"notification_email"`
+		}
+		if err := tx.Get(&user, `SELECT u.id, u.notification_email FROM Users u JOIN MTokens m ON m.user_id=u.id WHERE m.id=?`, id); err != nil {
+			return err
+		}
+		// A pending change is replaced in any case
+		if _, err := tx.Exec(`DELETE FROM NotificationEmailConfirmations WHERE user_id=?`, user.ID); err != nil {
+			return err
+		}
+		switch settings.Email {
+		case "":
+			if _, err := tx.Exec(`UPDATE Users SET notification_email=NULL WHERE id=?`, user.ID); err != nil {
+				return err
+			}
+		case user.Email.String:
+		default:
+			if _, err := tx.Exec(`INSERT INTO NotificationEmailConfirmations (user_id, email, code, expires_at)
+				VALUES(?, ?, ?, TIMESTAMPADD(SECOND, ?, CURRENT_TIMESTAMP()))`,
+				user.ID, settings.Email, hashUtils.SHA512Str([]byte(code)), lifetime); err != nil {
+				return err
+			}
+			pending = true
+		}
+		if _, err := tx.Exec(`DELETE FROM NotificationSubscriptions WHERE user_id=?`, user.ID); err != nil {
+			return err
+		}
+		for _, n := range settings.Subscriptions {
+			if _, err := tx.Exec(`INSERT IGNORE INTO NotificationSubscriptions (user_id, notification) VALUES(?, ?)`, user.ID, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// ConfirmEmail confirms the pending email address with the passed confirmation code, which then becomes the address
+// notifications are sent to; confirmed is false if the code is unknown or expired
+func ConfirmEmail(tx *sqlx.Tx, code string) (confirmed bool, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		var confirmations []struct {
+			UserID uint64 `db:"user_id"`
+			Email  string `db:"email"`
+		}
+		if err := tx.Select(&confirmations, `SELECT user_id, email FROM NotificationEmailConfirmations
+			WHERE code=? AND expires_at > CURRENT_TIMESTAMP()`, hashUtils.SHA512Str([]byte(code))); err != nil {
+			return err
+		}
+		if len(confirmations) == 0 {
+			return nil
+		}
+		c := confirmations[0]
+		if _, err := tx.Exec(`UPDATE Users SET notification_email=? WHERE id=?`, c.Email, c.UserID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM NotificationEmailConfirmations WHERE user_id=?`, c.UserID); err != nil {
+			return err
+		}
+		confirmed = true
+		return nil
+	})
+	return
+}
+
+// DeleteExpiredEmailConfirmations deletes the pending email addresses whose confirmation code expired
+func DeleteExpiredEmailConfirmations(tx *sqlx.Tx) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`DELETE FROM NotificationEmailConfirmations WHERE expires_at <= CURRENT_TIMESTAMP()`)
+		return err
+	})
+}
+
+// GetRecipient returns the email address of the user of the passed mytoken if the user subscribed to the passed
+// notification; found is false otherwise
+func GetRecipient(tx *sqlx.Tx, id mtid.MTID, notification string) (email string, found bool, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		var emails []string
+		if err := tx.Select(&emails, `SELECT u.notification_email FROM Users u
+			JOIN MTokens m ON m.user_id=u.id
+			JOIN NotificationSubscriptions ns ON ns.user_id=u.id
+			WHERE m.id=? AND ns.notification=? AND u.notification_email IS NOT NULL`, id, notification); err != nil {
+			return err
+		}
+		if len(emails) > 0 {
+			email, found = emails[0], true
+		}
+		return nil
+	})
+	return
+}
+
+// GetEmail returns the email address the user of the passed mytoken set for notifications; found is false if no
+// address is set
+func GetEmail(tx *sqlx.Tx, id mtid.MTID) (email string, found bool, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		var e db.NullString
+		if err := tx.Get(&e, `SELECT u.notification_email FROM Users u JOIN MTokens m ON m.user_id=u.id WHERE m.id=?`, id); err != nil {
+			return err
+		}
+		email, found = e.String, e.Valid
+		return nil
+	})
+	return
+}
+
+// ExpiringMytoken is a mytoken that expires soon and whose user subscribed to the expiring_soon notification
+type ExpiringMytoken struct {
+	ID           mtid.MTID     `db:"id"`
+	Name         db.NullString `db:"name"`
+	ManagementID string        `db:"management_id"`
+	ExpiresAt    int64         `db:"expires_at"`
+	Email        string        `db:"notification_email"`
+}
+
+// GetExpiringMytokens returns the mytokens that expire within the passed number of seconds and for which no
+// expiring_soon notification was sent yet
+func GetExpiringMytokens(tx *sqlx.Tx, within int) (mts []ExpiringMytoken, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		return tx.Select(&mts, `SELECT m.id, m.name, m.management_id, UNIX_TIMESTAMP(m.expires_at) AS expires_at, u.notification_email
+			FROM MTokens m
+			JOIN Users u ON u.id=m.user_id
+			JOIN NotificationSubscriptions ns ON ns.user_id=u.id
+			WHERE ns.notification=? AND u.notification_email IS NOT NULL AND m.expiry_notified=0
+			AND m.expires_at > CURRENT_TIMESTAMP() AND m.expires_at <= TIMESTAMPADD(SECOND, ?, CURRENT_TIMESTAMP())`,
+			api.NotificationExpiringSoon, within)
+	})
+	return
+}
+
+// MarkExpiryNotified marks that the expiring_soon notification is sent for the passed mytoken; marked is false if it
+// was already marked before
+func MarkExpiryNotified(tx *sqlx.Tx, id mtid.MTID) (marked bool, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		res, err := tx.Exec(`UPDATE MTokens SET expiry_notified=1 WHERE id=? AND expiry_notified=0`, id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		marked = n > 0
+		return err
+	})
+	return
+}
+
+// UnmarkExpiryNotified reverts MarkExpiryNotified for the passed mytoken, so that the expiring_soon notification is
+// sent again by the next check
+func UnmarkExpiryNotified(tx *sqlx.Tx, id mtid.MTID) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`UPDATE MTokens SET expiry_notified=0 WHERE id=?`, id)
+		return err
+	})
+}
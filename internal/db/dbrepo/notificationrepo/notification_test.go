@@ -0,0 +1,44 @@
+package notificationrepo
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/db/dbtest"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+)
+
+// TestEmailConfirmation checks that a new notification email address is only used after it was confirmed.
+func TestEmailConfirmation(t *testing.T) {
+	dbtest.Connect(t)
+	id := dbtest.CreateMytoken(t)
+	settings := api.NotificationSettings{
+		Email:         "user@example.com",
+		Subscriptions: []string{api.NotificationExpiringSoon},
+	}
+	pending, err := SetSettings(nil, id, settings, "code", 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pending {
+		t.Fatal("Expected the new email address to be pending")
+	}
+	if _, found, err := GetRecipient(nil, id, api.NotificationExpiringSoon); err != nil || found {
+		t.Fatalf("Expected no recipient before the confirmation, got found=%v, err=%v", found, err)
+	}
+	if confirmed, err := ConfirmEmail(nil, "wrong"); err != nil || confirmed {
+		t.Fatalf("Expected a wrong code not to confirm the email address, got confirmed=%v, err=%v", confirmed, err)
+	}
+	if confirmed, err := ConfirmEmail(nil, "code"); err != nil || !confirmed {
+		t.Fatalf("Expected the email address to be confirmed, got confirmed=%v, err=%v", confirmed, err)
+	}
+	email, found, err := GetRecipient(nil, id, api.NotificationExpiringSoon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || email != settings.Email {
+		t.Errorf("Expected recipient '%s', got '%s'", settings.Email, email)
+	}
+	if pending, err = SetSettings(nil, id, settings, "other", 3600); err != nil || pending {
+		t.Errorf("Expected the confirmed email address not to be pending again, got pending=%v, err=%v", pending, err)
+	}
+}
@@ -18,6 +18,14 @@ func UpdateRefreshToken(tx *sqlx.Tx, tokenID mtid.MTID, newRT, jwt string) error
 		if err != nil {
 			return err
 		}
+		return UpdateRefreshTokenWithKey(tx, rtID, newRT, key)
+	})
+}
+
+// UpdateRefreshTokenWithKey updates a refresh token in the database using an already decrypted encryption key, all
+// occurrences of the RT are updated.
+func UpdateRefreshTokenWithKey(tx *sqlx.Tx, rtID uint64, newRT string, key []byte) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
 		updatedRT, err := cryptUtils.AESEncrypt(newRT, key)
 		if err != nil {
 			return err
@@ -57,29 +65,50 @@ func (k encryptionKey) decrypt(jwt string) ([]byte, error) {
 }
 
 type rtStruct struct {
-	RT  string        `db:"refresh_token"`
-	Key encryptionKey `db:"encryption_key"`
+	RT   string        `db:"refresh_token"`
+	Key  encryptionKey `db:"encryption_key"`
+	RTID uint64        `db:"rt_id"`
 }
 
-func (rt rtStruct) decrypt(jwt string) (string, error) {
-	key, err := rt.Key.decrypt(jwt)
-	if err != nil {
-		return "", err
-	}
-	return cryptUtils.AESDecrypt(rt.RT, key)
+// RefreshTokenEntry holds a decrypted refresh token together with its decrypted encryption key, so that a changed
+// refresh token can be stored without querying the key again
+type RefreshTokenEntry struct {
+	RT   string
+	Key  []byte
+	RTID uint64
 }
 
 // GetRefreshToken returns the refresh token for a mytoken id
 func GetRefreshToken(tx *sqlx.Tx, myid mtid.MTID, jwt string) (string, bool, error) {
+	rt, found, err := GetRefreshTokenEntry(tx, myid, jwt)
+	if rt == nil {
+		return "", found, err
+	}
+	return rt.RT, found, err
+}
+
+// GetRefreshTokenEntry returns the refresh token for a mytoken id together with its encryption key
+func GetRefreshTokenEntry(tx *sqlx.Tx, myid mtid.MTID, jwt string) (*RefreshTokenEntry, bool, error) {
 	var rt rtStruct
 	found, err := helper.ParseError(db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		return tx.Get(&rt, `SELECT refresh_token, encryption_key FROM MyTokens WHERE id=?`, myid)
+		return tx.Get(&rt, `SELECT refresh_token, encryption_key, rt_id FROM MyTokens WHERE id=?`, myid)
 	}))
 	if !found {
-		return "", found, err
+		return nil, found, err
+	}
+	key, err := rt.Key.decrypt(jwt)
+	if err != nil {
+		return nil, true, err
+	}
+	plainRT, err := cryptUtils.AESDecrypt(rt.RT, key)
+	if err != nil {
+		return nil, true, err
 	}
-	plainRT, err := rt.decrypt(jwt)
-	return plainRT, true, err
+	return &RefreshTokenEntry{
+		RT:   plainRT,
+		Key:  key,
+		RTID: rt.RTID,
+	}, true, nil
 }
 
 // DeleteRefreshToken deletes a refresh token
@@ -0,0 +1,169 @@
+package webhookrepo
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+// Webhook is a webhook subscription of a user
+type Webhook struct {
+	ID     uint64        `db:"id"`
+	URL    string        `db:"url"`
+	Events db.NullString `db:"events"`
+	Secret db.NullString `db:"secret"`
+}
+
+// Subscription returns the api.WebhookSubscription for this Webhook; the secret is not included
+func (w Webhook) Subscription() api.WebhookSubscription {
+	s := api.WebhookSubscription{
+		ID:        w.ID,
+		URL:       w.URL,
+		HasSecret: w.Secret.Valid,
+	}
+	if w.Events.Valid {
+		s.Events = strings.Split(w.Events.String, ",")
+	}
+	return s
+}
+
+// GetWebhooks returns the webhook subscriptions of the user of the passed mytoken
+func GetWebhooks(tx *sqlx.Tx, id mtid.MTID) (webhooks []Webhook, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		return tx.Select(&webhooks, `SELECT w.id, w.url, w.events, w.secret FROM Webhooks w JOIN MTokens m ON m.user_id=w.user_id WHERE m.id=? ORDER BY w.id`, id)
+	})
+	return
+}
+
+// AddWebhook adds a webhook subscription for the user of the passed mytoken; if no events are passed, all events are
+// delivered
+func AddWebhook(tx *sqlx.Tx, id mtid.MTID, url string, events []string, secret string) (webhookID uint64, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		res, err := tx.Exec(`INSERT INTO Webhooks (user_id, url, events, secret) SELECT user_id, ?, ?, ? FROM MTokens WHERE id=?`,
+			url, db.NewNullString(strings.Join(events, ",")), db.NewNullString(secret), id)
+		if err != nil {
+			return err
+		}
+		lastID, err := res.LastInsertId()
+		webhookID = uint64(lastID)
+		return err
+	})
+	return
+}
+
+// RemoveWebhook removes a webhook subscription of the user of the passed mytoken; found is false if the user has no
+// webhook with this id
+func RemoveWebhook(tx *sqlx.Tx, id mtid.MTID, webhookID uint64) (found bool, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		res, err := tx.Exec(`DELETE FROM Webhooks WHERE id=? AND user_id=(SELECT user_id FROM MTokens WHERE id=?)`, webhookID, id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		found = n > 0
+		return err
+	})
+	return
+}
+
+// EnqueueForUser enqueues a delivery of the payload to each webhook of the user of the passed mytoken that subscribed
+// to the passed event
+func EnqueueForUser(tx *sqlx.Tx, id mtid.MTID, event string, payload []byte) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`INSERT INTO WebhookDeliveries (webhook_id, payload)
+			SELECT w.id, ? FROM Webhooks w JOIN MTokens m ON m.user_id=w.user_id
+			WHERE m.id=? AND (w.events IS NULL OR FIND_IN_SET(?, w.events) > 0)`,
+			string(payload), id, event)
+		return err
+	})
+}
+
+// EnqueueForOperator enqueues a delivery of the payload to the operator webhook with the passed name
+func EnqueueForOperator(tx *sqlx.Tx, name string, payload []byte) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`INSERT INTO WebhookDeliveries (operator_webhook, payload) VALUES(?, ?)`, name, string(payload))
+		return err
+	})
+}
+
+// Delivery is a pending delivery of a payload to a webhook. For user webhooks URL and Secret are taken from the
+// subscription, for operator webhooks only OperatorWebhook is set.
+type Delivery struct {
+	ID              uint64        `db:"id"`
+	WebhookID       sql.NullInt64 `db:"webhook_id"`
+	OperatorWebhook db.NullString `db:"operator_webhook"`
+	URL             db.NullString `db:"url"`
+	Secret          db.NullString `db:"secret"`
+	Payload         string        `db:"payload"`
+	Attempts        int           `db:"attempts"`
+}
+
+// Webhook returns a key identifying the webhook the delivery is for
+func (d Delivery) Webhook() string {
+	if d.OperatorWebhook.Valid {
+		return "operator:" + d.OperatorWebhook.String
+	}
+	return "user:" + strconv.FormatInt(d.WebhookID.Int64, 10)
+}
+
+// GetDueDeliveries returns up to limit deliveries whose next attempt is due, either those to operator webhooks or those
+// to user webhooks. At most perWebhook deliveries are returned for each webhook, so that a webhook with a large backlog
+// does not crowd out the others.
+func GetDueDeliveries(tx *sqlx.Tx, operator bool, perWebhook, limit int) (deliveries []Delivery, err error) {
+	queue := `d.operator_webhook IS NULL`
+	if operator {
+		queue = `d.operator_webhook IS NOT NULL`
+	}
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		return tx.Select(&deliveries, `SELECT id, webhook_id, operator_webhook, url, secret, payload, attempts FROM (
+				SELECT d.id, d.webhook_id, d.operator_webhook, w.url, w.secret, d.payload, d.attempts, d.next_attempt,
+					ROW_NUMBER() OVER (PARTITION BY d.webhook_id, d.operator_webhook ORDER BY d.next_attempt, d.id) AS n
+				FROM WebhookDeliveries d LEFT JOIN Webhooks w ON w.id=d.webhook_id
+				WHERE d.next_attempt <= CURRENT_TIMESTAMP() AND `+queue+`
+			) due WHERE n <= ? ORDER BY next_attempt, id LIMIT ?`, perWebhook, limit)
+	})
+	return
+}
+
+// Claim claims a delivery for an attempt by counting the attempt and moving its next attempt lease seconds into the
+// future, so that no other server instance picks it up meanwhile. claimed is false if the delivery was claimed by
+// someone else since it was read.
+func Claim(tx *sqlx.Tx, d Delivery, lease int) (claimed bool, err error) {
+	err = db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		res, err := tx.Exec(`UPDATE WebhookDeliveries SET attempts=attempts+1, next_attempt=TIMESTAMPADD(SECOND, ?, CURRENT_TIMESTAMP()) WHERE id=? AND attempts=?`,
+			lease, d.ID, d.Attempts)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		claimed = n > 0
+		return err
+	})
+	return
+}
+
+// Reschedule schedules the next attempt of a failed delivery in delay seconds
+func Reschedule(tx *sqlx.Tx, deliveryID uint64, delay int, lastError string) error {
+	if len(lastError) > 256 {
+		lastError = lastError[:256]
+	}
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`UPDATE WebhookDeliveries SET next_attempt=TIMESTAMPADD(SECOND, ?, CURRENT_TIMESTAMP()), last_error=? WHERE id=?`,
+			delay, lastError, deliveryID)
+		return err
+	})
+}
+
+// Delete removes a delivery from the queue
+func Delete(tx *sqlx.Tx, deliveryID uint64) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`DELETE FROM WebhookDeliveries WHERE id=?`, deliveryID)
+		return err
+	})
+}
@@ -0,0 +1,94 @@
+// Package dbtest provides helpers for tests and benchmarks that need a mytoken database. Such tests call Connect first;
+// since a database is not available in every environment, they are skipped unless MYTOKEN_TEST_DB_HOST is set, so
+// their doc comments do not repeat this.
+package dbtest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+// Connect connects to the test database configured through the MYTOKEN_TEST_DB_* environment variables; if
+// MYTOKEN_TEST_DB_HOST is not set, the test is skipped, so that the unit tests can run without a database
+func Connect(tb testing.TB) {
+	host := os.Getenv("MYTOKEN_TEST_DB_HOST")
+	if host == "" {
+		tb.Skip("MYTOKEN_TEST_DB_HOST not set")
+	}
+	if config.Get() == nil {
+		config.LoadDefault()
+	}
+	db.ConnectConfig(config.DBConf{
+		Hosts:             []string{host},
+		User:              os.Getenv("MYTOKEN_TEST_DB_USER"),
+		Password:          os.Getenv("MYTOKEN_TEST_DB_PASSWORD"),
+		DB:                os.Getenv("MYTOKEN_TEST_DB_DB"),
+		ReconnectInterval: 60,
+	})
+}
+
+// CreateMytoken inserts a minimal mytoken together with its user and refresh token; it is deleted when the test
+// finishes
+func CreateMytoken(tb testing.TB) mtid.MTID {
+	id := mtid.New()
+	if err := db.Transact(func(tx *sqlx.Tx) error {
+		res, err := tx.Exec(`INSERT INTO Users (sub, iss) VALUES (?, ?)`, id.Hash(), "https://test.example.com")
+		if err != nil {
+			return err
+		}
+		userID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		res, err = tx.Exec(`INSERT INTO RefreshTokens (rt) VALUES ('')`)
+		if err != nil {
+			return err
+		}
+		rtID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO MTokens (id, ip_created, user_id, rt_id, seqno, management_id) VALUES (?, '127.0.0.1', ?, ?, 1, ?)`, id, userID, rtID, id.ManagementID())
+		return err
+	}); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		if err := db.Transact(func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`DELETE FROM Users WHERE sub=?`, id.Hash())
+			return err
+		}); err != nil {
+			tb.Error(err)
+		}
+	})
+	return id
+}
+
+// CreateSubtoken inserts a minimal subtoken of the passed mytoken; like a real subtoken, it belongs to the user of its
+// parent, shares its refresh token, and has the parent's root as root. It is deleted when the test finishes.
+func CreateSubtoken(tb testing.TB, parentID mtid.MTID) mtid.MTID {
+	id := mtid.New()
+	if err := db.Transact(func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`INSERT INTO MTokens (id, parent_id, root_id, ip_created, user_id, rt_id, seqno, management_id)
+			SELECT ?, id, COALESCE(root_id, id), '127.0.0.1', user_id, rt_id, 1, ? FROM MTokens WHERE id=?`,
+			id, id.ManagementID(), parentID)
+		return err
+	}); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		if err := db.Transact(func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`DELETE FROM MTokens WHERE id=?`, id)
+			return err
+		}); err != nil {
+			tb.Error(err)
+		}
+	})
+	return id
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/server/routes"
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 	pkgModel "github.com/oidc-mytoken/server/shared/model"
+	"github.com/oidc-mytoken/server/shared/mytoken/profiles"
 	"github.com/oidc-mytoken/server/shared/utils"
 )
 
@@ -44,6 +45,9 @@ func Init() {
 	addAccessTokenGrant(mytokenConfig)
 	addSignedJWTGrant(mytokenConfig)
 	addTokenInfo(mytokenConfig)
+	addNotifications(mytokenConfig)
+	addWebhooks(mytokenConfig)
+	addEventStream(mytokenConfig)
 }
 
 func basicConfiguration() *pkg.MytokenConfiguration {
@@ -51,16 +55,19 @@ func basicConfiguration() *pkg.MytokenConfiguration {
 	otherPaths := routes.GetGeneralPaths()
 	return &pkg.MytokenConfiguration{
 		MytokenConfiguration: api.MytokenConfiguration{
-			Issuer:               config.Get().IssuerURL,
-			AccessTokenEndpoint:  utils.CombineURLPath(config.Get().IssuerURL, apiPaths.AccessTokenEndpoint),
-			MytokenEndpoint:      utils.CombineURLPath(config.Get().IssuerURL, apiPaths.MytokenEndpoint),
-			TokeninfoEndpoint:    utils.CombineURLPath(config.Get().IssuerURL, apiPaths.TokenInfoEndpoint),
-			UserSettingsEndpoint: utils.CombineURLPath(config.Get().IssuerURL, apiPaths.UserSettingEndpoint),
-			JWKSURI:              utils.CombineURLPath(config.Get().IssuerURL, otherPaths.JWKSEndpoint),
-			ProvidersSupported:   getProvidersFromConfig(),
-			TokenSigningAlgValue: config.Get().Signing.Alg,
-			ServiceDocumentation: config.Get().ServiceDocumentation,
-			Version:              version.VERSION(),
+			Issuer:                config.Get().IssuerURL,
+			AccessTokenEndpoint:   utils.CombineURLPath(config.Get().IssuerURL, apiPaths.AccessTokenEndpoint),
+			MytokenEndpoint:       utils.CombineURLPath(config.Get().IssuerURL, apiPaths.MytokenEndpoint),
+			TokeninfoEndpoint:     utils.CombineURLPath(config.Get().IssuerURL, apiPaths.TokenInfoEndpoint),
+			UserSettingsEndpoint:  utils.CombineURLPath(config.Get().IssuerURL, apiPaths.UserSettingEndpoint),
+			JWKSURI:               utils.CombineURLPath(config.Get().IssuerURL, otherPaths.JWKSEndpoint),
+			ProvidersSupported:    getProvidersFromConfig(),
+			TokenSigningAlgValue:  config.Get().Signing.Alg,
+			ServiceDocumentation:  config.Get().ServiceDocumentation,
+			Version:               version.VERSION(),
+			RestrictionProfiles:   profiles.RestrictionProfiles(),
+			CapabilityProfiles:    profiles.CapabilityProfiles(),
+			CapabilitiesSupported: api.CapabilityCatalogue(),
 		},
 		AccessTokenEndpointGrantTypesSupported: []pkgModel.GrantType{pkgModel.GrantTypeMytoken},
 		MytokenEndpointGrantTypesSupported:     []pkgModel.GrantType{pkgModel.GrantTypeOIDCFlow, pkgModel.GrantTypeMytoken},
@@ -72,6 +79,7 @@ func basicConfiguration() *pkg.MytokenConfiguration {
 func addTokenRevocation(mytokenConfig *pkg.MytokenConfiguration) {
 	if config.Get().Features.TokenRevocation.Enabled {
 		mytokenConfig.RevocationEndpoint = utils.CombineURLPath(config.Get().IssuerURL, routes.GetCurrentAPIPaths().RevocationEndpoint)
+		mytokenConfig.RevokeAllEndpoint = utils.CombineURLPath(config.Get().IssuerURL, routes.GetCurrentAPIPaths().RevokeAllEndpoint)
 	}
 }
 func addShortTokens(mytokenConfig *pkg.MytokenConfiguration) {
@@ -96,11 +104,24 @@ func addAccessTokenGrant(mytokenConfig *pkg.MytokenConfiguration) {
 		pkgModel.GrantTypeAccessToken.AddToSliceIfNotFound(&mytokenConfig.MytokenEndpointGrantTypesSupported)
 	}
 }
+func addNotifications(mytokenConfig *pkg.MytokenConfiguration) {
+	if config.Get().Features.Notifications.Email.Enabled {
+		mytokenConfig.NotificationsSupported = api.AllNotifications[:]
+	}
+}
 func addSignedJWTGrant(mytokenConfig *pkg.MytokenConfiguration) {
 	if config.Get().Features.SignedJWTGrant.Enabled {
 		pkgModel.GrantTypePrivateKeyJWT.AddToSliceIfNotFound(&mytokenConfig.MytokenEndpointGrantTypesSupported)
 	}
 }
+func addEventStream(mytokenConfig *pkg.MytokenConfiguration) {
+	if config.Get().Features.EventStream.Enabled {
+		mytokenConfig.EventStreamEndpoint = utils.CombineURLPath(config.Get().IssuerURL, routes.GetCurrentAPIPaths().EventStreamEndpoint)
+	}
+}
+func addWebhooks(mytokenConfig *pkg.MytokenConfiguration) {
+	mytokenConfig.WebhooksSupported = config.Get().Features.Webhooks.Enabled
+}
 func addTokenInfo(mytokenConfig *pkg.MytokenConfiguration) {
 	if !config.Get().Features.TokenInfo.Enabled {
 		mytokenConfig.TokeninfoEndpoint = ""
@@ -114,8 +135,21 @@ func addTokenInfo(mytokenConfig *pkg.MytokenConfiguration) {
 		if config.Get().Features.TokenInfo.Tree.Enabled {
 			pkgModel.TokeninfoActionSubtokenTree.AddToSliceIfNotFound(&mytokenConfig.TokenInfoEndpointActionsSupported)
 		}
+		if config.Get().Features.TokenInfo.History.Enabled && config.Get().Features.TokenInfo.Tree.Enabled {
+			pkgModel.TokeninfoActionSubtreeEventHistory.AddToSliceIfNotFound(&mytokenConfig.TokenInfoEndpointActionsSupported)
+		}
 		if config.Get().Features.TokenInfo.List.Enabled {
 			pkgModel.TokeninfoActionListMytokens.AddToSliceIfNotFound(&mytokenConfig.TokenInfoEndpointActionsSupported)
 		}
+		if config.Get().Features.TokenInfo.Suspend.Enabled {
+			pkgModel.TokeninfoActionSuspend.AddToSliceIfNotFound(&mytokenConfig.TokenInfoEndpointActionsSupported)
+			pkgModel.TokeninfoActionResume.AddToSliceIfNotFound(&mytokenConfig.TokenInfoEndpointActionsSupported)
+		}
+		if config.Get().Features.TokenInfo.Metadata.Enabled {
+			pkgModel.TokeninfoActionUpdateMetadata.AddToSliceIfNotFound(&mytokenConfig.TokenInfoEndpointActionsSupported)
+		}
+		if config.Get().Features.TokenInfo.AnomalyPolicy.Enabled {
+			pkgModel.TokeninfoActionAnomalyPolicy.AddToSliceIfNotFound(&mytokenConfig.TokenInfoEndpointActionsSupported)
+		}
 	}
 }
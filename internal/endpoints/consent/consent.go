@@ -18,6 +18,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/oidc/authcode"
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 	model2 "github.com/oidc-mytoken/server/shared/model"
+	"github.com/oidc-mytoken/server/shared/mytoken/profiles"
 	"github.com/oidc-mytoken/server/shared/utils"
 )
 
@@ -32,6 +33,12 @@ func handleConsent(ctx *fiber.Ctx, authInfo *authcodeinforepo.AuthFlowInfoOut) e
 		"capabilities": pkg.WebCapabilities(c),
 		"iss":          authInfo.Issuer,
 	}
+	if p, ok := profiles.RestrictionProfile(authInfo.RestrictionProfile); ok {
+		binding["restriction-profile"] = p
+	}
+	if p, ok := profiles.CapabilityProfile(authInfo.CapabilityProfile); ok {
+		binding["capability-profile"] = p
+	}
 	if c.Has(api.CapabilityCreateMT) {
 		if len(sc) == 0 {
 			sc = c
@@ -108,7 +115,24 @@ func HandleConsentPost(ctx *fiber.Ctx) error {
 			}.Send(ctx)
 		}
 	}
-	if err := authcodeinforepo.UpdateTokenInfoByState(nil, oState, req.Restrictions, req.Capabilities, req.SubtokenCapabilities); err != nil {
+	authInfo, err := authcodeinforepo.GetAuthFlowInfoByState(oState)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Response{
+				Status:   fiber.StatusBadRequest,
+				Response: api.APIErrorStateMismatch,
+			}.Send(ctx)
+		}
+		return model.ErrorToInternalServerErrorResponse(err).Send(ctx)
+	}
+	// the restriction profile is applied now, so that its relative times start with the consent
+	if err = profiles.ApplyRestrictionProfile(authInfo.RestrictionProfile, authInfo.IP, &req.Restrictions); err != nil {
+		return model.Response{
+			Status:   fiber.StatusBadRequest,
+			Response: model2.BadRequestError(err.Error()),
+		}.Send(ctx)
+	}
+	if err = authcodeinforepo.UpdateTokenInfoByState(nil, oState, req.Restrictions, req.Capabilities, req.SubtokenCapabilities); err != nil {
 		return model.ErrorToInternalServerErrorResponse(err).Send(ctx)
 	}
 	provider, ok := config.Get().ProviderByIssuer[req.Issuer]
@@ -118,7 +142,7 @@ func HandleConsentPost(ctx *fiber.Ctx) error {
 			Response: api.APIErrorUnknownIssuer,
 		}.Send(ctx)
 	}
-	authURL := authcode.GetAuthorizationURL(provider, oState.State(), req.Restrictions)
+	authURL := authcode.GetAuthorizationURL(provider, oState.State(), req.Restrictions, authInfo.Reauthenticate)
 	return model.Response{
 		Status: 278,
 		Response: map[string]string{
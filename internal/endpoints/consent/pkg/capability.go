@@ -8,15 +8,39 @@ import (
 type WebCapability struct {
 	api.Capability
 	intClass *int
+	Parent   string
+	Level    int
 }
 
+// WebCapabilities creates a flat list of WebCapability from api.Capabilities, where each umbrella capability is
+// followed by the capabilities it implies
 func WebCapabilities(cc api.Capabilities) (wc []WebCapability) {
 	for _, c := range cc {
-		wc = append(wc, WebCapability{c, nil})
+		if impliedByOther(c, cc) {
+			continue
+		}
+		wc = appendWebCapability(wc, c, "", 0)
 	}
 	return
 }
 
+func appendWebCapability(wc []WebCapability, c api.Capability, parent string, level int) []WebCapability {
+	wc = append(wc, WebCapability{Capability: c, Parent: parent, Level: level})
+	for _, child := range c.Children() {
+		wc = appendWebCapability(wc, child, c.Name, level+1)
+	}
+	return wc
+}
+
+func impliedByOther(c api.Capability, cc api.Capabilities) bool {
+	for _, o := range cc {
+		if o.Name != c.Name && o.Implies(c) {
+			return true
+		}
+	}
+	return false
+}
+
 // internal classes
 const (
 	intClassNormal = iota
@@ -27,12 +51,23 @@ const (
 var normalCapabilities = []string{
 	api.CapabilityAT.Name,
 	api.CapabilityCreateMT.Name,
+	api.CapabilityTokeninfo.Name,
 	api.CapabilityTokeninfoIntrospect.Name,
 	api.CapabilityTokeninfoHistory.Name,
 	api.CapabilityTokeninfoTree.Name,
 }
-var warningCapabilities = []string{api.CapabilityListMT.Name}
-var dangerCapabilities = []string{api.CapabilitySettings.Name}
+var warningCapabilities = []string{
+	api.CapabilityListMT.Name,
+	api.CapabilityReadManageMT.Name,
+	api.CapabilityReadSettings.Name,
+	api.CapabilitySuspendMT.Name,
+	api.CapabilityUpdateMTMetadata.Name,
+}
+var dangerCapabilities = []string{
+	api.CapabilitySettings.Name,
+	api.CapabilityManageMT.Name,
+	api.CapabilityRevokeAnyToken.Name,
+}
 
 func (c WebCapability) getIntClass() int {
 	if c.intClass != nil {
@@ -74,6 +109,11 @@ func (c WebCapability) CapabilityLevel() string {
 	return ""
 }
 
+// Indent returns the indentation (in rem) of this capability on the consent page
+func (c WebCapability) Indent() int {
+	return 2 * c.Level
+}
+
 func (c WebCapability) IsCreateMT() bool {
 	return c.Name == api.CapabilityCreateMT.Name
 }
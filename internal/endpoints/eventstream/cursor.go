@@ -0,0 +1,56 @@
+package eventstream
+
+import (
+	"time"
+)
+
+// cursor tracks which events of a stream were already sent. Event ids are assigned when an event is inserted, but the
+// event only becomes visible when its transaction commits, possibly on another server instance; so an event can appear
+// after events with a higher id. Therefore, events are queried starting at the floor, which only moves past an event
+// once it was sent lag ago, and events that were already sent are skipped.
+type cursor struct {
+	// floor is the id after which events are queried
+	floor uint64
+	// sent holds the ids of the events sent within the last lag and when they were sent
+	sent map[uint64]time.Time
+	lag  time.Duration
+}
+
+func newCursor(floor uint64, lag time.Duration) *cursor {
+	return &cursor{
+		floor: floor,
+		sent:  make(map[uint64]time.Time),
+		lag:   lag,
+	}
+}
+
+// add marks the event with the passed id as sent at now; it returns false if the event was sent before
+func (c *cursor) add(id uint64, now time.Time) bool {
+	if id <= c.floor {
+		return false
+	}
+	if _, found := c.sent[id]; found {
+		return false
+	}
+	c.sent[id] = now
+	return true
+}
+
+// advance moves the floor past all events that were sent more than lag before now
+func (c *cursor) advance(now time.Time) {
+	for id, t := range c.sent {
+		if now.Sub(t) < c.lag {
+			continue
+		}
+		if id > c.floor {
+			c.floor = id
+		}
+		delete(c.sent, id)
+	}
+	// events with an id below the floor are never sent again, so they need not be remembered
+	for id := range c.sent {
+		if id <= c.floor {
+			delete(c.sent, id)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package eventstream
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/eventrepo"
+	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/utils/ctxUtils"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	sharedModel "github.com/oidc-mytoken/server/shared/model"
+	eventService "github.com/oidc-mytoken/server/shared/mytoken/event"
+	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
+	mytoken "github.com/oidc-mytoken/server/shared/mytoken/pkg"
+)
+
+// batchSize is the maximum number of events read per poll
+const batchSize = 500
+
+// lag is the time events are remembered after they were sent, see cursor
+const lag = 10 * time.Second
+
+// resumeWindow is the number of seconds after its last connection within which a stream can be resumed
+const resumeWindow = 24 * 3600
+
+// getEventsAfter returns the events following an event id; it can be replaced in tests
+var getEventsAfter = eventrepo.GetEventsAfter
+
+// openStreams is the number of currently open streams of this server instance
+var openStreams int64
+
+// HandleEventStream handles requests to the event stream endpoint. It streams the events of the passed mytoken as
+// server-sent events as they are logged, which requires the tokeninfo_history capability; with the query parameter
+// all=true, the events of all mytokens of the user are streamed, which requires the list_mytokens capability. Streams
+// are closed after the configured maximum duration; clients resume them with the Last-Event-ID header.
+func HandleEventStream(ctx *fiber.Ctx) error {
+	log.Debug("Handle event stream request")
+	tok := ctxUtils.GetMytoken(ctx)
+	if tok == nil {
+		return model.Response{
+			Status:   fiber.StatusUnauthorized,
+			Response: sharedModel.InvalidTokenError("no mytoken found in request"),
+		}.Send(ctx)
+	}
+	mt, err := mytoken.ParseJWT(string(*tok))
+	if err != nil {
+		return model.Response{
+			Status:   fiber.StatusUnauthorized,
+			Response: sharedModel.InvalidTokenError(err.Error()),
+		}.Send(ctx)
+	}
+	allOfUser := false
+	if all := ctx.Query("all"); all != "" {
+		if allOfUser, err = strconv.ParseBool(all); err != nil {
+			return model.Response{
+				Status:   fiber.StatusBadRequest,
+				Response: sharedModel.BadRequestError("invalid value for 'all'"),
+			}.Send(ctx)
+		}
+	}
+	var streamID, lastEventID uint64
+	resumed := false
+	if id := ctx.Get("Last-Event-ID"); id != "" {
+		if streamID, lastEventID, err = parseEventID(id); err != nil {
+			return model.Response{
+				Status:   fiber.StatusBadRequest,
+				Response: sharedModel.BadRequestError("invalid Last-Event-ID"),
+			}.Send(ctx)
+		}
+		resumed = true
+	}
+	clientMetadata := *ctxUtils.ClientMetaData(ctx)
+	if errRes := authorize(mt, allOfUser, resumed, clientMetadata); errRes != nil {
+		return errRes.Send(ctx)
+	}
+	if resumed {
+		startEventID, found, err := eventrepo.ResumeEventStream(nil, streamID, mt.ID, allOfUser, resumeWindow)
+		if err != nil {
+			return model.ErrorToInternalServerErrorResponse(err).Send(ctx)
+		}
+		// A stream can only be resumed from an event it could have sent, so that it cannot be used to read older events
+		if !found || lastEventID < startEventID {
+			return model.Response{
+				Status:   fiber.StatusBadRequest,
+				Response: sharedModel.BadRequestError("unknown or expired event stream in Last-Event-ID"),
+			}.Send(ctx)
+		}
+	} else {
+		if lastEventID, err = eventrepo.GetLastEventID(nil); err != nil {
+			return model.ErrorToInternalServerErrorResponse(err).Send(ctx)
+		}
+		if streamID, err = eventrepo.CreateEventStream(nil, mt.ID, allOfUser, lastEventID, resumeWindow); err != nil {
+			return model.ErrorToInternalServerErrorResponse(err).Send(ctx)
+		}
+	}
+
+	conf := config.Get().Features.EventStream
+	if atomic.AddInt64(&openStreams, 1) > int64(conf.MaxConnections) {
+		atomic.AddInt64(&openStreams, -1)
+		return model.Response{
+			Status:   fiber.StatusServiceUnavailable,
+			Response: api.APIErrorTooManyEventStreams,
+		}.Send(ctx)
+	}
+	ctx.Set(fiber.HeaderContentType, "text/event-stream")
+	ctx.Set(fiber.HeaderCacheControl, "no-cache")
+	ctx.Set(fiber.HeaderConnection, "keep-alive")
+	ctx.Set("X-Accel-Buffering", "no")
+	s := &stream{
+		id:        streamID,
+		mt:        mt,
+		allOfUser: allOfUser,
+		cursor:    newCursor(lastEventID, lag),
+		conf:      conf,
+	}
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer atomic.AddInt64(&openStreams, -1)
+		s.run(w)
+	})
+	return nil
+}
+
+// authorize checks that the mytoken is valid and may be used for the stream. Opening and resuming a stream both
+// consume a usage and are logged like a tokeninfo request.
+func authorize(mt *mytoken.Mytoken, allOfUser, resumed bool, clientMetadata api.ClientMetaData) *model.Response {
+	if errRes := mt.VerifyNotRevoked(nil, clientMetadata); errRes != nil {
+		return errRes
+	}
+	capability, e := api.CapabilityTokeninfoHistory, event.MTEventTokenInfoHistory
+	if allOfUser {
+		capability, e = api.CapabilityListMT, event.MTEventTokenInfoListMTs
+	}
+	if errRes := mt.AuthorizeCapabilities(clientMetadata, capability); errRes != nil {
+		return errRes
+	}
+	possibleRestrictions, errRes := mt.RestrictionsForOther(nil, clientMetadata, capability)
+	if errRes != nil {
+		return errRes
+	}
+	comment := "event stream"
+	if resumed {
+		comment = "event stream resumed"
+	}
+	if err := db.Transact(func(tx *sqlx.Tx) error {
+		if possibleRestrictions != nil {
+			if _, err := possibleRestrictions.ConsumeForOther(tx, mt.ID); err != nil {
+				return err
+			}
+		}
+		return eventService.LogEvent(tx, eventService.MTEvent{
+			Event: event.FromNumber(e, comment),
+			MTID:  mt.ID,
+		}, clientMetadata)
+	}); err != nil {
+		return mt.ConsumeErrorResponse(err, clientMetadata)
+	}
+	return nil
+}
+
+// stream is an open event stream
+type stream struct {
+	// id identifies the stream across resumptions, see parseEventID
+	id        uint64
+	mt        *mytoken.Mytoken
+	allOfUser bool
+	cursor    *cursor
+	conf      config.EventStreamConf
+}
+
+// run writes events to w until the stream's maximum duration is reached, the client disconnects, or the mytoken
+// becomes invalid
+func (s *stream) run(w *bufio.Writer) {
+	pollInterval := time.Duration(s.conf.PollInterval) * time.Second
+	keepAliveInterval := time.Duration(s.conf.KeepAliveInterval) * time.Second
+	end := time.Now().Add(time.Duration(s.conf.MaxDuration) * time.Second)
+	// Clients wait a poll interval before they reconnect; the id lets them resume the stream even if no event is sent
+	if _, err := fmt.Fprintf(w, "retry: %d\nid: %d-%d\n\n", pollInterval.Milliseconds(), s.id, s.cursor.floor); err != nil || w.Flush() != nil {
+		return
+	}
+	lastWrite := time.Now()
+	for time.Now().Before(end) {
+		revoked, _, err := dbhelper.CheckTokenRevoked(nil, s.mt.ID, s.mt.SeqNo, s.mt.Rotation)
+		if err != nil {
+			log.WithError(err).Error("Could not check mytoken of event stream")
+			return
+		}
+		if revoked {
+			return
+		}
+		now := time.Now()
+		wrote, err := s.poll(w, now)
+		if err != nil {
+			return
+		}
+		if wrote {
+			lastWrite = now
+		}
+		s.cursor.advance(now)
+		if now.Sub(lastWrite) >= keepAliveInterval {
+			if _, err = w.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+			lastWrite = now
+		}
+		// A failing flush means that the client disconnected
+		if err = w.Flush(); err != nil {
+			return
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// poll writes all events that were not sent yet to w and reports if it wrote any. Events are read in batches starting
+// at the floor of the cursor; if a batch is full, the next one is read after its last event, so that a stream keeps up
+// even if more than batchSize events are within the lag.
+func (s *stream) poll(w *bufio.Writer, now time.Time) (wrote bool, err error) {
+	after := s.cursor.floor
+	for {
+		events, err := getEventsAfter(nil, s.mt.ID, s.allOfUser, after, batchSize)
+		if err != nil {
+			log.WithError(err).Error("Could not get events for event stream")
+			return wrote, err
+		}
+		for _, e := range events {
+			if !s.cursor.add(e.ID, now) {
+				continue
+			}
+			if err = writeEvent(w, s.id, e); err != nil {
+				return wrote, err
+			}
+			wrote = true
+		}
+		if len(events) < batchSize {
+			return wrote, nil
+		}
+		after = events[len(events)-1].ID
+	}
+}
+
+// writeEvent writes an event in the server-sent events format; its id consists of the stream id and the event id and
+// is used by clients to resume the stream
+func writeEvent(w *bufio.Writer, streamID uint64, e eventrepo.EventEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d-%d\ndata: %s\n\n", streamID, e.ID, data)
+	return err
+}
+
+// parseEventID parses an event id as written by writeEvent
+func parseEventID(id string) (streamID, eventID uint64, err error) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("malformed event id '%s'", id)
+	}
+	if streamID, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return
+	}
+	eventID, err = strconv.ParseUint(parts[1], 10, 64)
+	return
+}
@@ -0,0 +1,113 @@
+package eventstream
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/eventrepo"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	mytoken "github.com/oidc-mytoken/server/shared/mytoken/pkg"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+func TestCursor(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := newCursor(10, 10*time.Second)
+	if c.add(10, start) {
+		t.Error("Expected event at the floor not to be sent")
+	}
+	if !c.add(12, start) {
+		t.Error("Expected new event to be sent")
+	}
+	if c.add(12, start) {
+		t.Error("Expected event not to be sent twice")
+	}
+	c.advance(start.Add(time.Second))
+	if c.floor != 10 {
+		t.Errorf("Expected floor to stay at 10 within the lag, got %d", c.floor)
+	}
+	// an event with a lower id that is committed later is still sent
+	if !c.add(11, start.Add(2*time.Second)) {
+		t.Error("Expected late event within the lag to be sent")
+	}
+	c.advance(start.Add(11 * time.Second))
+	if c.floor != 12 {
+		t.Errorf("Expected floor 12 after the lag, got %d", c.floor)
+	}
+	if len(c.sent) != 0 {
+		t.Errorf("Expected no remembered events below the floor, got %v", c.sent)
+	}
+	if c.add(11, start.Add(12*time.Second)) {
+		t.Error("Expected event below the floor not to be sent")
+	}
+}
+
+func TestPollReadsPastFullBatches(t *testing.T) {
+	const total = 2*batchSize + 10
+	getEventsAfter = func(_ *sqlx.Tx, _ mtid.MTID, _ bool, afterID uint64, limit int) (events eventrepo.EventHistory, err error) {
+		for id := afterID + 1; id <= total && len(events) < limit; id++ {
+			events = append(events, eventrepo.EventEntry{ID: id})
+		}
+		return
+	}
+	defer func() { getEventsAfter = eventrepo.GetEventsAfter }()
+	s := &stream{
+		id:     7,
+		mt:     &mytoken.Mytoken{},
+		cursor: newCursor(0, lag),
+	}
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	now := time.Unix(1000, 0)
+	wrote, err := s.poll(w, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !wrote || len(s.cursor.sent) != total {
+		t.Errorf("Expected all %d events to be sent in one poll, got %d", total, len(s.cursor.sent))
+	}
+	// Within the lag, the first batch is read again, but nothing is sent twice
+	if wrote, err = s.poll(w, now.Add(time.Second)); err != nil || wrote {
+		t.Errorf("Expected no event to be sent again, got wrote=%t, err=%v", wrote, err)
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	e := eventrepo.EventEntry{
+		EventEntry: api.EventEntry{
+			Event:        "AT_created",
+			ManagementID: "mgmt",
+		},
+		ID:   42,
+		Time: 1000,
+	}
+	if err := writeEvent(w, 7, e); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	_ = w.Flush()
+	expected := "id: 7-42\ndata: {\"event\":\"AT_created\",\"management_id\":\"mgmt\",\"time\":1000}\n\n"
+	if buf.String() != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, buf.String())
+	}
+}
+
+func TestParseEventID(t *testing.T) {
+	streamID, eventID, err := parseEventID("7-42")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if streamID != 7 || eventID != 42 {
+		t.Errorf("Expected stream 7 and event 42, got %d and %d", streamID, eventID)
+	}
+	for _, id := range []string{"42", "7-", "-42", "a-42", "7-42-1"} {
+		if _, _, err = parseEventID(id); err == nil {
+			t.Errorf("Expected an error for '%s'", id)
+		}
+	}
+}
@@ -11,11 +11,15 @@ import (
 
 	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/db"
+	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/transfercoderepo"
 	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/utils/ctxUtils"
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 	sharedModel "github.com/oidc-mytoken/server/shared/model"
 	"github.com/oidc-mytoken/server/shared/mytoken"
+	eventService "github.com/oidc-mytoken/server/shared/mytoken/event"
+	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
 	mytokenPkg "github.com/oidc-mytoken/server/shared/mytoken/pkg"
 	"github.com/oidc-mytoken/server/shared/mytoken/token"
 	"github.com/oidc-mytoken/server/shared/utils"
@@ -34,7 +38,13 @@ func HandleRevoke(ctx *fiber.Ctx) error {
 		req.Token = ctx.Cookies("mytoken")
 		clearCookie = true
 	}
-	errRes := revokeAnyToken(nil, req.Token, req.OIDCIssuer, req.Recursive)
+	if req.ManagementID != "" {
+		if errRes := revokeByManagementID(req, ctxUtils.ClientMetaData(ctx)); errRes != nil {
+			return errRes.Send(ctx)
+		}
+		return ctx.SendStatus(fiber.StatusNoContent)
+	}
+	errRes := revokeAnyToken(nil, req.Token, req.OIDCIssuer, req.Recursive, ctxUtils.ClientIP(ctx))
 	if errRes != nil {
 		return errRes.Send(ctx)
 	}
@@ -55,11 +65,11 @@ func HandleRevoke(ctx *fiber.Ctx) error {
 	return ctx.SendStatus(fiber.StatusNoContent)
 }
 
-func revokeAnyToken(tx *sqlx.Tx, token, issuer string, recursive bool) (errRes *model.Response) {
+func revokeAnyToken(tx *sqlx.Tx, token, issuer string, recursive bool, ip string) (errRes *model.Response) {
 	if utils.IsJWT(token) { // normal Mytoken
-		return revokeMytoken(tx, token, issuer, recursive)
+		return revokeMytoken(tx, token, issuer, recursive, ip)
 	} else if len(token) == config.Get().Features.Polling.Len { // Transfer Code
-		return revokeTransferCode(tx, token, issuer)
+		return revokeTransferCode(tx, token, issuer, ip)
 	} else { // Short Token
 		shortToken := transfercoderepo.ParseShortToken(token)
 		var valid bool
@@ -77,11 +87,11 @@ func revokeAnyToken(tx *sqlx.Tx, token, issuer string, recursive bool) (errRes *
 		if !valid {
 			return nil
 		}
-		return revokeMytoken(tx, token, issuer, recursive)
+		return revokeMytoken(tx, token, issuer, recursive, ip)
 	}
 }
 
-func revokeMytoken(tx *sqlx.Tx, jwt, issuer string, recursive bool) (errRes *model.Response) {
+func revokeMytoken(tx *sqlx.Tx, jwt, issuer string, recursive bool, ip string) (errRes *model.Response) {
 	mt, err := mytokenPkg.ParseJWT(jwt)
 	if err != nil {
 		return nil
@@ -92,10 +102,10 @@ func revokeMytoken(tx *sqlx.Tx, jwt, issuer string, recursive bool) (errRes *mod
 			Response: sharedModel.BadRequestError("token not for specified issuer"),
 		}
 	}
-	return mytoken.RevokeMytoken(tx, mt.ID, token.Token(jwt), recursive, mt.OIDCIssuer)
+	return mytoken.RevokeMytoken(tx, mt.ID, token.Token(jwt), recursive, mt.OIDCIssuer, ip)
 }
 
-func revokeTransferCode(tx *sqlx.Tx, token, issuer string) (errRes *model.Response) {
+func revokeTransferCode(tx *sqlx.Tx, token, issuer, ip string) (errRes *model.Response) {
 	transferCode := transfercoderepo.ParseTransferCode(token)
 	err := db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
 		revokeMT, err := transferCode.GetRevokeJWT(tx)
@@ -108,7 +118,7 @@ func revokeTransferCode(tx *sqlx.Tx, token, issuer string) (errRes *model.Respon
 				return err
 			}
 			if valid { // if !valid the jwt field could not decrypted correctly, so we can skip that, but still delete the TransferCode
-				errRes = revokeAnyToken(tx, jwt, issuer, true)
+				errRes = revokeAnyToken(tx, jwt, issuer, true, ip)
 				if errRes != nil {
 					return fmt.Errorf("placeholder")
 				}
@@ -121,3 +131,68 @@ func revokeTransferCode(tx *sqlx.Tx, token, issuer string) (errRes *model.Respon
 	}
 	return
 }
+
+// revokeByManagementID revokes the mytoken with the requested management id; the mytoken passed in the request must
+// have the revoke_any_token capability and both mytokens must belong to the same user
+func revokeByManagementID(req api.RevocationRequest, clientMetadata *api.ClientMetaData) *model.Response {
+	jwt, err := token.GetLongMytoken(req.Token, clientMetadata.IP)
+	if err != nil {
+		return &model.Response{
+			Status:   fiber.StatusUnauthorized,
+			Response: sharedModel.InvalidTokenError(err.Error()),
+		}
+	}
+	mt, err := mytokenPkg.ParseJWT(string(jwt))
+	if err != nil {
+		return &model.Response{
+			Status:   fiber.StatusUnauthorized,
+			Response: sharedModel.InvalidTokenError(err.Error()),
+		}
+	}
+	if errRes := mt.VerifyNotRevoked(nil, *clientMetadata); errRes != nil {
+		return errRes
+	}
+	if errRes := mt.AuthorizeCapabilities(*clientMetadata, api.CapabilityRevokeAnyToken); errRes != nil {
+		return errRes
+	}
+	possibleRestrictions, errRes := mt.RestrictionsForOther(nil, *clientMetadata, api.CapabilityRevokeAnyToken)
+	if errRes != nil {
+		return errRes
+	}
+	if err = db.Transact(func(tx *sqlx.Tx) error {
+		id, found, err := dbhelper.GetMTIDByManagementID(tx, req.ManagementID, mt.ID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			errRes = &model.Response{
+				Status:   fiber.StatusNotFound,
+				Response: api.APIErrorUnknownManagementID,
+			}
+			return fmt.Errorf("error_res")
+		}
+		if possibleRestrictions != nil {
+			if _, err = possibleRestrictions.ConsumeForOther(tx, mt.ID); err != nil {
+				return err
+			}
+		}
+		// The event is logged before the revocation, since the requesting mytoken might revoke itself
+		if err = eventService.LogEvent(tx, eventService.MTEvent{
+			Event: event.FromNumber(event.MTEventRevokedOtherToken, req.ManagementID),
+			MTID:  mt.ID,
+		}, *clientMetadata); err != nil {
+			return err
+		}
+		return mytoken.RevokeMytokenByID(tx, id, req.Recursive, dbhelper.Revocation{
+			Reason: dbhelper.RevocationReasonRevokedByOtherToken,
+			Actor:  mt.ID.ManagementID(),
+			IP:     clientMetadata.IP,
+		})
+	}); err != nil {
+		if errRes != nil {
+			return errRes
+		}
+		return mt.ConsumeErrorResponse(err, *clientMetadata)
+	}
+	return nil
+}
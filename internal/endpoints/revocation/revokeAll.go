@@ -0,0 +1,126 @@
+package revocation
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/utils/ctxUtils"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	sharedModel "github.com/oidc-mytoken/server/shared/model"
+	"github.com/oidc-mytoken/server/shared/mytoken"
+	mytokenPkg "github.com/oidc-mytoken/server/shared/mytoken/pkg"
+	"github.com/oidc-mytoken/server/shared/mytoken/token"
+)
+
+// HandleRevokeAll handles requests to revoke all mytokens of a user. The mytokens of the users of all passed mytokens
+// are revoked, optionally limited to one issuer.
+func HandleRevokeAll(ctx *fiber.Ctx) error {
+	log.Debug("Handle revoke all request")
+	req := api.RevokeAllRequest{}
+	if len(ctx.Body()) > 0 {
+		if err := json.Unmarshal(ctx.Body(), &req); err != nil {
+			return model.ErrorToBadRequestErrorResponse(err).Send(ctx)
+		}
+	}
+	fromCookie := false
+	if req.Mytoken == "" {
+		req.Mytoken = ctx.Cookies("mytoken")
+		fromCookie = req.Mytoken != ""
+	}
+	clientMetadata := *ctxUtils.ClientMetaData(ctx)
+	// The passed mytokens are grouped by their user, i.e. subject and issuer
+	var users []string
+	byUser := make(map[string][]mytoken.PresentedMytoken)
+	for i, tok := range append([]string{req.Mytoken}, req.Mytokens...) {
+		mt, errRes := authorizeRevokeAll(tok, i == 0 && fromCookie, clientMetadata)
+		if errRes != nil {
+			return errRes.Send(ctx)
+		}
+		if req.OIDCIssuer != "" && req.OIDCIssuer != mt.OIDCIssuer {
+			continue
+		}
+		if _, found := byUser[mt.Subject]; !found {
+			users = append(users, mt.Subject)
+		}
+		byUser[mt.Subject] = append(byUser[mt.Subject], *mt)
+	}
+	if len(users) == 0 {
+		return model.Response{
+			Status:   fiber.StatusBadRequest,
+			Response: sharedModel.BadRequestError("no token for specified issuer"),
+		}.Send(ctx)
+	}
+	res := api.RevokeAllResponse{}
+	for _, user := range users {
+		report, errRes := mytoken.RevokeAllMytokens(byUser[user], clientMetadata.IP)
+		if errRes != nil {
+			return errRes.Send(ctx)
+		}
+		res.Issuers = append(res.Issuers, *report)
+	}
+	r := model.Response{
+		Status:   fiber.StatusOK,
+		Response: res,
+	}
+	if fromCookie {
+		r.Cookies = []*fiber.Cookie{{
+			Name:     "mytoken",
+			Value:    "",
+			Path:     "/api",
+			Expires:  time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC),
+			Secure:   config.Get().Server.TLS.Enabled,
+			HTTPOnly: true,
+			SameSite: "Strict",
+		}}
+	}
+	return r.Send(ctx)
+}
+
+// authorizeRevokeAll checks that the passed mytoken is valid and may revoke all mytokens of its user; this is the case
+// if it has the revoke_any_token capability or if it is the session mytoken of a fresh OIDC re-authentication in the
+// web interface
+func authorizeRevokeAll(tok string, fromCookie bool, clientMetadata api.ClientMetaData) (*mytoken.PresentedMytoken, *model.Response) {
+	jwt, err := token.GetLongMytoken(tok, clientMetadata.IP)
+	if err != nil {
+		return nil, &model.Response{
+			Status:   fiber.StatusUnauthorized,
+			Response: sharedModel.InvalidTokenError(err.Error()),
+		}
+	}
+	mt, err := mytokenPkg.ParseJWT(string(jwt))
+	if err != nil {
+		return nil, &model.Response{
+			Status:   fiber.StatusUnauthorized,
+			Response: sharedModel.InvalidTokenError(err.Error()),
+		}
+	}
+	if errRes := mt.VerifyNotRevoked(nil, clientMetadata); errRes != nil {
+		return nil, errRes
+	}
+	presented := &mytoken.PresentedMytoken{
+		Mytoken: mt,
+		JWT:     jwt,
+	}
+	if fromCookie && !mt.Capabilities.Has(api.CapabilityRevokeAnyToken) {
+		fresh, err := dbhelper.ReauthenticatedWithin(nil, mt.ID, config.Get().Features.TokenRevocation.FreshAuthMaxAge)
+		if err != nil {
+			return nil, model.ErrorToInternalServerErrorResponse(err)
+		}
+		if fresh {
+			return presented, nil
+		}
+	}
+	if errRes := mt.AuthorizeCapabilities(clientMetadata, api.CapabilityRevokeAnyToken); errRes != nil {
+		return nil, errRes
+	}
+	if _, errRes := mt.RestrictionsForOther(nil, clientMetadata, api.CapabilityRevokeAnyToken); errRes != nil {
+		return nil, errRes
+	}
+	return presented, nil
+}
@@ -0,0 +1,320 @@
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/notificationrepo"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/webhookrepo"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/notification"
+	"github.com/oidc-mytoken/server/internal/utils/ctxUtils"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	sharedModel "github.com/oidc-mytoken/server/shared/model"
+	eventService "github.com/oidc-mytoken/server/shared/mytoken/event"
+	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
+	mytoken "github.com/oidc-mytoken/server/shared/mytoken/pkg"
+	"github.com/oidc-mytoken/server/shared/mytoken/token"
+	"github.com/oidc-mytoken/server/shared/utils"
+)
+
+// maxEmailLength is the maximum length of a notification email address in the database
+const maxEmailLength = 256
+
+// A new notification email address must be confirmed within emailConfirmationLifetime seconds with a code of
+// emailConfirmationCodeLength characters
+const (
+	emailConfirmationLifetime   = 24 * 3600
+	emailConfirmationCodeLength = 64
+)
+
+// Limits of webhook subscriptions
+const (
+	maxWebhookURLLength = 2048
+	minSecretLength     = 16
+	maxSecretLength     = 128
+)
+
+// HandleSettings handles requests to the user settings endpoint. Settings included in the request, i.e. notification
+// settings or webhooks to add or remove, are changed, which requires the settings capability; otherwise the current
+// settings are returned, which requires read@settings.
+func HandleSettings(ctx *fiber.Ctx) error {
+	log.Debug("Handle user settings request")
+	var req api.UserSettingsRequest
+	if len(ctx.Body()) > 0 {
+		if err := json.Unmarshal(ctx.Body(), &req); err != nil {
+			return model.ErrorToBadRequestErrorResponse(err).Send(ctx)
+		}
+	}
+	var tok token.Token
+	if req.Mytoken != "" {
+		var err error
+		if tok, err = token.GetLongMytoken(req.Mytoken, ctxUtils.ClientIP(ctx)); err != nil {
+			return model.Response{
+				Status:   fiber.StatusUnauthorized,
+				Response: sharedModel.InvalidTokenError(err.Error()),
+			}.Send(ctx)
+		}
+	} else if t := ctxUtils.GetMytoken(ctx); t != nil {
+		tok = *t
+	} else {
+		return model.Response{
+			Status:   fiber.StatusUnauthorized,
+			Response: sharedModel.InvalidTokenError("no mytoken found in request"),
+		}.Send(ctx)
+	}
+	mt, err := mytoken.ParseJWT(string(tok))
+	if err != nil {
+		return model.Response{
+			Status:   fiber.StatusUnauthorized,
+			Response: sharedModel.InvalidTokenError(err.Error()),
+		}.Send(ctx)
+	}
+	return handleSettings(mt, &req, *ctxUtils.ClientMetaData(ctx)).Send(ctx)
+}
+
+// HandleConfirmEmail handles GET requests to the email confirmation endpoint, which is linked in the mail sent to a
+// new notification email address. It only displays a page that posts the code back, so that mail scanners that follow
+// links do not confirm an address.
+func HandleConfirmEmail(ctx *fiber.Ctx) error {
+	code := ctx.Query("code")
+	if code == "" {
+		return model.Response{
+			Status:   fiber.StatusBadRequest,
+			Response: sharedModel.BadRequestError("no confirmation code given"),
+		}.Send(ctx)
+	}
+	binding := map[string]interface{}{
+		"empty-navbar": true,
+		"action":       ctx.Path(),
+		"code":         code,
+	}
+	return ctx.Render("sites/confirm_email", binding, "layouts/main")
+}
+
+// HandleConfirmEmailPost handles POST requests to the email confirmation endpoint; with a valid code, the address
+// becomes the address notifications are sent to
+func HandleConfirmEmailPost(ctx *fiber.Ctx) error {
+	log.Debug("Handle email confirmation request")
+	code := ctx.FormValue("code")
+	if code == "" {
+		return model.Response{
+			Status:   fiber.StatusBadRequest,
+			Response: sharedModel.BadRequestError("no confirmation code given"),
+		}.Send(ctx)
+	}
+	confirmed, err := notificationrepo.ConfirmEmail(nil, code)
+	if err != nil {
+		return model.ErrorToInternalServerErrorResponse(err).Send(ctx)
+	}
+	if !confirmed {
+		return model.Response{
+			Status:   fiber.StatusBadRequest,
+			Response: sharedModel.BadRequestError("invalid or expired confirmation code"),
+		}.Send(ctx)
+	}
+	return ctx.SendString("The email address is confirmed; mytoken notifications are now sent to it.")
+}
+
+// validateNotificationSettings normalizes the passed settings and checks that they are valid
+func validateNotificationSettings(settings *api.NotificationSettings) error {
+	settings.Email = strings.TrimSpace(settings.Email)
+	if settings.Email != "" {
+		if len(settings.Email) > maxEmailLength {
+			return fmt.Errorf("email must not be longer than %d characters", maxEmailLength)
+		}
+		addr, err := mail.ParseAddress(settings.Email)
+		if err != nil || addr.Name != "" {
+			return fmt.Errorf("invalid email '%s'", settings.Email)
+		}
+	}
+	var subscriptions []string
+	for _, s := range settings.Subscriptions {
+		if !utils.StringInSlice(s, api.AllNotifications[:]) {
+			return fmt.Errorf("unknown notification '%s'", s)
+		}
+		if !utils.StringInSlice(s, subscriptions) {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+	if len(subscriptions) > 0 && settings.Email == "" {
+		return fmt.Errorf("subscriptions require an email")
+	}
+	settings.Subscriptions = subscriptions
+	return nil
+}
+
+// validateWebhook normalizes the passed webhook subscription and checks that it is valid
+func validateWebhook(webhook *api.WebhookSubscription) error {
+	if len(webhook.URL) > maxWebhookURLLength {
+		return fmt.Errorf("url must not be longer than %d characters", maxWebhookURLLength)
+	}
+	u, err := url.Parse(webhook.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid webhook url '%s', must be an https url", webhook.URL)
+	}
+	if webhook.Secret != "" && (len(webhook.Secret) < minSecretLength || len(webhook.Secret) > maxSecretLength) {
+		return fmt.Errorf("secret must be between %d and %d characters long", minSecretLength, maxSecretLength)
+	}
+	var events []string
+	for _, e := range webhook.Events {
+		if !utils.StringInSlice(e, event.AllEvents[1:]) {
+			return fmt.Errorf("unknown event '%s'", e)
+		}
+		if !utils.StringInSlice(e, events) {
+			events = append(events, e)
+		}
+	}
+	webhook.Events = events
+	return nil
+}
+
+// changeWebhooks adds and removes the webhooks given in the request; errRes is set if the request is not valid
+func changeWebhooks(tx *sqlx.Tx, mt *mytoken.Mytoken, req *api.UserSettingsRequest, clientMetadata api.ClientMetaData) (errRes *model.Response, err error) {
+	var comments []string
+	if req.RemoveWebhook != 0 {
+		found, err := webhookrepo.RemoveWebhook(tx, mt.ID, req.RemoveWebhook)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return &model.Response{
+				Status:   fiber.StatusNotFound,
+				Response: sharedModel.BadRequestError(fmt.Sprintf("unknown webhook %d", req.RemoveWebhook)),
+			}, nil
+		}
+		comments = append(comments, fmt.Sprintf("removed webhook %d", req.RemoveWebhook))
+	}
+	if req.AddWebhook != nil {
+		webhooks, err := webhookrepo.GetWebhooks(tx, mt.ID)
+		if err != nil {
+			return nil, err
+		}
+		if maxPerUser := config.Get().Features.Webhooks.MaxPerUser; len(webhooks) >= maxPerUser {
+			return &model.Response{
+				Status:   fiber.StatusBadRequest,
+				Response: sharedModel.BadRequestError(fmt.Sprintf("at most %d webhooks are allowed", maxPerUser)),
+			}, nil
+		}
+		w := req.AddWebhook
+		id, err := webhookrepo.AddWebhook(tx, mt.ID, w.URL, w.Events, w.Secret)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, fmt.Sprintf("added webhook %d", id))
+	}
+	err = eventService.LogEvent(tx, eventService.MTEvent{
+		Event: event.FromNumber(event.MTEventWebhookSettingsChanged, strings.Join(comments, "; ")),
+		MTID:  mt.ID,
+	}, clientMetadata)
+	return nil, err
+}
+
+func handleSettings(mt *mytoken.Mytoken, req *api.UserSettingsRequest, clientMetadata api.ClientMetaData) model.Response {
+	if errRes := mt.VerifyNotRevoked(nil, clientMetadata); errRes != nil {
+		return *errRes
+	}
+
+	setNotifications := req.Notifications != nil
+	setWebhooks := req.AddWebhook != nil || req.RemoveWebhook != 0
+	capability := api.CapabilityReadSettings
+	if setNotifications {
+		if !config.Get().Features.Notifications.Email.Enabled {
+			return model.Response{
+				Status:   fiber.StatusBadRequest,
+				Response: sharedModel.BadRequestError("notifications are not enabled on this server"),
+			}
+		}
+		if err := validateNotificationSettings(req.Notifications); err != nil {
+			return *model.ErrorToBadRequestErrorResponse(err)
+		}
+	}
+	if setWebhooks {
+		if !config.Get().Features.Webhooks.Enabled {
+			return model.Response{
+				Status:   fiber.StatusBadRequest,
+				Response: sharedModel.BadRequestError("webhooks are not enabled on this server"),
+			}
+		}
+		if req.AddWebhook != nil {
+			if err := validateWebhook(req.AddWebhook); err != nil {
+				return *model.ErrorToBadRequestErrorResponse(err)
+			}
+		}
+	}
+	if setNotifications || setWebhooks {
+		capability = api.CapabilitySettings
+	}
+	if errRes := mt.AuthorizeCapabilities(clientMetadata, capability); errRes != nil {
+		return *errRes
+	}
+	possibleRestrictions, errRes := mt.RestrictionsForOther(nil, clientMetadata, capability)
+	if errRes != nil {
+		return *errRes
+	}
+
+	var res api.UserSettingsResponse
+	code := utils.RandASCIIString(emailConfirmationCodeLength)
+	emailPending := false
+	if err := db.Transact(func(tx *sqlx.Tx) error {
+		if possibleRestrictions != nil {
+			if _, err := possibleRestrictions.ConsumeForOther(tx, mt.ID); err != nil {
+				return err
+			}
+		}
+		if setNotifications {
+			var err error
+			if emailPending, err = notificationrepo.SetSettings(tx, mt.ID, *req.Notifications, code, emailConfirmationLifetime); err != nil {
+				return err
+			}
+			if err := eventService.LogEvent(tx, eventService.MTEvent{
+				Event: event.FromNumber(event.MTEventNotificationSettingsChanged, ""),
+				MTID:  mt.ID,
+			}, clientMetadata); err != nil {
+				return err
+			}
+		}
+		if setWebhooks {
+			var err error
+			if errRes, err = changeWebhooks(tx, mt, req, clientMetadata); err != nil {
+				return err
+			}
+			if errRes != nil {
+				return fmt.Errorf("error_res")
+			}
+		}
+		var err error
+		if res.Notifications, err = notificationrepo.GetSettings(tx, mt.ID); err != nil {
+			return err
+		}
+		if !config.Get().Features.Webhooks.Enabled {
+			return nil
+		}
+		webhooks, err := webhookrepo.GetWebhooks(tx, mt.ID)
+		for _, w := range webhooks {
+			res.Webhooks = append(res.Webhooks, w.Subscription())
+		}
+		return err
+	}); err != nil {
+		if errRes != nil {
+			return *errRes
+		}
+		return *mt.ConsumeErrorResponse(err, clientMetadata)
+	}
+	if emailPending {
+		notification.SendEmailConfirmation(req.Notifications.Email, code)
+	}
+	return model.Response{
+		Status:   fiber.StatusOK,
+		Response: res,
+	}
+}
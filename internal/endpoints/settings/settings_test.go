@@ -0,0 +1,137 @@
+package settings
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+)
+
+func TestValidateNotificationSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings api.NotificationSettings
+		valid    bool
+		expected []string
+	}{
+		{
+			name:     "Empty",
+			settings: api.NotificationSettings{},
+			valid:    true,
+		},
+		{
+			name: "Valid",
+			settings: api.NotificationSettings{
+				Email:         " user@example.com ",
+				Subscriptions: []string{api.NotificationExpiringSoon, api.NotificationNewLocation, api.NotificationExpiringSoon},
+			},
+			valid:    true,
+			expected: []string{api.NotificationExpiringSoon, api.NotificationNewLocation},
+		},
+		{
+			name:     "InvalidEmail",
+			settings: api.NotificationSettings{Email: "not an email"},
+		},
+		{
+			name:     "EmailWithName",
+			settings: api.NotificationSettings{Email: "User <user@example.com>"},
+		},
+		{
+			name: "UnknownNotification",
+			settings: api.NotificationSettings{
+				Email:         "user@example.com",
+				Subscriptions: []string{"unknown"},
+			},
+		},
+		{
+			name:     "SubscriptionWithoutEmail",
+			settings: api.NotificationSettings{Subscriptions: []string{api.NotificationSubtokenCreated}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := test.settings
+			err := validateNotificationSettings(&s)
+			if test.valid != (err == nil) {
+				t.Fatalf("Expected valid=%v, got error '%v'", test.valid, err)
+			}
+			if !test.valid {
+				return
+			}
+			if len(s.Subscriptions) != len(test.expected) {
+				t.Fatalf("Expected subscriptions %v, got %v", test.expected, s.Subscriptions)
+			}
+			for i, sub := range s.Subscriptions {
+				if sub != test.expected[i] {
+					t.Errorf("Expected subscriptions %v, got %v", test.expected, s.Subscriptions)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateWebhook(t *testing.T) {
+	tests := []struct {
+		name     string
+		webhook  api.WebhookSubscription
+		valid    bool
+		expected []string
+	}{
+		{
+			name:    "AllEvents",
+			webhook: api.WebhookSubscription{URL: "https://example.com/hook"},
+			valid:   true,
+		},
+		{
+			name: "Valid",
+			webhook: api.WebhookSubscription{
+				URL:    "https://example.com/hook",
+				Events: []string{"AT_created", "revoked_other_token", "AT_created"},
+				Secret: "0123456789abcdef",
+			},
+			valid:    true,
+			expected: []string{"AT_created", "revoked_other_token"},
+		},
+		{
+			name:    "HTTP",
+			webhook: api.WebhookSubscription{URL: "http://example.com/hook"},
+		},
+		{
+			name:    "NoHost",
+			webhook: api.WebhookSubscription{URL: "https:///hook"},
+		},
+		{
+			name: "UnknownEvent",
+			webhook: api.WebhookSubscription{
+				URL:    "https://example.com/hook",
+				Events: []string{"unknown"},
+			},
+		},
+		{
+			name: "ShortSecret",
+			webhook: api.WebhookSubscription{
+				URL:    "https://example.com/hook",
+				Secret: "secret",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := test.webhook
+			err := validateWebhook(&w)
+			if test.valid != (err == nil) {
+				t.Fatalf("Expected valid=%v, got error '%v'", test.valid, err)
+			}
+			if !test.valid {
+				return
+			}
+			if len(w.Events) != len(test.expected) {
+				t.Fatalf("Expected events %v, got %v", test.expected, w.Events)
+			}
+			for i, e := range w.Events {
+				if e != test.expected[i] {
+					t.Errorf("Expected events %v, got %v", test.expected, w.Events)
+				}
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package access
 
 import (
 	"encoding/json"
+	"errors"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,7 +12,6 @@ import (
 	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/db"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/accesstokenrepo"
-	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/refreshtokenrepo"
 	request "github.com/oidc-mytoken/server/internal/endpoints/token/access/pkg"
 	serverModel "github.com/oidc-mytoken/server/internal/model"
@@ -19,9 +19,11 @@ import (
 	"github.com/oidc-mytoken/server/internal/utils/ctxUtils"
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 	"github.com/oidc-mytoken/server/shared/model"
+	"github.com/oidc-mytoken/server/shared/mytoken/anomaly"
 	eventService "github.com/oidc-mytoken/server/shared/mytoken/event"
 	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
 	mytoken "github.com/oidc-mytoken/server/shared/mytoken/pkg"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
 	"github.com/oidc-mytoken/server/shared/mytoken/restrictions"
 	"github.com/oidc-mytoken/server/shared/mytoken/token"
 	"github.com/oidc-mytoken/server/shared/utils"
@@ -46,15 +48,16 @@ func HandleAccessTokenEndpoint(ctx *fiber.Ctx) error {
 	}
 	log.Trace("Checked grant type")
 	if len(req.Mytoken) == 0 {
-		var err error
-		req.Mytoken, err = token.GetLongMytoken(ctx.Cookies("mytoken"))
-		if err != nil {
-			return serverModel.Response{
-				Status:   fiber.StatusUnauthorized,
-				Response: model.InvalidTokenError(err.Error()),
-			}.Send(ctx)
-		}
+		req.Mytoken = token.Token(ctx.Cookies("mytoken"))
+	}
+	jwt, err := token.GetLongMytoken(string(req.Mytoken), ctxUtils.ClientIP(ctx))
+	if err != nil {
+		return serverModel.Response{
+			Status:   fiber.StatusUnauthorized,
+			Response: model.InvalidTokenError(err.Error()),
+		}.Send(ctx)
 	}
+	req.Mytoken = jwt
 
 	mt, err := mytoken.ParseJWT(string(req.Mytoken))
 	if err != nil {
@@ -65,91 +68,140 @@ func HandleAccessTokenEndpoint(ctx *fiber.Ctx) error {
 	}
 	log.Trace("Parsed mytoken")
 
-	revoked, dbErr := dbhelper.CheckTokenRevoked(nil, mt.ID, mt.SeqNo, mt.Rotation)
-	if dbErr != nil {
-		return serverModel.ErrorToInternalServerErrorResponse(dbErr).Send(ctx)
+	return handleAccessTokenRefresh(mt, req, *ctxUtils.ClientMetaData(ctx)).Send(ctx)
+}
+
+// refreshParams holds everything that is needed to obtain an access token from the provider
+type refreshParams struct {
+	provider        *config.ProviderConf
+	rt              *refreshtokenrepo.RefreshTokenEntry
+	scopes          string
+	auds            string
+	usedRestriction *restrictions.Restriction
+}
+
+func handleAccessTokenRefresh(mt *mytoken.Mytoken, req request.AccessTokenRequest, networkData api.ClientMetaData) *serverModel.Response {
+	var params *refreshParams
+	var errorRes *serverModel.Response
+	var anomalies anomaly.Result
+	// All checks and the usage reservation are done within a single transaction; the provider is only contacted
+	// afterwards, so that the transaction is not held open during the refresh flow. An error response does not roll
+	// back the transaction: the checks only change the database when they detect an anomaly, which must be kept.
+	if err := db.Transact(func(tx *sqlx.Tx) error {
+		var err error
+		params, errorRes, err = prepareRefresh(tx, mt, &req, networkData, &anomalies)
+		return err
+	}); err != nil {
+		return serverModel.ErrorToInternalServerErrorResponse(err)
 	}
-	if revoked {
-		return (&serverModel.Response{
-			Status:   fiber.StatusUnauthorized,
-			Response: model.InvalidTokenError(""),
-		}).Send(ctx)
+	anomalies.Notify()
+	if errorRes != nil {
+		return errorRes
+	}
+	res := getAccessToken(mt, req, networkData, params)
+	if res.Status != fiber.StatusOK && params.usedRestriction != nil {
+		// The usage was reserved before talking to the provider; give it back, since no access token was issued
+		if err := params.usedRestriction.ReleaseAT(nil, mt.ID); err != nil {
+			log.WithError(err).Error("Could not release restriction usage")
+		}
+	}
+	return res
+}
+
+// prepareRefresh runs all checks of an access token request within the passed transaction; the result of the anomaly
+// detection is stored in anomalies, so that its notifications can be sent after the transaction was committed
+func prepareRefresh(tx *sqlx.Tx, mt *mytoken.Mytoken, req *request.AccessTokenRequest, networkData api.ClientMetaData, anomalies *anomaly.Result) (*refreshParams, *serverModel.Response, error) {
+	if errRes := mt.VerifyNotRevoked(tx, networkData); errRes != nil {
+		return nil, errRes, nil
 	}
 	log.Trace("Checked token not revoked")
 
-	if ok := mt.Restrictions.VerifyForAT(nil, ctx.IP(), mt.ID); !ok {
-		return (&serverModel.Response{
-			Status:   fiber.StatusForbidden,
-			Response: api.APIErrorUsageRestricted,
-		}).Send(ctx)
+	validRestrictions, errRes := mt.RestrictionsForAT(tx, networkData)
+	if errRes != nil {
+		return nil, errRes, nil
 	}
 	log.Trace("Checked mytoken restrictions")
-	if ok := mt.VerifyCapabilities(api.CapabilityAT); !ok {
-		res := serverModel.Response{
-			Status:   fiber.StatusForbidden,
-			Response: api.APIErrorInsufficientCapabilities,
-		}
-		return res.Send(ctx)
+	if errRes = mt.AuthorizeCapabilities(networkData, api.CapabilityAT); errRes != nil {
+		return nil, errRes, nil
 	}
 	log.Trace("Checked mytoken capabilities")
+	if *anomalies = anomaly.Check(tx, mt.ID, networkData); anomalies.Suspended {
+		return nil, &serverModel.Response{
+			Status:   fiber.StatusUnauthorized,
+			Response: model.InvalidTokenError(anomaly.SuspendedReason),
+		}, nil
+	}
+	log.Trace("Checked for anomalies")
 	if req.Issuer == "" {
 		req.Issuer = mt.OIDCIssuer
 	} else if req.Issuer != mt.OIDCIssuer {
-		res := serverModel.Response{
+		return nil, &serverModel.Response{
 			Status:   fiber.StatusBadRequest,
 			Response: model.BadRequestError("token not for specified issuer"),
-		}
-		return res.Send(ctx)
+		}, nil
 	}
 	log.Trace("Checked issuer")
 
-	return handleAccessTokenRefresh(mt, req, *ctxUtils.ClientMetaData(ctx)).Send(ctx)
-}
-
-func handleAccessTokenRefresh(mt *mytoken.Mytoken, req request.AccessTokenRequest, networkData api.ClientMetaData) *serverModel.Response {
 	provider, ok := config.Get().ProviderByIssuer[req.Issuer]
 	if !ok {
-		return &serverModel.Response{
+		return nil, &serverModel.Response{
 			Status:   fiber.StatusBadRequest,
 			Response: api.APIErrorUnknownIssuer,
-		}
+		}, nil
+	}
+	params := &refreshParams{
+		provider: provider,
+		scopes:   strings.Join(provider.Scopes, " "), // default if no restrictions apply
+		auds:     "",                                 // default if no restrictions apply
+	}
+	rt, rtFound, err := refreshtokenrepo.GetRefreshTokenEntry(tx, mt.ID, string(req.Mytoken))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !rtFound {
+		return nil, &serverModel.Response{
+			Status:   fiber.StatusUnauthorized,
+			Response: model.InvalidTokenError("No refresh token attached"),
+		}, nil
 	}
+	params.rt = rt
 
-	scopes := strings.Join(provider.Scopes, " ") // default if no restrictions apply
-	auds := ""                                   // default if no restrictions apply
-	var usedRestriction *restrictions.Restriction
 	if len(mt.Restrictions) > 0 {
-		possibleRestrictions := mt.Restrictions.GetValidForAT(nil, networkData.IP, mt.ID).WithScopes(utils.SplitIgnoreEmpty(req.Scope, " ")).WithAudiences(utils.SplitIgnoreEmpty(req.Audience, " "))
-		if len(possibleRestrictions) == 0 {
-			return &serverModel.Response{
-				Status:   fiber.StatusForbidden,
-				Response: api.APIErrorUsageRestricted,
+		possibleRestrictions := validRestrictions.WithScopes(utils.SplitIgnoreEmpty(req.Scope, " ")).WithAudiences(utils.SplitIgnoreEmpty(req.Audience, " "))
+		usedRestriction, err := possibleRestrictions.ConsumeForAT(tx, mt.ID)
+		if err != nil {
+			if !errors.Is(err, restrictions.ErrUsageRestricted) {
+				return nil, nil, err
 			}
+			if len(possibleRestrictions) == 0 {
+				eventService.LogDenial(mt.ID, event.MTEventDeniedRestriction, "scope or audience not allowed by restrictions", networkData)
+				return nil, &serverModel.Response{
+					Status:   fiber.StatusForbidden,
+					Response: api.APIErrorUsageRestricted,
+				}, nil
+			}
+			return nil, mt.ConsumeErrorResponse(err, networkData), nil
 		}
-		usedRestriction = &possibleRestrictions[0]
+		params.usedRestriction = usedRestriction
 		if req.Scope != "" {
-			scopes = req.Scope
+			params.scopes = req.Scope
 		} else if usedRestriction.Scope != "" {
-			scopes = usedRestriction.Scope
+			params.scopes = usedRestriction.Scope
 		}
 		if req.Audience != "" {
-			auds = req.Audience
+			params.auds = req.Audience
 		} else if len(usedRestriction.Audiences) > 0 {
-			auds = strings.Join(usedRestriction.Audiences, " ")
-		}
-	}
-	rt, rtFound, dbErr := refreshtokenrepo.GetRefreshToken(nil, mt.ID, string(req.Mytoken))
-	if dbErr != nil {
-		return serverModel.ErrorToInternalServerErrorResponse(dbErr)
-	}
-	if !rtFound {
-		return &serverModel.Response{
-			Status:   fiber.StatusUnauthorized,
-			Response: model.InvalidTokenError("No refresh token attached"),
+			params.auds = strings.Join(usedRestriction.Audiences, " ")
 		}
 	}
+	return params, nil, nil
+}
 
-	oidcRes, oidcErrRes, err := refresh.RefreshFlowAndUpdateDB(provider, mt.ID, string(req.Mytoken), rt, scopes, auds)
+func getAccessToken(mt *mytoken.Mytoken, req request.AccessTokenRequest, networkData api.ClientMetaData, params *refreshParams) *serverModel.Response {
+	scopes := params.scopes
+	oidcRes, oidcErrRes, err := refresh.RefreshFlowAndUpdate(params.provider, mt.ID, string(req.Mytoken), params.rt.RT, scopes, params.auds, func(_ mtid.MTID, newRT, _ string) error {
+		return refreshtokenrepo.UpdateRefreshTokenWithKey(nil, params.rt.RTID, newRT, params.rt.Key)
+	})
 	if err != nil {
 		return serverModel.ErrorToInternalServerErrorResponse(err)
 	}
@@ -176,18 +228,10 @@ func handleAccessTokenRefresh(mt *mytoken.Mytoken, req request.AccessTokenReques
 		if err = at.Store(tx); err != nil {
 			return err
 		}
-		if err = eventService.LogEvent(tx, eventService.MTEvent{
+		return eventService.LogEvent(tx, eventService.MTEvent{
 			Event: event.FromNumber(event.MTEventATCreated, "Used grant_type mytoken"),
 			MTID:  mt.ID,
-		}, networkData); err != nil {
-			return err
-		}
-		if usedRestriction != nil {
-			if err = usedRestriction.UsedAT(tx, mt.ID); err != nil {
-				return err
-			}
-		}
-		return nil
+		}, networkData)
 	}); err != nil {
 		return serverModel.ErrorToInternalServerErrorResponse(err)
 	}
@@ -65,6 +65,12 @@ func handleOIDCFlow(ctx *fiber.Ctx) error {
 			Response: api.APIErrorUnknownIssuer,
 		}.Send(ctx)
 	}
+	if err := req.ApplyProfiles(ctxUtils.ClientIP(ctx)); err != nil {
+		return serverModel.Response{
+			Status:   fiber.StatusBadRequest,
+			Response: model.BadRequestError(err.Error()),
+		}.Send(ctx)
+	}
 	switch req.OIDCFlow {
 	case model.OIDCFlowAuthorizationCode:
 		return authcode.StartAuthCodeFlow(ctx, *req).Send(ctx)
@@ -5,6 +5,7 @@ import (
 
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 	"github.com/oidc-mytoken/server/shared/model"
+	"github.com/oidc-mytoken/server/shared/mytoken/profiles"
 	"github.com/oidc-mytoken/server/shared/mytoken/restrictions"
 	"github.com/oidc-mytoken/server/shared/mytoken/token"
 )
@@ -33,6 +34,24 @@ func (r *MytokenFromMytokenRequest) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	*r = MytokenFromMytokenRequest(*rr)
+	if r.CapabilityProfile != "" { // capabilities are checked after the profile was applied
+		return nil
+	}
+	if r.SubtokenCapabilities != nil && !r.Capabilities.Has(api.CapabilityCreateMT) {
+		r.SubtokenCapabilities = nil
+	}
+	return nil
+}
+
+// ApplyProfiles merges the referenced restriction and capability profiles into the request; macros are resolved for
+// the passed ip
+func (r *MytokenFromMytokenRequest) ApplyProfiles(ip string) error {
+	if err := profiles.ApplyRestrictionProfile(r.RestrictionProfile, ip, &r.Restrictions); err != nil {
+		return err
+	}
+	if err := profiles.ApplyCapabilityProfile(r.CapabilityProfile, &r.Capabilities, &r.SubtokenCapabilities); err != nil {
+		return err
+	}
 	if r.SubtokenCapabilities != nil && !r.Capabilities.Has(api.CapabilityCreateMT) {
 		r.SubtokenCapabilities = nil
 	}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 	"github.com/oidc-mytoken/server/shared/model"
+	"github.com/oidc-mytoken/server/shared/mytoken/profiles"
 	"github.com/oidc-mytoken/server/shared/mytoken/restrictions"
 )
 
@@ -54,11 +55,33 @@ func (r *OIDCFlowRequest) UnmarshalJSON(data []byte) error {
 		ofr: ofr(*NewOIDCFlowRequest()),
 	}
 	o.RedirectType = o.redirectType
+	o.Capabilities = nil
 	if err := json.Unmarshal(data, &o); err != nil {
 		return err
 	}
 	o.redirectType = o.RedirectType
 	*r = OIDCFlowRequest(o.ofr)
+	if r.CapabilityProfile != "" { // capabilities are checked after the profile was applied
+		return nil
+	}
+	if r.Capabilities == nil {
+		r.Capabilities = NewOIDCFlowRequest().Capabilities
+	}
+	if r.SubtokenCapabilities != nil && !r.Capabilities.Has(api.CapabilityCreateMT) {
+		r.SubtokenCapabilities = nil
+	}
+	return nil
+}
+
+// ApplyProfiles merges the referenced capability profile into the request. The restriction profile is only checked
+// against the requested restrictions; it is applied when the user gives consent, so that its relative times start then.
+func (r *OIDCFlowRequest) ApplyProfiles(ip string) error {
+	if err := profiles.CheckRestrictionProfile(r.RestrictionProfile, ip, r.Restrictions); err != nil {
+		return err
+	}
+	if err := profiles.ApplyCapabilityProfile(r.CapabilityProfile, &r.Capabilities, &r.SubtokenCapabilities); err != nil {
+		return err
+	}
 	if r.SubtokenCapabilities != nil && !r.Capabilities.Has(api.CapabilityCreateMT) {
 		r.SubtokenCapabilities = nil
 	}
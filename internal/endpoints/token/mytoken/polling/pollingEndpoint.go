@@ -2,10 +2,13 @@ package polling
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/oidc-mytoken/server/internal/bruteforce"
+	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/transfercoderepo"
 	response "github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
 	"github.com/oidc-mytoken/server/internal/model"
@@ -23,45 +26,131 @@ func HandlePollingCode(ctx *fiber.Ctx) error {
 	return handlePollingCode(req, *ctxUtils.ClientMetaData(ctx)).Send(ctx)
 }
 
-func handlePollingCode(req response.PollingCodeRequest, networkData api.ClientMetaData) *model.Response {
-	pollingCode := req.PollingCode
-	log.WithField("polling_code", pollingCode).Debug("Handle polling code")
+// longPollCheckInterval is the time between two checks of a polling code during a long poll; the polling code is
+// checked in the database, so that the consent can be completed on any server instance
+const longPollCheckInterval = time.Second
+
+// checkPollingCode checks that the polling code exists and can still be used; if not, an error response is returned
+func checkPollingCode(pollingCode string) (transfercoderepo.TransferCodeStatus, *model.Response) {
 	pollingCodeStatus, err := transfercoderepo.CheckTransferCode(nil, pollingCode)
 	if err != nil {
-		return model.ErrorToInternalServerErrorResponse(err)
+		return pollingCodeStatus, model.ErrorToInternalServerErrorResponse(err)
 	}
 	if !pollingCodeStatus.Found {
 		log.WithField("polling_code", pollingCode).Debug("Polling code not known")
-		return &model.Response{
+		return pollingCodeStatus, &model.Response{
 			Status:   fiber.StatusUnauthorized,
 			Response: api.APIErrorBadTransferCode,
 		}
 	}
 	if pollingCodeStatus.ConsentDeclined {
 		log.WithField("polling_code", pollingCode).Debug("Consent declined")
-		return &model.Response{
+		return pollingCodeStatus, &model.Response{
 			Status:   fiber.StatusUnauthorized,
 			Response: api.APIErrorConsentDeclined,
 		}
 	}
 	if pollingCodeStatus.Expired {
 		log.WithField("polling_code", pollingCode).Debug("Polling code expired")
-		return &model.Response{
+		return pollingCodeStatus, &model.Response{
 			Status:   fiber.StatusUnauthorized,
 			Response: api.APIErrorTransferCodeExpired,
 		}
 	}
-	token, err := transfercoderepo.PopTokenForTransferCode(nil, pollingCode, networkData)
-	if err != nil {
-		log.WithError(err).Error()
-		return model.ErrorToInternalServerErrorResponse(err)
-	}
-	if token == "" {
+	return pollingCodeStatus, nil
+}
+
+// handlePollingCode returns the mytoken for a polling code once the consent is completed. If the request asks to
+// wait, it is held until the consent is completed or declined, or until the wait time, but at least the polling
+// interval, passes. Clients that poll without waiting faster than the polling interval get a slow_down error as
+// defined by RFC 8628; so do clients that long poll while another long poll of the polling code is running.
+func handlePollingCode(req response.PollingCodeRequest, networkData api.ClientMetaData) *model.Response {
+	pollingCode := req.PollingCode
+	log.WithField("polling_code", pollingCode).Debug("Handle polling code")
+	if bruteforce.Locked(bruteforce.KindPollingCode, networkData.IP) {
 		return &model.Response{
-			Status:   fiber.StatusPreconditionRequired,
-			Response: api.APIErrorAuthorizationPending,
+			Status:   fiber.StatusTooManyRequests,
+			Response: api.APIErrorTooManyFailedAttempts,
+		}
+	}
+	pollingCodeStatus, errRes := checkPollingCode(pollingCode)
+	if errRes != nil {
+		if errRes.Response == api.APIErrorBadTransferCode {
+			bruteforce.RecordFailure(bruteforce.KindPollingCode, networkData.IP)
 		}
+		return errRes
 	}
+	conf := config.Get().Features.Polling
+	wait := req.Wait
+	if wait > conf.LongPollMaxWait {
+		wait = conf.LongPollMaxWait
+	}
+	if wait <= 0 {
+		slowDown, err := transfercoderepo.RecordPoll(nil, pollingCode, conf.PollingInterval)
+		if err != nil {
+			return model.ErrorToInternalServerErrorResponse(err)
+		}
+		if slowDown {
+			log.WithField("polling_code", pollingCode).Debug("Polling too fast")
+			return &model.Response{
+				Status:   fiber.StatusBadRequest,
+				Response: api.APIErrorSlowDown,
+			}
+		}
+	} else {
+		if wait < conf.PollingInterval {
+			// Long polls are not checked against the polling interval, instead they are held for at least the polling
+			// interval, so that clients cannot poll faster by long polling back to back
+			wait = conf.PollingInterval
+		}
+		// Only one long poll per polling code is held, so that clients cannot tie up the server with parallel ones;
+		// the mark outlasts the long poll by a check interval, in case the last check takes longer
+		started, err := transfercoderepo.StartLongPoll(nil, pollingCode, wait+int64(longPollCheckInterval/time.Second))
+		if err != nil {
+			return model.ErrorToInternalServerErrorResponse(err)
+		}
+		if !started {
+			log.WithField("polling_code", pollingCode).Debug("Concurrent long poll")
+			return &model.Response{
+				Status:   fiber.StatusBadRequest,
+				Response: api.APIErrorConcurrentLongPoll,
+			}
+		}
+		defer func() {
+			if err := transfercoderepo.EndLongPoll(nil, pollingCode); err != nil {
+				log.WithError(err).Error("Could not end long poll")
+			}
+		}()
+	}
+	deadline := time.Now().Add(time.Duration(wait) * time.Second)
+	for {
+		token, err := transfercoderepo.PopTokenForTransferCode(nil, pollingCode, networkData)
+		if err != nil {
+			log.WithError(err).Error()
+			return model.ErrorToInternalServerErrorResponse(err)
+		}
+		if token != "" {
+			return tokenResponse(token, pollingCodeStatus, networkData)
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		if remaining > longPollCheckInterval {
+			remaining = longPollCheckInterval
+		}
+		time.Sleep(remaining)
+		if _, errRes = checkPollingCode(pollingCode); errRes != nil {
+			return errRes
+		}
+	}
+	return &model.Response{
+		Status:   fiber.StatusPreconditionRequired,
+		Response: api.APIErrorAuthorizationPending,
+	}
+}
+
+func tokenResponse(token string, pollingCodeStatus transfercoderepo.TransferCodeStatus, networkData api.ClientMetaData) *model.Response {
 	mt, err := mytoken.ParseJWT(token)
 	if err != nil {
 		return model.ErrorToInternalServerErrorResponse(err)
@@ -0,0 +1,86 @@
+package polling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/transfercoderepo"
+	"github.com/oidc-mytoken/server/internal/db/dbtest"
+	response "github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
+	serverModel "github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	"github.com/oidc-mytoken/server/shared/model"
+	"github.com/oidc-mytoken/server/shared/utils"
+)
+
+// TestHandlePollingCode_BackToBackLongPolls checks that clients that long poll back to back do not get a slow_down
+// error and are held for at least the polling interval.
+func TestHandlePollingCode_BackToBackLongPolls(t *testing.T) {
+	dbtest.Connect(t)
+	conf := &config.Get().Features.Polling
+	defer func(interval, maxWait int64) {
+		conf.PollingInterval, conf.LongPollMaxWait = interval, maxWait
+	}(conf.PollingInterval, conf.LongPollMaxWait)
+	conf.PollingInterval, conf.LongPollMaxWait = 2, 30
+
+	pollingCode := utils.RandASCIIString(conf.Len)
+	if err := transfercoderepo.CreatePollingCode(pollingCode, model.ResponseTypeToken).Store(nil); err != nil {
+		t.Fatal(err)
+	}
+	req := response.PollingCodeRequest{
+		PollingCodeRequest: api.PollingCodeRequest{
+			PollingCode: pollingCode,
+			Wait:        1,
+		},
+	}
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		res := handlePollingCode(req, api.ClientMetaData{IP: "127.0.0.1"})
+		if res.Response != api.APIErrorAuthorizationPending {
+			t.Fatalf("Expected authorization_pending for long poll %d, got %+v", i+1, res.Response)
+		}
+		if held := time.Since(start); held < 2*time.Second {
+			t.Errorf("Expected long poll %d to be held for the polling interval, but it returned after %s", i+1, held)
+		}
+	}
+}
+
+// TestHandlePollingCode_ConcurrentLongPolls checks that only one long poll per polling code is held at a time and
+// that another long poll can be started once it returned.
+func TestHandlePollingCode_ConcurrentLongPolls(t *testing.T) {
+	dbtest.Connect(t)
+	conf := &config.Get().Features.Polling
+	defer func(interval, maxWait int64) {
+		conf.PollingInterval, conf.LongPollMaxWait = interval, maxWait
+	}(conf.PollingInterval, conf.LongPollMaxWait)
+	conf.PollingInterval, conf.LongPollMaxWait = 2, 30
+
+	pollingCode := utils.RandASCIIString(conf.Len)
+	if err := transfercoderepo.CreatePollingCode(pollingCode, model.ResponseTypeToken).Store(nil); err != nil {
+		t.Fatal(err)
+	}
+	req := response.PollingCodeRequest{
+		PollingCodeRequest: api.PollingCodeRequest{
+			PollingCode: pollingCode,
+			Wait:        2,
+		},
+	}
+	first := make(chan *serverModel.Response)
+	go func() {
+		first <- handlePollingCode(req, api.ClientMetaData{IP: "127.0.0.1"})
+	}()
+	time.Sleep(500 * time.Millisecond)
+	res := handlePollingCode(req, api.ClientMetaData{IP: "127.0.0.1"})
+	if res.Status != fiber.StatusBadRequest || res.Response != api.APIErrorConcurrentLongPoll {
+		t.Errorf("Expected concurrent long poll to be rejected, got %d %+v", res.Status, res.Response)
+	}
+	if res = <-first; res.Response != api.APIErrorAuthorizationPending {
+		t.Fatalf("Expected authorization_pending for the first long poll, got %+v", res.Response)
+	}
+	if res = handlePollingCode(req, api.ClientMetaData{IP: "127.0.0.1"}); res.Response != api.APIErrorAuthorizationPending {
+		t.Errorf("Expected authorization_pending for a long poll after the first one, got %+v", res.Response)
+	}
+}
@@ -5,21 +5,20 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 
-	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
-	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/transfercoderepo"
 	"github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
 	"github.com/oidc-mytoken/server/internal/model"
 	"github.com/oidc-mytoken/server/internal/utils/ctxUtils"
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 	pkgModel "github.com/oidc-mytoken/server/shared/model"
 	mytoken "github.com/oidc-mytoken/server/shared/mytoken/pkg"
+	"github.com/oidc-mytoken/server/shared/mytoken/token"
 	"github.com/oidc-mytoken/server/shared/utils"
 )
 
 // HandleCreateTransferCodeForExistingMytoken handles request to create a transfer code for an existing mytoken
 func HandleCreateTransferCodeForExistingMytoken(ctx *fiber.Ctx) error {
-	token := ctxUtils.GetAuthHeaderToken(ctx)
-	if token == "" {
+	tok := ctxUtils.GetAuthHeaderToken(ctx)
+	if tok == "" {
 		var req api.CreateTransferCodeRequest
 		if err := json.Unmarshal(ctx.Body(), &req); err != nil {
 			return model.Response{
@@ -27,8 +26,8 @@ func HandleCreateTransferCodeForExistingMytoken(ctx *fiber.Ctx) error {
 				Response: pkgModel.BadRequestError(err.Error()),
 			}.Send(ctx)
 		}
-		token = req.Mytoken
-		if token == "" {
+		tok = req.Mytoken
+		if tok == "" {
 			return model.Response{
 				Status:   fiber.StatusUnauthorized,
 				Response: pkgModel.BadRequestError("required parameter 'mytoken' missing"),
@@ -36,49 +35,30 @@ func HandleCreateTransferCodeForExistingMytoken(ctx *fiber.Ctx) error {
 		}
 	}
 
-	var jwt string
-	var tokenType pkgModel.ResponseType
-	if utils.IsJWT(token) {
-		jwt = token
-		tokenType = pkgModel.ResponseTypeToken
-	} else {
+	tokenType := pkgModel.ResponseTypeToken
+	if !utils.IsJWT(tok) {
 		tokenType = pkgModel.ResponseTypeShortToken
-		shortToken := transfercoderepo.ParseShortToken(token)
-		tmp, valid, err := shortToken.JWT(nil)
-		jwt = tmp
-		if !valid {
-			return model.Response{
-				Status:   fiber.StatusUnauthorized,
-				Response: pkgModel.InvalidTokenError(""),
-			}.Send(ctx)
-		}
-		if err != nil {
-			return model.Response{
-				Status:   fiber.StatusUnauthorized,
-				Response: pkgModel.InvalidTokenError(err.Error()),
-			}.Send(ctx)
-		}
 	}
-	mToken, err := mytoken.ParseJWT(jwt)
+	jwt, err := token.GetLongMytoken(tok, ctxUtils.ClientIP(ctx))
 	if err != nil {
 		return model.Response{
 			Status:   fiber.StatusUnauthorized,
 			Response: pkgModel.InvalidTokenError(err.Error()),
 		}.Send(ctx)
 	}
-
-	revoked, dbErr := dbhelper.CheckTokenRevoked(nil, mToken.ID, mToken.SeqNo, mToken.Rotation)
-	if dbErr != nil {
-		return model.ErrorToInternalServerErrorResponse(dbErr).Send(ctx)
-	}
-	if revoked {
+	mToken, err := mytoken.ParseJWT(string(jwt))
+	if err != nil {
 		return model.Response{
 			Status:   fiber.StatusUnauthorized,
-			Response: pkgModel.InvalidTokenError(""),
+			Response: pkgModel.InvalidTokenError(err.Error()),
 		}.Send(ctx)
 	}
 
-	transferCode, expiresIn, err := mytoken.CreateTransferCode(mToken.ID, token, false, tokenType, *ctxUtils.ClientMetaData(ctx))
+	if errRes := mToken.VerifyNotRevoked(nil, *ctxUtils.ClientMetaData(ctx)); errRes != nil {
+		return errRes.Send(ctx)
+	}
+
+	transferCode, expiresIn, err := mytoken.CreateTransferCode(mToken.ID, tok, false, tokenType, *ctxUtils.ClientMetaData(ctx))
 	if err != nil {
 		return model.ErrorToInternalServerErrorResponse(err).Send(ctx)
 	}
@@ -0,0 +1,114 @@
+package tokeninfo
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/endpoints/tokeninfo/pkg"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	sharedModel "github.com/oidc-mytoken/server/shared/model"
+	"github.com/oidc-mytoken/server/shared/mytoken/anomaly"
+	eventService "github.com/oidc-mytoken/server/shared/mytoken/event"
+	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
+	mytoken "github.com/oidc-mytoken/server/shared/mytoken/pkg"
+)
+
+func validAnomalyPolicy(policy string) bool {
+	switch policy {
+	case "", api.AnomalyActionLog, api.AnomalyActionNotify, api.AnomalyActionSuspend:
+		return true
+	default:
+		return false
+	}
+}
+
+// handleTokenInfoAnomalyPolicy returns the anomaly policy of a mytoken and sets it if req.AnomalyPolicy is given.
+// Reading requires the read@settings capability, changing it the settings capability.
+func handleTokenInfoAnomalyPolicy(req *pkg.TokenInfoRequest, mt *mytoken.Mytoken, clientMetadata *api.ClientMetaData) model.Response {
+	// If we call this function it means the token is valid.
+
+	set := req.AnomalyPolicy != nil
+	capability := api.CapabilityReadSettings
+	if set {
+		capability = api.CapabilitySettings
+		if !validAnomalyPolicy(*req.AnomalyPolicy) {
+			return model.Response{
+				Status:   fiber.StatusBadRequest,
+				Response: sharedModel.BadRequestError(fmt.Sprintf("unknown anomaly_policy '%s'", *req.AnomalyPolicy)),
+			}
+		}
+	}
+	if errRes := mt.AuthorizeCapabilities(*clientMetadata, capability); errRes != nil {
+		return *errRes
+	}
+
+	possibleRestrictions, errRes := mt.RestrictionsForOther(nil, *clientMetadata, capability)
+	if errRes != nil {
+		return *errRes
+	}
+
+	managementID := req.ManagementID
+	if managementID == "" {
+		managementID = mt.ID.ManagementID()
+	}
+	res := api.TokeninfoAnomalyPolicyResponse{ManagementID: managementID}
+	if err := db.Transact(func(tx *sqlx.Tx) error {
+		id, found, err := dbhelper.GetMTIDByManagementID(tx, managementID, mt.ID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			errRes = &model.Response{
+				Status:   fiber.StatusNotFound,
+				Response: api.APIErrorUnknownManagementID,
+			}
+			return fmt.Errorf("error_res")
+		}
+		if possibleRestrictions != nil {
+			if _, err = possibleRestrictions.ConsumeForOther(tx, mt.ID); err != nil {
+				return err
+			}
+		}
+		if set {
+			if req.ForUser {
+				err = dbhelper.SetUserAnomalyPolicy(tx, id, *req.AnomalyPolicy)
+			} else {
+				err = dbhelper.SetMTAnomalyPolicy(tx, id, *req.AnomalyPolicy)
+			}
+			if err != nil {
+				return err
+			}
+			level := "token"
+			if req.ForUser {
+				level = "user"
+			}
+			comment := fmt.Sprintf("%s policy removed", level)
+			if *req.AnomalyPolicy != "" {
+				comment = fmt.Sprintf("%s policy set to '%s'", level, *req.AnomalyPolicy)
+			}
+			if err = eventService.LogEvent(tx, eventService.MTEvent{
+				Event: event.FromNumber(event.MTEventAnomalyPolicyChanged, comment),
+				MTID:  id,
+			}, *clientMetadata); err != nil {
+				return err
+			}
+		}
+		res.EffectivePolicy, res.TokenPolicy, res.UserPolicy, err = anomaly.EffectivePolicy(tx, id)
+		return err
+	}); err != nil {
+		if errRes != nil {
+			return *errRes
+		}
+		return *mt.ConsumeErrorResponse(err, *clientMetadata)
+	}
+
+	return model.Response{
+		Status:   fiber.StatusOK,
+		Response: res,
+	}
+}
@@ -3,54 +3,75 @@ package tokeninfo
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
 
 	"github.com/oidc-mytoken/server/internal/db"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/eventrepo"
+	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
 	"github.com/oidc-mytoken/server/internal/endpoints/tokeninfo/pkg"
 	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/utils/pagination"
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 	eventService "github.com/oidc-mytoken/server/shared/mytoken/event"
 	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
 	mytoken "github.com/oidc-mytoken/server/shared/mytoken/pkg"
-	"github.com/oidc-mytoken/server/shared/mytoken/restrictions"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
 )
 
-func handleTokenInfoHistory(mt *mytoken.Mytoken, clientMetadata *api.ClientMetaData) model.Response {
+func handleTokenInfoHistory(req *pkg.TokenInfoRequest, mt *mytoken.Mytoken, clientMetadata *api.ClientMetaData) model.Response {
 	// If we call this function it means the token is valid.
 
-	if !mt.Capabilities.Has(api.CapabilityTokeninfoHistory) {
-		return model.Response{
-			Status:   fiber.StatusForbidden,
-			Response: api.APIErrorInsufficientCapabilities,
-		}
+	required := []api.Capability{api.CapabilityTokeninfoHistory}
+	other := req.ManagementID != "" && req.ManagementID != mt.ID.ManagementID()
+	if other {
+		// The history of another mytoken of the user reveals this mytoken like the list of all mytokens
+		required = append(required, api.CapabilityListMT)
+	}
+	if errRes := mt.AuthorizeCapabilities(*clientMetadata, required...); errRes != nil {
+		return *errRes
+	}
+	query, err := historyQuery(req)
+	if err != nil {
+		return *model.ErrorToBadRequestErrorResponse(err)
 	}
 
-	var usedRestriction *restrictions.Restriction
-	if len(mt.Restrictions) > 0 {
-		possibleRestrictions := mt.Restrictions.GetValidForOther(nil, clientMetadata.IP, mt.ID)
-		if len(possibleRestrictions) == 0 {
-			return model.Response{
-				Status:   fiber.StatusForbidden,
-				Response: api.APIErrorUsageRestricted,
-			}
-		}
-		usedRestriction = &possibleRestrictions[0]
+	possibleRestrictions, errRes := mt.RestrictionsForOther(nil, *clientMetadata, required[0], required[1:]...)
+	if errRes != nil {
+		return *errRes
 	}
 
 	var history eventrepo.EventHistory
-	if err := db.Transact(func(tx *sqlx.Tx) error {
+	var next *pagination.Cursor
+	if err = db.Transact(func(tx *sqlx.Tx) error {
+		id := mt.ID
+		getHistory := eventrepo.GetEventHistory
+		if other {
+			var found bool
+			var err error
+			id, getHistory, found, err = historyOf(tx, req.ManagementID, mt.ID)
+			if err != nil {
+				return err
+			}
+			if !found {
+				errRes = &model.Response{
+					Status:   fiber.StatusNotFound,
+					Response: api.APIErrorUnknownManagementID,
+				}
+				return fmt.Errorf("error_res")
+			}
+		}
 		var err error
-		history, err = eventrepo.GetEventHistory(tx, mt.ID)
+		history, next, err = getHistory(tx, id, query)
 		if err != nil && !errors.Is(err, sql.ErrNoRows) {
 			return err
 		}
-		if usedRestriction == nil {
+		if possibleRestrictions == nil {
 			return nil
 		}
-		if err = usedRestriction.UsedOther(tx, mt.ID); err != nil {
+		if _, err = possibleRestrictions.ConsumeForOther(tx, mt.ID); err != nil {
 			return err
 		}
 		return eventService.LogEvent(tx, eventService.MTEvent{
@@ -58,10 +79,29 @@ func handleTokenInfoHistory(mt *mytoken.Mytoken, clientMetadata *api.ClientMetaD
 			MTID:  mt.ID,
 		}, *clientMetadata)
 	}); err != nil {
-		return *model.ErrorToInternalServerErrorResponse(err)
+		if errRes != nil {
+			return *errRes
+		}
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			return *model.ErrorToBadRequestErrorResponse(err)
+		}
+		return *mt.ConsumeErrorResponse(err, *clientMetadata)
 	}
 	return model.Response{
 		Status:   fiber.StatusOK,
-		Response: pkg.NewTokeninfoHistoryResponse(history),
+		Response: pkg.NewTokeninfoHistoryResponse(history, next),
+	}
+}
+
+type historyGetter func(*sqlx.Tx, mtid.MTID, eventrepo.EventHistoryQuery) (eventrepo.EventHistory, *pagination.Cursor, error)
+
+// historyOf returns the id of the mytoken with the passed management id, if it belongs to the same user, and how to
+// get its history; the history of a revoked mytoken is kept with its tombstone
+func historyOf(tx *sqlx.Tx, managementID string, sameUserAs mtid.MTID) (mtid.MTID, historyGetter, bool, error) {
+	id, found, err := dbhelper.GetMTIDByManagementID(tx, managementID, sameUserAs)
+	if err != nil || found {
+		return id, eventrepo.GetEventHistory, found, err
 	}
+	id, found, err = dbhelper.GetRevokedMTIDByManagementID(tx, managementID, sameUserAs)
+	return id, eventrepo.GetRevokedEventHistory, found, err
 }
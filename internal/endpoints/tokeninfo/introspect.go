@@ -16,11 +16,8 @@ import (
 func handleTokenInfoIntrospect(mt *mytoken.Mytoken, clientMetadata *api.ClientMetaData) model.Response {
 	// If we call this function it means the token is valid.
 
-	if !mt.Capabilities.Has(api.CapabilityTokeninfoIntrospect) {
-		return model.Response{
-			Status:   fiber.StatusForbidden,
-			Response: api.APIErrorInsufficientCapabilities,
-		}
+	if errRes := mt.AuthorizeCapabilities(*clientMetadata, api.CapabilityTokeninfoIntrospect); errRes != nil {
+		return *errRes
 	}
 	var usedToken mytoken.UsedMytoken
 	if err := db.RunWithinTransaction(nil, func(tx *sqlx.Tx) error {
@@ -2,13 +2,19 @@ package pkg
 
 import (
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/eventrepo"
+	"github.com/oidc-mytoken/server/internal/utils/pagination"
 )
 
 type TokeninfoHistoryResponse struct {
 	// un update check api.TokeninfoHistoryResponse
 	EventHistory eventrepo.EventHistory `json:"events"`
+	NextCursor   string                 `json:"next_cursor,omitempty"`
 }
 
-func NewTokeninfoHistoryResponse(h eventrepo.EventHistory) TokeninfoHistoryResponse {
-	return TokeninfoHistoryResponse{EventHistory: h}
+func NewTokeninfoHistoryResponse(h eventrepo.EventHistory, next *pagination.Cursor) TokeninfoHistoryResponse {
+	r := TokeninfoHistoryResponse{EventHistory: h}
+	if next != nil {
+		r.NextCursor = next.Encode()
+	}
+	return r
 }
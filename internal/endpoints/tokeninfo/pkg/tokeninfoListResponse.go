@@ -2,13 +2,19 @@ package pkg
 
 import (
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/tree"
+	"github.com/oidc-mytoken/server/internal/utils/pagination"
 )
 
 type TokeninfoListResponse struct {
 	// un update check api.TokeninfoListResponse
-	Tokens []tree.MytokenEntryTree `json:"mytokens"`
+	Tokens     []tree.MytokenEntryTree `json:"mytokens"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
 }
 
-func NewTokeninfoListResponse(l []tree.MytokenEntryTree) TokeninfoListResponse {
-	return TokeninfoListResponse{Tokens: l}
+func NewTokeninfoListResponse(l []tree.MytokenEntryTree, next *pagination.Cursor) TokeninfoListResponse {
+	r := TokeninfoListResponse{Tokens: l}
+	if next != nil {
+		r.NextCursor = next.Encode()
+	}
+	return r
 }
@@ -2,13 +2,19 @@ package pkg
 
 import (
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/tree"
+	"github.com/oidc-mytoken/server/internal/utils/pagination"
 )
 
 type TokeninfoTreeResponse struct {
 	// un update check api.TokeninforTeeResponse
-	Tokens tree.MytokenEntryTree `json:"mytokens"`
+	Tokens     tree.MytokenEntryTree `json:"mytokens"`
+	NextCursor string                `json:"next_cursor,omitempty"`
 }
 
-func NewTokeninfoTreeResponse(t tree.MytokenEntryTree) TokeninfoTreeResponse {
-	return TokeninfoTreeResponse{Tokens: t}
+func NewTokeninfoTreeResponse(t tree.MytokenEntryTree, next *pagination.Cursor) TokeninfoTreeResponse {
+	r := TokeninfoTreeResponse{Tokens: t}
+	if next != nil {
+		r.NextCursor = next.Encode()
+	}
+	return r
 }
@@ -0,0 +1,14 @@
+package pkg
+
+import (
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/tree"
+)
+
+type TokeninfoUpdateMetadataResponse struct {
+	// un update check api.TokeninfoUpdateMetadataResponse
+	Token tree.MytokenEntry `json:"token"`
+}
+
+func NewTokeninfoUpdateMetadataResponse(e tree.MytokenEntry) TokeninfoUpdateMetadataResponse {
+	return TokeninfoUpdateMetadataResponse{Token: e}
+}
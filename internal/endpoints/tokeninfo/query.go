@@ -0,0 +1,84 @@
+package tokeninfo
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/eventrepo"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/tree"
+	"github.com/oidc-mytoken/server/internal/endpoints/tokeninfo/pkg"
+	"github.com/oidc-mytoken/server/internal/utils/pagination"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
+	"github.com/oidc-mytoken/server/shared/utils"
+	"github.com/oidc-mytoken/server/shared/utils/unixtime"
+)
+
+// descending parses the sort order of the request; the default order is ascending
+func descending(order string) (bool, error) {
+	switch order {
+	case "", api.SortOrderAsc:
+		return false, nil
+	case api.SortOrderDesc:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown sort_order '%s'", order)
+	}
+}
+
+// treeQuery creates the tree.Query for the subtree and list actions from the request
+func treeQuery(req *pkg.TokenInfoRequest) (q tree.Query, err error) {
+	switch req.SortBy {
+	case "", api.SortByCreated, api.SortByName:
+	default:
+		return q, fmt.Errorf("unknown sort_by '%s'", req.SortBy)
+	}
+	switch req.Status {
+	case "", api.TokenStatusActive, api.TokenStatusSuspended:
+	default:
+		return q, fmt.Errorf("unknown status '%s'", req.Status)
+	}
+	q = tree.Query{
+		Tag:    req.Tag,
+		Status: req.Status,
+		SortBy: req.SortBy,
+		Limit:  pagination.Limit(req.Limit, req.Cursor),
+	}
+	if q.Descending, err = descending(req.SortOrder); err != nil {
+		return
+	}
+	if q.After, err = pagination.Decode(req.Cursor); err != nil || q.After == nil {
+		return
+	}
+	if q.SortBy != api.SortByName {
+		if _, e := strconv.ParseInt(q.After.Key, 10, 64); e != nil {
+			err = pagination.ErrInvalidCursor
+		}
+	}
+	return
+}
+
+// historyQuery creates the eventrepo.EventHistoryQuery for the history action from the request
+func historyQuery(req *pkg.TokenInfoRequest) (q eventrepo.EventHistoryQuery, err error) {
+	if req.SortBy != "" && req.SortBy != api.SortByTime {
+		return q, fmt.Errorf("unknown sort_by '%s'", req.SortBy)
+	}
+	for _, e := range req.Events {
+		if !utils.StringInSlice(e, event.AllEvents[:]) {
+			return q, fmt.Errorf("unknown event '%s'", e)
+		}
+	}
+	q = eventrepo.EventHistoryQuery{
+		Events:  req.Events,
+		Since:   unixtime.UnixTime(req.Since),
+		Until:   unixtime.UnixTime(req.Until),
+		IP:      req.IP,
+		Country: req.Country,
+		Limit:   pagination.Limit(req.Limit, req.Cursor),
+	}
+	if q.Descending, err = descending(req.SortOrder); err != nil {
+		return
+	}
+	q.After, err = pagination.Decode(req.Cursor)
+	return
+}
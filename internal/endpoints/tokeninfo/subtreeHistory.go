@@ -0,0 +1,66 @@
+package tokeninfo
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/eventrepo"
+	"github.com/oidc-mytoken/server/internal/endpoints/tokeninfo/pkg"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/utils/pagination"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	eventService "github.com/oidc-mytoken/server/shared/mytoken/event"
+	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
+	mytoken "github.com/oidc-mytoken/server/shared/mytoken/pkg"
+)
+
+func handleTokenInfoSubtreeHistory(req *pkg.TokenInfoRequest, mt *mytoken.Mytoken, clientMetadata *api.ClientMetaData) model.Response {
+	// If we call this function it means the token is valid.
+
+	// The history of the subtree reveals the subtree and the history of each token in it
+	if errRes := mt.AuthorizeCapabilities(*clientMetadata, api.CapabilityTokeninfoHistory, api.CapabilityTokeninfoTree); errRes != nil {
+		return *errRes
+	}
+	query, err := historyQuery(req)
+	if err != nil {
+		return *model.ErrorToBadRequestErrorResponse(err)
+	}
+
+	possibleRestrictions, errRes := mt.RestrictionsForOther(nil, *clientMetadata, api.CapabilityTokeninfoHistory, api.CapabilityTokeninfoTree)
+	if errRes != nil {
+		return *errRes
+	}
+
+	var history eventrepo.EventHistory
+	var next *pagination.Cursor
+	if err = db.Transact(func(tx *sqlx.Tx) error {
+		var err error
+		history, next, err = eventrepo.GetSubtreeEventHistory(tx, mt.ID, query)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if possibleRestrictions == nil {
+			return nil
+		}
+		if _, err = possibleRestrictions.ConsumeForOther(tx, mt.ID); err != nil {
+			return err
+		}
+		return eventService.LogEvent(tx, eventService.MTEvent{
+			Event: event.FromNumber(event.MTEventTokenInfoSubtreeHistory, ""),
+			MTID:  mt.ID,
+		}, *clientMetadata)
+	}); err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			return *model.ErrorToBadRequestErrorResponse(err)
+		}
+		return *mt.ConsumeErrorResponse(err, *clientMetadata)
+	}
+	return model.Response{
+		Status:   fiber.StatusOK,
+		Response: pkg.NewTokeninfoHistoryResponse(history, next),
+	}
+}
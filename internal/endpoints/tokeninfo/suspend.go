@@ -0,0 +1,93 @@
+package tokeninfo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/endpoints/tokeninfo/pkg"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	sharedModel "github.com/oidc-mytoken/server/shared/model"
+	eventService "github.com/oidc-mytoken/server/shared/mytoken/event"
+	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
+	mytoken "github.com/oidc-mytoken/server/shared/mytoken/pkg"
+)
+
+func handleTokenInfoSuspend(req *pkg.TokenInfoRequest, mt *mytoken.Mytoken, clientMetadata *api.ClientMetaData, suspend bool) model.Response {
+	// If we call this function it means the token is valid.
+
+	if errRes := mt.AuthorizeCapabilities(*clientMetadata, api.CapabilitySuspendMT); errRes != nil {
+		return *errRes
+	}
+
+	possibleRestrictions, errRes := mt.RestrictionsForOther(nil, *clientMetadata, api.CapabilitySuspendMT)
+	if errRes != nil {
+		return *errRes
+	}
+
+	managementID := req.ManagementID
+	if managementID == "" {
+		managementID = mt.ID.ManagementID()
+	}
+	if err := db.Transact(func(tx *sqlx.Tx) error {
+		id, found, err := dbhelper.GetMTIDByManagementID(tx, managementID, mt.ID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			errRes = &model.Response{
+				Status:   fiber.StatusNotFound,
+				Response: api.APIErrorUnknownManagementID,
+			}
+			return fmt.Errorf("error_res")
+		}
+		if possibleRestrictions != nil {
+			if _, err = possibleRestrictions.ConsumeForOther(tx, mt.ID); err != nil {
+				return err
+			}
+		}
+		ev := event.MTEventResumed
+		if suspend {
+			ev = event.MTEventSuspended
+			err = dbhelper.SuspendMT(tx, id)
+		} else {
+			err = dbhelper.ResumeMT(tx, id)
+		}
+		if err != nil {
+			if errors.Is(err, dbhelper.ErrSuspendedByParent) {
+				errRes = &model.Response{
+					Status:   fiber.StatusBadRequest,
+					Response: sharedModel.BadRequestError(err.Error()),
+				}
+				return fmt.Errorf("error_res")
+			}
+			return err
+		}
+		comment := ""
+		if id.Hash() != mt.ID.Hash() {
+			comment = fmt.Sprintf("by %s", mt.ID.ManagementID())
+		}
+		return eventService.LogEvent(tx, eventService.MTEvent{
+			Event: event.FromNumber(ev, comment),
+			MTID:  id,
+		}, *clientMetadata)
+	}); err != nil {
+		if errRes != nil {
+			return *errRes
+		}
+		return *mt.ConsumeErrorResponse(err, *clientMetadata)
+	}
+
+	return model.Response{
+		Status: fiber.StatusOK,
+		Response: api.TokeninfoSuspendResponse{
+			ManagementID: managementID,
+			Suspended:    suspend,
+		},
+	}
+}
@@ -6,12 +6,13 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 
-	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/endpoints/tokeninfo/pkg"
 	"github.com/oidc-mytoken/server/internal/model"
 	"github.com/oidc-mytoken/server/internal/utils/ctxUtils"
 	model2 "github.com/oidc-mytoken/server/shared/model"
 	mytoken "github.com/oidc-mytoken/server/shared/mytoken/pkg"
+	"github.com/oidc-mytoken/server/shared/mytoken/token"
 )
 
 func HandleTokenInfo(ctx *fiber.Ctx) error {
@@ -28,11 +29,28 @@ func HandleTokenInfo(ctx *fiber.Ctx) error {
 	case model2.TokeninfoActionIntrospect:
 		return handleTokenInfoIntrospect(st, clientMetadata).Send(ctx)
 	case model2.TokeninfoActionEventHistory:
-		return handleTokenInfoHistory(st, clientMetadata).Send(ctx)
+		return handleTokenInfoHistory(&req, st, clientMetadata).Send(ctx)
+	case model2.TokeninfoActionSubtreeEventHistory:
+		return handleTokenInfoSubtreeHistory(&req, st, clientMetadata).Send(ctx)
 	case model2.TokeninfoActionSubtokenTree:
-		return handleTokenInfoTree(st, clientMetadata).Send(ctx)
+		return handleTokenInfoTree(&req, st, clientMetadata).Send(ctx)
 	case model2.TokeninfoActionListMytokens:
-		return handleTokenInfoList(st, clientMetadata).Send(ctx)
+		return handleTokenInfoList(&req, st, clientMetadata).Send(ctx)
+	case model2.TokeninfoActionSuspend, model2.TokeninfoActionResume:
+		if !config.Get().Features.TokenInfo.Suspend.Enabled {
+			return actionNotSupported(req.Action).Send(ctx)
+		}
+		return handleTokenInfoSuspend(&req, st, clientMetadata, req.Action == model2.TokeninfoActionSuspend).Send(ctx)
+	case model2.TokeninfoActionUpdateMetadata:
+		if !config.Get().Features.TokenInfo.Metadata.Enabled {
+			return actionNotSupported(req.Action).Send(ctx)
+		}
+		return handleTokenInfoUpdateMetadata(&req, st, clientMetadata).Send(ctx)
+	case model2.TokeninfoActionAnomalyPolicy:
+		if !config.Get().Features.TokenInfo.AnomalyPolicy.Enabled {
+			return actionNotSupported(req.Action).Send(ctx)
+		}
+		return handleTokenInfoAnomalyPolicy(&req, st, clientMetadata).Send(ctx)
 	default:
 		return model.Response{
 			Status:   fiber.StatusBadRequest,
@@ -41,35 +59,37 @@ func HandleTokenInfo(ctx *fiber.Ctx) error {
 	}
 }
 
+// actionNotSupported returns the response for an action that is disabled in the config
+func actionNotSupported(action model2.TokeninfoAction) model.Response {
+	return model.Response{
+		Status:   fiber.StatusBadRequest,
+		Response: model2.BadRequestError(fmt.Sprintf("action '%s' is not supported by this server", action.String())),
+	}
+}
+
 func testMytoken(ctx *fiber.Ctx, req *pkg.TokenInfoRequest) (*mytoken.Mytoken, *model.Response) {
 	if req.Mytoken == "" {
-		if t := ctxUtils.GetMytoken(ctx); t != nil {
-			req.Mytoken = *t
-		} else {
-			return nil, &model.Response{
-				Status:   fiber.StatusUnauthorized,
-				Response: model2.InvalidTokenError("no mytoken found in request"),
-			}
-		}
+		req.Mytoken = token.Token(ctxUtils.GetMytokenStr(ctx))
 	}
-
-	mt, err := mytoken.ParseJWT(string(req.Mytoken))
+	jwt, err := token.GetLongMytoken(string(req.Mytoken), ctxUtils.ClientIP(ctx))
 	if err != nil {
 		return nil, &model.Response{
 			Status:   fiber.StatusUnauthorized,
 			Response: model2.InvalidTokenError(err.Error()),
 		}
 	}
+	req.Mytoken = jwt
 
-	revoked, dbErr := dbhelper.CheckTokenRevoked(nil, mt.ID, mt.SeqNo, mt.Rotation)
-	if dbErr != nil {
-		return nil, model.ErrorToInternalServerErrorResponse(dbErr)
-	}
-	if revoked {
+	mt, err := mytoken.ParseJWT(string(req.Mytoken))
+	if err != nil {
 		return nil, &model.Response{
 			Status:   fiber.StatusUnauthorized,
-			Response: model2.InvalidTokenError(""),
+			Response: model2.InvalidTokenError(err.Error()),
 		}
 	}
+
+	if errRes := mt.VerifyNotRevoked(nil, *ctxUtils.ClientMetaData(ctx)); errRes != nil {
+		return nil, errRes
+	}
 	return mt, nil
 }
@@ -11,46 +11,41 @@ import (
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/tree"
 	"github.com/oidc-mytoken/server/internal/endpoints/tokeninfo/pkg"
 	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/utils/pagination"
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 	eventService "github.com/oidc-mytoken/server/shared/mytoken/event"
 	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
 	mytoken "github.com/oidc-mytoken/server/shared/mytoken/pkg"
-	"github.com/oidc-mytoken/server/shared/mytoken/restrictions"
 )
 
-func handleTokenInfoTree(mt *mytoken.Mytoken, clientMetadata *api.ClientMetaData) model.Response {
+func handleTokenInfoTree(req *pkg.TokenInfoRequest, mt *mytoken.Mytoken, clientMetadata *api.ClientMetaData) model.Response {
 	// If we call this function it means the token is valid.
 
-	if !mt.Capabilities.Has(api.CapabilityTokeninfoTree) {
-		return model.Response{
-			Status:   fiber.StatusForbidden,
-			Response: api.APIErrorInsufficientCapabilities,
-		}
+	if errRes := mt.AuthorizeCapabilities(*clientMetadata, api.CapabilityTokeninfoTree); errRes != nil {
+		return *errRes
+	}
+	query, err := treeQuery(req)
+	if err != nil {
+		return *model.ErrorToBadRequestErrorResponse(err)
 	}
 
-	var usedRestriction *restrictions.Restriction
-	if len(mt.Restrictions) > 0 {
-		possibleRestrictions := mt.Restrictions.GetValidForOther(nil, clientMetadata.IP, mt.ID)
-		if len(possibleRestrictions) == 0 {
-			return model.Response{
-				Status:   fiber.StatusForbidden,
-				Response: api.APIErrorUsageRestricted,
-			}
-		}
-		usedRestriction = &possibleRestrictions[0]
+	possibleRestrictions, errRes := mt.RestrictionsForOther(nil, *clientMetadata, api.CapabilityTokeninfoTree)
+	if errRes != nil {
+		return *errRes
 	}
 
 	var tokenTree tree.MytokenEntryTree
-	if err := db.Transact(func(tx *sqlx.Tx) error {
+	var next *pagination.Cursor
+	if err = db.Transact(func(tx *sqlx.Tx) error {
 		var err error
-		tokenTree, err = tree.TokenSubTree(tx, mt.ID)
+		tokenTree, next, err = tree.SubtreePage(tx, mt.ID, query)
 		if err != nil && !errors.Is(err, sql.ErrNoRows) {
 			return err
 		}
-		if usedRestriction == nil {
+		if possibleRestrictions == nil {
 			return nil
 		}
-		if err = usedRestriction.UsedOther(tx, mt.ID); err != nil {
+		if _, err = possibleRestrictions.ConsumeForOther(tx, mt.ID); err != nil {
 			return err
 		}
 		return eventService.LogEvent(tx, eventService.MTEvent{
@@ -58,11 +53,11 @@ func handleTokenInfoTree(mt *mytoken.Mytoken, clientMetadata *api.ClientMetaData
 			MTID:  mt.ID,
 		}, *clientMetadata)
 	}); err != nil {
-		return *model.ErrorToInternalServerErrorResponse(err)
+		return *mt.ConsumeErrorResponse(err, *clientMetadata)
 	}
 
 	return model.Response{
 		Status:   fiber.StatusOK,
-		Response: pkg.NewTokeninfoTreeResponse(tokenTree),
+		Response: pkg.NewTokeninfoTreeResponse(tokenTree, next),
 	}
 }
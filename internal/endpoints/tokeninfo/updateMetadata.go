@@ -0,0 +1,186 @@
+package tokeninfo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/tree"
+	"github.com/oidc-mytoken/server/internal/endpoints/tokeninfo/pkg"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	eventService "github.com/oidc-mytoken/server/shared/mytoken/event"
+	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
+	mytoken "github.com/oidc-mytoken/server/shared/mytoken/pkg"
+	"github.com/oidc-mytoken/server/shared/utils"
+)
+
+const (
+	maxNameLength        = 100
+	maxDescriptionLength = 1000
+	maxTagLength         = 100
+	maxTags              = 32
+)
+
+// normalizeTags trims the passed tags, removes duplicates, and sorts them; tags are compared case-insensitive like
+// in the database
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			return nil, errors.New("tags must not be empty")
+		}
+		if len(t) > maxTagLength {
+			return nil, fmt.Errorf("tags must not be longer than %d characters", maxTagLength)
+		}
+		if !utils.StringInSliceIgnoreCase(t, normalized) {
+			normalized = append(normalized, t)
+		}
+	}
+	if len(normalized) > maxTags {
+		return nil, fmt.Errorf("a mytoken must not have more than %d tags", maxTags)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// sameTags checks if the two passed tag sets are equal; like in normalizeTags, tags are compared case-insensitive
+func sameTags(a, b []string) bool {
+	fold := func(tags []string) []string {
+		folded := []string{}
+		for _, t := range tags {
+			t = strings.ToLower(strings.TrimSpace(t))
+			if !utils.StringInSlice(t, folded) {
+				folded = append(folded, t)
+			}
+		}
+		sort.Strings(folded)
+		return folded
+	}
+	a, b = fold(a), fold(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func checkMetadataRequest(req *pkg.TokenInfoRequest) error {
+	if req.Name == nil && req.Description == nil && req.Tags == nil {
+		return errors.New("no metadata given")
+	}
+	if req.Name != nil && len(*req.Name) > maxNameLength {
+		return fmt.Errorf("name must not be longer than %d characters", maxNameLength)
+	}
+	if req.Description != nil && len(*req.Description) > maxDescriptionLength {
+		return fmt.Errorf("description must not be longer than %d characters", maxDescriptionLength)
+	}
+	if req.Tags != nil {
+		tags, err := normalizeTags(*req.Tags)
+		if err != nil {
+			return err
+		}
+		req.Tags = &tags
+	}
+	return nil
+}
+
+func handleTokenInfoUpdateMetadata(req *pkg.TokenInfoRequest, mt *mytoken.Mytoken, clientMetadata *api.ClientMetaData) model.Response {
+	// If we call this function it means the token is valid.
+
+	if errRes := mt.AuthorizeCapabilities(*clientMetadata, api.CapabilityUpdateMTMetadata); errRes != nil {
+		return *errRes
+	}
+	if err := checkMetadataRequest(req); err != nil {
+		return *model.ErrorToBadRequestErrorResponse(err)
+	}
+
+	possibleRestrictions, errRes := mt.RestrictionsForOther(nil, *clientMetadata, api.CapabilityUpdateMTMetadata)
+	if errRes != nil {
+		return *errRes
+	}
+
+	managementID := req.ManagementID
+	if managementID == "" {
+		managementID = mt.ID.ManagementID()
+	}
+	var entry tree.MytokenEntry
+	if err := db.Transact(func(tx *sqlx.Tx) error {
+		id, found, err := dbhelper.GetMTIDByManagementID(tx, managementID, mt.ID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			errRes = &model.Response{
+				Status:   fiber.StatusNotFound,
+				Response: api.APIErrorUnknownManagementID,
+			}
+			return fmt.Errorf("error_res")
+		}
+		if possibleRestrictions != nil {
+			if _, err = possibleRestrictions.ConsumeForOther(tx, mt.ID); err != nil {
+				return err
+			}
+		}
+		if entry, err = tree.GetEntry(tx, id); err != nil {
+			return err
+		}
+		comment := ""
+		if id.Hash() != mt.ID.Hash() {
+			comment = fmt.Sprintf("by %s", mt.ID.ManagementID())
+		}
+		logEvent := func(ev int) error {
+			return eventService.LogEvent(tx, eventService.MTEvent{
+				Event: event.FromNumber(ev, comment),
+				MTID:  id,
+			}, *clientMetadata)
+		}
+		if req.Name != nil && *req.Name != entry.Name.String {
+			if err = dbhelper.UpdateName(tx, id, *req.Name); err != nil {
+				return err
+			}
+			if err = logEvent(event.MTEventNameChanged); err != nil {
+				return err
+			}
+		}
+		if req.Description != nil && *req.Description != entry.Description.String {
+			if err = dbhelper.UpdateDescription(tx, id, *req.Description); err != nil {
+				return err
+			}
+			if err = logEvent(event.MTEventDescriptionChanged); err != nil {
+				return err
+			}
+		}
+		if req.Tags != nil && !sameTags(*req.Tags, entry.Tags) {
+			if err = dbhelper.SetTags(tx, id, *req.Tags); err != nil {
+				return err
+			}
+			if err = logEvent(event.MTEventTagsChanged); err != nil {
+				return err
+			}
+		}
+		entry, err = tree.GetEntry(tx, id)
+		return err
+	}); err != nil {
+		if errRes != nil {
+			return *errRes
+		}
+		return *mt.ConsumeErrorResponse(err, *clientMetadata)
+	}
+
+	return model.Response{
+		Status:   fiber.StatusOK,
+		Response: pkg.NewTokeninfoUpdateMetadataResponse(entry),
+	}
+}
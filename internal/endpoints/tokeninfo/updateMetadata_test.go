@@ -0,0 +1,24 @@
+package tokeninfo
+
+import (
+	"testing"
+)
+
+func TestSameTags(t *testing.T) {
+	cases := []struct {
+		a, b []string
+		exp  bool
+	}{
+		{a: []string{}, b: nil, exp: true},
+		{a: []string{"ci", "laptop"}, b: []string{"laptop", "ci"}, exp: true},
+		{a: []string{"CI", "Laptop"}, b: []string{"ci", "laptop"}, exp: true},
+		{a: []string{" ci", "CI"}, b: []string{"ci"}, exp: true},
+		{a: []string{"ci"}, b: []string{"ci", "laptop"}, exp: false},
+		{a: []string{"ci"}, b: []string{"cd"}, exp: false},
+	}
+	for _, c := range cases {
+		if same := sameTags(c.a, c.b); same != c.exp {
+			t.Errorf("For '%v' and '%v' expected '%v', got '%v'", c.a, c.b, c.exp, same)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
@@ -85,6 +87,7 @@ func exportRSAPrivateKeyAsPemStr(privkey *rsa.PrivateKey) string {
 
 var privateKey interface{}
 var publicKey interface{}
+var keyID string
 var jwks = jwk.NewSet()
 
 // GetPrivateKey returns the private key
@@ -136,5 +139,26 @@ func LoadKey() {
 	if err = key.Set(jwk.KeyUsageKey, string(jwk.ForSignature)); err != nil {
 		panic(err)
 	}
+	keyID = key.KeyID()
 	jwks.Add(key)
 }
+
+// SignDetached signs payload with the server key and returns a JWS with detached payload (RFC 7515, Appendix F); the
+// signature can be verified with the key from the jwks
+func SignDetached(payload []byte) (string, error) {
+	alg := config.Get().Signing.Alg
+	header, err := json.Marshal(map[string]string{
+		"alg": alg,
+		"kid": keyID,
+	})
+	if err != nil {
+		return "", err
+	}
+	encodedHeader := base64.RawURLEncoding.EncodeToString(header)
+	signingInput := encodedHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sig, err := jwt.GetSigningMethod(alg).Sign(signingInput, privateKey)
+	if err != nil {
+		return "", err
+	}
+	return encodedHeader + ".." + sig, nil
+}
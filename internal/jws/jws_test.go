@@ -0,0 +1,37 @@
+package jws
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+func TestSignDetached(t *testing.T) {
+	config.LoadDefault()
+	sk, _, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, publicKey = sk, &sk.(*ecdsa.PrivateKey).PublicKey
+	payload := []byte(`{"event":"created"}`)
+	signed, err := SignDetached(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	parts := strings.Split(signed, ".")
+	if len(parts) != 3 || parts[1] != "" {
+		t.Fatalf("Expected a jws with detached payload, got '%s'", signed)
+	}
+	signingInput := parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload)
+	if err = jwt.GetSigningMethod(config.Get().Signing.Alg).Verify(signingInput, parts[2], publicKey); err != nil {
+		t.Errorf("Could not verify signature: %s", err)
+	}
+	if err = jwt.GetSigningMethod(config.Get().Signing.Alg).Verify(parts[0]+"."+base64.RawURLEncoding.EncodeToString([]byte("other")), parts[2], publicKey); err == nil {
+		t.Error("Signature must not be valid for another payload")
+	}
+}
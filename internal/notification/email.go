@@ -0,0 +1,119 @@
+package notification
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+// sender sends a single notification message
+type sender interface {
+	Send(to, subject, body string) error
+}
+
+// smtpSender sends emails through an smtp server
+type smtpSender struct {
+	from string
+	conf config.SMTPConf
+}
+
+func newSMTPSender(conf config.EmailConf) *smtpSender {
+	return &smtpSender{
+		from: conf.From,
+		conf: conf.SMTP,
+	}
+}
+
+func (s *smtpSender) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.conf.Host, strconv.Itoa(s.conf.Port))
+	if s.conf.TLS == config.SMTPTLSImplicit {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: s.conf.Host})
+		if err != nil {
+			return nil, err
+		}
+		return smtp.NewClient(conn, s.conf.Host)
+	}
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	if s.conf.TLS == config.SMTPTLSStartTLS {
+		if err = c.StartTLS(&tls.Config{ServerName: s.conf.Host}); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Send implements the sender interface
+func (s *smtpSender) Send(to, subject, body string) error {
+	from, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %s", err)
+	}
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %s", err)
+	}
+	msg, err := message(from, rcpt, subject, body, time.Now())
+	if err != nil {
+		return err
+	}
+	c, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if s.conf.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", s.conf.Username, s.conf.Password, s.conf.Host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err = c.Rcpt(rcpt.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// message creates a plain text email
+func message(from, to *mail.Address, subject, body string, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	w := quotedprintable.NewWriter(&buf)
+	if _, err := w.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,160 @@
+package notification
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+)
+
+// smtpStandIn is a minimal local smtp server that accepts a single message
+type smtpStandIn struct {
+	listener net.Listener
+	from     string
+	rcpt     string
+	data     string
+	done     chan struct{}
+}
+
+func startSMTPStandIn(t *testing.T) *smtpStandIn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStandIn{
+		listener: l,
+		done:     make(chan struct{}),
+	}
+	go s.serve()
+	t.Cleanup(func() { _ = l.Close() })
+	return s
+}
+
+func (s *smtpStandIn) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStandIn) serve() {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP stand-in")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.rcpt = strings.Trim(line[len("RCPT TO:"):], "<> ")
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.data = data.String()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTPSender(t *testing.T) {
+	s := startSMTPStandIn(t)
+	sender := newSMTPSender(config.EmailConf{
+		Enabled: true,
+		From:    "mytoken <noreply@example.com>",
+		SMTP: config.SMTPConf{
+			Host: "127.0.0.1",
+			Port: s.port(),
+			TLS:  config.SMTPTLSNone,
+		},
+	})
+	if err := sender.Send("user@example.com", "Test subject", "Hello user"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	<-s.done
+	if s.from != "noreply@example.com" {
+		t.Errorf("Expected sender 'noreply@example.com', got '%s'", s.from)
+	}
+	if s.rcpt != "user@example.com" {
+		t.Errorf("Expected recipient 'user@example.com', got '%s'", s.rcpt)
+	}
+	for _, expected := range []string{"Subject: Test subject\r\n", "To: <user@example.com>\r\n", "\r\n\r\nHello user"} {
+		if !strings.Contains(s.data, expected) {
+			t.Errorf("Expected message to contain '%s', got '%s'", expected, s.data)
+		}
+	}
+}
+
+func TestSMTPSender_InvalidRecipient(t *testing.T) {
+	sender := newSMTPSender(config.EmailConf{
+		From: "noreply@example.com",
+		SMTP: config.SMTPConf{
+			Host: "127.0.0.1",
+			Port: 1,
+			TLS:  config.SMTPTLSNone,
+		},
+	})
+	if err := sender.Send("not an address", "subject", "body"); err == nil {
+		t.Error("Expected an error for an invalid recipient")
+	}
+}
+
+func TestRender(t *testing.T) {
+	config.LoadDefault()
+	if _, err := os.Stat("../server/web/mails"); err != nil {
+		t.Fatal(err)
+	}
+	SetTemplates(http.FS(os.DirFS("../server/web")))
+	for _, n := range api.AllNotifications {
+		body, err := render(n, map[string]interface{}{
+			"name":          "<my token>",
+			"management_id": "abc",
+			"ip":            "192.0.2.1",
+			"country":       "DE",
+		})
+		if err != nil {
+			t.Fatalf("Could not render '%s': %s", n, err)
+		}
+		if !strings.HasPrefix(body, "Hello,") {
+			t.Errorf("Expected '%s' to be rendered in the layout, got '%s'", n, body)
+		}
+		if !strings.Contains(body, "abc") {
+			t.Errorf("Expected '%s' to contain the management id, got '%s'", n, body)
+		}
+		if strings.Contains(body, "&lt;") {
+			t.Errorf("Expected '%s' not to be html escaped, got '%s'", n, body)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package notification
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/notificationrepo"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+)
+
+// StartExpiryChecker starts a background job that periodically sends the expiring_soon notification for mytokens that
+// expire within the configured time
+func StartExpiryChecker() {
+	if !config.Get().Features.Notifications.Email.Enabled {
+		return
+	}
+	go func() {
+		for {
+			checkExpiringMytokens()
+			time.Sleep(time.Duration(config.Get().Features.Notifications.CheckInterval) * time.Second)
+		}
+	}()
+}
+
+func checkExpiringMytokens() {
+	mts, err := notificationrepo.GetExpiringMytokens(nil, config.Get().Features.Notifications.ExpiryWarning)
+	if err != nil {
+		log.WithError(err).Error("Could not get expiring mytokens")
+		return
+	}
+	for _, mt := range mts {
+		// Marking first ensures that each notification is sent by only one of multiple server instances
+		marked, err := notificationrepo.MarkExpiryNotified(nil, mt.ID)
+		if err != nil {
+			log.WithError(err).Error("Could not mark expiry notification")
+			continue
+		}
+		if !marked {
+			continue
+		}
+		data := map[string]interface{}{
+			"name":          mt.Name.String,
+			"management_id": mt.ManagementID,
+			"expires_at":    time.Unix(mt.ExpiresAt, 0).UTC().Format(time.RFC1123),
+		}
+		if err = send(mt.Email, api.NotificationExpiringSoon, data); err != nil {
+			log.WithError(err).Error("Could not send expiry notification")
+			// The mark is removed again, so that the notification is retried with the next check
+			if err = notificationrepo.UnmarkExpiryNotified(nil, mt.ID); err != nil {
+				log.WithError(err).Error("Could not unmark expiry notification")
+			}
+		}
+	}
+}
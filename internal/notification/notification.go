@@ -0,0 +1,124 @@
+package notification
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+
+	"github.com/gofiber/template/mustache"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/notificationrepo"
+	"github.com/oidc-mytoken/server/internal/server/routes"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/shared/utils"
+)
+
+// mailLayout is the layout all mail templates are rendered in
+const mailLayout = "mails/layout"
+
+// mailConfirmEmail is the template of the mail that confirms a notification email address
+const mailConfirmEmail = "confirm_email"
+
+var templates *mustache.Engine
+
+// newSender returns the sender used for notifications; it can be replaced in tests
+var newSender = func() sender {
+	return newSMTPSender(config.Get().Features.Notifications.Email)
+}
+
+var subjects = map[string]string{
+	api.NotificationSubtokenCreated: "A subtoken of your mytoken was created",
+	api.NotificationExpiringSoon:    "Your mytoken expires soon",
+	api.NotificationNewLocation:     "Your mytoken was used from a new location",
+	api.NotificationAnomalyDetected: "An anomalous usage of your mytoken was detected",
+	mailConfirmEmail:                "Confirm your email address for mytoken notifications",
+}
+
+// SetTemplates sets the file system the mail templates are loaded from; the templates are expected in the 'mails'
+// directory
+func SetTemplates(fs http.FileSystem) {
+	templates = mustache.NewFileSystem(fs, ".mustache")
+}
+
+func render(notification string, data map[string]interface{}) (string, error) {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data["issuer"] = config.Get().IssuerURL
+	var buf bytes.Buffer
+	if err := templates.Render(&buf, "mails/"+notification, data, mailLayout); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func send(to, notification string, data map[string]interface{}) error {
+	body, err := render(notification, data)
+	if err != nil {
+		return err
+	}
+	return newSender().Send(to, subjects[notification], body)
+}
+
+// Notify sends the passed notification about a mytoken to its user, if notifications are enabled and the user
+// subscribed to it. The notification is sent asynchronously, so requests are not slowed down; errors are only logged.
+func Notify(id mtid.MTID, notification string, data map[string]interface{}) {
+	notify(id, notification, data, func() (string, bool, error) {
+		return notificationrepo.GetRecipient(nil, id, notification)
+	})
+}
+
+// NotifyUser sends the passed notification about a mytoken to its user like Notify, but without a subscription; it
+// is used for notifications the user requested otherwise, e.g. through the anomaly policy of the mytoken
+func NotifyUser(id mtid.MTID, notification string, data map[string]interface{}) {
+	notify(id, notification, data, func() (string, bool, error) {
+		return notificationrepo.GetEmail(nil, id)
+	})
+}
+
+func notify(id mtid.MTID, notification string, data map[string]interface{}, recipient func() (string, bool, error)) {
+	if !config.Get().Features.Notifications.Email.Enabled {
+		return
+	}
+	// The data is copied, since the caller might pass it to several notifications
+	mailData := map[string]interface{}{
+		"management_id": id.ManagementID(),
+	}
+	for k, v := range data {
+		mailData[k] = v
+	}
+	go func() {
+		email, found, err := recipient()
+		if err != nil {
+			log.WithError(err).Error("Could not get notification recipient")
+			return
+		}
+		if !found {
+			return
+		}
+		if err = send(email, notification, mailData); err != nil {
+			log.WithError(err).WithField("notification", notification).Error("Could not send notification")
+		}
+	}()
+}
+
+// SendEmailConfirmation sends the link with the passed confirmation code to a new notification email address. The
+// mail is sent asynchronously; errors are only logged.
+func SendEmailConfirmation(email, code string) {
+	if !config.Get().Features.Notifications.Email.Enabled {
+		return
+	}
+	data := map[string]interface{}{
+		"email": email,
+		"confirmation_url": utils.CombineURLPath(config.Get().IssuerURL, routes.GetCurrentAPIPaths().EmailConfirmationEndpoint) +
+			"?code=" + url.QueryEscape(code),
+	}
+	go func() {
+		if err := send(email, mailConfirmEmail, data); err != nil {
+			log.WithError(err).Error("Could not send email confirmation")
+		}
+	}()
+}
@@ -18,11 +18,13 @@ import (
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/authcodeinforepo"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/authcodeinforepo/state"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo"
+	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/transfercoderepo"
 	response "github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
 	"github.com/oidc-mytoken/server/internal/model"
 	"github.com/oidc-mytoken/server/internal/oidc/issuer"
 	"github.com/oidc-mytoken/server/internal/server/routes"
+	"github.com/oidc-mytoken/server/internal/utils/ctxUtils"
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 	"github.com/oidc-mytoken/server/shared/context"
 	pkgModel "github.com/oidc-mytoken/server/shared/model"
@@ -44,7 +46,9 @@ func Init() {
 	consentEndpoint = utils.CombineURLPath(config.Get().IssuerURL, generalPaths.ConsentEndpoint)
 }
 
-func GetAuthorizationURL(provider *config.ProviderConf, oState string, restrictions restrictions.Restrictions) string {
+// GetAuthorizationURL returns the url of the provider's authorization endpoint for the passed state; if reauthenticate
+// is set, the provider is asked to authenticate the user again
+func GetAuthorizationURL(provider *config.ProviderConf, oState string, restrictions restrictions.Restrictions, reauthenticate bool) string {
 	log.Debug("Generating authorization url")
 	scopes := restrictions.GetScopes()
 	if len(scopes) <= 0 {
@@ -58,6 +62,12 @@ func GetAuthorizationURL(provider *config.ProviderConf, oState string, restricti
 		Scopes:       scopes,
 	}
 	additionalParams := []oauth2.AuthCodeOption{oauth2.ApprovalForce}
+	if reauthenticate {
+		additionalParams = []oauth2.AuthCodeOption{
+			oauth2.SetAuthURLParam("prompt", "login consent"),
+			oauth2.SetAuthURLParam("max_age", "0"),
+		}
+	}
 	if issuerUtils.CompareIssuerURLs(provider.Issuer, issuer.GOOGLE) {
 		additionalParams = append(additionalParams, oauth2.AccessTypeOffline)
 	} else if !utils.StringInSlice(oidc.ScopeOfflineAccess, oauth2Config.Scopes) {
@@ -90,7 +100,12 @@ func StartAuthCodeFlow(ctx *fiber.Ctx, oidcReq response.OIDCFlowRequest) *model.
 		}
 	}
 
-	req.Restrictions.ReplaceThisIp(ctx.IP())
+	if err := req.Restrictions.ReplaceMacros(ctxUtils.ClientIP(ctx)); err != nil {
+		return &model.Response{
+			Status:   fiber.StatusBadRequest,
+			Response: pkgModel.BadRequestError(err.Error()),
+		}
+	}
 	oState, consentCode := state.CreateState(state.Info{Native: req.Native()})
 	authFlowInfoO := authcodeinforepo.AuthFlowInfoOut{
 		State:                oState,
@@ -99,6 +114,11 @@ func StartAuthCodeFlow(ctx *fiber.Ctx, oidcReq response.OIDCFlowRequest) *model.
 		Capabilities:         req.Capabilities,
 		SubtokenCapabilities: req.SubtokenCapabilities,
 		Name:                 req.Name,
+		RestrictionProfile:   req.RestrictionProfile,
+		CapabilityProfile:    req.CapabilityProfile,
+		SubtokenLimits:       req.SubtokenLimits,
+		Reauthenticate:       req.Reauthenticate,
+		IP:                   ctxUtils.ClientIP(ctx),
 	}
 	authFlowInfo := authcodeinforepo.AuthFlowInfo{
 		AuthFlowInfoOut: authFlowInfoO,
@@ -113,6 +133,7 @@ func StartAuthCodeFlow(ctx *fiber.Ctx, oidcReq response.OIDCFlowRequest) *model.
 			PollingCode:          poll,
 			PollingCodeExpiresIn: config.Get().Features.Polling.PollingCodeExpiresAfter,
 			PollingInterval:      config.Get().Features.Polling.PollingInterval,
+			PollingMaxWait:       config.Get().Features.Polling.LongPollMaxWait,
 		}
 	}
 	if err := authFlowInfo.Store(nil); err != nil {
@@ -187,6 +208,15 @@ func CodeExchange(oState *state.State, code string, networkData api.ClientMetaDa
 	if err != nil {
 		return model.ErrorToInternalServerErrorResponse(err)
 	}
+	var authTime unixtime.UnixTime
+	if authInfo.Reauthenticate {
+		if authTime, err = getReauthenticationTime(provider, token, oidcSub); err != nil {
+			return &model.Response{
+				Status:   fiber.StatusForbidden,
+				Response: pkgModel.OIDCError(api.ErrorAccessDenied, err.Error()),
+			}
+		}
+	}
 	var ste *mytokenrepo.MytokenEntry
 	if err = db.Transact(func(tx *sqlx.Tx) error {
 		ste, err = createMytokenEntry(tx, authInfo, token, oidcSub, networkData)
@@ -204,6 +234,11 @@ func CodeExchange(oState *state.State, code string, networkData api.ClientMetaDa
 		if err = at.Store(tx); err != nil {
 			return err
 		}
+		if authInfo.Reauthenticate {
+			if err = dbhelper.StoreReauthentication(tx, ste.ID, authTime); err != nil {
+				return err
+			}
+		}
 		if authInfo.PollingCode {
 			jwt, err := ste.Token.ToJWT()
 			if err != nil {
@@ -252,14 +287,14 @@ func CodeExchange(oState *state.State, code string, networkData api.ClientMetaDa
 }
 
 func createMytokenEntry(tx *sqlx.Tx, authFlowInfo *authcodeinforepo.AuthFlowInfoOut, token *oauth2.Token, oidcSub string, networkData api.ClientMetaData) (*mytokenrepo.MytokenEntry, error) {
-	ste := mytokenrepo.NewMytokenEntry(
-		mytoken.NewMytoken(
-			oidcSub,
-			authFlowInfo.Issuer,
-			authFlowInfo.Restrictions,
-			authFlowInfo.Capabilities,
-			authFlowInfo.SubtokenCapabilities),
-		authFlowInfo.Name, networkData)
+	mt := mytoken.NewMytoken(
+		oidcSub,
+		authFlowInfo.Issuer,
+		authFlowInfo.Restrictions,
+		authFlowInfo.Capabilities,
+		authFlowInfo.SubtokenCapabilities)
+	mt.SubtokenLimits = authFlowInfo.SubtokenLimits
+	ste := mytokenrepo.NewMytokenEntry(mt, authFlowInfo.Name, networkData)
 	if err := ste.InitRefreshToken(token.RefreshToken); err != nil {
 		return nil, err
 	}
@@ -276,3 +311,31 @@ func getSubjectFromUserinfo(provider *oidc.Provider, token *oauth2.Token) (strin
 	}
 	return userInfo.Subject, nil
 }
+
+// getReauthenticationTime returns the time at which the user authenticated at the provider according to the id token
+// of the passed token response. It fails if the id token is invalid, is not about the passed subject, or the
+// authentication is not recent, i.e. the provider did not authenticate the user again.
+func getReauthenticationTime(provider *config.ProviderConf, token *oauth2.Token, oidcSub string) (unixtime.UnixTime, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return 0, fmt.Errorf("no id token received")
+	}
+	idToken, err := provider.Provider.Verifier(&oidc.Config{ClientID: provider.ClientID}).Verify(context.Get(), rawIDToken)
+	if err != nil {
+		return 0, fmt.Errorf("invalid id token: %s", err)
+	}
+	if idToken.Subject != oidcSub {
+		return 0, fmt.Errorf("id token is for another subject")
+	}
+	var claims struct {
+		AuthTime int64 `json:"auth_time"`
+	}
+	if err = idToken.Claims(&claims); err != nil {
+		return 0, err
+	}
+	authTime := unixtime.UnixTime(claims.AuthTime)
+	if claims.AuthTime == 0 || int64(unixtime.Now())-claims.AuthTime > config.Get().Features.TokenRevocation.FreshAuthMaxAge {
+		return 0, fmt.Errorf("the provider did not authenticate the user again")
+	}
+	return authTime, nil
+}
@@ -4,7 +4,9 @@ import (
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/endpoints/eventstream"
 	"github.com/oidc-mytoken/server/internal/endpoints/revocation"
+	"github.com/oidc-mytoken/server/internal/endpoints/settings"
 	"github.com/oidc-mytoken/server/internal/endpoints/token/access"
 	"github.com/oidc-mytoken/server/internal/endpoints/token/mytoken"
 	"github.com/oidc-mytoken/server/internal/endpoints/tokeninfo"
@@ -24,6 +26,7 @@ func addAPIvXRoutes(s fiber.Router, version int) {
 	s.Post(apiPaths.AccessTokenEndpoint, access.HandleAccessTokenEndpoint)
 	if config.Get().Features.TokenRevocation.Enabled {
 		s.Post(apiPaths.RevocationEndpoint, revocation.HandleRevoke)
+		s.Post(apiPaths.RevokeAllEndpoint, revocation.HandleRevokeAll)
 	}
 	if config.Get().Features.TransferCodes.Enabled {
 		s.Post(apiPaths.TokenTransferEndpoint, mytoken.HandleCreateTransferCodeForExistingMytoken)
@@ -31,4 +34,13 @@ func addAPIvXRoutes(s fiber.Router, version int) {
 	if config.Get().Features.TokenInfo.Enabled {
 		s.Post(apiPaths.TokenInfoEndpoint, tokeninfo.HandleTokenInfo)
 	}
+	if config.Get().Features.EventStream.Enabled {
+		s.Get(apiPaths.EventStreamEndpoint, eventstream.HandleEventStream)
+	}
+	s.Get(apiPaths.UserSettingEndpoint, settings.HandleSettings)
+	s.Post(apiPaths.UserSettingEndpoint, settings.HandleSettings)
+	if config.Get().Features.Notifications.Email.Enabled {
+		s.Get(apiPaths.EmailConfirmationEndpoint, settings.HandleConfirmEmail)
+		s.Post(apiPaths.EmailConfirmationEndpoint, settings.HandleConfirmEmailPost)
+	}
 }
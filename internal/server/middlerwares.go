@@ -3,6 +3,7 @@ package server
 import (
 	"embed"
 	"io/fs"
+	"net"
 	"net/http"
 	"time"
 
@@ -16,7 +17,13 @@ import (
 	"github.com/gofiber/helmet/v2"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/oidc-mytoken/server/internal/bruteforce"
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/utils/ctxUtils"
 	loggerUtils "github.com/oidc-mytoken/server/internal/utils/logger"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	"github.com/oidc-mytoken/server/shared/utils"
 )
 
 //go:embed web/static
@@ -44,14 +51,23 @@ func addMiddlewares(s fiber.Router) {
 	addFaviconMiddleware(s)
 	addLoggerMiddleware(s)
 	addLimiterMiddleware(s)
+	addShortTokenGuardMiddleware(s)
 	addHelmetMiddleware(s)
 	addStaticFiles(s)
 	addCompressMiddleware(s)
 }
 
+// localClientIP is the key of the fiber.Ctx local holding the client ip for the access log
+const localClientIP = "client_ip"
+
 func addLoggerMiddleware(s fiber.Router) {
+	// The access log uses the client ip derived from the forwarding headers, not the address of a proxy
+	s.Use(func(ctx *fiber.Ctx) error {
+		ctx.Locals(localClientIP, ctxUtils.ClientIP(ctx))
+		return ctx.Next()
+	})
 	s.Use(logger.New(logger.Config{
-		Format:     "${time} ${ip} ${latency} - ${status} ${method} ${path}\n",
+		Format:     "${time} ${locals:" + localClientIP + "} ${latency} - ${status} ${method} ${path}\n",
 		TimeFormat: "2006-01-02 15:04:05",
 		Output:     loggerUtils.MustGetAccessLogger(),
 	}))
@@ -60,13 +76,36 @@ func addLoggerMiddleware(s fiber.Router) {
 func addLimiterMiddleware(s fiber.Router) {
 	s.Use(limiter.New(limiter.Config{
 		Next: func(c *fiber.Ctx) bool {
-			return c.IP() == "127.0.0.1"
+			return net.ParseIP(ctxUtils.ClientIP(c)).IsLoopback()
 		},
-		Max:        100,
-		Expiration: 5 * time.Minute,
+		KeyGenerator: ctxUtils.ClientIP,
+		Max:          100,
+		Expiration:   5 * time.Minute,
 	}))
 }
 
+// addShortTokenGuardMiddleware adds a middleware that protects short tokens against guessing; it rejects requests with
+// a short token from clients that are locked out. Failed lookups are recorded where short tokens are resolved, see
+// token.GetLongMytoken.
+func addShortTokenGuardMiddleware(s fiber.Router) {
+	if !config.Get().Features.BruteForceProtection.Enabled {
+		return
+	}
+	s.Use(func(ctx *fiber.Ctx) error {
+		tok := ctxUtils.GetMytokenStr(ctx)
+		if tok == "" || utils.IsJWT(tok) {
+			return ctx.Next()
+		}
+		if bruteforce.Locked(bruteforce.KindShortToken, ctxUtils.ClientIP(ctx)) {
+			return model.Response{
+				Status:   fiber.StatusTooManyRequests,
+				Response: api.APIErrorTooManyFailedAttempts,
+			}.Send(ctx)
+		}
+		return ctx.Next()
+	})
+}
+
 func addCompressMiddleware(s fiber.Router) {
 	s.Use(compress.New())
 }
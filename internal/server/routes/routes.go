@@ -13,12 +13,15 @@ func init() {
 	routes = &paths{
 		api: map[int]APIPaths{
 			0: {
-				MytokenEndpoint:       utils.CombineURLPath(apiPath.V0, "/token/my"),
-				AccessTokenEndpoint:   utils.CombineURLPath(apiPath.V0, "/token/access"),
-				TokenInfoEndpoint:     utils.CombineURLPath(apiPath.V0, "/tokeninfo"),
-				RevocationEndpoint:    utils.CombineURLPath(apiPath.V0, "/token/revoke"),
-				TokenTransferEndpoint: utils.CombineURLPath(apiPath.V0, "/token/transfer"),
-				UserSettingEndpoint:   utils.CombineURLPath(apiPath.V0, "/user"),
+				MytokenEndpoint:           utils.CombineURLPath(apiPath.V0, "/token/my"),
+				AccessTokenEndpoint:       utils.CombineURLPath(apiPath.V0, "/token/access"),
+				TokenInfoEndpoint:         utils.CombineURLPath(apiPath.V0, "/tokeninfo"),
+				RevocationEndpoint:        utils.CombineURLPath(apiPath.V0, "/token/revoke"),
+				RevokeAllEndpoint:         utils.CombineURLPath(apiPath.V0, "/token/revoke/all"),
+				TokenTransferEndpoint:     utils.CombineURLPath(apiPath.V0, "/token/transfer"),
+				UserSettingEndpoint:       utils.CombineURLPath(apiPath.V0, "/user"),
+				EventStreamEndpoint:       utils.CombineURLPath(apiPath.V0, "/events"),
+				EmailConfirmationEndpoint: utils.CombineURLPath(apiPath.V0, "/user/email/confirm"),
 			},
 		},
 		other: GeneralPaths{
@@ -51,8 +54,12 @@ type APIPaths struct {
 	AccessTokenEndpoint   string
 	TokenInfoEndpoint     string
 	RevocationEndpoint    string
+	RevokeAllEndpoint     string
 	TokenTransferEndpoint string
 	UserSettingEndpoint   string
+	EventStreamEndpoint   string
+	// EmailConfirmationEndpoint is linked in the mail that confirms a notification email address
+	EmailConfirmationEndpoint string
 }
 
 // GetCurrentAPIPaths returns the api paths for the most recent major version
@@ -18,6 +18,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/endpoints/consent"
 	"github.com/oidc-mytoken/server/internal/endpoints/redirect"
 	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/notification"
 	"github.com/oidc-mytoken/server/internal/server/routes"
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 )
@@ -41,6 +42,9 @@ var webFiles fs.FS
 var _partials embed.FS
 var partials fs.FS
 
+//go:embed web/mails
+var _mails embed.FS
+
 func init() {
 	var err error
 	webFiles, err = fs.Sub(_webFiles, "web")
@@ -51,6 +55,11 @@ func init() {
 	if err != nil {
 		log.WithError(err).Fatal()
 	}
+	mails, err := fs.Sub(_mails, "web")
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+	notification.SetTemplates(http.FS(mails))
 }
 
 func initTemplateEngine() {
@@ -139,10 +139,10 @@ function approve() {
     let data = {
         "oidc_iss": issuer,
         "restrictions": restrictions,
-        "capabilities": $('.capability-check:checked').map(function(_, el) {
+        "capabilities": $('.capability-check:checked:enabled').map(function(_, el) {
             return $(el).val();
         }).get(),
-        "subtoken_capabilities": $('.subtoken-capability-check:checked').map(function(_, el) {
+        "subtoken_capabilities": $('.subtoken-capability-check:checked:enabled').map(function(_, el) {
             return $(el).val();
         }).get()
     };
@@ -186,4 +186,40 @@ $('#cp-create_mytoken').click(function() {
     let enabled = $(this).prop("checked");
     $('.subtoken-capability-check').prop("checked", enabled);
     $('.subtoken-capability-check').prop("disabled", !enabled);
+    if (enabled) {
+        $('.subtoken-capability-check').each(function() {
+            updateImpliedCapabilities($(this), 'subtoken-capability-check');
+        });
+    }
+});
+
+// Capabilities implied by a checked umbrella capability are shown as checked and cannot be changed individually
+function updateImpliedCapabilities(el, checkClass) {
+    let checked = el.prop("checked") && !el.prop("disabled") || el.prop("checked") && el.data("implied");
+    $('.' + checkClass).filter(function() {
+        return $(this).data("parent") === el.val();
+    }).each(function() {
+        let child = $(this);
+        child.data("implied", checked);
+        if (checked) {
+            child.prop("checked", true);
+        }
+        child.prop("disabled", checked);
+        updateImpliedCapabilities(child, checkClass);
+    });
+}
+
+$('.capability-check').change(function() {
+    updateImpliedCapabilities($(this), 'capability-check');
+});
+$('.subtoken-capability-check').change(function() {
+    updateImpliedCapabilities($(this), 'subtoken-capability-check');
+});
+$(function() {
+    $('.capability-check').each(function() {
+        updateImpliedCapabilities($(this), 'capability-check');
+    });
+    $('.subtoken-capability-check').each(function() {
+        updateImpliedCapabilities($(this), 'subtoken-capability-check');
+    });
 });
@@ -4,6 +4,7 @@ const configElements = [
     "mytoken_endpoint",
     "usersettings_endpoint",
     "revocation_endpoint",
+    "revoke_all_endpoint",
     "tokeninfo_endpoint"
 ]
 
@@ -0,0 +1,84 @@
+// Revoking all mytokens requires a fresh authentication at the OpenID provider: a new session mytoken is obtained with
+// 'reauthenticate' and the revocation is done when the browser returns to this page.
+
+$('#revoke-all-start').on('click', function(e){
+    e.preventDefault();
+    let msg = $('#revoke-all-msg');
+    if (!confirm("Do you really want to revoke all your mytokens?")) {
+        return false;
+    }
+    _tokeninfo('introspect',
+        function(res){
+            startReauthentication(res['token']['oidc_iss'], function (errRes) {
+                msg.text(getErrorMessage(errRes));
+                msg.addClass('text-danger');
+            });
+        },
+        function (errRes) {
+            msg.text(getErrorMessage(errRes));
+            msg.addClass('text-danger');
+        });
+    return false;
+});
+
+function startReauthentication(issuer, errCallback) {
+    let data = {
+        "grant_type": "oidc_flow",
+        "oidc_flow": "authorization_code",
+        "oidc_issuer": issuer,
+        "reauthenticate": true,
+        "name": "mytoken-web revoke all",
+        "capabilities": ["tokeninfo_introspect"],
+        "restrictions": [
+            {
+                "exp": Math.floor(Date.now() / 1000) + 600,
+                "ip": ["this"],
+                "usages_AT": 0,
+                "usages_other": 5
+            }
+        ]
+    };
+    data = JSON.stringify(data);
+    $.ajax({
+        type: "POST",
+        url: storageGet("mytoken_endpoint"),
+        data: data,
+        success: function(res){
+            storageSet('revoke_all_pending', 'true');
+            window.location.href = res['authorization_url'];
+        },
+        error: errCallback,
+        dataType: "json",
+        contentType : "application/json"
+    });
+}
+
+function revokeAll() {
+    let msg = $('#revoke-all-msg');
+    $('#revoke-all-tab').tab('show');
+    $.ajax({
+        type: "POST",
+        url: storageGet('revoke_all_endpoint'),
+        success: function(res){
+            let revoked = 0;
+            res['issuers'].forEach(function (report) {
+                revoked += report['mytokens_revoked'].length;
+            });
+            alert("Revoked " + revoked + " mytokens. You are now signed out.");
+            window.location.href = "/";
+        },
+        error: function (errRes) {
+            msg.text(getErrorMessage(errRes));
+            msg.addClass('text-danger');
+        },
+        dataType: "json",
+        contentType : "application/json"
+    });
+}
+
+$(function () {
+    if (storageGet('revoke_all_pending') === 'true') {
+        _storage().removeItem('revoke_all_pending');
+        revokeAll();
+    }
+})
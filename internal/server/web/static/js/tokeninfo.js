@@ -1,8 +1,8 @@
 
-function _tokeninfo(action, successFnc, errorFnc, token=undefined) {
-    let data = {
+function _tokeninfo(action, successFnc, errorFnc, token=undefined, params={}) {
+    let data = Object.assign({}, params, {
         'action':action
-    };
+    });
     if (token!==undefined) {
         data['mytoken'] = token;
     }
@@ -18,6 +18,41 @@ function _tokeninfo(action, successFnc, errorFnc, token=undefined) {
     });
 }
 
+const tokeninfoPageSize = 50;
+
+// _pagedTokeninfo requests the passed tokeninfo action page by page: the items of all pages loaded so far are passed
+// to successFnc and the more button loads the next page. withToken is called before each request with a callback
+// that takes the mytoken to use, since a mytoken might only be usable once.
+function _pagedTokeninfo(action, itemsOf, more, successFnc, errorFnc, withToken, params={}, items=[], cursor=undefined) {
+    more.off('click');
+    more.addClass('d-none');
+    let data = Object.assign({}, params, {
+        'limit': tokeninfoPageSize
+    });
+    if (cursor!==undefined) {
+        data['cursor'] = cursor;
+    }
+    withToken(function (token) {
+        _tokeninfo(action,
+            function (res) {
+                items = items.concat(itemsOf(res));
+                successFnc(res, items);
+                let next = res['next_cursor'];
+                if (next) {
+                    more.removeClass('d-none');
+                    more.on('click', function (e) {
+                        e.preventDefault();
+                        _pagedTokeninfo(action, itemsOf, more, successFnc, errorFnc, withToken, params, items, next);
+                        return false;
+                    });
+                }
+            }, errorFnc, token, data);
+    });
+}
+
+function sessionToken(callback) {
+    callback(undefined);
+}
 
 $('#get-session-token-info').on('click', function(e){
     let msg = $('#session-token-info-msg');
@@ -115,9 +150,13 @@ $('#get-history').on('click', function(e){
     e.preventDefault();
     let msg = $('#history-msg');
     let copy = $('#history-copy');
-    _tokeninfo('event_history',
-        function(res){
-            msg.html(historyToHTML(res['events']));
+    _pagedTokeninfo('event_history',
+        function (res) {
+            return res['events'];
+        },
+        $('#more-history'),
+        function(res, events){
+            msg.html(historyToHTML(events));
             msg.removeClass('text-danger');
             copy.addClass('d-none');
         },
@@ -126,7 +165,7 @@ $('#get-history').on('click', function(e){
             msg.text(getErrorMessage(errRes));
             msg.addClass('text-danger');
             copy.removeClass('d-none');
-        })
+        }, sessionToken, {'sort_order': 'desc'})
     return false;
 })
 
@@ -134,9 +173,16 @@ $('#get-tree').on('click', function(e){
     e.preventDefault();
     let msg = $('#tree-msg');
     let copy = $('#tree-copy');
-    _tokeninfo('subtoken_tree',
-        function(res){
-            msg.html(tokenlistToHTML([res['mytokens']]));
+    _pagedTokeninfo('subtoken_tree',
+        function (res) {
+            return res['mytokens']['children'] || [];
+        },
+        $('#more-tree'),
+        function(res, children){
+            let tree = Object.assign({}, res['mytokens'], {
+                'children': children
+            });
+            msg.html(tokenlistToHTML([tree]));
             msg.removeClass('text-danger');
             copy.addClass('d-none');
         },
@@ -145,7 +191,7 @@ $('#get-tree').on('click', function(e){
             msg.text(getErrorMessage(errRes));
             msg.addClass('text-danger');
             copy.removeClass('d-none');
-        })
+        }, sessionToken)
     return false;
 })
 
@@ -153,28 +199,31 @@ $('#get-list').on('click', function(e){
     e.preventDefault();
     let msg = $('#list-msg');
     let copy = $('#list-copy');
-    getMT(
+    let errorFnc = function (errRes) {
+        console.log(errRes);
+        msg.text(getErrorMessage(errRes));
+        msg.addClass('text-danger');
+        copy.removeClass('d-none');
+    };
+    _pagedTokeninfo('list_mytokens',
         function (res) {
-            const mToken = res['mytoken']
-            _tokeninfo('list_mytokens',
-                function(infoRes){
-                    msg.html(tokenlistToHTML(infoRes['mytokens']));
-                    msg.removeClass('text-danger');
-                    copy.addClass('d-none');
-                },
-                function (errRes) {
-                    console.log(errRes);
-                    msg.text(getErrorMessage(errRes));
-                    msg.addClass('text-danger');
-                    copy.removeClass('d-none');
-                }, mToken) ;
+            return res['mytokens'];
         },
-        function (errRes) {
-            msg.text(getErrorMessage(errRes));
-            msg.addClass('text-danger');
-            copy.removeClass('d-none');
+        $('#more-list'),
+        function(res, mytokens){
+            msg.html(tokenlistToHTML(mytokens));
+            msg.removeClass('text-danger');
+            copy.addClass('d-none');
         },
-        "list_mytokens"
-    );
+        errorFnc,
+        function (callback) {
+            getMT(
+                function (res) {
+                    callback(res['mytoken']);
+                },
+                errorFnc,
+                "list_mytokens"
+            );
+        });
     return false;
 })
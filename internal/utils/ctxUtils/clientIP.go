@@ -0,0 +1,92 @@
+package ctxUtils
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/shared/utils"
+)
+
+// ClientIP returns the ip address of the client for a given fiber.Ctx. If the request comes from a trusted proxy, the
+// client ip is taken from the configured client ip header, i.e. Forwarded or X-Forwarded-For; hops are followed from
+// the right as long as they are trusted proxies.
+func ClientIP(ctx *fiber.Ctx) string {
+	var trusted []string
+	header := config.ClientIPHeaderXForwardedFor
+	if c := config.Get(); c != nil {
+		trusted = c.Server.TrustedProxies
+		header = c.Server.ClientIPHeader
+	}
+	return clientIP(ctx, trusted, header)
+}
+
+func clientIP(ctx *fiber.Ctx, trusted []string, header string) string {
+	ip := utils.NormalizeIP(ctx.IP())
+	if len(trusted) == 0 || !utils.IPIsIn(ip, trusted) {
+		return ip
+	}
+	hops := forwardedHops(ctx, header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseForwardedNode(hops[i])
+		if hop == "" { // unknown or obfuscated identifier, we cannot go further back
+			return ip
+		}
+		ip = hop
+		if !utils.IPIsIn(ip, trusted) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// forwardedHops returns the forwarded-for nodes from the passed header, which is either Forwarded or X-Forwarded-For,
+// in the order in which they appear in the request. The other header is ignored, since it is not set by the proxy
+// and therefore fully controlled by the client.
+func forwardedHops(ctx *fiber.Ctx, header string) (hops []string) {
+	if header == config.ClientIPHeaderForwarded {
+		for _, f := range headerValues(ctx, fiber.HeaderForwarded) {
+			for _, element := range strings.Split(f, ",") {
+				for _, pair := range strings.Split(element, ";") {
+					kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+					if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+						hops = append(hops, kv[1])
+					}
+				}
+			}
+		}
+		return
+	}
+	for _, xff := range headerValues(ctx, fiber.HeaderXForwardedFor) {
+		hops = append(hops, strings.Split(xff, ",")...)
+	}
+	return
+}
+
+func headerValues(ctx *fiber.Ctx, key string) (values []string) {
+	ctx.Request().Header.VisitAll(func(k, v []byte) {
+		if strings.EqualFold(string(k), key) {
+			values = append(values, string(v))
+		}
+	})
+	return
+}
+
+// parseForwardedNode parses a node from a Forwarded or X-Forwarded-For header and returns the normalized ip address;
+// if the node is not an ip address an empty string is returned
+func parseForwardedNode(node string) string {
+	node = strings.Trim(strings.TrimSpace(node), "\"")
+	if strings.HasPrefix(node, "[") {
+		if i := strings.IndexByte(node, ']'); i > 0 {
+			node = node[1:i]
+		}
+	} else if strings.Count(node, ":") == 1 { // ipv4 with port
+		node = node[:strings.IndexByte(node, ':')]
+	}
+	if net.ParseIP(node) == nil {
+		return ""
+	}
+	return utils.NormalizeIP(node)
+}
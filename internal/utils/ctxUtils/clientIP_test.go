@@ -0,0 +1,80 @@
+package ctxUtils
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+func testClientIP(t *testing.T, remote string, headers map[string]string, trusted []string, expected string) {
+	testClientIPWithHeader(t, remote, headers, trusted, config.ClientIPHeaderXForwardedFor, expected)
+}
+
+func testClientIPWithHeader(t *testing.T, remote string, headers map[string]string, trusted []string, header, expected string) {
+	req := fasthttp.Request{}
+	for k, v := range headers {
+		req.Header.Add(k, v)
+	}
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Init(&req, &net.TCPAddr{IP: net.ParseIP(remote), Port: 12345}, nil)
+	app := fiber.New()
+	ctx := app.AcquireCtx(fctx)
+	defer app.ReleaseCtx(ctx)
+	if ip := clientIP(ctx, trusted, header); ip != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, ip)
+	}
+}
+
+func TestClientIP_NoProxy(t *testing.T) {
+	testClientIP(t, "192.0.2.1", nil, nil, "192.0.2.1")
+	testClientIP(t, "2001:db8::1", nil, nil, "2001:db8::1")
+}
+func TestClientIP_UntrustedProxy(t *testing.T) {
+	headers := map[string]string{fiber.HeaderXForwardedFor: "198.51.100.7"}
+	testClientIP(t, "192.0.2.1", headers, nil, "192.0.2.1")
+	testClientIP(t, "192.0.2.1", headers, []string{"10.0.0.0/8"}, "192.0.2.1")
+}
+func TestClientIP_XForwardedFor(t *testing.T) {
+	trusted := []string{"10.0.0.0/8"}
+	testClientIP(t, "10.0.0.1", map[string]string{fiber.HeaderXForwardedFor: "198.51.100.7"}, trusted, "198.51.100.7")
+	testClientIP(t, "10.0.0.1", map[string]string{fiber.HeaderXForwardedFor: "203.0.113.9, 198.51.100.7, 10.0.0.2"}, trusted, "198.51.100.7")
+	testClientIP(t, "10.0.0.1", map[string]string{fiber.HeaderXForwardedFor: "2001:db8::7"}, trusted, "2001:db8::7")
+	testClientIP(t, "10.0.0.1", map[string]string{fiber.HeaderXForwardedFor: "10.0.0.3, 10.0.0.2"}, trusted, "10.0.0.3")
+}
+func TestClientIP_Forwarded(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "2001:db8:ffff::/48"}
+	header := config.ClientIPHeaderForwarded
+	testClientIPWithHeader(t, "10.0.0.1", map[string]string{fiber.HeaderForwarded: "for=198.51.100.7;proto=https"}, trusted, header, "198.51.100.7")
+	testClientIPWithHeader(t, "10.0.0.1", map[string]string{fiber.HeaderForwarded: `for="[2001:db8::7]:4711", for=10.0.0.2`}, trusted, header, "2001:db8::7")
+	testClientIPWithHeader(t, "2001:db8:ffff::1", map[string]string{fiber.HeaderForwarded: "For=198.51.100.7:8080"}, trusted, header, "198.51.100.7")
+}
+func TestClientIP_SpoofedForwarded(t *testing.T) {
+	trusted := []string{"10.0.0.0/8"}
+	// The proxy sets X-Forwarded-For; a Forwarded header sent by the client must not be used
+	testClientIP(t, "10.0.0.1", map[string]string{
+		fiber.HeaderForwarded:     "for=127.0.0.1",
+		fiber.HeaderXForwardedFor: "203.0.113.9",
+	}, trusted, "203.0.113.9")
+	testClientIP(t, "10.0.0.1", map[string]string{fiber.HeaderForwarded: "for=127.0.0.1"}, trusted, "10.0.0.1")
+}
+func TestClientIP_SpoofedXForwardedFor(t *testing.T) {
+	trusted := []string{"10.0.0.0/8"}
+	// The proxy sets Forwarded; a X-Forwarded-For header sent by the client must not be used
+	testClientIPWithHeader(t, "10.0.0.1", map[string]string{
+		fiber.HeaderForwarded:     "for=203.0.113.9",
+		fiber.HeaderXForwardedFor: "127.0.0.1",
+	}, trusted, config.ClientIPHeaderForwarded, "203.0.113.9")
+}
+func TestClientIP_ObfuscatedNode(t *testing.T) {
+	trusted := []string{"10.0.0.0/8"}
+	header := config.ClientIPHeaderForwarded
+	testClientIPWithHeader(t, "10.0.0.1", map[string]string{fiber.HeaderForwarded: "for=198.51.100.7, for=_hidden"}, trusted, header, "10.0.0.1")
+	testClientIPWithHeader(t, "10.0.0.1", map[string]string{fiber.HeaderForwarded: "for=unknown"}, trusted, header, "10.0.0.1")
+}
+func TestClientIP_V4MappedRemote(t *testing.T) {
+	testClientIP(t, "::ffff:10.0.0.1", map[string]string{fiber.HeaderXForwardedFor: "198.51.100.7"}, []string{"10.0.0.0/8"}, "198.51.100.7")
+}
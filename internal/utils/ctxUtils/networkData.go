@@ -9,7 +9,7 @@ import (
 // ClientMetaData returns the model.ClientMetaData for a given fiber.Ctx
 func ClientMetaData(ctx *fiber.Ctx) *api.ClientMetaData {
 	return &api.ClientMetaData{
-		IP:        ctx.IP(),
+		IP:        ClientIP(ctx),
 		UserAgent: string(ctx.Request().Header.UserAgent()),
 	}
 }
@@ -26,13 +26,13 @@ func GetMytokenStr(ctx *fiber.Ctx) string {
 	return ""
 }
 
-// GetMytoken checks a fiber.Ctx for a mytoken and returns a token object
+// GetMytoken checks a fiber.Ctx for a mytoken and returns a token object holding the jwt of the mytoken
 func GetMytoken(ctx *fiber.Ctx) *token.Token {
 	tok := GetMytokenStr(ctx)
 	if tok == "" {
 		return nil
 	}
-	t, err := token.GetLongMytoken(tok)
+	t, err := token.GetLongMytoken(tok, ClientIP(ctx))
 	if err != nil {
 		return nil
 	}
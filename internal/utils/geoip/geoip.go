@@ -1,35 +1,112 @@
 package geoip
 
 import (
-	"github.com/ip2location/ip2location-go"
+	"fmt"
+	"sync"
+
 	log "github.com/sirupsen/logrus"
 
 	"github.com/oidc-mytoken/server/internal/config"
 )
 
-var geoDB *ip2location.DB
+// database is the interface implemented by the different geo ip database providers
+type database interface {
+	Country(ip string) string
+	CountryCode(ip string) string
+	// Location returns the approximate coordinates of ip; ok is false if the database does not hold location data
+	Location(ip string) (latitude, longitude float64, ok bool)
+	Close()
+}
+
+var geoDB database
+var asnDB *mmdbDB
+var geoDBMutex sync.RWMutex
 
-// Init initializes the geo ip db
+// open opens the geo ip database file for the passed provider
+func open(provider, file string) (database, error) {
+	switch provider {
+	case config.GeoIPProviderIP2Location:
+		return openIP2Location(file)
+	case config.GeoIPProviderMMDB:
+		return openMMDB(file)
+	default:
+		return nil, fmt.Errorf("unknown geo ip provider '%s'", provider)
+	}
+}
+
+// Init initializes the geo ip db; it can also be used to reload the database. Lookups that are in progress when Init is
+// called are completed with the old database; if the new database cannot be opened, the old one is kept. Without a
+// configured database file, geo ip lookups are disabled.
 func Init() {
-	db, err := ip2location.OpenDB(config.Get().GeoIPDBFile)
-	if err != nil {
-		log.WithError(err).Error()
+	conf := config.Get().GeoIP
+	var db database
+	var err error
+	if conf.DBFile != "" {
+		if db, err = open(conf.Provider, conf.DBFile); err != nil {
+			log.WithError(err).WithField("file", conf.DBFile).Error("Could not load geo ip database")
+			return
+		}
 	}
-	log.Debug("Loaded geo ip data")
-	if geoDB != nil {
-		geoDB.Close()
+	var asn *mmdbDB
+	if conf.ASNDBFile != "" {
+		if asn, err = openMMDB(conf.ASNDBFile); err != nil {
+			log.WithError(err).WithField("file", conf.ASNDBFile).Error("Could not load asn database")
+		}
 	}
+	geoDBMutex.Lock()
+	old, oldASN := geoDB, asnDB
 	geoDB = db
+	if asn != nil || conf.ASNDBFile == "" {
+		asnDB = asn
+	} else {
+		oldASN = nil // keep the old asn database
+	}
+	geoDBMutex.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	if oldASN != nil {
+		oldASN.Close()
+	}
+	log.WithField("provider", conf.Provider).Debug("Loaded geo ip data")
 }
 
 // Country returns the country name string for a given ip
 func Country(ip string) string {
-	res, _ := geoDB.Get_country_long(ip)
-	return res.Country_long
+	geoDBMutex.RLock()
+	defer geoDBMutex.RUnlock()
+	if geoDB == nil {
+		return ""
+	}
+	return geoDB.Country(ip)
 }
 
 // CountryCode returns the country code string for a given ip
 func CountryCode(ip string) string {
-	res, _ := geoDB.Get_country_short(ip)
-	return res.Country_short
+	geoDBMutex.RLock()
+	defer geoDBMutex.RUnlock()
+	if geoDB == nil {
+		return ""
+	}
+	return geoDB.CountryCode(ip)
+}
+
+// Location returns the approximate coordinates for a given ip; ok is false if they are not known
+func Location(ip string) (latitude, longitude float64, ok bool) {
+	geoDBMutex.RLock()
+	defer geoDBMutex.RUnlock()
+	if geoDB == nil {
+		return
+	}
+	return geoDB.Location(ip)
+}
+
+// ASN returns the number of the autonomous system a given ip belongs to, or 0 if it is not known
+func ASN(ip string) uint {
+	geoDBMutex.RLock()
+	defer geoDBMutex.RUnlock()
+	if asnDB == nil {
+		return 0
+	}
+	return asnDB.ASN(ip)
 }
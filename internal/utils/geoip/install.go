@@ -0,0 +1,104 @@
+package geoip
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/utils/zipdownload"
+)
+
+var fileExtensions = map[string]string{
+	config.GeoIPProviderIP2Location: ".bin",
+	config.GeoIPProviderMMDB:        ".mmdb",
+}
+
+// ExtractDatabase returns the database file for the passed provider from data; data can be a zip archive, a gzipped
+// tar archive, or the plain database file.
+func ExtractDatabase(data []byte, provider string) ([]byte, error) {
+	ext, ok := fileExtensions[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown geo ip provider '%s'", provider)
+	}
+	var files map[string][]byte
+	var err error
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		files, err = zipdownload.Unzip(data)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		files, err = untargz(data)
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for name, content := range files {
+		if strings.EqualFold(filepath.Ext(name), ext) {
+			return content, nil
+		}
+	}
+	return nil, fmt.Errorf("archive does not contain a '%s' file", ext)
+}
+
+func untargz(data []byte) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return files, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return files, err
+		}
+		files[hdr.Name] = content
+	}
+}
+
+// InstallDatabase writes the passed database to file. The database is first written to a temporary file and
+// validated; only then the existing file is replaced, so a running server never reads a partially written database.
+func InstallDatabase(data []byte, provider, file string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op after a successful rename
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmpName, 0644); err != nil {
+		return err
+	}
+	db, err := open(provider, tmpName)
+	if err != nil {
+		return fmt.Errorf("not a valid %s database: %s", provider, err)
+	}
+	db.Close()
+	return os.Rename(tmpName, file)
+}
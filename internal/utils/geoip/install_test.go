@@ -0,0 +1,97 @@
+package geoip
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+func zipArchive(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarGzArchive(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testExtract(t *testing.T, data []byte, provider string, expected []byte) {
+	got, err := ExtractDatabase(data, provider)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("Expected '%s', got '%s'", expected, got)
+	}
+}
+
+func TestExtractDatabase_Plain(t *testing.T) {
+	data := []byte("plain database")
+	testExtract(t, data, config.GeoIPProviderMMDB, data)
+	testExtract(t, data, config.GeoIPProviderIP2Location, data)
+}
+
+func TestExtractDatabase_Zip(t *testing.T) {
+	data := zipArchive(t, map[string][]byte{
+		"LICENSE.TXT":                   []byte("license"),
+		"IP2LOCATION-LITE-DB1.IPV6.BIN": []byte("bin database"),
+	})
+	testExtract(t, data, config.GeoIPProviderIP2Location, []byte("bin database"))
+}
+
+func TestExtractDatabase_TarGz(t *testing.T) {
+	data := tarGzArchive(t, map[string][]byte{
+		"GeoLite2-Country_20210601/COPYRIGHT.txt":         []byte("copyright"),
+		"GeoLite2-Country_20210601/GeoLite2-Country.mmdb": []byte("mmdb database"),
+	})
+	testExtract(t, data, config.GeoIPProviderMMDB, []byte("mmdb database"))
+}
+
+func TestExtractDatabase_WrongProvider(t *testing.T) {
+	data := zipArchive(t, map[string][]byte{
+		"IP2LOCATION-LITE-DB1.IPV6.BIN": []byte("bin database"),
+	})
+	if _, err := ExtractDatabase(data, config.GeoIPProviderMMDB); err == nil {
+		t.Error("Expected an error for an archive without mmdb file")
+	}
+}
+
+func TestExtractDatabase_UnknownProvider(t *testing.T) {
+	if _, err := ExtractDatabase([]byte("data"), "unknown"); err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+}
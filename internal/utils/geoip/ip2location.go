@@ -0,0 +1,48 @@
+package geoip
+
+import (
+	"github.com/ip2location/ip2location-go"
+)
+
+type ip2locationDB struct {
+	db *ip2location.DB
+}
+
+func openIP2Location(file string) (*ip2locationDB, error) {
+	db, err := ip2location.OpenDB(file)
+	if err != nil {
+		return nil, err
+	}
+	return &ip2locationDB{db: db}, nil
+}
+
+// Country implements the database interface
+func (d *ip2locationDB) Country(ip string) string {
+	res, _ := d.db.Get_country_long(ip)
+	return res.Country_long
+}
+
+// CountryCode implements the database interface
+func (d *ip2locationDB) CountryCode(ip string) string {
+	res, _ := d.db.Get_country_short(ip)
+	return res.Country_short
+}
+
+// Location implements the database interface; the LITE DB1 database does not hold coordinates, for which 0, 0 is
+// returned
+func (d *ip2locationDB) Location(ip string) (latitude, longitude float64, ok bool) {
+	res, err := d.db.Get_latitude(ip)
+	if err != nil || (res.Latitude == 0 && res.Longitude == 0) {
+		return
+	}
+	res2, err := d.db.Get_longitude(ip)
+	if err != nil {
+		return
+	}
+	return float64(res.Latitude), float64(res2.Longitude), true
+}
+
+// Close implements the database interface
+func (d *ip2locationDB) Close() {
+	d.db.Close()
+}
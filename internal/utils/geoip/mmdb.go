@@ -0,0 +1,90 @@
+package geoip
+
+import (
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+	log "github.com/sirupsen/logrus"
+)
+
+type mmdbDB struct {
+	db *maxminddb.Reader
+}
+
+// mmdbCountryRecord holds the parts of a MaxMind (GeoIP2 / GeoLite2) country record that are used by mytoken
+type mmdbCountryRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+}
+
+// mmdbLocationRecord holds the location of a MaxMind city record; country databases do not have it
+type mmdbLocationRecord struct {
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// mmdbASNRecord holds the parts of a MaxMind (GeoLite2) ASN record that are used by mytoken
+type mmdbASNRecord struct {
+	AutonomousSystemNumber uint `maxminddb:"autonomous_system_number"`
+}
+
+func openMMDB(file string) (*mmdbDB, error) {
+	db, err := maxminddb.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	return &mmdbDB{db: db}, nil
+}
+
+func (d *mmdbDB) lookupInto(ip string, rec interface{}) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return
+	}
+	if err := d.db.Lookup(parsed, rec); err != nil {
+		log.WithError(err).WithField("ip", ip).Error("Could not lookup ip in mmdb")
+	}
+}
+
+func (d *mmdbDB) lookup(ip string) (rec mmdbCountryRecord) {
+	d.lookupInto(ip, &rec)
+	return
+}
+
+// Country implements the database interface
+func (d *mmdbDB) Country(ip string) string {
+	return d.lookup(ip).Country.Names["en"]
+}
+
+// CountryCode implements the database interface
+func (d *mmdbDB) CountryCode(ip string) string {
+	return d.lookup(ip).Country.ISOCode
+}
+
+// Location implements the database interface
+func (d *mmdbDB) Location(ip string) (latitude, longitude float64, ok bool) {
+	var rec mmdbLocationRecord
+	d.lookupInto(ip, &rec)
+	if rec.Location.Latitude == nil || rec.Location.Longitude == nil {
+		return
+	}
+	return *rec.Location.Latitude, *rec.Location.Longitude, true
+}
+
+// ASN returns the autonomous system number for ip from an ASN database
+func (d *mmdbDB) ASN(ip string) uint {
+	var rec mmdbASNRecord
+	d.lookupInto(ip, &rec)
+	return rec.AutonomousSystemNumber
+}
+
+// Close implements the database interface
+func (d *mmdbDB) Close() {
+	if err := d.db.Close(); err != nil {
+		log.WithError(err).Error()
+	}
+}
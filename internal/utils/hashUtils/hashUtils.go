@@ -2,8 +2,10 @@ package hashUtils
 
 import (
 	"crypto/hmac"
+	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/base64"
+	"encoding/hex"
 )
 
 // SHA512 hashes the passed data with sha512
@@ -17,6 +19,12 @@ func SHA512Str(data []byte) string {
 	return base64.StdEncoding.EncodeToString(hash[:])
 }
 
+// SHA256Hex hashes the passed data with sha256 and returns the hex encoded hash
+func SHA256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
 // HMACSHA512Str creates a hmac using sha512
 func HMACSHA512Str(data, secret []byte) string {
 	h := hmac.New(sha512.New, secret)
@@ -12,3 +12,11 @@ func TestHashUtils_SHA512(t *testing.T) {
 		t.Errorf("hash '%s' does not match expected hash '%s'", hash, expected)
 	}
 }
+
+func TestHashUtils_SHA256Hex(t *testing.T) {
+	hash := SHA256Hex([]byte("abc"))
+	expected := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if hash != expected {
+		t.Errorf("hash '%s' does not match expected hash '%s'", hash, expected)
+	}
+}
@@ -0,0 +1,59 @@
+// Package pagination provides the cursors and page sizes used for cursor-based pagination.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+// ErrInvalidCursor is returned if a cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks the last entry of a page; the next page starts with the entry following it. Key is the value of the
+// sort key of that entry and ID a unique id that breaks ties between entries with the same key.
+type Cursor struct {
+	Key string `json:"k"`
+	ID  string `json:"i"`
+}
+
+// Encode returns the opaque string representation of the Cursor that is passed to clients
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode decodes a cursor string as returned by Cursor.Encode; an empty string results in a nil Cursor
+func Decode(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// Limit returns the page size for the requested limit and cursor. If neither is passed, the result is not paged and 0
+// is returned, so that clients that do not know about pagination still get all entries. If only a cursor is passed the
+// configured default is used, and the limit is capped at the configured maximum.
+func Limit(requested int, cursor string) int {
+	conf := config.Get().Features.TokenInfo.PageSize
+	if requested <= 0 {
+		if cursor == "" {
+			return 0
+		}
+		return conf.Default
+	}
+	if requested > conf.Max {
+		return conf.Max
+	}
+	return requested
+}
@@ -0,0 +1,59 @@
+package pagination
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+func TestCursorEncodeDecode(t *testing.T) {
+	c := Cursor{
+		Key: "1630000000",
+		ID:  "42",
+	}
+	decoded, err := Decode(c.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded == nil || *decoded != c {
+		t.Errorf("Expected '%+v', but got '%+v'", c, decoded)
+	}
+}
+
+func TestDecodeEmpty(t *testing.T) {
+	c, err := Decode("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != nil {
+		t.Errorf("Expected no cursor, but got '%+v'", c)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, s := range []string{"%%%", "bm90IGpzb24"} {
+		if _, err := Decode(s); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Expected ErrInvalidCursor for '%s', but got '%v'", s, err)
+		}
+	}
+}
+
+func TestLimit(t *testing.T) {
+	config.LoadDefault()
+	conf := config.Get().Features.TokenInfo.PageSize
+	for _, tc := range []struct {
+		requested int
+		cursor    string
+		expected  int
+	}{
+		{0, "", 0},
+		{0, "cursor", conf.Default},
+		{10, "", 10},
+		{conf.Max + 1, "", conf.Max},
+	} {
+		if l := Limit(tc.requested, tc.cursor); l != tc.expected {
+			t.Errorf("Expected limit %d for %d and cursor '%s', but got %d", tc.expected, tc.requested, tc.cursor, l)
+		}
+	}
+}
@@ -14,9 +14,12 @@ func DownloadZipped(url string) (map[string][]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	return Unzip(resp.Body())
+}
 
-	body := resp.Body()
-	zipReader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+// Unzip returns all files contained in the passed zip archive
+func Unzip(archive []byte) (map[string][]byte, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
 	if err != nil {
 		return nil, err
 	}
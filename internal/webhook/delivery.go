@@ -0,0 +1,269 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/webhookrepo"
+	"github.com/oidc-mytoken/server/internal/jws"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+)
+
+// batchSize is the maximum number of deliveries attempted per poll
+const batchSize = 100
+
+// privateNetworks are the address ranges that user webhooks must not point to, in addition to loopback, link-local,
+// multicast, and unspecified addresses
+var privateNetworks = func() (nets []*net.IPNet) {
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return
+}()
+
+// publicIP checks if ip is a public unicast address
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range privateNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// denyPrivateTargets is used as net.Dialer.Control to refuse connections to non-public addresses. It checks the
+// resolved address, so it also catches host names that resolve to internal addresses.
+func denyPrivateTargets(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("webhook target '%s' is not a public address", host)
+	}
+	return nil
+}
+
+// newClient returns a http.Client for webhook deliveries; if restricted, it only connects to public addresses
+func newClient(timeout time.Duration, restricted bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if restricted {
+		dialer.Control = denyPrivateTargets
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: dialer.DialContext,
+		},
+		// Redirects are not followed, so that they cannot be used to reach other targets
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// backoff returns the number of seconds to wait before the next attempt after attempt failed attempts; the wait time
+// doubles with every attempt, starting at initial and limited by maxDelay
+func backoff(attempt, initial, maxDelay int) int {
+	delay := initial
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+// sign returns the name and value of the header holding the signature of payload. If a secret is given, the payload is
+// signed with HMAC-SHA256, otherwise with a JWS using the server's signing key.
+func sign(payload []byte, secret string) (header, value string, err error) {
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(payload)
+		return api.WebhookHeaderSignature, "sha256=" + hex.EncodeToString(mac.Sum(nil)), nil
+	}
+	value, err = jws.SignDetached(payload)
+	return api.WebhookHeaderJWS, value, err
+}
+
+// deliver posts the signed payload to url; any response other than 2xx is an error
+func deliver(client *http.Client, url, secret string, deliveryID uint64, payload []byte) error {
+	header, signature, err := sign(payload, secret)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(header, signature)
+	req.Header.Set(api.WebhookHeaderDelivery, strconv.FormatUint(deliveryID, 10))
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// StartDeliveryWorker starts background jobs that periodically deliver the due webhook deliveries; user and operator
+// webhooks are delivered by separate workers
+func StartDeliveryWorker() {
+	conf := config.Get().Features.Webhooks
+	if !conf.Enabled {
+		return
+	}
+	timeout := time.Duration(conf.Timeout) * time.Second
+	users := newDispatcher(newClient(timeout, !conf.AllowPrivateTargets), nil, conf.Workers, conf.MaxConcurrencyPerWebhook)
+	go users.run()
+	if len(conf.OperatorSubscriptions) == 0 {
+		return
+	}
+	operatorHooks := make(map[string]config.OperatorWebhookConf)
+	for _, s := range conf.OperatorSubscriptions {
+		operatorHooks[s.Name] = s
+	}
+	operators := newDispatcher(newClient(timeout, false), operatorHooks,
+		len(operatorHooks)*conf.MaxConcurrencyPerWebhook, conf.MaxConcurrencyPerWebhook)
+	go operators.run()
+}
+
+// dispatcher delivers the due deliveries of one queue, either the one of the user webhooks or the one of the operator
+// webhooks, with a bounded number of concurrent attempts in total and per webhook
+type dispatcher struct {
+	client *http.Client
+	// operatorHooks are the configured operator webhooks; it is nil for the user queue
+	operatorHooks map[string]config.OperatorWebhookConf
+	slots         chan struct{}
+	maxPerWebhook int
+
+	mutex  sync.Mutex
+	active map[string]int
+}
+
+func newDispatcher(client *http.Client, operatorHooks map[string]config.OperatorWebhookConf, workers, maxPerWebhook int) *dispatcher {
+	return &dispatcher{
+		client:        client,
+		operatorHooks: operatorHooks,
+		slots:         make(chan struct{}, workers),
+		maxPerWebhook: maxPerWebhook,
+		active:        make(map[string]int),
+	}
+}
+
+func (p *dispatcher) run() {
+	for {
+		p.dispatchDue()
+		time.Sleep(time.Duration(config.Get().Features.Webhooks.PollInterval) * time.Second)
+	}
+}
+
+// acquire reserves an attempt to the passed webhook; it returns false if the webhook already has the maximum number of
+// attempts in flight
+func (p *dispatcher) acquire(webhook string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.active[webhook] >= p.maxPerWebhook {
+		return false
+	}
+	p.active[webhook]++
+	return true
+}
+
+// release frees an attempt reserved with acquire
+func (p *dispatcher) release(webhook string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.active[webhook]--; p.active[webhook] <= 0 {
+		delete(p.active, webhook)
+	}
+}
+
+// dispatchDue starts an attempt for each due delivery whose webhook has capacity left; it blocks while all workers are
+// busy
+func (p *dispatcher) dispatchDue() {
+	conf := config.Get().Features.Webhooks
+	deliveries, err := webhookrepo.GetDueDeliveries(nil, p.operatorHooks != nil, p.maxPerWebhook, batchSize)
+	if err != nil {
+		log.WithError(err).Error("Could not get due webhook deliveries")
+		return
+	}
+	for _, d := range deliveries {
+		url, secret := d.URL.String, d.Secret.String
+		if d.OperatorWebhook.Valid {
+			s, found := p.operatorHooks[d.OperatorWebhook.String]
+			if !found {
+				// The operator webhook was removed from the config
+				if err = webhookrepo.Delete(nil, d.ID); err != nil {
+					log.WithError(err).Error("Could not delete webhook delivery")
+				}
+				continue
+			}
+			url, secret = s.URL, s.Secret
+		}
+		webhook := d.Webhook()
+		if !p.acquire(webhook) {
+			continue
+		}
+		p.slots <- struct{}{}
+		// The lease must outlast the attempt, so that no other instance picks the delivery up meanwhile
+		claimed, err := webhookrepo.Claim(nil, d, 2*conf.Timeout)
+		if err != nil || !claimed {
+			if err != nil {
+				log.WithError(err).Error("Could not claim webhook delivery")
+			}
+			<-p.slots
+			p.release(webhook)
+			continue
+		}
+		go func(d webhookrepo.Delivery) {
+			defer func() {
+				<-p.slots
+				p.release(webhook)
+			}()
+			p.attempt(d, url, secret)
+		}(d)
+	}
+}
+
+// attempt delivers a claimed delivery and deletes or reschedules it depending on the outcome
+func (p *dispatcher) attempt(d webhookrepo.Delivery, url, secret string) {
+	conf := config.Get().Features.Webhooks
+	attempt := d.Attempts + 1
+	err := deliver(p.client, url, secret, d.ID, []byte(d.Payload))
+	if err == nil || attempt >= conf.MaxAttempts {
+		if err != nil {
+			log.WithError(err).WithField("url", url).Warn("Giving up webhook delivery")
+		}
+		if err = webhookrepo.Delete(nil, d.ID); err != nil {
+			log.WithError(err).Error("Could not delete webhook delivery")
+		}
+		return
+	}
+	log.WithError(err).WithField("url", url).Debug("Webhook delivery failed")
+	if err = webhookrepo.Reschedule(nil, d.ID, backoff(attempt, conf.InitialBackoff, conf.MaxBackoff), err.Error()); err != nil {
+		log.WithError(err).Error("Could not reschedule webhook delivery")
+	}
+}
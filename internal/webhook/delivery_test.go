@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt  int
+		expected int
+	}{
+		{attempt: 1, expected: 30},
+		{attempt: 2, expected: 60},
+		{attempt: 3, expected: 120},
+		{attempt: 5, expected: 480},
+		{attempt: 10, expected: 3600},
+		{attempt: 100, expected: 3600},
+	}
+	for _, test := range tests {
+		if d := backoff(test.attempt, 30, 3600); d != test.expected {
+			t.Errorf("Expected backoff of %d for attempt %d, got %d", test.expected, test.attempt, d)
+		}
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":         true,
+		"2001:db8::1":     true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+		"0.0.0.0":         false,
+		"224.0.0.1":       false,
+	}
+	for ip, expected := range tests {
+		if public := publicIP(net.ParseIP(ip)); public != expected {
+			t.Errorf("Expected public=%v for %s, got %v", expected, ip, public)
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	payload := []byte(`{"event":"AT_created"}`)
+	secret := "0123456789abcdef"
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	expectedSignature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	var received []byte
+	var signature, delivery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+		signature = r.Header.Get(api.WebhookHeaderSignature)
+		delivery = r.Header.Get(api.WebhookHeaderDelivery)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	if err := deliver(newClient(time.Second, false), server.URL, secret, 42, payload); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if string(received) != string(payload) {
+		t.Errorf("Expected payload '%s', got '%s'", payload, received)
+	}
+	if signature != expectedSignature {
+		t.Errorf("Expected signature '%s', got '%s'", expectedSignature, signature)
+	}
+	if delivery != "42" {
+		t.Errorf("Expected delivery id '42', got '%s'", delivery)
+	}
+	if err := deliver(newClient(time.Second, false), server.URL+"/fail", secret, 42, payload); err == nil {
+		t.Error("Expected an error for a failing webhook")
+	}
+	if err := deliver(newClient(time.Second, true), server.URL, secret, 42, payload); err == nil {
+		t.Error("Expected an error for a loopback target with a restricted client")
+	}
+}
+
+func TestSubscribed(t *testing.T) {
+	if !subscribed(nil, "AT_created") {
+		t.Error("Expected no events to subscribe to all events")
+	}
+	if !subscribed([]string{"MT_created", "AT_created"}, "AT_created") {
+		t.Error("Expected subscribed event to match")
+	}
+	if subscribed([]string{"MT_created"}, "AT_created") {
+		t.Error("Expected other event not to match")
+	}
+}
+
+func TestDispatcherAcquire(t *testing.T) {
+	p := newDispatcher(nil, nil, 10, 2)
+	if !p.acquire("user:1") || !p.acquire("user:1") {
+		t.Fatal("Expected the first two attempts to be acquired")
+	}
+	if p.acquire("user:1") {
+		t.Error("Expected a third concurrent attempt to the same webhook not to be acquired")
+	}
+	if !p.acquire("user:2") {
+		t.Error("Expected an attempt to another webhook to be acquired")
+	}
+	p.release("user:1")
+	if !p.acquire("user:1") {
+		t.Error("Expected an attempt to be acquired after a release")
+	}
+}
@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"encoding/json"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/webhookrepo"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+// Enqueue enqueues the delivery of an event of the passed mytoken to all webhooks of its user and all operator
+// webhooks that subscribed to the event. It must be called in the same transaction that stores the event, so that
+// deliveries are only made for events that are persisted; the delivery itself happens asynchronously.
+func Enqueue(tx *sqlx.Tx, id mtid.MTID, payload api.WebhookPayload) error {
+	conf := config.Get().Features.Webhooks
+	if !conf.Enabled {
+		return nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if err = webhookrepo.EnqueueForUser(tx, id, payload.Event, data); err != nil {
+		return err
+	}
+	for _, s := range conf.OperatorSubscriptions {
+		if !subscribed(s.Events, payload.Event) {
+			continue
+		}
+		if err = webhookrepo.EnqueueForOperator(tx, s.Name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribed checks if event is one of the subscribed events; no subscribed events means all events
+func subscribed(events []string, event string) bool {
+	if len(events) == 0 {
+		return true
+	}
+	for _, e := range events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
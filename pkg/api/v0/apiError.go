@@ -15,26 +15,33 @@ var (
 	APIErrorBadTransferCode          = APIError{ErrorInvalidToken, "Bad polling or transfer code"}
 	APIErrorTransferCodeExpired      = APIError{ErrorExpiredToken, "polling or transfer code is expired"}
 	APIErrorAuthorizationPending     = APIError{ErrorAuthorizationPending, ""}
+	APIErrorSlowDown                 = APIError{ErrorSlowDown, "Polling too fast, the polling interval is increased by 5 seconds"}
+	APIErrorConcurrentLongPoll       = APIError{ErrorSlowDown, "Another long poll for this polling code is still running"}
 	APIErrorConsentDeclined          = APIError{ErrorAccessDenied, "user declined consent"}
 	APIErrorNoRefreshToken           = APIError{ErrorOIDC, "Did not receive a refresh token"}
 	APIErrorInsufficientCapabilities = APIError{ErrorInsufficientCapabilities, "The provided token does not have the required capability for this operation"}
 	APIErrorUsageRestricted          = APIError{ErrorUsageRestricted, "The restrictions of this token does not allow this usage"}
 	APIErrorNYI                      = APIError{ErrorNYI, ""}
+	APIErrorUnknownManagementID      = APIError{ErrorInvalidRequest, "No mytoken with this management_id found"}
+	APIErrorTooManyEventStreams      = APIError{ErrorTemporarilyUnavailable, "Too many open event streams, try again later"}
+	APIErrorTooManyFailedAttempts    = APIError{ErrorTooManyFailedAttempts, "Too many failed attempts, try again later"}
 )
 
 // Predefined OAuth2/OIDC errors
 const (
-	ErrorInvalidRequest       = "invalid_request"
-	ErrorInvalidClient        = "invalid_client"
-	ErrorInvalidGrant         = "invalid_grant"
-	ErrorUnauthorizedClient   = "unauthorized_client"
-	ErrorUnsupportedGrantType = "unsupported_grant_type"
-	ErrorInvalidScope         = "invalid_scope"
-	ErrorInvalidToken         = "invalid_token"
-	ErrorInsufficientScope    = "insufficient_scope"
-	ErrorExpiredToken         = "expired_token"
-	ErrorAccessDenied         = "access_denied"
-	ErrorAuthorizationPending = "authorization_pending"
+	ErrorInvalidRequest         = "invalid_request"
+	ErrorInvalidClient          = "invalid_client"
+	ErrorInvalidGrant           = "invalid_grant"
+	ErrorUnauthorizedClient     = "unauthorized_client"
+	ErrorUnsupportedGrantType   = "unsupported_grant_type"
+	ErrorInvalidScope           = "invalid_scope"
+	ErrorInvalidToken           = "invalid_token"
+	ErrorInsufficientScope      = "insufficient_scope"
+	ErrorExpiredToken           = "expired_token"
+	ErrorAccessDenied           = "access_denied"
+	ErrorAuthorizationPending   = "authorization_pending"
+	ErrorSlowDown               = "slow_down"
+	ErrorTemporarilyUnavailable = "temporarily_unavailable"
 )
 
 // Additional Mytoken errors
@@ -44,4 +51,6 @@ const (
 	ErrorNYI                      = "not_yet_implemented"
 	ErrorInsufficientCapabilities = "insufficient_capabilities"
 	ErrorUsageRestricted          = "usage_restricted"
+	ErrorSubtokenLimitReached     = "subtoken_limit_reached"
+	ErrorTooManyFailedAttempts    = "too_many_failed_attempts"
 )
@@ -11,4 +11,6 @@ type PollingInfo struct {
 	PollingCode          string `json:"polling_code,omitempty"`
 	PollingCodeExpiresIn int64  `json:"polling_code_expires_in,omitempty"`
 	PollingInterval      int64  `json:"polling_interval,omitempty"`
+	// PollingMaxWait is the maximum number of seconds a client can request to wait for the consent with a long poll
+	PollingMaxWait int64 `json:"polling_max_wait,omitempty"`
 }
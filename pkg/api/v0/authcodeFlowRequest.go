@@ -8,12 +8,18 @@ type AuthCodeFlowRequest struct {
 
 // OIDCFlowRequest holds the request for an OIDC Flow request
 type OIDCFlowRequest struct {
-	Issuer               string       `json:"oidc_issuer"`
-	GrantType            string       `json:"grant_type"`
-	OIDCFlow             string       `json:"oidc_flow"`
-	Restrictions         Restrictions `json:"restrictions"`
-	Capabilities         Capabilities `json:"capabilities"`
-	SubtokenCapabilities Capabilities `json:"subtoken_capabilities"`
-	Name                 string       `json:"name"`
-	ResponseType         string       `json:"response_type"`
+	Issuer               string          `json:"oidc_issuer"`
+	GrantType            string          `json:"grant_type"`
+	OIDCFlow             string          `json:"oidc_flow"`
+	Restrictions         Restrictions    `json:"restrictions"`
+	Capabilities         Capabilities    `json:"capabilities"`
+	SubtokenCapabilities Capabilities    `json:"subtoken_capabilities"`
+	Name                 string          `json:"name"`
+	ResponseType         string          `json:"response_type"`
+	RestrictionProfile   string          `json:"restriction_profile,omitempty"`
+	CapabilityProfile    string          `json:"capability_profile,omitempty"`
+	SubtokenLimits       *SubtokenLimits `json:"subtoken_limits,omitempty"`
+	// Reauthenticate requests that the user authenticates again at the OpenID provider, even if there is a session;
+	// the web interface uses it to authorize the revocation of all mytokens
+	Reauthenticate bool `json:"reauthenticate,omitempty"`
 }
@@ -18,7 +18,15 @@ var (
 	}
 	CapabilitySettings = Capability{
 		Name:        "settings",
-		Description: "Allows to modify user settings.",
+		Description: "Allows to read and modify user settings.",
+	}
+	CapabilityReadSettings = Capability{
+		Name:        "read@settings",
+		Description: "Allows to read user settings.",
+	}
+	CapabilityTokeninfo = Capability{
+		Name:        "tokeninfo",
+		Description: "Allows to obtain all information about this token.",
 	}
 	CapabilityTokeninfoIntrospect = Capability{
 		Name:        "tokeninfo_introspect",
@@ -36,6 +44,26 @@ var (
 		Name:        "list_mytokens",
 		Description: "Allows to list all mytokens.",
 	}
+	CapabilityManageMT = Capability{
+		Name:        "manage_mytokens",
+		Description: "Allows to list and manage all mytokens, including revoking any of them.",
+	}
+	CapabilityReadManageMT = Capability{
+		Name:        "read@manage_mytokens",
+		Description: "Allows read-only access to the management of all mytokens.",
+	}
+	CapabilityRevokeAnyToken = Capability{
+		Name:        "revoke_any_token",
+		Description: "Allows to revoke any mytoken of the user.",
+	}
+	CapabilitySuspendMT = Capability{
+		Name:        "suspend_mytokens",
+		Description: "Allows to temporarily suspend and resume mytokens of the user.",
+	}
+	CapabilityUpdateMTMetadata = Capability{
+		Name:        "update_mytoken_metadata",
+		Description: "Allows to change the name, description, and tags of mytokens of the user.",
+	}
 )
 
 // AllCapabilities holds all defined Capabilities
@@ -43,10 +71,45 @@ var AllCapabilities = Capabilities{
 	CapabilityAT,
 	CapabilityCreateMT,
 	CapabilitySettings,
+	CapabilityReadSettings,
+	CapabilityTokeninfo,
 	CapabilityTokeninfoIntrospect,
 	CapabilityTokeninfoHistory,
 	CapabilityTokeninfoTree,
+	CapabilityManageMT,
+	CapabilityReadManageMT,
 	CapabilityListMT,
+	CapabilityRevokeAnyToken,
+	CapabilitySuspendMT,
+	CapabilityUpdateMTMetadata,
+}
+
+// capabilityChildren maps umbrella Capabilities to the Capabilities they directly imply
+var capabilityChildren = map[string]Capabilities{
+	CapabilitySettings.Name:     {CapabilityReadSettings},
+	CapabilityTokeninfo.Name:    {CapabilityTokeninfoIntrospect, CapabilityTokeninfoHistory, CapabilityTokeninfoTree},
+	CapabilityManageMT.Name:     {CapabilityReadManageMT, CapabilityRevokeAnyToken, CapabilitySuspendMT, CapabilityUpdateMTMetadata},
+	CapabilityReadManageMT.Name: {CapabilityListMT},
+}
+
+// CapabilityInfo describes a Capability in the capability catalogue
+type CapabilityInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Implies     []string `json:"implies,omitempty"`
+}
+
+// CapabilityCatalogue returns the catalogue of all defined Capabilities including the Capabilities each of them
+// directly implies
+func CapabilityCatalogue() (cat []CapabilityInfo) {
+	for _, c := range AllCapabilities {
+		cat = append(cat, CapabilityInfo{
+			Name:        c.Name,
+			Description: c.Description,
+			Implies:     c.Children().Strings(),
+		})
+	}
+	return
 }
 
 func descriptionFor(name string) string {
@@ -91,6 +154,24 @@ type Capability struct {
 	Description string
 }
 
+// Children returns the Capabilities that are directly implied by this Capability
+func (c Capability) Children() Capabilities {
+	return capabilityChildren[c.Name]
+}
+
+// Implies checks if this Capability is the passed Capability or (transitively) implies it
+func (c Capability) Implies(a Capability) bool {
+	if c.Name == a.Name {
+		return true
+	}
+	for _, cc := range c.Children() {
+		if cc.Implies(a) {
+			return true
+		}
+	}
+	return false
+}
+
 // MarshalJSON implements the json.Marshaler interface
 func (c Capability) MarshalJSON() ([]byte, error) {
 	return json.Marshal(c.Name)
@@ -124,23 +205,57 @@ func (c Capabilities) Value() (driver.Value, error) {
 	return json.Marshal(c)
 }
 
-// Tighten tightens two set of Capabilities into one new
+// UnmarshalYAML implements the yaml.Unmarshaler interface
+func (c *Capability) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err != nil {
+		return err
+	}
+	*c = NewCapability(name)
+	return nil
+}
+
+// Tighten tightens two set of Capabilities into one new; if an umbrella Capability from b is not covered by a, the
+// implied Capabilities that are covered by a are used instead
 func Tighten(a, b Capabilities) (res Capabilities) {
 	if b == nil {
 		return a
 	}
 	for _, bb := range b {
-		if a.Has(bb) {
-			res = append(res, bb)
+		for _, c := range tightenOne(a, bb) {
+			if !res.Has(c) {
+				res = append(res, c)
+			}
 		}
 	}
 	return
 }
 
-// Has checks if Capabilities slice contains the passed Capability
+func tightenOne(a Capabilities, b Capability) Capabilities {
+	if a.Has(b) {
+		return Capabilities{b}
+	}
+	var res Capabilities
+	for _, c := range b.Children() {
+		res = append(res, tightenOne(a, c)...)
+	}
+	return res
+}
+
+// IsSubsetOf checks if all Capabilities are also contained in the passed Capabilities
+func (c Capabilities) IsSubsetOf(b Capabilities) bool {
+	for _, cc := range c {
+		if !b.Has(cc) {
+			return false
+		}
+	}
+	return true
+}
+
+// Has checks if Capabilities slice contains the passed Capability or a Capability that implies it
 func (c Capabilities) Has(a Capability) bool {
 	for _, cc := range c {
-		if cc == a {
+		if cc.Implies(a) {
 			return true
 		}
 	}
@@ -56,3 +56,39 @@ func TestTightenSubSet(t *testing.T) {
 	testTighten(t, a, b, expected)
 	testTighten(t, b, a, expected)
 }
+func TestTightenUmbrellaCovered(t *testing.T) {
+	a := Capabilities{CapabilityTokeninfo}
+	b := Capabilities{CapabilityTokeninfoTree, CapabilityAT}
+	expected := Capabilities{CapabilityTokeninfoTree}
+	testTighten(t, a, b, expected)
+}
+func TestTightenUmbrellaNarrowed(t *testing.T) {
+	a := Capabilities{CapabilityTokeninfoTree, CapabilityListMT}
+	b := Capabilities{CapabilityTokeninfo, CapabilityManageMT}
+	expected := Capabilities{CapabilityTokeninfoTree, CapabilityListMT}
+	testTighten(t, a, b, expected)
+}
+func TestTightenReadWrite(t *testing.T) {
+	a := Capabilities{CapabilityReadSettings}
+	b := Capabilities{CapabilitySettings}
+	expected := Capabilities{CapabilityReadSettings}
+	testTighten(t, a, b, expected)
+	testTighten(t, b, a, expected)
+}
+
+func TestHasImplied(t *testing.T) {
+	c := Capabilities{CapabilityManageMT}
+	for _, a := range []Capability{CapabilityManageMT, CapabilityReadManageMT, CapabilityListMT, CapabilityRevokeAnyToken} {
+		if !c.Has(a) {
+			t.Errorf("Expected '%v' to have '%s'", c, a.Name)
+		}
+	}
+	for _, a := range []Capability{CapabilityAT, CapabilitySettings, CapabilityTokeninfoTree} {
+		if c.Has(a) {
+			t.Errorf("Expected '%v' to not have '%s'", c, a.Name)
+		}
+	}
+	if (Capabilities{CapabilityReadManageMT}).Has(CapabilityRevokeAnyToken) {
+		t.Errorf("Read-only capability must not imply '%s'", CapabilityRevokeAnyToken.Name)
+	}
+}
@@ -3,8 +3,12 @@ package api
 type EventHistory []EventEntry
 
 type EventEntry struct {
-	Event          string `db:"event" json:"event"`
-	Time           int64  `db:"time" json:"time"`
-	Comment        string `db:"comment" json:"comment,omitempty"`
+	Event   string `db:"event" json:"event"`
+	Time    int64  `db:"time" json:"time"`
+	Comment string `db:"comment" json:"comment,omitempty"`
+	Country string `db:"country" json:"country,omitempty"`
+	// ManagementID and TokenName identify the mytoken an event belongs to in the history of a subtree
+	ManagementID   string `db:"management_id" json:"management_id,omitempty"`
+	TokenName      string `db:"token_name" json:"token_name,omitempty"`
 	ClientMetaData `json:",inline"`
 }
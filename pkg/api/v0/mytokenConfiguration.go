@@ -7,8 +7,10 @@ type MytokenConfiguration struct {
 	MytokenEndpoint                        string                    `json:"mytoken_endpoint"`
 	TokeninfoEndpoint                      string                    `json:"tokeninfo_endpoint,omitempty"`
 	RevocationEndpoint                     string                    `json:"revocation_endpoint,omitempty"`
+	RevokeAllEndpoint                      string                    `json:"revoke_all_endpoint,omitempty"`
 	UserSettingsEndpoint                   string                    `json:"usersettings_endpoint"`
 	TokenTransferEndpoint                  string                    `json:"token_transfer_endpoint,omitempty"`
+	EventStreamEndpoint                    string                    `json:"event_stream_endpoint,omitempty"`
 	JWKSURI                                string                    `json:"jwks_uri"`
 	ProvidersSupported                     []SupportedProviderConfig `json:"providers_supported"`
 	TokenSigningAlgValue                   string                    `json:"token_signing_alg_value"`
@@ -19,6 +21,11 @@ type MytokenConfiguration struct {
 	ResponseTypesSupported                 []string                  `json:"response_types_supported"`
 	ServiceDocumentation                   string                    `json:"service_documentation,omitempty"`
 	Version                                string                    `json:"version,omitempty"`
+	RestrictionProfiles                    []RestrictionProfile      `json:"restriction_profiles,omitempty"`
+	CapabilityProfiles                     []CapabilityProfile       `json:"capability_profiles,omitempty"`
+	CapabilitiesSupported                  []CapabilityInfo          `json:"capabilities_supported"`
+	NotificationsSupported                 []string                  `json:"notifications_supported,omitempty"`
+	WebhooksSupported                      bool                      `json:"webhooks_supported,omitempty"`
 }
 
 // SupportedProviderConfig holds information about a provider
@@ -3,8 +3,12 @@ package api
 // MytokenEntry holds the information of a MytokenEntry as stored in the
 // database
 type MytokenEntry struct {
-	Name           string `json:"name,omitempty"`
-	CreatedAt      int64  `json:"created"`
+	ManagementID   string   `json:"management_id"`
+	Name           string   `json:"name,omitempty"`
+	Description    string   `json:"description,omitempty"`
+	Tags           []string `db:"-" json:"tags,omitempty"`
+	CreatedAt      int64    `json:"created"`
+	Suspended      bool     `db:"suspended" json:"suspended,omitempty"`
 	ClientMetaData `json:",inline"`
 }
 
@@ -4,4 +4,7 @@ package api
 type PollingCodeRequest struct {
 	GrantType   string `json:"grant_type"`
 	PollingCode string `json:"polling_code"`
+	// Wait is the number of seconds the server should hold the request until the consent is completed; it is limited
+	// to the polling_max_wait of the polling code. Only one long poll per polling code is held at a time.
+	Wait int64 `json:"wait,omitempty"`
 }
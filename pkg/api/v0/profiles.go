@@ -0,0 +1,18 @@
+package api
+
+// RestrictionProfile is a named set of restrictions defined by the mytoken instance, that can be referenced in a
+// mytoken request. The nbf and exp values are given in seconds relative to the creation of the mytoken.
+type RestrictionProfile struct {
+	Name         string       `json:"name"`
+	Description  string       `json:"description,omitempty"`
+	Restrictions Restrictions `json:"restrictions"`
+}
+
+// CapabilityProfile is a named set of capabilities defined by the mytoken instance, that can be referenced in a
+// mytoken request
+type CapabilityProfile struct {
+	Name                 string       `json:"name"`
+	Description          string       `json:"description,omitempty"`
+	Capabilities         Capabilities `json:"capabilities"`
+	SubtokenCapabilities Capabilities `json:"subtoken_capabilities,omitempty"`
+}
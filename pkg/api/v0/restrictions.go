@@ -5,15 +5,18 @@ type Restrictions []Restriction
 
 // Restriction describes a token usage restriction
 type Restriction struct {
-	NotBefore     int64    `json:"nbf,omitempty"`
-	ExpiresAt     int64    `json:"exp,omitempty"`
-	Scope         string   `json:"scope,omitempty"`
-	Audiences     []string `json:"audience,omitempty"`
-	IPs           []string `json:"ip,omitempty"`
-	GeoIPAllow    []string `json:"geoip_allow,omitempty"`
-	GeoIPDisallow []string `json:"geoip_disallow,omitempty"`
-	UsagesAT      *int64   `json:"usages_AT,omitempty"`
-	UsagesOther   *int64   `json:"usages_other,omitempty"`
+	NotBefore     int64    `json:"nbf,omitempty" yaml:"nbf,omitempty"`
+	ExpiresAt     int64    `json:"exp,omitempty" yaml:"exp,omitempty"`
+	Scope         string   `json:"scope,omitempty" yaml:"scope,omitempty"`
+	Audiences     []string `json:"audience,omitempty" yaml:"audience,omitempty"`
+	IPs           []string `json:"ip,omitempty" yaml:"ip,omitempty"`
+	GeoIPAllow    []string `json:"geoip_allow,omitempty" yaml:"geoip_allow,omitempty"`
+	GeoIPDisallow []string `json:"geoip_disallow,omitempty" yaml:"geoip_disallow,omitempty"`
+	UsagesAT      *int64   `json:"usages_AT,omitempty" yaml:"usages_AT,omitempty"`
+	UsagesOther   *int64   `json:"usages_other,omitempty" yaml:"usages_other,omitempty"`
+	// Capabilities are the capabilities this restriction authorises; if empty, all capabilities of the token are
+	// authorised
+	Capabilities Capabilities `json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
 }
 
 // UsedRestriction is a type for a restriction that has been used and additionally has information how often is has been used
@@ -5,4 +5,7 @@ type RevocationRequest struct {
 	Token      string `json:"token"` // We don't use model.Token here because we need to revoke a short token differently
 	Recursive  bool   `json:"recursive,omitempty"`
 	OIDCIssuer string `json:"oidc_issuer,omitempty"`
+	// ManagementID identifies another mytoken of the same user that should be revoked; Token then must be a mytoken
+	// with the revoke_any_token capability
+	ManagementID string `json:"management_id,omitempty"`
 }
@@ -0,0 +1,33 @@
+package api
+
+// RevokeAllRequest holds the information for a request to revoke all mytokens of a user
+type RevokeAllRequest struct {
+	Mytoken string `json:"mytoken,omitempty"`
+	// Mytokens holds further mytokens of the user, e.g. for other issuers; the mytokens of their users are revoked as
+	// well. Refresh tokens can only be decrypted with a mytoken that uses them, so a refresh token is only revoked at
+	// the OpenID provider if one of its mytokens is passed.
+	Mytokens []string `json:"mytokens,omitempty"`
+	// OIDCIssuer optionally limits the revocation to this issuer; if it is not set, the mytokens of all issuers of the
+	// passed mytokens are revoked
+	OIDCIssuer string `json:"oidc_issuer,omitempty"`
+}
+
+// RevokeAllResponse is the report of a request to revoke all mytokens of a user
+type RevokeAllResponse struct {
+	Issuers []RevokeAllIssuerReport `json:"issuers"`
+}
+
+// RevokeAllIssuerReport is the report about the revoked mytokens of a user at one issuer
+type RevokeAllIssuerReport struct {
+	OIDCIssuer string `json:"oidc_issuer"`
+	// MytokensRevoked holds the management ids of the revoked mytokens
+	MytokensRevoked []string `json:"mytokens_revoked"`
+	// RefreshTokensRevoked is the number of refresh tokens that were revoked at the OpenID provider
+	RefreshTokensRevoked int `json:"refresh_tokens_revoked"`
+	// RefreshTokensDeleted is the number of refresh tokens that could not be decrypted and therefore were only deleted
+	RefreshTokensDeleted int `json:"refresh_tokens_deleted"`
+	TransferCodesDeleted int `json:"transfer_codes_deleted"`
+	ShortTokensDeleted   int `json:"short_tokens_deleted"`
+	// Errors holds errors that occurred while revoking refresh tokens at the OpenID provider
+	Errors []string `json:"errors,omitempty"`
+}
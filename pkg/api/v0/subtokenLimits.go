@@ -0,0 +1,90 @@
+package api
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+)
+
+// SubtokenLimits limits the subtokens that can be created from a mytoken
+type SubtokenLimits struct {
+	// MaxDepth is the maximum number of generations of subtokens below the mytoken; 0 means no subtokens at all
+	MaxDepth *uint64 `json:"max_depth,omitempty"`
+	// MaxChildren is the maximum number of live direct subtokens
+	MaxChildren *uint64 `json:"max_children,omitempty"`
+	// MaxDescendants is the maximum number of live direct and indirect subtokens
+	MaxDescendants *uint64 `json:"max_descendants,omitempty"`
+}
+
+// Scan implements the sql.Scanner interface.
+func (l *SubtokenLimits) Scan(src interface{}) error {
+	if src == nil {
+		return nil
+	}
+	val := src.([]uint8)
+	return json.Unmarshal(val, l)
+}
+
+// Value implements the driver.Valuer interface
+func (l SubtokenLimits) Value() (driver.Value, error) {
+	if l.empty() {
+		return nil, nil
+	}
+	return json.Marshal(l)
+}
+
+func (l SubtokenLimits) empty() bool {
+	return l.MaxDepth == nil && l.MaxChildren == nil && l.MaxDescendants == nil
+}
+
+// ForSubtoken returns the SubtokenLimits of a subtoken of a mytoken with these limits. The wanted limits are only
+// applied where they are tighter than what is left of these limits one generation further down.
+func (l *SubtokenLimits) ForSubtoken(wanted *SubtokenLimits) *SubtokenLimits {
+	res := SubtokenLimits{}
+	if wanted != nil {
+		res = SubtokenLimits{
+			MaxDepth:       copyLimit(wanted.MaxDepth),
+			MaxChildren:    copyLimit(wanted.MaxChildren),
+			MaxDescendants: copyLimit(wanted.MaxDescendants),
+		}
+	}
+	if l != nil {
+		res.MaxDepth = minLimit(res.MaxDepth, decrementLimit(l.MaxDepth))
+		res.MaxDescendants = minLimit(res.MaxDescendants, decrementLimit(l.MaxDescendants))
+		// the subtoken itself counts against the parent's descendants
+		res.MaxChildren = minLimit(res.MaxChildren, decrementLimit(l.MaxDescendants))
+	}
+	if res.empty() {
+		return nil
+	}
+	return &res
+}
+
+func copyLimit(a *uint64) *uint64 {
+	if a == nil {
+		return nil
+	}
+	v := *a
+	return &v
+}
+
+func decrementLimit(a *uint64) *uint64 {
+	if a == nil {
+		return nil
+	}
+	v := *a
+	if v > 0 {
+		v--
+	}
+	return &v
+}
+
+// minLimit returns the smaller limit, where nil is no limit
+func minLimit(a, b *uint64) *uint64 {
+	if a == nil {
+		return b
+	}
+	if b == nil || *a <= *b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,61 @@
+package api
+
+import "testing"
+
+func newLimit(v uint64) *uint64 {
+	return &v
+}
+
+func checkLimit(t *testing.T, name string, expected, got *uint64) {
+	if expected == nil && got == nil {
+		return
+	}
+	if expected == nil || got == nil || *expected != *got {
+		t.Errorf("%s: Expected '%v', got '%v'", name, expected, got)
+	}
+}
+
+func TestSubtokenLimitsForSubtokenNoLimits(t *testing.T) {
+	var l *SubtokenLimits
+	if res := l.ForSubtoken(nil); res != nil {
+		t.Errorf("Expected no limits, got '%+v'", res)
+	}
+}
+
+func TestSubtokenLimitsForSubtokenInherited(t *testing.T) {
+	l := &SubtokenLimits{
+		MaxDepth:       newLimit(2),
+		MaxChildren:    newLimit(3),
+		MaxDescendants: newLimit(10),
+	}
+	res := l.ForSubtoken(nil)
+	checkLimit(t, "max_depth", newLimit(1), res.MaxDepth)
+	checkLimit(t, "max_children", newLimit(9), res.MaxChildren)
+	checkLimit(t, "max_descendants", newLimit(9), res.MaxDescendants)
+}
+
+func TestSubtokenLimitsForSubtokenWantedTighter(t *testing.T) {
+	l := &SubtokenLimits{
+		MaxDepth:       newLimit(2),
+		MaxDescendants: newLimit(10),
+	}
+	res := l.ForSubtoken(&SubtokenLimits{
+		MaxDepth:    newLimit(0),
+		MaxChildren: newLimit(2),
+	})
+	checkLimit(t, "max_depth", newLimit(0), res.MaxDepth)
+	checkLimit(t, "max_children", newLimit(2), res.MaxChildren)
+	checkLimit(t, "max_descendants", newLimit(9), res.MaxDescendants)
+}
+
+func TestSubtokenLimitsForSubtokenWantedLooser(t *testing.T) {
+	l := &SubtokenLimits{
+		MaxDepth: newLimit(2),
+	}
+	res := l.ForSubtoken(&SubtokenLimits{
+		MaxDepth: newLimit(5),
+	})
+	checkLimit(t, "max_depth", newLimit(1), res.MaxDepth)
+	checkLimit(t, "max_children", nil, res.MaxChildren)
+	checkLimit(t, "max_descendants", nil, res.MaxDescendants)
+}
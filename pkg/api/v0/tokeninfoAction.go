@@ -1,12 +1,17 @@
 package api
 
 // AllTokeninfoActions holds all defined TokenInfo strings
-var AllTokeninfoActions = [...]string{TokeninfoActionIntrospect, TokeninfoActionEventHistory, TokeninfoActionSubtokenTree, TokeninfoActionListMytokens}
+var AllTokeninfoActions = [...]string{TokeninfoActionIntrospect, TokeninfoActionEventHistory, TokeninfoActionSubtokenTree, TokeninfoActionListMytokens, TokeninfoActionSuspend, TokeninfoActionResume, TokeninfoActionUpdateMetadata, TokeninfoActionSubtreeEventHistory, TokeninfoActionAnomalyPolicy}
 
 // TokeninfoActions
 const (
-	TokeninfoActionIntrospect   = "introspect"
-	TokeninfoActionEventHistory = "event_history"
-	TokeninfoActionSubtokenTree = "subtoken_tree"
-	TokeninfoActionListMytokens = "list_mytokens"
+	TokeninfoActionIntrospect          = "introspect"
+	TokeninfoActionEventHistory        = "event_history"
+	TokeninfoActionSubtokenTree        = "subtoken_tree"
+	TokeninfoActionListMytokens        = "list_mytokens"
+	TokeninfoActionSuspend             = "suspend"
+	TokeninfoActionResume              = "resume"
+	TokeninfoActionUpdateMetadata      = "update_metadata"
+	TokeninfoActionSubtreeEventHistory = "subtree_event_history"
+	TokeninfoActionAnomalyPolicy       = "anomaly_policy"
 )
@@ -3,4 +3,58 @@ package api
 type TokenInfoRequest struct {
 	Action  string `json:"action"`
 	Mytoken string `json:"mytoken"`
+	// ManagementID identifies another mytoken of the same user for actions that can be applied to other mytokens; the
+	// history action also accepts the management id of a revoked mytoken as long as its tombstone is kept
+	ManagementID string `json:"management_id,omitempty"`
+	// Tag limits the mytokens returned by the subtoken tree and list actions to those with this tag
+	Tag string `json:"tag,omitempty"`
+	// Name, Description, and Tags are used by the update_metadata action; omitted fields are not changed
+	Name        *string   `json:"name,omitempty"`
+	Description *string   `json:"description,omitempty"`
+	Tags        *[]string `json:"tags,omitempty"`
+	// Cursor, Limit, SortBy, and SortOrder are used for pagination and sorting by the subtoken tree, list, and history
+	// actions; if neither Cursor nor Limit is set, all entries are returned
+	Cursor    string `json:"cursor,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+	SortBy    string `json:"sort_by,omitempty"`
+	SortOrder string `json:"sort_order,omitempty"`
+	// Status limits the mytokens returned by the subtoken tree and list actions to active or suspended mytokens
+	Status string `json:"status,omitempty"`
+	// Events, Since, Until, IP, and Country filter the events returned by the history action. The country of an event
+	// is only known for events logged since the server looks up countries; older events never match a Country filter.
+	Events  []string `json:"events,omitempty"`
+	Since   int64    `json:"since,omitempty"`
+	Until   int64    `json:"until,omitempty"`
+	IP      string   `json:"ip,omitempty"`
+	Country string   `json:"country,omitempty"`
+	// AnomalyPolicy is set by the anomaly_policy action; an empty string removes the policy. If ForUser is true the
+	// policy is set for all mytokens of the user instead of a single mytoken
+	AnomalyPolicy *string `json:"anomaly_policy,omitempty"`
+	ForUser       bool    `json:"for_user,omitempty"`
 }
+
+// Sort orders
+const (
+	SortOrderAsc  = "asc"
+	SortOrderDesc = "desc"
+)
+
+// Sort keys
+const (
+	SortByCreated = "created"
+	SortByName    = "name"
+	SortByTime    = "time"
+)
+
+// Mytoken status filters
+const (
+	TokenStatusActive    = "active"
+	TokenStatusSuspended = "suspended"
+)
+
+// Actions taken on a detected anomaly
+const (
+	AnomalyActionLog     = "log"
+	AnomalyActionNotify  = "notify"
+	AnomalyActionSuspend = "suspend"
+)
@@ -7,11 +7,32 @@ type TokeninfoIntrospectResponse struct {
 
 type TokeninfoHistoryResponse struct {
 	EventHistory EventHistory `json:"events"`
+	NextCursor   string       `json:"next_cursor,omitempty"`
 }
 
 type TokeninfoTreeResponse struct {
-	Tokens MytokenEntryTree `json:"mytokens"`
+	Tokens     MytokenEntryTree `json:"mytokens"`
+	NextCursor string           `json:"next_cursor,omitempty"`
 }
 type TokeninfoListResponse struct {
-	Tokens []MytokenEntryTree `json:"mytokens"`
+	Tokens     []MytokenEntryTree `json:"mytokens"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+type TokeninfoUpdateMetadataResponse struct {
+	Token MytokenEntry `json:"token"`
+}
+
+type TokeninfoSuspendResponse struct {
+	ManagementID string `json:"management_id"`
+	Suspended    bool   `json:"suspended"`
+}
+
+type TokeninfoAnomalyPolicyResponse struct {
+	ManagementID string `json:"management_id"`
+	// TokenPolicy and UserPolicy are empty if no policy is set on that level
+	TokenPolicy string `json:"token_policy,omitempty"`
+	UserPolicy  string `json:"user_policy,omitempty"`
+	// EffectivePolicy is the action that is taken when an anomaly is detected for this mytoken
+	EffectivePolicy string `json:"effective_policy"`
 }
@@ -0,0 +1,73 @@
+package api
+
+// UserSettingsRequest is a request to the user settings endpoint; settings that are omitted are only returned, not
+// changed
+type UserSettingsRequest struct {
+	Mytoken       string                `json:"mytoken,omitempty"`
+	Notifications *NotificationSettings `json:"notifications,omitempty"`
+	// AddWebhook adds a webhook subscription; RemoveWebhook removes the webhook subscription with this id
+	AddWebhook    *WebhookSubscription `json:"add_webhook,omitempty"`
+	RemoveWebhook uint64               `json:"remove_webhook,omitempty"`
+}
+
+// UserSettingsResponse is the response of the user settings endpoint
+type UserSettingsResponse struct {
+	Notifications NotificationSettings  `json:"notifications"`
+	Webhooks      []WebhookSubscription `json:"webhooks,omitempty"`
+}
+
+// WebhookSubscription is a webhook that receives the events of a user's mytokens
+type WebhookSubscription struct {
+	ID  uint64 `json:"id,omitempty"`
+	URL string `json:"url"`
+	// Events limits the delivered events; if empty, all events are delivered
+	Events []string `json:"events,omitempty"`
+	// Secret is used to sign the payloads with HMAC-SHA256; if not set, they are signed with the server key. The
+	// secret is never returned, HasSecret indicates if one is set.
+	Secret    string `json:"secret,omitempty"`
+	HasSecret bool   `json:"has_secret"`
+}
+
+// WebhookPayload is the payload delivered to webhooks for each event
+type WebhookPayload struct {
+	Event        string `json:"event"`
+	Comment      string `json:"comment,omitempty"`
+	ManagementID string `json:"management_id"`
+	Time         int64  `json:"time"`
+	IP           string `json:"ip"`
+	UserAgent    string `json:"user_agent,omitempty"`
+	Country      string `json:"country,omitempty"`
+}
+
+// Headers of webhook deliveries
+const (
+	// WebhookHeaderSignature holds the hex encoded HMAC-SHA256 of the payload, prefixed with 'sha256='
+	WebhookHeaderSignature = "Mytoken-Signature"
+	// WebhookHeaderJWS holds a JWS with detached payload signed with the server key
+	WebhookHeaderJWS = "Mytoken-JWS"
+	// WebhookHeaderDelivery holds a unique id of the delivery, which is the same for all attempts
+	WebhookHeaderDelivery = "Mytoken-Delivery"
+)
+
+// NotificationSettings holds the address notifications are sent to and the notifications a user subscribed to. A new
+// address is only used after it was confirmed through the link sent to it; until then it is returned as PendingEmail.
+type NotificationSettings struct {
+	Email         string   `json:"email"`
+	PendingEmail  string   `json:"pending_email,omitempty"`
+	Subscriptions []string `json:"subscriptions"`
+}
+
+// AllNotifications holds all notifications a user can subscribe to
+var AllNotifications = [...]string{NotificationSubtokenCreated, NotificationExpiringSoon, NotificationNewLocation}
+
+// Notifications
+const (
+	// NotificationSubtokenCreated is sent if a subtoken is created from a mytoken; mytokens obtained through an
+	// authorization code flow are not reported
+	NotificationSubtokenCreated = "subtoken_created"
+	NotificationExpiringSoon    = "expiring_soon"
+	NotificationNewLocation     = "new_location"
+	// NotificationAnomalyDetected cannot be subscribed to; it is sent if the anomaly policy of a mytoken is notify or
+	// suspend
+	NotificationAnomalyDetected = "anomaly_detected"
+)
@@ -20,6 +20,11 @@ const ( // assert that these are in the same order as api.AllTokeninfoActions
 	TokeninfoActionEventHistory
 	TokeninfoActionSubtokenTree
 	TokeninfoActionListMytokens
+	TokeninfoActionSuspend
+	TokeninfoActionResume
+	TokeninfoActionUpdateMetadata
+	TokeninfoActionSubtreeEventHistory
+	TokeninfoActionAnomalyPolicy
 	maxTokeninfoAction
 )
 
@@ -0,0 +1,274 @@
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/eventrepo"
+	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/notification"
+	"github.com/oidc-mytoken/server/internal/utils/geoip"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	eventService "github.com/oidc-mytoken/server/shared/mytoken/event"
+	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+// maxCommentLength is the maximum length of an event comment in the database
+const maxCommentLength = 100
+
+// SuspendedReason is the error description returned if a mytoken was suspended because of an anomaly
+const SuspendedReason = "token was suspended because of an anomalous usage"
+
+// earthRadius is the mean radius of the earth in km
+const earthRadius = 6371.0
+
+// ignoredEvents are the events that are not part of the baseline, because they were not caused by a legitimate usage
+var ignoredEvents = []string{
+	event.AllEvents[event.MTEventDeniedCapability],
+	event.AllEvents[event.MTEventDeniedRestriction],
+	event.AllEvents[event.MTEventDeniedUsageLimit],
+	event.AllEvents[event.MTEventDeniedInvalidToken],
+	event.AllEvents[event.MTEventAnomalyDetected],
+}
+
+// locate returns the coordinates of an ip; it can be replaced in tests
+var locate = geoip.Location
+
+// Prefixes of the anomaly descriptions that are about the location of a usage
+const (
+	newCountry       = "new country"
+	impossibleTravel = "impossible travel"
+)
+
+// locationChanged checks if one of the anomalies is about the location of a usage
+func locationChanged(anomalies []string) bool {
+	for _, a := range anomalies {
+		if strings.HasPrefix(a, newCountry) || strings.HasPrefix(a, impossibleTravel) {
+			return true
+		}
+	}
+	return false
+}
+
+// usage describes a single usage of a mytoken
+type usage struct {
+	ip        string
+	userAgent string
+	country   string
+	asn       uint
+}
+
+// detect compares the usage u with the baseline b of previous usages and returns a description of each anomaly
+func detect(u usage, b eventrepo.UsageBaseline, conf config.AnomalyDetectionConf) (anomalies []string) {
+	if b.Events == 0 {
+		return
+	}
+	if conf.NewCountry && u.country != "" && b.WithCountry > 0 && b.SameCountry == 0 {
+		anomalies = append(anomalies, fmt.Sprintf("%s %s", newCountry, u.country))
+	}
+	if conf.NewASN && u.asn != 0 && b.WithASN > 0 && b.SameASN == 0 {
+		anomalies = append(anomalies, fmt.Sprintf("new AS%d", u.asn))
+	}
+	if conf.NewUserAgent && u.userAgent != "" && !knownProduct(u.userAgent, b.UserAgents) {
+		anomalies = append(anomalies, "new user agent")
+	}
+	if conf.ImpossibleTravel.Enabled && b.LastIP != "" && b.LastIP != u.ip {
+		if speed, distance, ok := travelSpeed(b.LastIP, u.ip, b.LastSecondsAgo); ok &&
+			distance > conf.ImpossibleTravel.MinDistance && speed > conf.ImpossibleTravel.MaxSpeed {
+			anomalies = append(anomalies, fmt.Sprintf("%s of %.0f km", impossibleTravel, distance))
+		}
+	}
+	return
+}
+
+// userAgentProduct returns the product names of a user agent without their versions and comments, e.g. "Mozilla
+// AppleWebKit Chrome Safari" for a Chrome user agent, so that updates of a client are not reported as anomalies
+func userAgentProduct(userAgent string) string {
+	var outside strings.Builder
+	depth := 0
+	for _, r := range userAgent {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			outside.WriteRune(r)
+		}
+	}
+	var products []string
+	for _, p := range strings.Fields(outside.String()) {
+		products = append(products, strings.SplitN(p, "/", 2)[0])
+	}
+	return strings.Join(products, " ")
+}
+
+// knownProduct checks if the product of the passed user agent is the product of one of the known user agents
+func knownProduct(userAgent string, known []string) bool {
+	product := userAgentProduct(userAgent)
+	for _, k := range known {
+		if userAgentProduct(k) == product {
+			return true
+		}
+	}
+	return false
+}
+
+// travelSpeed returns the speed in km/h needed to travel between the locations of the two ips in the passed time
+func travelSpeed(fromIP, toIP string, seconds int64) (speed, distance float64, ok bool) {
+	lat1, lon1, ok := locate(fromIP)
+	if !ok {
+		return
+	}
+	lat2, lon2, ok := locate(toIP)
+	if !ok {
+		return
+	}
+	distance = haversine(lat1, lon1, lat2, lon2)
+	if seconds < 1 {
+		seconds = 1
+	}
+	speed = distance / (float64(seconds) / 3600)
+	return
+}
+
+// haversine returns the great-circle distance in km between two coordinates
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// effectivePolicy returns the action to take on an anomaly; a mytoken's own policy takes precedence over the policy
+// of its user, which takes precedence over the server default
+func effectivePolicy(tokenPolicy, userPolicy string) string {
+	if tokenPolicy != "" {
+		return tokenPolicy
+	}
+	if userPolicy != "" {
+		return userPolicy
+	}
+	return config.Get().Features.AnomalyDetection.DefaultAction
+}
+
+// EffectivePolicy returns the action taken on an anomaly for the passed mytoken, together with the policies set for
+// the mytoken and its user
+func EffectivePolicy(tx *sqlx.Tx, id mtid.MTID) (effective, tokenPolicy, userPolicy string, err error) {
+	tokenPolicy, userPolicy, err = dbhelper.GetAnomalyPolicies(tx, id)
+	effective = effectivePolicy(tokenPolicy, userPolicy)
+	return
+}
+
+// Result is the result of Check
+type Result struct {
+	// Suspended is true if the mytoken was suspended, in which case the request must be denied
+	Suspended bool
+	notify    func()
+}
+
+// Notify notifies the user and the operator about the detected anomalies, if any. It must only be called after the
+// transaction passed to Check was committed, so that nobody is notified about an anomaly that was rolled back.
+func (r Result) Notify() {
+	if r.notify != nil {
+		r.notify()
+	}
+}
+
+// Check runs the anomaly detection for a usage of the mytoken within the passed transaction and applies the
+// mytoken's policy to any anomaly. If the mytoken was suspended, the request must be denied; the transaction must then
+// still be committed. The notifications are not sent by Check, but by Result.Notify. Check must be called before the
+// usage itself is logged; errors are only logged, so that the detection never breaks a legitimate request.
+func Check(tx *sqlx.Tx, id mtid.MTID, clientMetaData api.ClientMetaData) (result Result) {
+	conf := config.Get().Features.AnomalyDetection
+	if !conf.Enabled {
+		return
+	}
+	u := usage{
+		ip:        clientMetaData.IP,
+		userAgent: clientMetaData.UserAgent,
+		country:   geoip.CountryCode(clientMetaData.IP),
+		asn:       geoip.ASN(clientMetaData.IP),
+	}
+	var anomalies []string
+	var policy string
+	if err := db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		b, err := eventrepo.GetUsageBaseline(tx, id, u.country, u.asn, conf.BaselineEvents, ignoredEvents)
+		if err != nil {
+			return err
+		}
+		anomalies = detect(u, b, conf)
+		if len(anomalies) == 0 {
+			return nil
+		}
+		policy, _, _, err = EffectivePolicy(tx, id)
+		if err != nil {
+			return err
+		}
+		comment := strings.Join(anomalies, "; ")
+		if len(comment) > maxCommentLength {
+			comment = comment[:maxCommentLength]
+		}
+		if err = eventService.LogEvent(tx, eventService.MTEvent{
+			Event: event.FromNumber(event.MTEventAnomalyDetected, comment),
+			MTID:  id,
+		}, clientMetaData); err != nil {
+			return err
+		}
+		if policy != api.AnomalyActionSuspend {
+			return nil
+		}
+		if err = dbhelper.SuspendMT(tx, id); err != nil {
+			return err
+		}
+		return eventService.LogEvent(tx, eventService.MTEvent{
+			Event: event.FromNumber(event.MTEventSuspended, "anomaly detected"),
+			MTID:  id,
+		}, clientMetaData)
+	}); err != nil {
+		log.WithError(err).Error("Could not run anomaly detection")
+		return
+	}
+	if len(anomalies) == 0 {
+		return
+	}
+	result.Suspended = policy == api.AnomalyActionSuspend
+	data := map[string]interface{}{
+		"ip":        u.ip,
+		"country":   u.country,
+		"anomalies": strings.Join(anomalies, "; "),
+		"suspended": result.Suspended,
+	}
+	// With the notify and suspend actions, the user is notified of all anomalies; otherwise, only users who subscribed
+	// to the new_location notification are notified of a new location
+	if policy == api.AnomalyActionNotify || result.Suspended {
+		result.notify = func() {
+			notify(id, anomalies, policy, clientMetaData, data)
+		}
+	} else if locationChanged(anomalies) {
+		result.notify = func() {
+			notification.Notify(id, api.NotificationNewLocation, data)
+		}
+	}
+	return
+}
+
+// notify reports an anomaly to the user by email and to the operator through the server log
+func notify(id mtid.MTID, anomalies []string, policy string, clientMetaData api.ClientMetaData, data map[string]interface{}) {
+	log.WithFields(log.Fields{
+		"management_id": id.ManagementID(),
+		"anomalies":     anomalies,
+		"action":        policy,
+		"ip":            clientMetaData.IP,
+		"user_agent":    clientMetaData.UserAgent,
+	}).Warn("Detected anomalous mytoken usage")
+	notification.NotifyUser(id, api.NotificationAnomalyDetected, data)
+}
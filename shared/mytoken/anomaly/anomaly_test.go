@@ -0,0 +1,201 @@
+package anomaly
+
+import (
+	"math"
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/eventrepo"
+)
+
+var testConf = config.AnomalyDetectionConf{
+	Enabled:      true,
+	NewCountry:   true,
+	NewASN:       true,
+	NewUserAgent: true,
+	ImpossibleTravel: config.ImpossibleTravelConf{
+		Enabled:     true,
+		MaxSpeed:    1000,
+		MinDistance: 600,
+	},
+}
+
+// testLocations maps ips to the coordinates of Karlsruhe, Berlin, and Sydney
+var testLocations = map[string][2]float64{
+	"192.0.2.1":    {49.01, 8.40},
+	"192.0.2.2":    {52.52, 13.40},
+	"198.51.100.1": {-33.87, 151.21},
+}
+
+func fakeLocate(ip string) (float64, float64, bool) {
+	l, ok := testLocations[ip]
+	return l[0], l[1], ok
+}
+
+func TestHaversine(t *testing.T) {
+	// Karlsruhe - Berlin is about 525 km
+	d := haversine(49.01, 8.40, 52.52, 13.40)
+	if math.Abs(d-525) > 10 {
+		t.Errorf("Expected about 525 km, got %f", d)
+	}
+	if d = haversine(49.01, 8.40, 49.01, 8.40); d != 0 {
+		t.Errorf("Expected 0 km, got %f", d)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	locate = fakeLocate
+	u := usage{
+		ip:        "192.0.2.1",
+		userAgent: "agent",
+		country:   "DE",
+		asn:       64500,
+	}
+	known := eventrepo.UsageBaseline{
+		Events:         5,
+		WithCountry:    5,
+		SameCountry:    5,
+		WithASN:        5,
+		SameASN:        5,
+		UserAgents:     []string{"agent/1.0"},
+		LastIP:         "192.0.2.1",
+		LastSecondsAgo: 60,
+	}
+	tests := []struct {
+		name     string
+		baseline func(b eventrepo.UsageBaseline) eventrepo.UsageBaseline
+		expected []string
+	}{
+		{
+			name:     "Known",
+			baseline: func(b eventrepo.UsageBaseline) eventrepo.UsageBaseline { return b },
+		},
+		{
+			name:     "NoHistory",
+			baseline: func(b eventrepo.UsageBaseline) eventrepo.UsageBaseline { return eventrepo.UsageBaseline{} },
+		},
+		{
+			name: "NewCountry",
+			baseline: func(b eventrepo.UsageBaseline) eventrepo.UsageBaseline {
+				b.SameCountry = 0
+				return b
+			},
+			expected: []string{"new country DE"},
+		},
+		{
+			name: "NoCountryData",
+			baseline: func(b eventrepo.UsageBaseline) eventrepo.UsageBaseline {
+				b.WithCountry, b.SameCountry = 0, 0
+				return b
+			},
+		},
+		{
+			name: "NewASN",
+			baseline: func(b eventrepo.UsageBaseline) eventrepo.UsageBaseline {
+				b.SameASN = 0
+				return b
+			},
+			expected: []string{"new AS64500"},
+		},
+		{
+			name: "NewUserAgent",
+			baseline: func(b eventrepo.UsageBaseline) eventrepo.UsageBaseline {
+				b.UserAgents = []string{"other/1.0"}
+				return b
+			},
+			expected: []string{"new user agent"},
+		},
+		{
+			name: "PlausibleTravel",
+			baseline: func(b eventrepo.UsageBaseline) eventrepo.UsageBaseline {
+				b.LastIP = "198.51.100.1"
+				b.LastSecondsAgo = 24 * 3600
+				return b
+			},
+		},
+		{
+			name: "ShortDistance",
+			baseline: func(b eventrepo.UsageBaseline) eventrepo.UsageBaseline {
+				b.LastIP = "192.0.2.2"
+				return b
+			},
+		},
+		{
+			name: "ImpossibleTravel",
+			baseline: func(b eventrepo.UsageBaseline) eventrepo.UsageBaseline {
+				b.LastIP = "198.51.100.1"
+				b.LastSecondsAgo = 3600
+				return b
+			},
+			expected: []string{"impossible travel of 16536 km"},
+		},
+		{
+			name: "UnknownLocation",
+			baseline: func(b eventrepo.UsageBaseline) eventrepo.UsageBaseline {
+				b.LastIP = "203.0.113.1"
+				return b
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			anomalies := detect(u, test.baseline(known), testConf)
+			if len(anomalies) != len(test.expected) {
+				t.Fatalf("Expected anomalies %v, got %v", test.expected, anomalies)
+			}
+			for i, a := range anomalies {
+				if a != test.expected[i] {
+					t.Errorf("Expected anomaly '%s', got '%s'", test.expected[i], a)
+				}
+			}
+		})
+	}
+}
+
+func TestDetect_Disabled(t *testing.T) {
+	locate = fakeLocate
+	u := usage{
+		ip:        "192.0.2.1",
+		userAgent: "agent",
+		country:   "DE",
+		asn:       64500,
+	}
+	b := eventrepo.UsageBaseline{
+		Events:         1,
+		WithCountry:    1,
+		WithASN:        1,
+		LastIP:         "198.51.100.1",
+		LastSecondsAgo: 1,
+	}
+	if anomalies := detect(u, b, config.AnomalyDetectionConf{}); len(anomalies) != 0 {
+		t.Errorf("Expected no anomalies with all checks disabled, got %v", anomalies)
+	}
+}
+
+func TestUserAgentProduct(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		expected  string
+	}{
+		{"mytoken-client/0.3.0", "mytoken-client"},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:118.0) Gecko/20100101 Firefox/118.0", "Mozilla Gecko Firefox"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/117.0.0.0 Safari/537.36", "Mozilla AppleWebKit Chrome Safari"},
+		{"curl", "curl"},
+	}
+	for _, test := range tests {
+		if p := userAgentProduct(test.userAgent); p != test.expected {
+			t.Errorf("Expected product '%s' for '%s', got '%s'", test.expected, test.userAgent, p)
+		}
+	}
+}
+
+func TestDetect_UpdatedUserAgent(t *testing.T) {
+	u := usage{userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:119.0) Gecko/20100101 Firefox/119.0"}
+	b := eventrepo.UsageBaseline{
+		Events:     1,
+		UserAgents: []string{"Mozilla/5.0 (X11; Linux x86_64; rv:118.0) Gecko/20100101 Firefox/118.0"},
+	}
+	if anomalies := detect(u, b, testConf); len(anomalies) != 0 {
+		t.Errorf("Expected no anomalies for an updated client, got %v", anomalies)
+	}
+}
@@ -0,0 +1,66 @@
+package event
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/eventrepo"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	pkg "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+)
+
+// maxCommentLength is the maximum length of an event comment in the database
+const maxCommentLength = 100
+
+// denialEvents are the names of all events for denied attempts
+var denialEvents = []string{
+	pkg.AllEvents[pkg.MTEventDeniedCapability],
+	pkg.AllEvents[pkg.MTEventDeniedRestriction],
+	pkg.AllEvents[pkg.MTEventDeniedUsageLimit],
+	pkg.AllEvents[pkg.MTEventDeniedInvalidToken],
+}
+
+// LogDenial logs a denied or failed attempt to use a mytoken with the passed reason. The event is stored in its own
+// transaction, so it is kept even if the transaction of the request is rolled back, and it does not consume any
+// usages. Denial events are rate limited per mytoken; errors are only logged, since the request fails anyway.
+func LogDenial(id mtid.MTID, denial int, reason string, clientMetaData api.ClientMetaData) {
+	conf := config.Get().Features.DenialEvents
+	if !conf.Enabled {
+		return
+	}
+	if len(reason) > maxCommentLength {
+		reason = reason[:maxCommentLength]
+	}
+	e := &eventrepo.EventDBObject{
+		Event:          pkg.FromNumber(denial, reason),
+		MTID:           id,
+		ClientMetaData: clientMetaData,
+	}
+	if err := db.Transact(func(tx *sqlx.Tx) error {
+		stored, err := e.StoreDenial(tx, denialEvents, conf.MaxPerMinute)
+		if err != nil || !stored {
+			return err
+		}
+		return enqueueWebhooks(tx, MTEvent{
+			Event: e.Event,
+			MTID:  id,
+		}, clientMetaData)
+	}); err != nil {
+		log.WithError(err).Error("Could not store denial event")
+	}
+}
+
+// LogCapabilityDenial logs that a mytoken was used for an action it lacks the capability for
+func LogCapabilityDenial(id mtid.MTID, capability api.Capability, clientMetaData api.ClientMetaData) {
+	LogDenial(id, pkg.MTEventDeniedCapability, fmt.Sprintf("missing capability '%s'", capability.Name), clientMetaData)
+}
+
+// LogInvalidTokenDenial logs that a revoked, suspended, or otherwise invalid mytoken was used
+func LogInvalidTokenDenial(id mtid.MTID, reason string, clientMetaData api.ClientMetaData) {
+	LogDenial(id, pkg.MTEventDeniedInvalidToken, reason, clientMetaData)
+}
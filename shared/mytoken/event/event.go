@@ -1,9 +1,14 @@
 package event
 
 import (
+	"time"
+
 	"github.com/jmoiron/sqlx"
 
+	"github.com/oidc-mytoken/server/internal/db"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/eventrepo"
+	"github.com/oidc-mytoken/server/internal/utils/geoip"
+	"github.com/oidc-mytoken/server/internal/webhook"
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 	pkg "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
 	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
@@ -14,13 +19,31 @@ type MTEvent struct {
 	MTID mtid.MTID
 }
 
-// LogEvent logs an event to the database
+// LogEvent logs an event to the database and enqueues its delivery to subscribed webhooks
 func LogEvent(tx *sqlx.Tx, event MTEvent, clientMetaData api.ClientMetaData) error {
-	return (&eventrepo.EventDBObject{
-		Event:          event.Event,
-		MTID:           event.MTID,
-		ClientMetaData: clientMetaData,
-	}).Store(tx)
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		if err := (&eventrepo.EventDBObject{
+			Event:          event.Event,
+			MTID:           event.MTID,
+			ClientMetaData: clientMetaData,
+		}).Store(tx); err != nil {
+			return err
+		}
+		return enqueueWebhooks(tx, event, clientMetaData)
+	})
+}
+
+// enqueueWebhooks enqueues the delivery of a stored event to the subscribed webhooks
+func enqueueWebhooks(tx *sqlx.Tx, event MTEvent, clientMetaData api.ClientMetaData) error {
+	return webhook.Enqueue(tx, event.MTID, api.WebhookPayload{
+		Event:        event.Event.String(),
+		Comment:      event.Event.Comment,
+		ManagementID: event.MTID.ManagementID(),
+		Time:         time.Now().Unix(),
+		IP:           clientMetaData.IP,
+		UserAgent:    clientMetaData.UserAgent,
+		Country:      geoip.CountryCode(clientMetaData.IP),
+	})
 }
 
 // LogEvents logs multiple events for the same token to the database
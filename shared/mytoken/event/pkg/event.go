@@ -62,7 +62,7 @@ func eventStringToInt(str string) int {
 }
 
 // AllEvents hold all possible Events
-var AllEvents = [...]string{"unknown", "created", "AT_created", "MT_created", "tokeninfo_introspect", "tokeninfo_history", "tokeninfo_tree", "tokeninfo_list_mytokens", "mng_enabled_AT_grant", "mng_disabled_AT_grant", "mng_enabled_JWT_grant", "mng_disabled_JWT_grant", "mng_linked_grant", "mng_unlinked_grant", "mng_enabled_tracing", "mng_disabled_tracing", "inherited_RT", "transfer_code_created", "transfer_code_used"}
+var AllEvents = [...]string{"unknown", "created", "AT_created", "MT_created", "tokeninfo_introspect", "tokeninfo_history", "tokeninfo_tree", "tokeninfo_list_mytokens", "mng_enabled_AT_grant", "mng_disabled_AT_grant", "mng_enabled_JWT_grant", "mng_disabled_JWT_grant", "mng_linked_grant", "mng_unlinked_grant", "mng_enabled_tracing", "mng_disabled_tracing", "inherited_RT", "transfer_code_created", "transfer_code_used", "revoked_other_token", "suspended", "resumed", "name_changed", "description_changed", "tags_changed", "tokeninfo_subtree_history", "denied_capability", "denied_restriction", "denied_usage_limit", "denied_invalid_token", "anomaly_detected", "anomaly_policy_changed", "notification_settings_changed", "webhook_settings_changed"}
 
 // Events for Mytokens
 const (
@@ -85,5 +85,20 @@ const (
 	MTEventInheritedRT
 	MTEventTransferCodeCreated
 	MTEventTransferCodeUsed
+	MTEventRevokedOtherToken
+	MTEventSuspended
+	MTEventResumed
+	MTEventNameChanged
+	MTEventDescriptionChanged
+	MTEventTagsChanged
+	MTEventTokenInfoSubtreeHistory
+	MTEventDeniedCapability
+	MTEventDeniedRestriction
+	MTEventDeniedUsageLimit
+	MTEventDeniedInvalidToken
+	MTEventAnomalyDetected
+	MTEventAnomalyPolicyChanged
+	MTEventNotificationSettingsChanged
+	MTEventWebhookSettingsChanged
 	maxEvent
 )
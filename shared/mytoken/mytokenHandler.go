@@ -11,19 +11,24 @@ import (
 	"github.com/jmoiron/sqlx"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/oidc-mytoken/server/internal/bruteforce"
 	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/db"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo"
 	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/transfercoderepo"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/tree"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/refreshtokenrepo"
 	response "github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
 	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/notification"
 	"github.com/oidc-mytoken/server/internal/oidc/revoke"
 	"github.com/oidc-mytoken/server/internal/server/httpStatus"
 	"github.com/oidc-mytoken/server/internal/utils/ctxUtils"
+	"github.com/oidc-mytoken/server/internal/utils/geoip"
 	"github.com/oidc-mytoken/server/pkg/api/v0"
 	pkgModel "github.com/oidc-mytoken/server/shared/model"
+	"github.com/oidc-mytoken/server/shared/mytoken/anomaly"
 	eventService "github.com/oidc-mytoken/server/shared/mytoken/event"
 	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
 	mytoken "github.com/oidc-mytoken/server/shared/mytoken/pkg"
@@ -41,6 +46,13 @@ func HandleMytokenFromTransferCode(ctx *fiber.Ctx) *model.Response {
 		return model.ErrorToBadRequestErrorResponse(err)
 	}
 	log.Trace("Parsed request")
+	ip := ctxUtils.ClientIP(ctx)
+	if bruteforce.Locked(bruteforce.KindTransferCode, ip) {
+		return &model.Response{
+			Status:   fiber.StatusTooManyRequests,
+			Response: api.APIErrorTooManyFailedAttempts,
+		}
+	}
 	var errorRes *model.Response = nil
 	var tokenStr string
 	if err := db.Transact(func(tx *sqlx.Tx) error {
@@ -49,6 +61,7 @@ func HandleMytokenFromTransferCode(ctx *fiber.Ctx) *model.Response {
 			return err
 		}
 		if !status.Found {
+			bruteforce.RecordFailure(bruteforce.KindTransferCode, ip)
 			errorRes = &model.Response{
 				Status:   fiber.StatusUnauthorized,
 				Response: api.APIErrorBadTransferCode,
@@ -75,7 +88,7 @@ func HandleMytokenFromTransferCode(ctx *fiber.Ctx) *model.Response {
 	if !utils.IsJWT(tokenStr) {
 		tokenType = pkgModel.ResponseTypeShortToken
 	}
-	jwt, err := token.GetLongMytoken(tokenStr)
+	jwt, err := token.GetLongMytoken(tokenStr, ctxUtils.ClientIP(ctx))
 	if err != nil {
 		return model.ErrorToInternalServerErrorResponse(err)
 	}
@@ -111,15 +124,16 @@ func HandleMytokenFromMytoken(ctx *fiber.Ctx) *model.Response {
 	// GrantType already checked
 
 	if len(req.Mytoken) == 0 {
-		var err error
-		req.Mytoken, err = token.GetLongMytoken(ctx.Cookies("mytoken"))
-		if err != nil {
-			return &model.Response{
-				Status:   fiber.StatusUnauthorized,
-				Response: pkgModel.InvalidTokenError(err.Error()),
-			}
+		req.Mytoken = token.Token(ctx.Cookies("mytoken"))
+	}
+	jwt, err := token.GetLongMytoken(string(req.Mytoken), ctxUtils.ClientIP(ctx))
+	if err != nil {
+		return &model.Response{
+			Status:   fiber.StatusUnauthorized,
+			Response: pkgModel.InvalidTokenError(err.Error()),
 		}
 	}
+	req.Mytoken = jwt
 
 	mt, err := mytoken.ParseJWT(string(req.Mytoken))
 	if err != nil {
@@ -130,32 +144,30 @@ func HandleMytokenFromMytoken(ctx *fiber.Ctx) *model.Response {
 	}
 	log.Trace("Parsed mytoken")
 
-	revoked, dbErr := dbhelper.CheckTokenRevoked(nil, mt.ID, mt.SeqNo, mt.Rotation)
-	if dbErr != nil {
-		return model.ErrorToInternalServerErrorResponse(dbErr)
-	}
-	if revoked {
-		return &model.Response{
-			Status:   fiber.StatusUnauthorized,
-			Response: pkgModel.InvalidTokenError(""),
-		}
+	clientMetadata := *ctxUtils.ClientMetaData(ctx)
+	if errRes := mt.VerifyNotRevoked(nil, clientMetadata); errRes != nil {
+		return errRes
 	}
 	log.Trace("Checked token not revoked")
 
-	if ok := mt.VerifyCapabilities(api.CapabilityCreateMT); !ok {
-		return &model.Response{
-			Status:   fiber.StatusForbidden,
-			Response: api.APIErrorInsufficientCapabilities,
-		}
+	if errRes := mt.AuthorizeCapabilities(clientMetadata, api.CapabilityCreateMT); errRes != nil {
+		return errRes
 	}
 	log.Trace("Checked mytoken capabilities")
-	if ok := mt.Restrictions.VerifyForOther(nil, ctx.IP(), mt.ID); !ok {
+	if _, errRes := mt.RestrictionsForOther(nil, clientMetadata, api.CapabilityCreateMT); errRes != nil {
+		return errRes
+	}
+	log.Trace("Checked mytoken restrictions")
+	// Without a transaction passed, Check commits its own one, so the notifications can be sent right away
+	anomalies := anomaly.Check(nil, mt.ID, clientMetadata)
+	anomalies.Notify()
+	if anomalies.Suspended {
 		return &model.Response{
-			Status:   fiber.StatusForbidden,
-			Response: api.APIErrorUsageRestricted,
+			Status:   fiber.StatusUnauthorized,
+			Response: pkgModel.InvalidTokenError(anomaly.SuspendedReason),
 		}
 	}
-	log.Trace("Checked mytoken restrictions")
+	log.Trace("Checked for anomalies")
 
 	if req.Issuer == "" {
 		req.Issuer = mt.OIDCIssuer
@@ -168,7 +180,18 @@ func HandleMytokenFromMytoken(ctx *fiber.Ctx) *model.Response {
 		}
 		log.Trace("Checked issuer")
 	}
-	req.Restrictions.ReplaceThisIp(ctx.IP())
+	if err = req.ApplyProfiles(ctxUtils.ClientIP(ctx)); err != nil {
+		return &model.Response{
+			Status:   fiber.StatusBadRequest,
+			Response: pkgModel.BadRequestError(err.Error()),
+		}
+	}
+	if err = req.Restrictions.ReplaceMacros(ctxUtils.ClientIP(ctx)); err != nil {
+		return &model.Response{
+			Status:   fiber.StatusBadRequest,
+			Response: pkgModel.BadRequestError(err.Error()),
+		}
+	}
 	return handleMytokenFromMytoken(mt, req, ctxUtils.ClientMetaData(ctx), req.ResponseType)
 }
 
@@ -179,20 +202,43 @@ func handleMytokenFromMytoken(parent *mytoken.Mytoken, req *response.MytokenFrom
 	}
 	if err := db.Transact(func(tx *sqlx.Tx) error {
 		if len(parent.Restrictions) > 0 {
-			if err := parent.Restrictions.GetValidForOther(tx, networkData.IP, parent.ID)[0].UsedOther(tx, parent.ID); err != nil {
+			if _, err := parent.Restrictions.GetValidForOther(tx, networkData.IP, parent.ID, api.CapabilityCreateMT).ConsumeForOther(tx, parent.ID); err != nil {
 				return err
 			}
 		}
+		if err := tree.CheckSubtokenLimits(tx, parent.ID); err != nil {
+			return err
+		}
 		if err := ste.Store(tx, "Used grant_type mytoken"); err != nil {
 			return err
 		}
+		if config.Get().Features.UsageBudget.Enabled && len(parent.Restrictions) > 0 {
+			if err := ste.Token.Restrictions.LinkBudgets(tx, ste.ID, parent.Restrictions, parent.ID); err != nil {
+				return err
+			}
+		}
 		return eventService.LogEvents(tx, []eventService.MTEvent{
-			{event.FromNumber(event.MTEventInheritedRT, "Got RT from parent"), ste.ID},
-			{event.FromNumber(event.MTEventMTCreated, strings.TrimSpace(fmt.Sprintf("Created MT %s", req.Name))), parent.ID},
+			{Event: event.FromNumber(event.MTEventInheritedRT, "Got RT from parent"), MTID: ste.ID},
+			{Event: event.FromNumber(event.MTEventMTCreated, strings.TrimSpace(fmt.Sprintf("Created MT %s", req.Name))), MTID: parent.ID},
 		}, *networkData)
 	}); err != nil {
-		return model.ErrorToInternalServerErrorResponse(err)
+		if errors.Is(err, tree.ErrSubtokenLimitReached) {
+			return &model.Response{
+				Status: fiber.StatusForbidden,
+				Response: api.APIError{
+					Error:            api.ErrorSubtokenLimitReached,
+					ErrorDescription: err.Error(),
+				},
+			}
+		}
+		return parent.ConsumeErrorResponse(err, *networkData)
 	}
+	notification.Notify(ste.ID, api.NotificationSubtokenCreated, map[string]interface{}{
+		"name":                 req.Name,
+		"parent_management_id": parent.ID.ManagementID(),
+		"ip":                   networkData.IP,
+		"country":              geoip.CountryCode(networkData.IP),
+	})
 
 	res, err := ste.Token.ToTokenResponse(responseType, *networkData, "")
 	if err != nil {
@@ -251,9 +297,9 @@ func createMytokenEntry(parent *mytoken.Mytoken, req *response.MytokenFromMytoke
 	if c.Has(api.CapabilityCreateMT) {
 		sc = api.Tighten(capsFromParent, req.SubtokenCapabilities)
 	}
-	ste := mytokenrepo.NewMytokenEntry(
-		mytoken.NewMytoken(parent.OIDCSubject, parent.OIDCIssuer, r, c, sc),
-		req.Name, networkData)
+	mt := mytoken.NewMytoken(parent.OIDCSubject, parent.OIDCIssuer, r, c, sc)
+	mt.SubtokenLimits = parent.SubtokenLimits.ForSubtoken(req.SubtokenLimits)
+	ste := mytokenrepo.NewMytokenEntry(mt, req.Name, networkData)
 	encryptionKey, _, err := refreshtokenrepo.GetEncryptionKey(nil, parent.ID, string(req.Mytoken))
 	if err != nil {
 		return ste, model.ErrorToInternalServerErrorResponse(err)
@@ -266,8 +312,115 @@ func createMytokenEntry(parent *mytoken.Mytoken, req *response.MytokenFromMytoke
 	return ste, nil
 }
 
+// PresentedMytoken is a mytoken passed in a request together with its jwt, which is needed to decrypt its refresh
+// token
+type PresentedMytoken struct {
+	*mytoken.Mytoken
+	JWT token.Token
+}
+
+// RevokeAllMytokens revokes all mytokens of the user of the passed mytokens, which must all belong to the same user,
+// and deletes their refresh tokens. A refresh token can only be decrypted with a mytoken that uses it, so the refresh
+// tokens of the passed mytokens are also revoked at the provider, the others are only deleted.
+func RevokeAllMytokens(mts []PresentedMytoken, ip string) (*api.RevokeAllIssuerReport, *model.Response) {
+	provider, ok := config.Get().ProviderByIssuer[mts[0].OIDCIssuer]
+	if !ok {
+		return nil, &model.Response{
+			Status:   fiber.StatusBadRequest,
+			Response: api.APIErrorUnknownIssuer,
+		}
+	}
+	rts := make(map[uint64]string)
+	var revoked dbhelper.RevokedUserTokens
+	if err := db.Transact(func(tx *sqlx.Tx) error {
+		for _, mt := range mts {
+			rt, found, err := refreshtokenrepo.GetRefreshTokenEntry(tx, mt.ID, string(mt.JWT))
+			if err != nil {
+				return err
+			}
+			if found {
+				rts[rt.RTID] = rt.RT
+			}
+		}
+		var err error
+		if revoked, err = dbhelper.RevokeAllOfUser(tx, mts[0].ID, dbhelper.Revocation{
+			Reason: dbhelper.RevocationReasonRevokeAll,
+			Actor:  mts[0].ID.ManagementID(),
+			IP:     ip,
+		}); err != nil {
+			return err
+		}
+		for _, rtID := range revoked.RTIDs {
+			count, err := refreshtokenrepo.CountRTOccurrences(tx, rtID)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+			if err = refreshtokenrepo.DeleteRefreshToken(tx, rtID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, model.ErrorToInternalServerErrorResponse(err)
+	}
+	res := &api.RevokeAllIssuerReport{
+		OIDCIssuer:           mts[0].OIDCIssuer,
+		MytokensRevoked:      revoked.ManagementIDs,
+		RefreshTokensDeleted: len(revoked.RTIDs),
+		TransferCodesDeleted: revoked.TransferCodes,
+		ShortTokensDeleted:   revoked.ShortTokens,
+	}
+	if provider.Endpoints.Revocation == "" {
+		return res, nil
+	}
+	// The refresh tokens are revoked at the provider after the transaction, so that a failing provider does not
+	// prevent the revocation of the mytokens
+	for _, rt := range rts {
+		if rt == "" {
+			continue
+		}
+		if e := revoke.RefreshToken(provider, rt); e != nil {
+			apiError := e.Response.(api.APIError)
+			res.Errors = append(res.Errors, fmt.Sprintf("%s: %s", apiError.Error, apiError.ErrorDescription))
+			continue
+		}
+		res.RefreshTokensRevoked++
+		res.RefreshTokensDeleted--
+	}
+	return res, nil
+}
+
+// RevokeMytokenByID revokes a Mytoken that is only known by its id, e.g. because it was identified through its
+// management id. Since the refresh token cannot be decrypted without the Mytoken, it is not revoked at the provider;
+// it is only deleted from the database if no other Mytoken uses it.
+func RevokeMytokenByID(tx *sqlx.Tx, id mtid.MTID, recursive bool, rev dbhelper.Revocation) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		rtID, err := refreshtokenrepo.GetRTID(tx, id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+		if err = dbhelper.RevokeMT(tx, id, recursive, rev); err != nil {
+			return err
+		}
+		count, err := refreshtokenrepo.CountRTOccurrences(tx, rtID)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		return refreshtokenrepo.DeleteRefreshToken(tx, rtID)
+	})
+}
+
 // RevokeMytoken revokes a Mytoken
-func RevokeMytoken(tx *sqlx.Tx, id mtid.MTID, token token.Token, recursive bool, issuer string) *model.Response {
+func RevokeMytoken(tx *sqlx.Tx, id mtid.MTID, token token.Token, recursive bool, issuer, ip string) *model.Response {
 	provider, ok := config.Get().ProviderByIssuer[issuer]
 	if !ok {
 		return &model.Response{
@@ -287,7 +440,11 @@ func RevokeMytoken(tx *sqlx.Tx, id mtid.MTID, token token.Token, recursive bool,
 		if err != nil {
 			return err
 		}
-		if err = dbhelper.RevokeMT(tx, id, recursive); err != nil {
+		if err = dbhelper.RevokeMT(tx, id, recursive, dbhelper.Revocation{
+			Reason: dbhelper.RevocationReasonRevoked,
+			Actor:  id.ManagementID(),
+			IP:     ip,
+		}); err != nil {
 			return err
 		}
 		count, err := refreshtokenrepo.CountRTOccurrences(tx, rtID)
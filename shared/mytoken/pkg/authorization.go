@@ -0,0 +1,107 @@
+package mytoken
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+
+	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	serverModel "github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	"github.com/oidc-mytoken/server/shared/model"
+	eventService "github.com/oidc-mytoken/server/shared/mytoken/event"
+	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
+	"github.com/oidc-mytoken/server/shared/mytoken/restrictions"
+)
+
+// The following functions check if a request of the passed client may use the Mytoken. If it may not, they log the
+// denial and return the error response, so that every denied attempt is logged exactly once.
+
+// VerifyNotRevoked checks that the Mytoken is neither revoked nor suspended
+func (mt *Mytoken) VerifyNotRevoked(tx *sqlx.Tx, clientMetadata api.ClientMetaData) *serverModel.Response {
+	revoked, reason, err := dbhelper.CheckTokenRevoked(tx, mt.ID, mt.SeqNo, mt.Rotation)
+	if err != nil {
+		return serverModel.ErrorToInternalServerErrorResponse(err)
+	}
+	if revoked {
+		eventService.LogInvalidTokenDenial(mt.ID, reason, clientMetadata)
+		return &serverModel.Response{
+			Status:   fiber.StatusUnauthorized,
+			Response: model.InvalidTokenError(reason),
+		}
+	}
+	if mt.ExpiresAt > 0 {
+		if err = dbhelper.SetMissingExpiresAt(tx, mt.ID, mt.ExpiresAt); err != nil {
+			return serverModel.ErrorToInternalServerErrorResponse(err)
+		}
+	}
+	return nil
+}
+
+// AuthorizeCapabilities checks that the Mytoken has all the required capabilities
+func (mt *Mytoken) AuthorizeCapabilities(clientMetadata api.ClientMetaData, required ...api.Capability) *serverModel.Response {
+	for _, c := range required {
+		if !mt.VerifyCapabilities(c) {
+			eventService.LogCapabilityDenial(mt.ID, c, clientMetadata)
+			return &serverModel.Response{
+				Status:   fiber.StatusForbidden,
+				Response: api.APIErrorInsufficientCapabilities,
+			}
+		}
+	}
+	return nil
+}
+
+// RestrictionsForOther returns the restrictions of the Mytoken that allow the client to exercise the passed capability,
+// which is not obtaining an access token; with further capabilities, the restrictions must allow these as well. A
+// usage of the returned restrictions is consumed with restrictions.Restrictions.ConsumeForOther. If the Mytoken is
+// not restricted, nil is returned.
+func (mt *Mytoken) RestrictionsForOther(tx *sqlx.Tx, clientMetadata api.ClientMetaData, capability api.Capability, further ...api.Capability) (restrictions.Restrictions, *serverModel.Response) {
+	if len(mt.Restrictions) == 0 {
+		return nil, nil
+	}
+	candidates := mt.Restrictions
+	for _, c := range further {
+		candidates = candidates.WithCapability(c)
+	}
+	valid := candidates.GetValidForOther(tx, clientMetadata.IP, mt.ID, capability)
+	if len(valid) == 0 {
+		candidates.LogDenial(mt.ID, capability, clientMetadata)
+		return nil, &serverModel.Response{
+			Status:   fiber.StatusForbidden,
+			Response: api.APIErrorUsageRestricted,
+		}
+	}
+	return valid, nil
+}
+
+// RestrictionsForAT returns the restrictions of the Mytoken that allow the client to obtain an access token; a usage
+// of them is consumed with restrictions.Restrictions.ConsumeForAT. If the Mytoken is not restricted, nil is returned.
+func (mt *Mytoken) RestrictionsForAT(tx *sqlx.Tx, clientMetadata api.ClientMetaData) (restrictions.Restrictions, *serverModel.Response) {
+	if len(mt.Restrictions) == 0 {
+		return nil, nil
+	}
+	valid := mt.Restrictions.GetValidForAT(tx, clientMetadata.IP, mt.ID)
+	if len(valid) == 0 {
+		mt.Restrictions.LogDenial(mt.ID, api.CapabilityAT, clientMetadata)
+		return nil, &serverModel.Response{
+			Status:   fiber.StatusForbidden,
+			Response: api.APIErrorUsageRestricted,
+		}
+	}
+	return valid, nil
+}
+
+// ConsumeErrorResponse returns the error response for an error of a transaction that consumed a usage of the Mytoken;
+// if no usages were left, i.e. the error is restrictions.ErrUsageRestricted, the denial is logged
+func (mt *Mytoken) ConsumeErrorResponse(err error, clientMetadata api.ClientMetaData) *serverModel.Response {
+	if errors.Is(err, restrictions.ErrUsageRestricted) {
+		eventService.LogDenial(mt.ID, event.MTEventDeniedUsageLimit, "no usages left", clientMetadata)
+		return &serverModel.Response{
+			Status:   fiber.StatusForbidden,
+			Response: api.APIErrorUsageRestricted,
+		}
+	}
+	return serverModel.ErrorToInternalServerErrorResponse(err)
+}
@@ -44,6 +44,15 @@ func (i *MTID) Hash() string {
 	return i.hash
 }
 
+// ManagementID returns the public management id for this MTID; it can be used to identify a mytoken (e.g. for
+// revocation) without revealing the mytoken id
+func (i *MTID) ManagementID() string {
+	if !i.HashValid() {
+		return ""
+	}
+	return hashUtils.SHA256Hex([]byte(i.Hash()))
+}
+
 // Value implements the driver.Valuer interface
 func (i MTID) Value() (driver.Value, error) {
 	ns := db.NewNullString(i.Hash())
@@ -39,6 +39,7 @@ type Mytoken struct {
 	Capabilities         api.Capabilities          `json:"capabilities"`
 	SubtokenCapabilities api.Capabilities          `json:"subtoken_capabilities,omitempty"`
 	Rotation             *rotation.Rotation        `json:"rotation,omitempty"`
+	SubtokenLimits       *api.SubtokenLimits       `json:"subtoken_limits,omitempty"`
 	jwt                  string
 }
 
@@ -0,0 +1,276 @@
+package profiles
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	"github.com/oidc-mytoken/server/shared/mytoken/restrictions"
+	"github.com/oidc-mytoken/server/shared/utils"
+	"github.com/oidc-mytoken/server/shared/utils/unixtime"
+)
+
+// RestrictionProfiles returns all configured restriction profiles
+func RestrictionProfiles() (profiles []api.RestrictionProfile) {
+	for _, p := range config.Get().Profiles.Restrictions {
+		profiles = append(profiles, api.RestrictionProfile{
+			Name:         p.Name,
+			Description:  p.Description,
+			Restrictions: p.Restrictions,
+		})
+	}
+	return
+}
+
+// CapabilityProfiles returns all configured capability profiles
+func CapabilityProfiles() (profiles []api.CapabilityProfile) {
+	for _, p := range config.Get().Profiles.Capabilities {
+		profiles = append(profiles, api.CapabilityProfile{
+			Name:                 p.Name,
+			Description:          p.Description,
+			Capabilities:         api.NewCapabilities(p.Capabilities),
+			SubtokenCapabilities: api.NewCapabilities(p.SubtokenCapabilities),
+		})
+	}
+	return
+}
+
+// RestrictionProfile returns the restriction profile with the passed name
+func RestrictionProfile(name string) (api.RestrictionProfile, bool) {
+	for _, p := range RestrictionProfiles() {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return api.RestrictionProfile{}, false
+}
+
+// CapabilityProfile returns the capability profile with the passed name
+func CapabilityProfile(name string) (api.CapabilityProfile, bool) {
+	for _, p := range CapabilityProfiles() {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return api.CapabilityProfile{}, false
+}
+
+// ApplyRestrictionProfile merges the restriction profile with the passed name into the explicitly requested
+// restrictions. The macros of the profile and of the explicit restrictions are resolved for the passed ip. If no name is
+// given, the restrictions are not changed.
+func ApplyRestrictionProfile(name, ip string, r *restrictions.Restrictions) error {
+	if name == "" {
+		return nil
+	}
+	p, ok := RestrictionProfile(name)
+	if !ok {
+		return fmt.Errorf("unknown restriction_profile '%s'", name)
+	}
+	base := fromProfile(p.Restrictions)
+	if err := base.ReplaceMacros(ip); err != nil {
+		return err
+	}
+	if err := r.ReplaceMacros(ip); err != nil {
+		return err
+	}
+	merged, err := merge(base, *r)
+	if err != nil {
+		return err
+	}
+	*r = merged
+	return nil
+}
+
+// CheckRestrictionProfile checks that the restriction profile with the passed name exists and can be merged with the
+// explicitly requested restrictions, without changing them. This is used when the profile is only applied later.
+func CheckRestrictionProfile(name, ip string, r restrictions.Restrictions) error {
+	c := make(restrictions.Restrictions, len(r))
+	for i, rr := range r {
+		c[i] = copyRestriction(rr)
+	}
+	return ApplyRestrictionProfile(name, ip, &c)
+}
+
+// ApplyCapabilityProfile merges the capability profile with the passed name into the explicitly requested
+// capabilities and subtoken capabilities. If no name is given, the capabilities are not changed.
+func ApplyCapabilityProfile(name string, c, sc *api.Capabilities) error {
+	if name == "" {
+		return nil
+	}
+	p, ok := CapabilityProfile(name)
+	if !ok {
+		return fmt.Errorf("unknown capability_profile '%s'", name)
+	}
+	*c = mergeCapabilities(p.Capabilities, *c)
+	*sc = mergeCapabilities(p.SubtokenCapabilities, *sc)
+	return nil
+}
+
+func mergeCapabilities(a, b api.Capabilities) (res api.Capabilities) {
+	for _, c := range append(append(api.Capabilities{}, a...), b...) {
+		if !res.Has(c) {
+			res = append(res, c)
+		}
+	}
+	return
+}
+
+// MergeRestrictions merges the restrictions of a profile with explicitly requested restrictions. The relative nbf and
+// exp values of the profile are converted into absolute times. Every explicit restriction clause is combined with
+// every clause of the profile; explicit values can only tighten the profile's values. An error is returned if an
+// explicit clause does not overlap with a clause of the profile.
+func MergeRestrictions(profile api.Restrictions, explicit restrictions.Restrictions) (restrictions.Restrictions, error) {
+	if len(profile) == 0 {
+		return explicit, nil
+	}
+	return merge(fromProfile(profile), explicit)
+}
+
+func merge(base, explicit restrictions.Restrictions) (res restrictions.Restrictions, err error) {
+	if len(explicit) == 0 {
+		return base, nil
+	}
+	for _, e := range explicit {
+		for _, b := range base {
+			r, ok := tighten(copyRestriction(b), e)
+			if !ok {
+				return nil, fmt.Errorf("requested restrictions do not match the restriction_profile")
+			}
+			res = append(res, r)
+		}
+	}
+	return
+}
+
+func fromProfile(profile api.Restrictions) restrictions.Restrictions {
+	base := make(restrictions.Restrictions, len(profile))
+	for i, p := range profile {
+		r := restrictions.Restriction{Restriction: p}
+		r.Restriction.NotBefore = 0
+		r.Restriction.ExpiresAt = 0
+		if p.NotBefore != 0 {
+			r.NotBefore = unixtime.InSeconds(p.NotBefore)
+		}
+		if p.ExpiresAt != 0 {
+			r.ExpiresAt = unixtime.InSeconds(p.ExpiresAt)
+		}
+		base[i] = copyRestriction(r)
+	}
+	return base
+}
+
+// copyRestriction returns a deep copy, so that the profile's slices are not altered when the restrictions of a token
+// are modified
+func copyRestriction(r restrictions.Restriction) restrictions.Restriction {
+	r.Audiences = copyStrings(r.Audiences)
+	r.IPs = copyStrings(r.IPs)
+	r.GeoIPAllow = copyStrings(r.GeoIPAllow)
+	r.GeoIPDisallow = copyStrings(r.GeoIPDisallow)
+	if r.Capabilities != nil {
+		r.Capabilities = append(api.Capabilities{}, r.Capabilities...)
+	}
+	if r.UsagesAT != nil {
+		u := *r.UsagesAT
+		r.UsagesAT = &u
+	}
+	if r.UsagesOther != nil {
+		u := *r.UsagesOther
+		r.UsagesOther = &u
+	}
+	return r
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
+
+// tighten combines the profile clause r with the explicit clause e, so that the result is at least as strict as
+// both; ok is false if the two clauses cannot both be satisfied
+func tighten(r, e restrictions.Restriction) (_ restrictions.Restriction, ok bool) {
+	if e.NotBefore > r.NotBefore {
+		r.NotBefore = e.NotBefore
+	}
+	if e.ExpiresAt != 0 && (r.ExpiresAt == 0 || e.ExpiresAt < r.ExpiresAt) {
+		r.ExpiresAt = e.ExpiresAt
+	}
+	if r.ExpiresAt != 0 && r.NotBefore >= r.ExpiresAt {
+		return r, false
+	}
+	scopes, ok := intersect(utils.SplitIgnoreEmpty(r.Scope, " "), utils.SplitIgnoreEmpty(e.Scope, " "))
+	if !ok {
+		return r, false
+	}
+	r.Scope = strings.Join(scopes, " ")
+	if r.Audiences, ok = intersect(r.Audiences, e.Audiences); !ok {
+		return r, false
+	}
+	if r.GeoIPAllow, ok = intersect(r.GeoIPAllow, e.GeoIPAllow); !ok {
+		return r, false
+	}
+	if r.IPs, ok = intersectIPs(r.IPs, e.IPs); !ok {
+		return r, false
+	}
+	for _, c := range e.GeoIPDisallow {
+		if !utils.StringInSlice(c, r.GeoIPDisallow) {
+			r.GeoIPDisallow = append(r.GeoIPDisallow, c)
+		}
+	}
+	if utils.CompareNullableIntsWithNilAsInfinity(e.UsagesAT, r.UsagesAT) < 0 {
+		u := *e.UsagesAT
+		r.UsagesAT = &u
+	}
+	if utils.CompareNullableIntsWithNilAsInfinity(e.UsagesOther, r.UsagesOther) < 0 {
+		u := *e.UsagesOther
+		r.UsagesOther = &u
+	}
+	if len(e.Capabilities) > 0 {
+		if len(r.Capabilities) == 0 {
+			r.Capabilities = append(api.Capabilities{}, e.Capabilities...)
+		} else {
+			var caps api.Capabilities
+			for _, c := range e.Capabilities {
+				if r.Capabilities.Has(c) {
+					caps = append(caps, c)
+				}
+			}
+			if len(caps) == 0 {
+				return r, false
+			}
+			r.Capabilities = caps
+		}
+	}
+	return r, true
+}
+
+// intersect returns the values of the explicit list that are also in the profile's list; an empty list does not
+// restrict anything
+func intersect(profile, explicit []string) ([]string, bool) {
+	if len(explicit) == 0 {
+		return profile, true
+	}
+	if len(profile) == 0 {
+		return copyStrings(explicit), true
+	}
+	res := utils.IntersectSlices(profile, explicit)
+	return res, len(res) > 0
+}
+
+// intersectIPs returns the ips and subnets of the explicit list that are contained in the profile's list
+func intersectIPs(profile, explicit []string) (res []string, ok bool) {
+	if len(explicit) == 0 {
+		return profile, true
+	}
+	if len(profile) == 0 {
+		return copyStrings(explicit), true
+	}
+	for _, ip := range explicit {
+		if utils.IPIsIn(ip, profile) {
+			res = append(res, ip)
+		}
+	}
+	return res, len(res) > 0
+}
@@ -0,0 +1,131 @@
+package profiles
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	"github.com/oidc-mytoken/server/shared/mytoken/restrictions"
+	"github.com/oidc-mytoken/server/shared/utils"
+	"github.com/oidc-mytoken/server/shared/utils/unixtime"
+)
+
+var campusProfile = api.Restrictions{
+	{
+		ExpiresAt: 7 * 24 * 3600,
+		Scope:     "openid storage.read",
+		IPs:       []string{"192.0.2.0/24"},
+		UsagesAT:  utils.NewInt64(100),
+	},
+}
+
+func mustMerge(t *testing.T, profile api.Restrictions, explicit restrictions.Restrictions) restrictions.Restrictions {
+	merged, err := MergeRestrictions(profile, explicit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return merged
+}
+
+func TestMergeRestrictions_NoProfile(t *testing.T) {
+	explicit := restrictions.Restrictions{{Restriction: api.Restriction{Scope: "openid"}}}
+	merged := mustMerge(t, nil, explicit)
+	if len(merged) != 1 || merged[0].Scope != "openid" {
+		t.Errorf("Expected explicit restrictions '%+v', got '%+v'", explicit, merged)
+	}
+}
+
+func TestMergeRestrictions_OnlyProfile(t *testing.T) {
+	merged := mustMerge(t, campusProfile, nil)
+	if len(merged) != 1 {
+		t.Fatalf("Expected one restriction, got '%+v'", merged)
+	}
+	m := merged[0]
+	if m.Scope != "openid storage.read" || m.IPs[0] != "192.0.2.0/24" || *m.UsagesAT != 100 {
+		t.Errorf("Expected restriction from profile, got '%+v'", m)
+	}
+	exp := unixtime.InSeconds(7 * 24 * 3600)
+	if m.ExpiresAt < exp-5 || m.ExpiresAt > exp {
+		t.Errorf("Expected exp to be relative to now (%d), got %d", exp, m.ExpiresAt)
+	}
+	if m.Restriction.ExpiresAt != 0 {
+		t.Errorf("Expected relative exp to be cleared, got %d", m.Restriction.ExpiresAt)
+	}
+}
+
+func TestMergeRestrictions_ExplicitTightens(t *testing.T) {
+	explicit := restrictions.Restrictions{
+		{Restriction: api.Restriction{Scope: "openid", UsagesAT: utils.NewInt64(10)}},
+		{ExpiresAt: 100, Restriction: api.Restriction{IPs: []string{"192.0.2.1"}, GeoIPDisallow: []string{"XX"}}},
+	}
+	merged := mustMerge(t, campusProfile, explicit)
+	if len(merged) != 2 {
+		t.Fatalf("Expected two restrictions, got '%+v'", merged)
+	}
+	if merged[0].Scope != "openid" || *merged[0].UsagesAT != 10 || merged[0].IPs[0] != "192.0.2.0/24" || merged[0].ExpiresAt == 0 {
+		t.Errorf("Unexpected first restriction '%+v'", merged[0])
+	}
+	if merged[1].Scope != "openid storage.read" || merged[1].IPs[0] != "192.0.2.1" || merged[1].ExpiresAt != 100 || *merged[1].UsagesAT != 100 || merged[1].GeoIPDisallow[0] != "XX" {
+		t.Errorf("Unexpected second restriction '%+v'", merged[1])
+	}
+}
+
+func TestMergeRestrictions_ExplicitCannotLoosen(t *testing.T) {
+	explicit := restrictions.Restrictions{
+		{
+			ExpiresAt: unixtime.InSeconds(365 * 24 * 3600),
+			Restriction: api.Restriction{
+				Scope:    "openid storage.read storage.modify",
+				UsagesAT: utils.NewInt64(1000),
+			},
+		},
+	}
+	merged := mustMerge(t, campusProfile, explicit)
+	if len(merged) != 1 {
+		t.Fatalf("Expected one restriction, got '%+v'", merged)
+	}
+	m := merged[0]
+	if m.ExpiresAt > unixtime.InSeconds(7*24*3600) {
+		t.Errorf("Expected exp of the profile, got %d", m.ExpiresAt)
+	}
+	if m.Scope != "openid storage.read" || *m.UsagesAT != 100 {
+		t.Errorf("Expected restriction to keep the profile's limits, got '%+v'", m)
+	}
+}
+
+func TestMergeRestrictions_NoOverlap(t *testing.T) {
+	for _, explicit := range []restrictions.Restrictions{
+		{{Restriction: api.Restriction{Scope: "storage.modify"}}},
+		{{Restriction: api.Restriction{IPs: []string{"198.51.100.1"}}}},
+		{{NotBefore: unixtime.InSeconds(8 * 24 * 3600)}},
+	} {
+		if _, err := MergeRestrictions(campusProfile, explicit); err == nil {
+			t.Errorf("Expected error for restrictions '%+v'", explicit)
+		}
+	}
+}
+
+func TestMergeRestrictions_ProfileNotModified(t *testing.T) {
+	merged := mustMerge(t, campusProfile, nil)
+	merged.ReplaceThisIp("192.0.2.1")
+	merged[0].IPs[0] = "this"
+	*merged[0].UsagesAT = 1
+	if campusProfile[0].IPs[0] != "192.0.2.0/24" || *campusProfile[0].UsagesAT != 100 {
+		t.Errorf("Profile was modified: '%+v'", campusProfile[0])
+	}
+}
+
+func TestMergeCapabilities(t *testing.T) {
+	merged := mergeCapabilities(
+		api.Capabilities{api.CapabilityAT, api.CapabilityTokeninfoIntrospect},
+		api.Capabilities{api.CapabilityTokeninfoIntrospect, api.CapabilityCreateMT},
+	)
+	exp := api.Capabilities{api.CapabilityAT, api.CapabilityTokeninfoIntrospect, api.CapabilityCreateMT}
+	if len(merged) != len(exp) {
+		t.Fatalf("Expected '%v', got '%v'", exp, merged)
+	}
+	for i, c := range exp {
+		if merged[i] != c {
+			t.Errorf("Expected '%v', got '%v'", exp, merged)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package restrictions
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
+	"github.com/oidc-mytoken/server/shared/utils/unixtime"
+)
+
+func TestDenial(t *testing.T) {
+	tests := []struct {
+		name          string
+		restrictions  Restrictions
+		capability    api.Capability
+		expectedEvent int
+	}{
+		{
+			name:          "Capability",
+			restrictions:  Restrictions{{Restriction: api.Restriction{Capabilities: api.Capabilities{api.CapabilityAT}}}},
+			capability:    api.CapabilityCreateMT,
+			expectedEvent: event.MTEventDeniedRestriction,
+		},
+		{
+			name:          "Expired",
+			restrictions:  Restrictions{{ExpiresAt: unixtime.InSeconds(-60)}},
+			capability:    api.CapabilityAT,
+			expectedEvent: event.MTEventDeniedRestriction,
+		},
+		{
+			name:          "IP",
+			restrictions:  Restrictions{{Restriction: api.Restriction{IPs: []string{"192.168.0.1"}}}},
+			capability:    api.CapabilityAT,
+			expectedEvent: event.MTEventDeniedRestriction,
+		},
+		{
+			name:          "UsageLimit",
+			restrictions:  Restrictions{{Restriction: api.Restriction{IPs: []string{"127.0.0.1"}}}},
+			capability:    api.CapabilityAT,
+			expectedEvent: event.MTEventDeniedUsageLimit,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			denial, reason := test.restrictions.denial("127.0.0.1", test.capability)
+			if denial != test.expectedEvent {
+				t.Errorf("Expected event '%s', but got '%s' (%s)", event.AllEvents[test.expectedEvent], event.AllEvents[denial], reason)
+			}
+			if reason == "" {
+				t.Error("Expected a reason")
+			}
+		})
+	}
+}
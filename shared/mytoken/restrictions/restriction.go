@@ -3,17 +3,23 @@ package restrictions
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
+	"net"
 	"strings"
 
 	"github.com/jinzhu/copier"
 	"github.com/jmoiron/sqlx"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/oidc-mytoken/server/internal/db"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
 	"github.com/oidc-mytoken/server/internal/utils/geoip"
 	"github.com/oidc-mytoken/server/internal/utils/hashUtils"
 	"github.com/oidc-mytoken/server/pkg/api/v0"
+	eventService "github.com/oidc-mytoken/server/shared/mytoken/event"
+	event "github.com/oidc-mytoken/server/shared/mytoken/event/pkg"
 	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
 	"github.com/oidc-mytoken/server/shared/utils"
 	"github.com/oidc-mytoken/server/shared/utils/unixtime"
@@ -72,96 +78,167 @@ func (r *Restriction) verifyGeoIPDisallow(ip string) bool {
 	}
 	return !utils.StringInSlice(geoip.CountryCode(ip), disallow)
 }
-func (r *Restriction) getATUsageCounts(tx *sqlx.Tx, myID mtid.MTID) (*int64, error) {
+
+// getUsages returns the usages of this restriction from the passed usages of a mytoken; nil is returned if the
+// restriction was not used before
+func (r *Restriction) getUsages(usages map[string]mytokenrepohelper.TokenUsage) (*mytokenrepohelper.TokenUsage, error) {
 	hash, err := r.hash()
 	if err != nil {
 		return nil, err
 	}
-	return mytokenrepohelper.GetTokenUsagesAT(tx, myID, string(hash))
+	u, found := usages[string(hash)]
+	if !found {
+		return nil, nil
+	}
+	return &u, nil
 }
-func (r *Restriction) verifyATUsageCounts(tx *sqlx.Tx, myID mtid.MTID) bool {
+func (r *Restriction) verifyATUsageCounts(usages map[string]mytokenrepohelper.TokenUsage) bool {
 	log.Trace("Verifying AT usage count")
 	if r.UsagesAT == nil {
 		return true
 	}
-	usages, err := r.getATUsageCounts(tx, myID)
+	u, err := r.getUsages(usages)
 	if err != nil {
 		log.WithError(err).Error()
 		return false
 	}
-	if usages == nil {
+	if u == nil {
 		//  was not used before
-		log.WithFields(map[string]interface{}{
-			"myID": myID.String(),
-		}).Debug("Did not found restriction in database; it was not used before")
+		log.Debug("Did not found restriction in database; it was not used before")
 		return *r.UsagesAT > 0
 	}
 	log.WithFields(map[string]interface{}{
-		"myID":       myID.String(),
-		"used":       *usages,
-		"usageLimit": *r.UsagesAT,
+		"used":            u.UsagesAT,
+		"usedDescendants": u.DescendantUsagesAT,
+		"usageLimit":      *r.UsagesAT,
 	}).Debug("Found restriction usage in db.")
-	return *usages < *r.UsagesAT
-}
-func (r *Restriction) getOtherUsageCounts(tx *sqlx.Tx, myID mtid.MTID) (*int64, error) {
-	hash, err := r.hash()
-	if err != nil {
-		return nil, err
-	}
-	return mytokenrepohelper.GetTokenUsagesOther(tx, myID, string(hash))
+	return u.UsagesAT+u.DescendantUsagesAT < *r.UsagesAT
 }
-func (r *Restriction) verifyOtherUsageCounts(tx *sqlx.Tx, id mtid.MTID) bool {
+func (r *Restriction) verifyOtherUsageCounts(usages map[string]mytokenrepohelper.TokenUsage) bool {
 	log.Trace("Verifying other usage count")
 	if r.UsagesOther == nil {
 		return true
 	}
-	usages, err := r.getOtherUsageCounts(tx, id)
+	u, err := r.getUsages(usages)
 	if err != nil {
 		log.WithError(err).Error()
 		return false
 	}
-	if usages == nil {
+	if u == nil {
 		// was not used before
-		log.WithFields(map[string]interface{}{
-			"id": id.String(),
-		}).Debug("Did not found restriction in database; it was not used before")
+		log.Debug("Did not found restriction in database; it was not used before")
 		return *r.UsagesOther > 0
 	}
 	log.WithFields(map[string]interface{}{
-		"id":         id.String(),
-		"used":       *usages,
-		"usageLimit": *r.UsagesAT,
+		"used":            u.UsagesOther,
+		"usedDescendants": u.DescendantUsagesOther,
+		"usageLimit":      *r.UsagesOther,
 	}).Debug("Found restriction usage in db.")
-	return *usages < *r.UsagesOther
+	return u.UsagesOther+u.DescendantUsagesOther < *r.UsagesOther
 }
 func (r *Restriction) verify(ip string) bool {
 	return r.verifyTimeBased() &&
 		r.verifyIPBased(ip)
 }
-func (r *Restriction) verifyAT(tx *sqlx.Tx, ip string, id mtid.MTID) bool {
-	return r.verify(ip) && r.verifyATUsageCounts(tx, id)
-}
-func (r *Restriction) verifyOther(tx *sqlx.Tx, ip string, id mtid.MTID) bool {
-	return r.verify(ip) &&
-		r.verifyOtherUsageCounts(tx, id)
+
+// ConsumeAT atomically reserves one usage of this restriction for obtaining an access token; it returns false if the
+// usage limit is already reached
+func (r *Restriction) ConsumeAT(tx *sqlx.Tx, id mtid.MTID) (bool, error) {
+	js, err := json.Marshal(r)
+	if err != nil {
+		return false, err
+	}
+	return mytokenrepohelper.ConsumeTokenUsageAT(tx, id, js, r.UsagesAT)
 }
 
-// UsedAT will update the usages_AT value for this restriction; it should be called after this restriction was used to obtain an access token;
-func (r *Restriction) UsedAT(tx *sqlx.Tx, id mtid.MTID) error {
+// ReleaseAT gives back a usage that was reserved with ConsumeAT, e.g. because obtaining the access token failed
+func (r *Restriction) ReleaseAT(tx *sqlx.Tx, id mtid.MTID) error {
 	js, err := json.Marshal(r)
 	if err != nil {
 		return err
 	}
-	return mytokenrepohelper.IncreaseTokenUsageAT(tx, id, js)
+	return mytokenrepohelper.ReleaseTokenUsageAT(tx, id, js)
 }
 
-// UsedOther will update the usages_other value for this restriction; it should be called after this restriction was used for other reasons than obtaining an access token;
-func (r *Restriction) UsedOther(tx *sqlx.Tx, id mtid.MTID) error {
+// ConsumeOther atomically reserves one usage of this restriction for other reasons than obtaining an access token;
+// it returns false if the usage limit is already reached
+func (r *Restriction) ConsumeOther(tx *sqlx.Tx, id mtid.MTID) (bool, error) {
 	js, err := json.Marshal(r)
 	if err != nil {
-		return err
+		return false, err
+	}
+	return mytokenrepohelper.ConsumeTokenUsageOther(tx, id, js, r.UsagesOther)
+}
+
+// LinkBudgets links each of these restrictions of a subtoken with a usage limit to the restriction of the parent it
+// was derived from, so that the usages of the subtoken also count against the parent's usage limits
+func (r Restrictions) LinkBudgets(tx *sqlx.Tx, id mtid.MTID, parent Restrictions, parentID mtid.MTID) error {
+	return db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
+		for _, rr := range r {
+			p := rr.budgetOrigin(parent)
+			if p == nil {
+				continue
+			}
+			js, err := json.Marshal(rr)
+			if err != nil {
+				return err
+			}
+			parentJS, err := json.Marshal(p)
+			if err != nil {
+				return err
+			}
+			if err = mytokenrepohelper.LinkTokenUsageBudget(tx, id, js, parentID, parentJS); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// budgetOrigin returns the first of the parent's restrictions with a usage limit this restriction is tighter than
+func (r *Restriction) budgetOrigin(parent Restrictions) *Restriction {
+	for i, p := range parent {
+		if p.UsagesAT == nil && p.UsagesOther == nil {
+			continue
+		}
+		if r.isTighterThan(p) {
+			return &parent[i]
+		}
+	}
+	return nil
+}
+
+// ErrUsageRestricted is returned if none of the restrictions has usages left
+var ErrUsageRestricted = errors.New("usage restricted")
+
+// ConsumeForAT reserves a usage of the first of these restrictions that has usages left for obtaining an access token
+// and returns this restriction; if no restriction can be used ErrUsageRestricted is returned
+func (r Restrictions) ConsumeForAT(tx *sqlx.Tx, id mtid.MTID) (*Restriction, error) {
+	for i := range r {
+		ok, err := r[i].ConsumeAT(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &r[i], nil
+		}
+	}
+	return nil, ErrUsageRestricted
+}
+
+// ConsumeForOther reserves a usage of the first of these restrictions that has usages left for other reasons than
+// obtaining an access token and returns this restriction; if no restriction can be used ErrUsageRestricted is returned
+func (r Restrictions) ConsumeForOther(tx *sqlx.Tx, id mtid.MTID) (*Restriction, error) {
+	for i := range r {
+		ok, err := r[i].ConsumeOther(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &r[i], nil
+		}
 	}
-	return mytokenrepohelper.IncreaseTokenUsageOther(tx, id, js)
+	return nil, ErrUsageRestricted
 }
 
 // VerifyForAT verifies if this restrictions can be used to obtain an access token
@@ -172,29 +249,59 @@ func (r Restrictions) VerifyForAT(tx *sqlx.Tx, ip string, id mtid.MTID) bool {
 	return len(r.GetValidForAT(tx, ip, id)) > 0
 }
 
-// VerifyForOther verifies if this restrictions can be used for other actions than obtaining an access token
-func (r Restrictions) VerifyForOther(tx *sqlx.Tx, ip string, id mtid.MTID) bool {
+// VerifyForOther verifies if this restrictions can be used to exercise the passed capability, which is not obtaining
+// an access token
+func (r Restrictions) VerifyForOther(tx *sqlx.Tx, ip string, id mtid.MTID, capability api.Capability) bool {
 	if len(r) == 0 {
 		return true
 	}
-	return len(r.GetValidForOther(tx, ip, id)) > 0
+	return len(r.GetValidForOther(tx, ip, id, capability)) > 0
 }
 
 // GetValidForAT returns the subset of Restrictions that can be used to obtain an access token
-func (r Restrictions) GetValidForAT(tx *sqlx.Tx, ip string, myID mtid.MTID) (ret Restrictions) {
+func (r Restrictions) GetValidForAT(tx *sqlx.Tx, ip string, myID mtid.MTID) Restrictions {
+	return r.WithCapability(api.CapabilityAT).getValid(tx, ip, myID, func(rr *Restriction) bool { return rr.UsagesAT != nil }, (*Restriction).verifyATUsageCounts)
+}
+
+// GetValidForOther returns the subset of Restrictions that can be used to exercise the passed capability, which is not
+// obtaining an access token
+func (r Restrictions) GetValidForOther(tx *sqlx.Tx, ip string, myID mtid.MTID, capability api.Capability) Restrictions {
+	return r.WithCapability(capability).getValid(tx, ip, myID, func(rr *Restriction) bool { return rr.UsagesOther != nil }, (*Restriction).verifyOtherUsageCounts)
+}
+
+// WithCapability returns the subset of Restrictions that authorise the specified capability
+func (r Restrictions) WithCapability(capability api.Capability) (ret Restrictions) {
 	for _, rr := range r {
-		if rr.verifyAT(tx, ip, myID) {
-			log.Trace("Found a valid restriction")
+		if len(rr.Capabilities) == 0 || rr.Capabilities.Has(capability) {
 			ret = append(ret, rr)
 		}
 	}
 	return
 }
 
-// GetValidForOther returns the subset of Restrictions that can be used for other actions than obtaining an access token
-func (r Restrictions) GetValidForOther(tx *sqlx.Tx, ip string, myID mtid.MTID) (ret Restrictions) {
+// getValid returns the subset of Restrictions that are valid for the given ip and have usages left. The usages of all
+// restrictions are loaded with a single query and only if at least one of the otherwise valid restrictions has a usage
+// limit.
+func (r Restrictions) getValid(tx *sqlx.Tx, ip string, myID mtid.MTID, hasLimit func(*Restriction) bool, verifyUsages func(*Restriction, map[string]mytokenrepohelper.TokenUsage) bool) (ret Restrictions) {
+	var candidates Restrictions
+	limited := false
 	for _, rr := range r {
-		if rr.verifyOther(tx, ip, myID) {
+		if rr.verify(ip) {
+			candidates = append(candidates, rr)
+			limited = limited || hasLimit(&rr)
+		}
+	}
+	if !limited {
+		return candidates
+	}
+	usages, err := mytokenrepohelper.GetTokenUsages(tx, myID)
+	if err != nil {
+		log.WithError(err).Error()
+		return nil
+	}
+	for _, rr := range candidates {
+		if verifyUsages(&rr, usages) {
+			log.Trace("Found a valid restriction")
 			ret = append(ret, rr)
 		}
 	}
@@ -370,11 +477,52 @@ func Tighten(old, wanted Restrictions) (res Restrictions, ok bool) {
 	return
 }
 
-// ReplaceThisIp replaces the special value 'this' with the given ip.
-func (r *Restrictions) ReplaceThisIp(ip string) {
+// ReplaceMacros resolves all macros in the restrictions for a request from the given ip, i.e. 'this' and
+// 'this/<prefix length>' in the ip list and 'this' in the geo ip lists.
+func (r *Restrictions) ReplaceMacros(ip string) error {
+	if err := r.ReplaceThisIp(ip); err != nil {
+		return err
+	}
+	return r.ReplaceThisCountry(ip)
+}
+
+// ReplaceThisIp replaces the special value 'this' with the given ip and 'this/<prefix length>' with the subnet of
+// the given ip.
+func (r *Restrictions) ReplaceThisIp(ip string) error {
+	ip = utils.NormalizeIP(ip)
 	for _, rr := range *r {
+		for i, rip := range rr.IPs {
+			if !strings.HasPrefix(strings.ToLower(rip), "this/") {
+				continue
+			}
+			_, subnet, err := net.ParseCIDR(ip + rip[len("this"):])
+			if err != nil {
+				return fmt.Errorf("invalid ip '%s' for client ip '%s'", rip, ip)
+			}
+			rr.IPs[i] = subnet.String()
+		}
 		utils.ReplaceStringInSlice(&rr.IPs, "this", ip, false)
 	}
+	return nil
+}
+
+// ReplaceThisCountry replaces the special value 'this' in the geo ip allow and disallow lists with the country code
+// of the given ip.
+func (r *Restrictions) ReplaceThisCountry(ip string) error {
+	country := ""
+	for _, rr := range *r {
+		if !utils.StringInSliceIgnoreCase("this", rr.GeoIPAllow) && !utils.StringInSliceIgnoreCase("this", rr.GeoIPDisallow) {
+			continue
+		}
+		if country == "" {
+			if country = geoip.CountryCode(ip); country == "" || country == "-" { // ip2location uses '-' for unknown
+				return fmt.Errorf("could not determine the country of ip '%s'", ip)
+			}
+		}
+		utils.ReplaceStringInSlice(&rr.GeoIPAllow, "this", country, false)
+		utils.ReplaceStringInSlice(&rr.GeoIPDisallow, "this", country, false)
+	}
+	return nil
 }
 
 func (r *Restrictions) removeIndex(i int) { // skipcq SCC-U1000
@@ -419,5 +567,45 @@ func (r *Restriction) isTighterThan(b Restriction) bool {
 	if utils.CompareNullableIntsWithNilAsInfinity(r.UsagesOther, b.UsagesOther) > 0 {
 		return false
 	}
+	if len(r.Capabilities) == 0 && len(b.Capabilities) > 0 || !r.Capabilities.IsSubsetOf(b.Capabilities) && len(b.Capabilities) != 0 {
+		return false
+	}
 	return true
 }
+
+// denial returns the denial event and its reason for a request from the passed ip that is not allowed by any of the
+// Restrictions to exercise the passed capability
+func (r Restrictions) denial(ip string, capability api.Capability) (int, string) {
+	steps := []struct {
+		check  func(*Restriction) bool
+		reason string
+	}{
+		{(*Restriction).verifyTimeBased, "restrictions expired or not yet valid"},
+		{func(rr *Restriction) bool { return rr.verifyIPs(ip) }, "ip not allowed by restrictions"},
+		{func(rr *Restriction) bool { return rr.verifyGeoIP(ip) }, "geo location not allowed by restrictions"},
+	}
+	candidates := r.WithCapability(capability)
+	if len(candidates) == 0 {
+		return event.MTEventDeniedRestriction, fmt.Sprintf("no restriction allows capability '%s'", capability.Name)
+	}
+	for _, s := range steps {
+		var next Restrictions
+		for _, rr := range candidates {
+			if s.check(&rr) {
+				next = append(next, rr)
+			}
+		}
+		if len(next) == 0 {
+			return event.MTEventDeniedRestriction, s.reason
+		}
+		candidates = next
+	}
+	return event.MTEventDeniedUsageLimit, "no usages left"
+}
+
+// LogDenial logs that the Restrictions did not allow a request from the passed client to exercise the passed
+// capability
+func (r Restrictions) LogDenial(id mtid.MTID, capability api.Capability, clientMetaData api.ClientMetaData) {
+	denial, reason := r.denial(clientMetaData.IP, capability)
+	eventService.LogDenial(id, denial, reason, clientMetaData)
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/oidc-mytoken/server/pkg/api/v0"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
 	"github.com/oidc-mytoken/server/shared/utils"
 	"github.com/oidc-mytoken/server/shared/utils/unixtime"
 )
@@ -419,6 +420,28 @@ func TestIsTighterThanIP(t *testing.T) {
 	testIsTighter(t, d, e, true)
 	testIsTighter(t, e, d, false)
 }
+func TestIsTighterThanIPv6(t *testing.T) {
+	a := Restriction{Restriction: api.Restriction{IPs: []string{"2001:db8::1"}}}
+	b := Restriction{Restriction: api.Restriction{IPs: []string{"2001:db8::/64"}}}
+	c := Restriction{Restriction: api.Restriction{IPs: []string{"2001:db8::/32"}}}
+	d := Restriction{Restriction: api.Restriction{IPs: []string{"2001:db9::/64", "2001:db8::1"}}}
+	testIsTighter(t, a, b, true)
+	testIsTighter(t, b, a, false)
+	testIsTighter(t, b, c, true)
+	testIsTighter(t, c, b, false)
+	testIsTighter(t, a, c, true)
+	testIsTighter(t, d, c, false)
+	testIsTighter(t, a, d, true)
+}
+func TestIsTighterThanIPv4MappedV6(t *testing.T) {
+	a := Restriction{Restriction: api.Restriction{IPs: []string{"::ffff:192.168.0.12"}}}
+	b := Restriction{Restriction: api.Restriction{IPs: []string{"192.168.0.0/24"}}}
+	c := Restriction{Restriction: api.Restriction{IPs: []string{"::ffff:192.168.0.0/120"}}}
+	testIsTighter(t, a, b, true)
+	testIsTighter(t, b, a, false)
+	testIsTighter(t, b, c, true)
+	testIsTighter(t, c, b, true)
+}
 func TestIsTighterThanIPOneEmpty(t *testing.T) {
 	a := Restriction{}
 	b := Restriction{Restriction: api.Restriction{IPs: []string{"192.168.0.12", "192.168.0.14"}}}
@@ -489,6 +512,21 @@ func TestIsTighterThanUsagesOtherOneEmpty(t *testing.T) {
 	testIsTighter(t, a, b, false)
 	testIsTighter(t, b, a, true)
 }
+func TestIsTighterThanCapabilities(t *testing.T) {
+	a := Restriction{Restriction: api.Restriction{Capabilities: api.Capabilities{api.CapabilityAT, api.CapabilityListMT}}}
+	b := Restriction{Restriction: api.Restriction{Capabilities: api.Capabilities{api.CapabilityAT}}}
+	c := Restriction{Restriction: api.Restriction{Capabilities: api.Capabilities{api.CapabilityTokeninfoTree}}}
+	testIsTighter(t, a, b, false)
+	testIsTighter(t, b, a, true)
+	testIsTighter(t, a, c, false)
+	testIsTighter(t, c, a, false)
+}
+func TestIsTighterThanCapabilitiesOneEmpty(t *testing.T) {
+	a := Restriction{}
+	b := Restriction{Restriction: api.Restriction{Capabilities: api.Capabilities{api.CapabilityAT}}}
+	testIsTighter(t, a, b, false)
+	testIsTighter(t, b, a, true)
+}
 func TestIsTighterThanMultiple1(t *testing.T) {
 	a := Restriction{}
 	b := Restriction{
@@ -846,3 +884,102 @@ func TestRestriction_VerifyTimeBased(t *testing.T) {
 		}
 	}
 }
+
+func TestRestrictions_ReplaceThisIp(t *testing.T) {
+	cases := []struct {
+		ip  string
+		exp string
+	}{
+		{ip: "192.168.0.12", exp: "192.168.0.12"},
+		{ip: "2001:db8:0:0:0:0:0:1", exp: "2001:db8::1"},
+		{ip: "::ffff:192.168.0.12", exp: "192.168.0.12"},
+	}
+	for _, c := range cases {
+		r := Restrictions{
+			{Restriction: api.Restriction{IPs: []string{"this", "10.0.0.0/8"}}},
+			{Restriction: api.Restriction{IPs: []string{"This"}}},
+		}
+		r.ReplaceThisIp(c.ip)
+		if r[0].IPs[0] != c.exp || r[0].IPs[1] != "10.0.0.0/8" || r[1].IPs[0] != c.exp {
+			t.Errorf("For ip '%s' expected 'this' to be replaced with '%s', but got '%+v'", c.ip, c.exp, r)
+		}
+		if !r[0].verifyIPs(c.ip) {
+			t.Errorf("Expected ip '%s' to verify after replacing 'this'", c.ip)
+		}
+	}
+}
+
+func TestRestrictions_ReplaceThisIpSubnet(t *testing.T) {
+	cases := []struct {
+		ip  string
+		r   string
+		exp string
+	}{
+		{ip: "192.168.0.12", r: "this/24", exp: "192.168.0.0/24"},
+		{ip: "192.168.0.12", r: "This/16", exp: "192.168.0.0/16"},
+		{ip: "2001:db8:1:2::1", r: "this/48", exp: "2001:db8:1::/48"},
+		{ip: "::ffff:192.168.0.12", r: "this/24", exp: "192.168.0.0/24"},
+	}
+	for _, c := range cases {
+		r := Restrictions{{Restriction: api.Restriction{IPs: []string{c.r}}}}
+		if err := r.ReplaceThisIp(c.ip); err != nil {
+			t.Errorf("Unexpected error for '%s' and '%s': %s", c.r, c.ip, err)
+			continue
+		}
+		if r[0].IPs[0] != c.exp {
+			t.Errorf("For '%s' and '%s' expected '%s', got '%s'", c.r, c.ip, c.exp, r[0].IPs[0])
+		}
+	}
+}
+
+func TestRestrictions_ReplaceThisIpSubnetInvalid(t *testing.T) {
+	for _, ip := range []string{"this/33", "this/abc", "this/"} {
+		r := Restrictions{{Restriction: api.Restriction{IPs: []string{ip}}}}
+		if err := r.ReplaceThisIp("192.168.0.12"); err == nil {
+			t.Errorf("Expected error for '%s'", ip)
+		}
+	}
+}
+
+func TestRestrictions_ReplaceThisCountryUnknown(t *testing.T) {
+	r := Restrictions{{Restriction: api.Restriction{GeoIPAllow: []string{"this"}}}}
+	if err := r.ReplaceThisCountry("192.168.0.12"); err == nil {
+		t.Error("Expected error if the country cannot be determined")
+	}
+	r = Restrictions{{Restriction: api.Restriction{GeoIPAllow: []string{"de"}}}}
+	if err := r.ReplaceThisCountry("192.168.0.12"); err != nil {
+		t.Errorf("Unexpected error without macro: %s", err)
+	}
+}
+
+func TestRestrictions_UnmarshalRelativeTime(t *testing.T) {
+	var r Restrictions
+	if err := json.Unmarshal([]byte(`[{"nbf":"+1h","exp":"+7d"}]`), &r); err != nil {
+		t.Fatal(err)
+	}
+	nbf := unixtime.InSeconds(3600)
+	exp := unixtime.InSeconds(7 * 24 * 3600)
+	if r[0].NotBefore < nbf-5 || r[0].NotBefore > nbf || r[0].ExpiresAt < exp-5 || r[0].ExpiresAt > exp {
+		t.Errorf("Expected nbf '%d' and exp '%d', got '%+v'", nbf, exp, r[0])
+	}
+}
+
+func TestWithCapability(t *testing.T) {
+	all := Restriction{Restriction: api.Restriction{Scope: "all"}}
+	at := Restriction{Restriction: api.Restriction{Scope: "at", Capabilities: api.Capabilities{api.CapabilityAT}}}
+	list := Restriction{Restriction: api.Restriction{Scope: "list", Capabilities: api.Capabilities{api.CapabilityListMT, api.CapabilityTokeninfoTree}}}
+	r := Restrictions{all, at, list}
+	checkRestrictions(t, Restrictions{all, at}, r.WithCapability(api.CapabilityAT), true, true)
+	checkRestrictions(t, Restrictions{all, list}, r.WithCapability(api.CapabilityTokeninfoTree), true, true)
+	checkRestrictions(t, Restrictions{all}, r.WithCapability(api.CapabilityCreateMT), true, true)
+}
+
+func TestGetValidForOtherCapability(t *testing.T) {
+	at := Restriction{Restriction: api.Restriction{Capabilities: api.Capabilities{api.CapabilityAT}}}
+	list := Restriction{Restriction: api.Restriction{Capabilities: api.Capabilities{api.CapabilityListMT}}}
+	r := Restrictions{at, list}
+	if r.VerifyForOther(nil, "192.168.0.12", mtid.MTID{}, api.CapabilityCreateMT) {
+		t.Errorf("Restrictions '%+v' must not be valid for '%s'", r, api.CapabilityCreateMT.Name)
+	}
+	checkRestrictions(t, Restrictions{list}, r.GetValidForOther(nil, "192.168.0.12", mtid.MTID{}, api.CapabilityListMT), true, true)
+}
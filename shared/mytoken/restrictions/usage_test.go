@@ -0,0 +1,139 @@
+package restrictions
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/db/dbtest"
+	"github.com/oidc-mytoken/server/pkg/api/v0"
+	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/shared/utils"
+)
+
+func usageMap(t *testing.T, r Restriction, at, other int64) map[string]mytokenrepohelper.TokenUsage {
+	hash, err := r.hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]mytokenrepohelper.TokenUsage{
+		string(hash): {
+			RestrictionHash: string(hash),
+			UsagesAT:        at,
+			UsagesOther:     other,
+		},
+	}
+}
+
+func TestVerifyATUsageCounts(t *testing.T) {
+	r := Restriction{Restriction: api.Restriction{UsagesAT: utils.NewInt64(2)}}
+	if !r.verifyATUsageCounts(nil) {
+		t.Error("unused restriction not valid")
+	}
+	if !r.verifyATUsageCounts(usageMap(t, r, 1, 5)) {
+		t.Error("restriction with usages left not valid")
+	}
+	if r.verifyATUsageCounts(usageMap(t, r, 2, 0)) {
+		t.Error("restriction without usages left valid")
+	}
+}
+
+func TestVerifyOtherUsageCounts(t *testing.T) {
+	r := Restriction{Restriction: api.Restriction{UsagesOther: utils.NewInt64(2)}}
+	if !r.verifyOtherUsageCounts(nil) {
+		t.Error("unused restriction not valid")
+	}
+	if !r.verifyOtherUsageCounts(usageMap(t, r, 5, 1)) {
+		t.Error("restriction with usages left not valid")
+	}
+	if r.verifyOtherUsageCounts(usageMap(t, r, 0, 2)) {
+		t.Error("restriction without usages left valid")
+	}
+}
+
+func TestVerifyUsageCountsWithDescendants(t *testing.T) {
+	// The usages of subtokens count against a shared budget
+	r := Restriction{Restriction: api.Restriction{UsagesAT: utils.NewInt64(3), UsagesOther: utils.NewInt64(3)}}
+	usages := usageMap(t, r, 1, 1)
+	for k, u := range usages {
+		u.DescendantUsagesAT = 1
+		u.DescendantUsagesOther = 2
+		usages[k] = u
+	}
+	if !r.verifyATUsageCounts(usages) {
+		t.Error("restriction with shared usages left not valid")
+	}
+	if r.verifyOtherUsageCounts(usages) {
+		t.Error("restriction with shared usages used up by subtokens valid")
+	}
+}
+
+func TestGetValidForATWithoutUsageLimits(t *testing.T) {
+	// No restriction has a usage limit, so the database must not be queried
+	r := Restrictions{
+		{Restriction: api.Restriction{Scope: "a"}},
+		{Restriction: api.Restriction{Scope: "b"}, ExpiresAt: 1},
+		{Restriction: api.Restriction{Scope: "c", UsagesOther: utils.NewInt64(1)}},
+	}
+	valid := r.GetValidForAT(nil, "192.168.0.1", mtid.New())
+	if len(valid) != 2 {
+		t.Errorf("Expected 2 valid restrictions, but got %d", len(valid))
+	}
+}
+
+func TestBudgetOrigin(t *testing.T) {
+	parent := Restrictions{
+		{Restriction: api.Restriction{Scope: "a"}},
+		{Restriction: api.Restriction{Scope: "b", UsagesAT: utils.NewInt64(10)}},
+		{Restriction: api.Restriction{UsagesAT: utils.NewInt64(10)}},
+	}
+	child := Restriction{Restriction: api.Restriction{Scope: "a", UsagesAT: utils.NewInt64(5)}}
+	if o := child.budgetOrigin(parent); o != &parent[2] {
+		t.Errorf("Expected budget origin '%+v', but got '%+v'", parent[2], o)
+	}
+	unlimited := Restriction{Restriction: api.Restriction{Scope: "a"}}
+	if o := unlimited.budgetOrigin(parent); o != nil {
+		t.Errorf("Expected no budget origin, but got '%+v'", o)
+	}
+}
+
+func benchmarkRestrictions(n int) Restrictions {
+	r := make(Restrictions, n)
+	for i := range r {
+		r[i] = Restriction{Restriction: api.Restriction{
+			Scope:    fmt.Sprintf("scope%d", i),
+			UsagesAT: utils.NewInt64(10),
+		}}
+	}
+	return r
+}
+
+// BenchmarkGetValidForAT evaluates all restrictions with a single usage query; compare with
+// BenchmarkGetValidForATPerRestriction.
+func BenchmarkGetValidForAT(b *testing.B) {
+	dbtest.Connect(b)
+	id := dbtest.CreateMytoken(b)
+	r := benchmarkRestrictions(10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(r.GetValidForAT(nil, "192.168.0.1", id)) != len(r) {
+			b.Fatal("restrictions not valid")
+		}
+	}
+}
+
+// BenchmarkGetValidForATPerRestriction evaluates the restrictions with one usage query per restriction, each in its
+// own transaction, as it was done before the usages were loaded at once.
+func BenchmarkGetValidForATPerRestriction(b *testing.B) {
+	dbtest.Connect(b)
+	id := dbtest.CreateMytoken(b)
+	r := benchmarkRestrictions(10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, rr := range r {
+			if len(Restrictions{rr}.GetValidForAT(nil, "192.168.0.1", id)) != 1 {
+				b.Fatal("restriction not valid")
+			}
+		}
+	}
+}
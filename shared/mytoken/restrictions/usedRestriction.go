@@ -3,7 +3,7 @@ package restrictions
 import (
 	"github.com/jmoiron/sqlx"
 
-	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
 	"github.com/oidc-mytoken/server/shared/mytoken/pkg/mtid"
 )
 
@@ -12,12 +12,21 @@ type UsedRestriction struct {
 	Restriction
 	UsagesATDone    *int64 `json:"usages_AT_done,omitempty"`
 	UsagesOtherDone *int64 `json:"usages_other_done,omitempty"`
+	// The usages done by subtokens that count against this restriction's usage limits
+	UsagesATDescendants    *int64 `json:"usages_AT_descendants,omitempty"`
+	UsagesOtherDescendants *int64 `json:"usages_other_descendants,omitempty"`
 }
 
+// ToUsedRestrictions returns the Restrictions together with their usages; the usages of all restrictions are loaded
+// with a single query
 func (r Restrictions) ToUsedRestrictions(tx *sqlx.Tx, id mtid.MTID) (ur []UsedRestriction, err error) {
-	var u UsedRestriction
+	usages, err := mytokenrepohelper.GetTokenUsages(tx, id)
+	if err != nil {
+		return
+	}
 	for _, rr := range r {
-		u, err = rr.ToUsedRestriction(tx, id)
+		var u UsedRestriction
+		u, err = rr.toUsedRestriction(usages)
 		if err != nil {
 			return
 		}
@@ -26,19 +35,30 @@ func (r Restrictions) ToUsedRestrictions(tx *sqlx.Tx, id mtid.MTID) (ur []UsedRe
 	return
 }
 
+// ToUsedRestriction returns the Restriction together with its usages
 func (r Restriction) ToUsedRestriction(tx *sqlx.Tx, id mtid.MTID) (UsedRestriction, error) {
+	usages, err := mytokenrepohelper.GetTokenUsages(tx, id)
+	if err != nil {
+		return UsedRestriction{}, err
+	}
+	return r.toUsedRestriction(usages)
+}
+
+func (r Restriction) toUsedRestriction(usages map[string]mytokenrepohelper.TokenUsage) (UsedRestriction, error) {
 	ur := UsedRestriction{
 		Restriction: r,
 	}
-	err := db.RunWithinTransaction(tx, func(tx *sqlx.Tx) error {
-		at, err := r.getATUsageCounts(tx, id)
-		if err != nil {
-			return err
-		}
-		ur.UsagesATDone = at
-		other, err := r.getOtherUsageCounts(tx, id)
-		ur.UsagesOtherDone = other
-		return err
-	})
-	return ur, err
+	u, err := r.getUsages(usages)
+	if err != nil || u == nil {
+		return ur, err
+	}
+	ur.UsagesATDone = &u.UsagesAT
+	ur.UsagesOtherDone = &u.UsagesOther
+	if u.DescendantUsagesAT > 0 {
+		ur.UsagesATDescendants = &u.DescendantUsagesAT
+	}
+	if u.DescendantUsagesOther > 0 {
+		ur.UsagesOtherDescendants = &u.DescendantUsagesOther
+	}
+	return ur, nil
 }
@@ -1,28 +1,23 @@
 package token
 
 import (
-	"encoding/json"
 	"fmt"
 
+	"github.com/oidc-mytoken/server/internal/bruteforce"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/transfercoderepo"
 	"github.com/oidc-mytoken/server/shared/utils"
 )
 
-// Token is a type used for tokens passed in http requests; these can be normal Mytoken or a short token. This type will unmarshal always into a jwt of the (long) Mytoken
+// Token is a type used for tokens passed in http requests; these can be normal Mytoken or a short token. The jwt of the
+// (long) Mytoken is obtained with GetLongMytoken.
 type Token string
 
-// UnmarshalJSON implements the json.Unmarshaler interface
-func (t *Token) UnmarshalJSON(data []byte) (err error) {
-	var token string
-	if err = json.Unmarshal(data, &token); err != nil {
-		return
+// GetLongMytoken returns the long / jwt of a Mytoken; the passed token can be a jwt or a short token. A short token
+// that is not found is recorded as a failed lookup by the passed client ip.
+func GetLongMytoken(token, ip string) (Token, error) {
+	if token == "" {
+		return "", fmt.Errorf("no mytoken found in request")
 	}
-	*t, err = GetLongMytoken(token)
-	return
-}
-
-// GetLongMytoken returns the long / jwt of a Mytoken; the passed token can be a jwt or a short token
-func GetLongMytoken(token string) (Token, error) {
 	if utils.IsJWT(token) {
 		return Token(token), nil
 	}
@@ -31,6 +26,9 @@ func GetLongMytoken(token string) (Token, error) {
 	var validErr error
 	if !valid {
 		validErr = fmt.Errorf("token not valid")
+		if dbErr == nil {
+			bruteforce.RecordFailure(bruteforce.KindShortToken, ip)
+		}
 	}
 	return Token(token), utils.ORErrors(dbErr, validErr)
 }
@@ -3,6 +3,11 @@ package unixtime
 import (
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/oidc-mytoken/server/shared/utils"
@@ -42,3 +47,88 @@ func (t *UnixTime) Scan(src interface{}) error {
 	*t = New(tmp.Time)
 	return nil
 }
+
+// UnmarshalJSON implements the json.Unmarshaler interface. Besides a unix timestamp, a time relative to the current
+// time can be given as a string, e.g. "+7d" or "+1h30m".
+func (t *UnixTime) UnmarshalJSON(data []byte) error {
+	var i int64
+	if err := json.Unmarshal(data, &i); err == nil {
+		*t = UnixTime(i)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// Parse parses a unix timestamp or a time relative to the current time; relative times start with '+' followed by a
+// duration as understood by ParseDuration
+func Parse(s string) (UnixTime, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "+") {
+		d, err := ParseDuration(s[1:])
+		if err != nil {
+			return 0, err
+		}
+		return New(time.Now().Add(d)), nil
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s'", s)
+	}
+	return UnixTime(i), nil
+}
+
+var durationUnits = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// ParseDuration parses a duration such as "7d", "1h30m", or "3600"; supported units are s, m, h, d, and w. A number
+// without a unit is interpreted as seconds.
+func ParseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("invalid duration ''")
+	}
+	var d time.Duration
+	for len(s) > 0 {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("invalid duration '%s'", s)
+		}
+		n, err := strconv.ParseInt(s[:i], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		unit := time.Second
+		if i < len(s) {
+			var ok bool
+			if unit, ok = durationUnits[s[i]]; !ok {
+				return 0, fmt.Errorf("unknown unit '%c' in duration", s[i])
+			}
+			i++
+		} else if d != 0 {
+			return 0, fmt.Errorf("missing unit in duration")
+		}
+		// Durations that do not fit into a time.Duration would silently wrap around
+		if n > int64(math.MaxInt64/unit) || time.Duration(n)*unit > math.MaxInt64-d {
+			return 0, fmt.Errorf("duration out of range")
+		}
+		d += time.Duration(n) * unit
+		s = s[i:]
+	}
+	return d, nil
+}
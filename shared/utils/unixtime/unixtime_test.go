@@ -0,0 +1,77 @@
+package unixtime
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	cases := []struct {
+		s   string
+		exp time.Duration
+	}{
+		{s: "3600", exp: time.Hour},
+		{s: "30s", exp: 30 * time.Second},
+		{s: "15m", exp: 15 * time.Minute},
+		{s: "1h", exp: time.Hour},
+		{s: "7d", exp: 7 * 24 * time.Hour},
+		{s: "2w", exp: 14 * 24 * time.Hour},
+		{s: "1d12h", exp: 36 * time.Hour},
+	}
+	for _, c := range cases {
+		d, err := ParseDuration(c.s)
+		if err != nil {
+			t.Errorf("Unexpected error for '%s': %s", c.s, err)
+			continue
+		}
+		if d != c.exp {
+			t.Errorf("For '%s' expected '%s', got '%s'", c.s, c.exp, d)
+		}
+	}
+}
+
+func TestParseDuration_Invalid(t *testing.T) {
+	for _, s := range []string{"", "d", "7x", "1d12", "-1h", "1.5h"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Errorf("Expected error for '%s'", s)
+		}
+	}
+}
+
+func TestParseDuration_Overflow(t *testing.T) {
+	for _, s := range []string{"9223372036854775808", "9223372037s", "15251w", "106751d23h47m16s1s", "9223372036854775807w"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Errorf("Expected error for '%s'", s)
+		}
+	}
+	if _, err := ParseDuration("15250w"); err != nil {
+		t.Errorf("Unexpected error for '15250w': %s", err)
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	var r struct {
+		NotBefore UnixTime `json:"nbf"`
+		ExpiresAt UnixTime `json:"exp"`
+	}
+	if err := json.Unmarshal([]byte(`{"nbf":1600000000,"exp":"+7d"}`), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.NotBefore != 1600000000 {
+		t.Errorf("Expected nbf to be '1600000000', got '%d'", r.NotBefore)
+	}
+	exp := New(time.Now().Add(7 * 24 * time.Hour))
+	if r.ExpiresAt < exp-5 || r.ExpiresAt > exp {
+		t.Errorf("Expected exp to be about '%d', got '%d'", exp, r.ExpiresAt)
+	}
+}
+
+func TestUnmarshalJSON_Invalid(t *testing.T) {
+	var u UnixTime
+	for _, data := range []string{`"7d"`, `"+"`, `"tomorrow"`, `true`} {
+		if err := json.Unmarshal([]byte(data), &u); err == nil {
+			t.Errorf("Expected error for '%s'", data)
+		}
+	}
+}
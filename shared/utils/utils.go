@@ -64,6 +64,16 @@ func StringInSlice(key string, slice []string) bool {
 	return false
 }
 
+// StringInSliceIgnoreCase checks if a string is in a slice of strings, ignoring case
+func StringInSliceIgnoreCase(key string, slice []string) bool {
+	for _, s := range slice {
+		if strings.EqualFold(s, key) {
+			return true
+		}
+	}
+	return false
+}
+
 // ReplaceStringInSlice replaces all occurrences of a string in a slice with another string
 func ReplaceStringInSlice(s *[]string, o, n string, caseSensitive bool) {
 	if !caseSensitive {
@@ -99,26 +109,77 @@ func IPsAreSubSet(ipsA, ipsB []string) bool {
 	return true
 }
 
-// IPIsIn checks if a ip is in a slice of ips, it will also check ip subnets
+// IPIsIn checks if a ip is in a slice of ips, it will also check ip subnets. The passed ip can also be a subnet; it
+// is then checked if the whole subnet is contained.
 func IPIsIn(ip string, ips []string) bool {
 	if ips == nil {
 		return false
 	}
-	ipA := net.ParseIP(ip)
+	netA := parseIPNet(ip)
 	for _, ipp := range ips {
-		if strings.Contains(ipp, "/") {
-			_, ipNetB, _ := net.ParseCIDR(ipp)
-			if ipNetB != nil && ipNetB.Contains(ipA) {
+		if netA == nil {
+			if ip == ipp {
 				return true
 			}
-		} else if ip == ipp {
+			continue
+		}
+		if netB := parseIPNet(ipp); netB != nil && ipNetContains(netB, netA) {
 			return true
 		}
-
 	}
 	return false
 }
 
+// NormalizeIP returns the canonical string representation of an ip address. IPv4-mapped IPv6 addresses are returned
+// as IPv4 addresses and an IPv6 zone is removed. If ip is not a valid ip address it is returned unchanged.
+func NormalizeIP(ip string) string {
+	parsed := net.ParseIP(stripIPZone(ip))
+	if parsed == nil {
+		return ip
+	}
+	return parsed.String()
+}
+
+func stripIPZone(ip string) string {
+	if i := strings.IndexByte(ip, '%'); i >= 0 {
+		return ip[:i]
+	}
+	return ip
+}
+
+// parseIPNet parses an ip address or a subnet in CIDR notation; a single ip address is returned as a subnet that only
+// contains this address. IPv4-mapped IPv6 addresses and subnets are converted to IPv4. nil is returned if s cannot be
+// parsed.
+func parseIPNet(s string) *net.IPNet {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(stripIPZone(s))
+		if ip == nil {
+			return nil
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)}
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(8*net.IPv6len, 8*net.IPv6len)}
+	}
+	ip, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil
+	}
+	ones, bits := ipNet.Mask.Size()
+	const v4MappedPrefixLen = 8 * (net.IPv6len - net.IPv4len)
+	if bits == 8*net.IPv6len && ones >= v4MappedPrefixLen && ip.To4() != nil {
+		return &net.IPNet{IP: ipNet.IP.To4(), Mask: net.CIDRMask(ones-v4MappedPrefixLen, 8*net.IPv4len)}
+	}
+	return ipNet
+}
+
+// ipNetContains checks if the subnet a is completely contained in the subnet b
+func ipNetContains(b, a *net.IPNet) bool {
+	onesA, bitsA := a.Mask.Size()
+	onesB, bitsB := b.Mask.Size()
+	return bitsA == bitsB && onesA >= onesB && b.Contains(a.IP)
+}
+
 // CombineURLPath combines multiple parts of a url
 func CombineURLPath(p string, ps ...string) (r string) {
 	r = p
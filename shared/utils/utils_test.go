@@ -334,3 +334,73 @@ func TestSplitIgnoreEmpty_MultipleEmpty(t *testing.T) {
 	split := SplitIgnoreEmpty(s, " ")
 	checkSlice(t, split, exp)
 }
+
+func testIPIsIn(t *testing.T, ip string, ips []string, expected bool) {
+	if in := IPIsIn(ip, ips); in != expected {
+		if expected {
+			t.Errorf("Expected '%s' to be in '%v'", ip, ips)
+		} else {
+			t.Errorf("Expected '%s' not to be in '%v'", ip, ips)
+		}
+	}
+}
+func TestIPIsIn_V4(t *testing.T) {
+	ips := []string{"192.168.0.0/24", "10.0.0.1"}
+	testIPIsIn(t, "192.168.0.12", ips, true)
+	testIPIsIn(t, "10.0.0.1", ips, true)
+	testIPIsIn(t, "10.0.0.2", ips, false)
+	testIPIsIn(t, "192.168.1.12", ips, false)
+}
+func TestIPIsIn_V6(t *testing.T) {
+	ips := []string{"2001:db8::/32", "fe80::1"}
+	testIPIsIn(t, "2001:db8:1234::1", ips, true)
+	testIPIsIn(t, "fe80::1", ips, true)
+	testIPIsIn(t, "fe80:0:0:0:0:0:0:1", ips, true)
+	testIPIsIn(t, "fe80::1%eth0", ips, true)
+	testIPIsIn(t, "fe80::2", ips, false)
+	testIPIsIn(t, "2001:db9::1", ips, false)
+}
+func TestIPIsIn_MixedFamilies(t *testing.T) {
+	testIPIsIn(t, "192.168.0.1", []string{"::/0"}, false)
+	testIPIsIn(t, "2001:db8::1", []string{"0.0.0.0/0"}, false)
+}
+func TestIPIsIn_V4MappedV6(t *testing.T) {
+	testIPIsIn(t, "::ffff:192.168.0.12", []string{"192.168.0.0/24"}, true)
+	testIPIsIn(t, "192.168.0.12", []string{"::ffff:192.168.0.0/120"}, true)
+	testIPIsIn(t, "::ffff:192.168.0.12", []string{"192.168.0.12"}, true)
+	testIPIsIn(t, "192.168.0.12", []string{"::ffff:c0a8:c"}, true)
+	testIPIsIn(t, "192.168.1.12", []string{"::ffff:192.168.0.0/120"}, false)
+}
+func TestIPIsIn_Subnet(t *testing.T) {
+	testIPIsIn(t, "192.168.0.0/25", []string{"192.168.0.0/24"}, true)
+	testIPIsIn(t, "192.168.0.0/23", []string{"192.168.0.0/24"}, false)
+	testIPIsIn(t, "2001:db8:1::/48", []string{"2001:db8::/32"}, true)
+	testIPIsIn(t, "2001:db8::/31", []string{"2001:db8::/32"}, false)
+	testIPIsIn(t, "::ffff:10.0.0.0/104", []string{"10.0.0.0/8"}, true)
+}
+func TestIPIsIn_NoIP(t *testing.T) {
+	testIPIsIn(t, "a", []string{"a", "b"}, true)
+	testIPIsIn(t, "c", []string{"a", "b"}, false)
+	testIPIsIn(t, "a", nil, false)
+}
+func TestIPsAreSubSet_V6(t *testing.T) {
+	if !IPsAreSubSet([]string{"2001:db8::1", "2001:db8:1::/64"}, []string{"2001:db8::/32"}) {
+		t.Error("Expected ips to be a subset")
+	}
+	if IPsAreSubSet([]string{"2001:db8::1", "2001:db9::/64"}, []string{"2001:db8::/32"}) {
+		t.Error("Expected ips not to be a subset")
+	}
+}
+
+func testNormalizeIP(t *testing.T, ip, expected string) {
+	if n := NormalizeIP(ip); n != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, n)
+	}
+}
+func TestNormalizeIP(t *testing.T) {
+	testNormalizeIP(t, "192.168.0.1", "192.168.0.1")
+	testNormalizeIP(t, "::ffff:192.168.0.1", "192.168.0.1")
+	testNormalizeIP(t, "2001:DB8:0:0:0:0:0:1", "2001:db8::1")
+	testNormalizeIP(t, "fe80::1%eth0", "fe80::1")
+	testNormalizeIP(t, "not an ip", "not an ip")
+}